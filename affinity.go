@@ -0,0 +1,225 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Kinds of objects an AffinityRule relates a Guest to
+const (
+	AffinityGuests      = "guests"
+	AffinityHypervisors = "hypervisors"
+)
+
+type (
+	// AffinityRule places a Guest relative to other Guests or to Hypervisors.
+	//
+	// A guests rule relates the Guest to the other Guests matching the
+	// Selector and/or in the ServerGroup. Affinity places it on a Hypervisor
+	// running one of them, unless none are placed yet, and anti-affinity on
+	// a Hypervisor running none of them.
+	//
+	// A hypervisors rule places the Guest on a Hypervisor matching the
+	// Selector or, with anti-affinity, one not matching it.
+	//
+	// Hard rules filter the candidate Hypervisors while soft rules are only
+	// preferences used to rank them.
+	AffinityRule struct {
+		Kind        string `json:"kind"`
+		Selector    string `json:"selector,omitempty"`
+		ServerGroup string `json:"server_group,omitempty"`
+		Anti        bool   `json:"anti"`
+		Soft        bool   `json:"soft"`
+	}
+
+	// AffinityRules is an alias to a slice of AffinityRule
+	AffinityRules []AffinityRule
+)
+
+// Validate ensures an AffinityRule has reasonable data.
+func (r AffinityRule) Validate() error {
+	if _, err := ParseSelector(r.Selector); err != nil {
+		return err
+	}
+
+	switch r.Kind {
+	case AffinityGuests:
+		if r.Selector == "" && r.ServerGroup == "" {
+			return errors.New("missing selector or server group")
+		}
+	case AffinityHypervisors:
+		if r.Selector == "" {
+			return errors.New("missing selector")
+		}
+		if r.ServerGroup != "" {
+			return errors.New("server group only applies to guests")
+		}
+	default:
+		return errors.New("invalid kind")
+	}
+	return nil
+}
+
+// String describes the AffinityRule for logging
+func (r AffinityRule) String() string {
+	s := r.Kind
+	if r.Selector != "" {
+		s += fmt.Sprintf(" selector=%q", r.Selector)
+	}
+	if r.ServerGroup != "" {
+		s += fmt.Sprintf(" server_group=%q", r.ServerGroup)
+	}
+	if r.Anti {
+		s = "anti-affinity " + s
+	} else {
+		s = "affinity " + s
+	}
+	if r.Soft {
+		s = "soft " + s
+	}
+	return s
+}
+
+// relatedGuestHosts returns the number of Guests related by a guests rule on
+// each Hypervisor
+func (g *Guest) relatedGuestHosts(r AffinityRule) (map[string]int, error) {
+	sel, err := ParseSelector(r.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var guests Guests
+	if sel.Empty() {
+		err = g.context.ForEachGuest(func(guest *Guest) error {
+			guests = append(guests, guest)
+			return nil
+		})
+		if err != nil && !g.context.kv.IsKeyNotFound(err) {
+			return nil, err
+		}
+	} else {
+		guests, err = g.context.SelectGuests(sel)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hosts := make(map[string]int)
+	for _, guest := range guests {
+		if guest.ID == g.ID || guest.HypervisorID == "" {
+			continue
+		}
+		if r.ServerGroup != "" && guest.ServerGroup != r.ServerGroup {
+			continue
+		}
+		hosts[guest.HypervisorID]++
+	}
+	return hosts, nil
+}
+
+// affinityMatcher returns a function reporting whether a Hypervisor satisfies
+// an AffinityRule of the Guest
+func (g *Guest) affinityMatcher(r AffinityRule) (func(*Hypervisor) bool, error) {
+	if r.Kind == AffinityHypervisors {
+		sel, err := ParseSelector(r.Selector)
+		if err != nil {
+			return nil, err
+		}
+		return func(h *Hypervisor) bool {
+			return sel.Matches(h.Metadata) != r.Anti
+		}, nil
+	}
+
+	hosts, err := g.relatedGuestHosts(r)
+	if err != nil {
+		return nil, err
+	}
+	return func(h *Hypervisor) bool {
+		if r.Anti {
+			return hosts[h.ID] == 0
+		}
+		// the first of the related guests may go anywhere
+		return len(hosts) == 0 || hosts[h.ID] > 0
+	}, nil
+}
+
+// CandidateAffinity returns Hypervisors that satisfy every hard AffinityRule of
+// the Guest.
+func CandidateAffinity(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateAffinity",
+	}
+
+	var matchers []func(*Hypervisor) bool
+	var rules AffinityRules
+	for _, r := range g.Affinity {
+		if r.Soft {
+			continue
+		}
+		m, err := g.affinityMatcher(r)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+		rules = append(rules, r)
+	}
+
+	var hypervisors Hypervisors
+	for _, h := range hs {
+		satisfied := true
+		for i, m := range matchers {
+			if !m(h) {
+				satisfied = false
+				log.WithFields(logFields).WithFields(log.Fields{
+					"hypervisorID": h.ID,
+					"rule":         rules[i].String(),
+				}).Debug("hypervisor candidate failed")
+				break
+			}
+		}
+		if satisfied {
+			hypervisors = append(hypervisors, h)
+		}
+	}
+
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
+
+// ScoreAffinity prefers Hypervisors satisfying more of the soft AffinityRules
+// of the Guest.
+func ScoreAffinity(g *Guest, hs Hypervisors) ([]float64, error) {
+	scores := make([]float64, len(hs))
+
+	soft := 0
+	for _, r := range g.Affinity {
+		if !r.Soft {
+			continue
+		}
+		soft++
+		m, err := g.affinityMatcher(r)
+		if err != nil {
+			return nil, err
+		}
+		for i, h := range hs {
+			if m(h) {
+				scores[i]++
+			}
+		}
+	}
+
+	if soft > 0 {
+		for i := range scores {
+			scores[i] /= float64(soft)
+		}
+	}
+	return scores, nil
+}
@@ -0,0 +1,134 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestAffinity(t *testing.T) {
+	suite.Run(t, new(AffinitySuite))
+}
+
+type AffinitySuite struct {
+	common.Suite
+	hypervisors lochness.Hypervisors
+}
+
+func (s *AffinitySuite) SetupTest() {
+	s.Suite.SetupTest()
+
+	// the first hypervisor runs a web replica and is labeled, the second is
+	// empty
+	hypervisor, replica := s.NewHypervisorWithGuest()
+	replica.Metadata["app"] = "web"
+	replica.ServerGroup = "web-replicas"
+	s.Require().NoError(replica.Save())
+	hypervisor.Metadata["rack"] = "a"
+	s.Require().NoError(hypervisor.Save())
+
+	s.hypervisors = lochness.Hypervisors{hypervisor, s.NewHypervisor()}
+}
+
+func (s *AffinitySuite) TestValidate() {
+	tests := []struct {
+		description string
+		rule        lochness.AffinityRule
+		expectedErr bool
+	}{
+		{"missing kind", lochness.AffinityRule{Selector: "app=web"}, true},
+		{"invalid kind", lochness.AffinityRule{Kind: "foo", Selector: "app=web"}, true},
+		{"invalid selector", lochness.AffinityRule{Kind: lochness.AffinityGuests, Selector: "a=(b"}, true},
+		{"guests without selector or group", lochness.AffinityRule{Kind: lochness.AffinityGuests}, true},
+		{"guests with selector", lochness.AffinityRule{Kind: lochness.AffinityGuests, Selector: "app=web"}, false},
+		{"guests with group", lochness.AffinityRule{Kind: lochness.AffinityGuests, ServerGroup: "web"}, false},
+		{"hypervisors without selector", lochness.AffinityRule{Kind: lochness.AffinityHypervisors}, true},
+		{"hypervisors with group", lochness.AffinityRule{Kind: lochness.AffinityHypervisors, Selector: "rack=a", ServerGroup: "web"}, true},
+		{"hypervisors with selector", lochness.AffinityRule{Kind: lochness.AffinityHypervisors, Selector: "rack=a"}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.rule.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+
+	guest := s.NewGuest()
+	guest.Affinity = lochness.AffinityRules{{Kind: lochness.AffinityGuests}}
+	s.Error(guest.Validate(), "guest with invalid rule should be invalid")
+}
+
+func (s *AffinitySuite) TestCandidateAffinity() {
+	web := lochness.AffinityRule{Kind: lochness.AffinityGuests, Selector: "app=web"}
+	group := lochness.AffinityRule{Kind: lochness.AffinityGuests, ServerGroup: "web-replicas"}
+	db := lochness.AffinityRule{Kind: lochness.AffinityGuests, Selector: "app=db"}
+	rack := lochness.AffinityRule{Kind: lochness.AffinityHypervisors, Selector: "rack=a"}
+	anti := func(r lochness.AffinityRule) lochness.AffinityRule {
+		r.Anti = true
+		return r
+	}
+	soft := func(r lochness.AffinityRule) lochness.AffinityRule {
+		r.Soft = true
+		return r
+	}
+
+	tests := []struct {
+		description string
+		rules       lochness.AffinityRules
+		expected    []int
+	}{
+		{"no rules", nil, []int{0, 1}},
+		{"guest affinity", lochness.AffinityRules{web}, []int{0}},
+		{"guest anti-affinity", lochness.AffinityRules{anti(web)}, []int{1}},
+		{"server group anti-affinity", lochness.AffinityRules{anti(group)}, []int{1}},
+		{"affinity with none placed", lochness.AffinityRules{db}, []int{0, 1}},
+		{"anti-affinity with none placed", lochness.AffinityRules{anti(db)}, []int{0, 1}},
+		{"hypervisor affinity", lochness.AffinityRules{rack}, []int{0}},
+		{"hypervisor anti-affinity", lochness.AffinityRules{anti(rack)}, []int{1}},
+		{"conflicting rules", lochness.AffinityRules{web, anti(rack)}, []int{}},
+		{"soft rules", lochness.AffinityRules{soft(anti(web))}, []int{0, 1}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest := s.NewGuest()
+		guest.Affinity = test.rules
+
+		candidates, err := lochness.CandidateAffinity(guest, s.hypervisors)
+		s.NoError(err, msg("should succeed"))
+		s.Len(candidates, len(test.expected), msg("unexpected candidates"))
+		for i, j := range test.expected {
+			if i < len(candidates) {
+				s.Equal(s.hypervisors[j].ID, candidates[i].ID, msg("unexpected candidate"))
+			}
+		}
+	}
+}
+
+func (s *AffinitySuite) TestScoreAffinity() {
+	guest := s.NewGuest()
+
+	scores, err := lochness.ScoreAffinity(guest, s.hypervisors)
+	s.NoError(err)
+	s.Equal([]float64{0, 0}, scores, "no rules should score 0")
+
+	guest.Affinity = lochness.AffinityRules{
+		{Kind: lochness.AffinityGuests, ServerGroup: "web-replicas", Anti: true, Soft: true},
+		{Kind: lochness.AffinityHypervisors, Selector: "rack=a", Soft: true},
+		{Kind: lochness.AffinityGuests, Selector: "app=web"},
+	}
+	scores, err = lochness.ScoreAffinity(guest, s.hypervisors)
+	s.NoError(err)
+	s.Equal([]float64{0.5, 0.5}, scores, "should score the fraction of soft rules satisfied")
+
+	guest.Affinity[1].Anti = true
+	scores, err = lochness.ScoreAffinity(guest, s.hypervisors)
+	s.NoError(err)
+	s.Equal([]float64{0, 1}, scores)
+}
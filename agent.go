@@ -11,5 +11,13 @@ type (
 		DeleteGuest(string) (string, error)
 		GuestAction(string, string) (string, error)
 		CheckJobStatus(string, string) (bool, error)
+		AttachVolume(string, string) (string, error)
+		DetachVolume(string, string) (string, error)
+		MigrateGuest(string, bool) (string, error)
+		ResizeGuest(string, string) (string, error)
+		CreateSnapshot(string, string) (string, error)
+		DeleteSnapshot(string, string) (string, error)
+		RollbackSnapshot(string, string) (string, error)
+		SnapshotSize(string, string) (uint64, error)
 	}
 )
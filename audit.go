@@ -0,0 +1,364 @@
+package lochness
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// AuditPath is the path in the config store.
+	AuditPath = "lochness/audit/"
+
+	// ErrInvalidAuditRecordID is returned when fetching an AuditRecord by
+	// something that can not be its id
+	ErrInvalidAuditRecordID = errors.New("invalid audit record id")
+)
+
+// Headers identifying who makes an HTTP request, for its AuditSource
+const (
+	AuditActorHeader     = "X-Actor"
+	AuditRequestIDHeader = "X-Request-ID"
+)
+
+// Audit record actions
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+var (
+	// auditRedactedFields are the fields of each object type whose values are
+	// left out of AuditRecords, as they may be large or sensitive
+	auditRedactedFields = map[string][]string{
+		"guest": {"user_data"},
+	}
+
+	// auditIgnoredFields are the fields of each object type holding internal
+	// bookkeeping, such as reservations and quota charges. They are left out
+	// of AuditRecords, and updates changing only them are not recorded.
+	auditIgnoredFields = map[string][]string{
+		"hypervisor": {"available_resources", "reservations"},
+		"quota":      {"usage", "guests"},
+	}
+)
+
+type (
+	// AuditSource identifies who makes the changes recorded through a Context.
+	AuditSource struct {
+		Actor     string `json:"actor"`
+		SourceIP  string `json:"source_ip"`
+		RequestID string `json:"request_id"`
+	}
+
+	// AuditRecord is an append-only record of a change to an object in the
+	// config store, and who made it.
+	AuditRecord struct {
+		AuditSource
+		ID         string                 `json:"id"` // ordered by time
+		Time       time.Time              `json:"time"`
+		ObjectType string                 `json:"object_type"`
+		ObjectID   string                 `json:"object_id"`
+		Action     string                 `json:"action"`
+		Diff       map[string]AuditChange `json:"diff"` // changed fields
+	}
+
+	// AuditChange is the value of a field before and after a change. A
+	// missing value means the field did not exist. The values of redacted
+	// fields are left out, only recording that they changed.
+	AuditChange struct {
+		Before   json.RawMessage `json:"before,omitempty"`
+		After    json.RawMessage `json:"after,omitempty"`
+		Redacted bool            `json:"redacted,omitempty"`
+	}
+
+	// AuditRecords is an alias to a slice of *AuditRecord
+	AuditRecords []*AuditRecord
+
+	// AuditFilter selects AuditRecords. Zero fields match any record.
+	AuditFilter struct {
+		ObjectType string
+		ObjectID   string
+		Actor      string
+		RequestID  string
+		Since      time.Time
+		Until      time.Time
+		Limit      int // most recent records kept
+	}
+)
+
+// WithAudit returns a Context recording an AuditRecord of every change made
+// through it, attributed to the source.
+func (c *Context) WithAudit(source AuditSource) *Context {
+	return &Context{
+		kv:    c.kv,
+		audit: &source,
+	}
+}
+
+// RequestAuditSource returns the AuditSource of an HTTP request, from its
+// remote address and its actor and request id headers. A request without an id
+// is given one.
+func RequestAuditSource(r *http.Request) AuditSource {
+	requestID := r.Header.Get(AuditRequestIDHeader)
+	if requestID == "" {
+		requestID = uuid.New()
+		r.Header.Set(AuditRequestIDHeader, requestID)
+	}
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+	return AuditSource{
+		Actor:     r.Header.Get(AuditActorHeader),
+		SourceIP:  sourceIP,
+		RequestID: requestID,
+	}
+}
+
+// auditSaved returns the data saved at key, to diff a change against, when
+// changes made through the Context are audited.
+func (c *Context) auditSaved(key string) ([]byte, error) {
+	if c.audit == nil {
+		return nil, nil
+	}
+	value, err := c.kv.Get(key)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return value.Data, nil
+}
+
+// recordChange records an AuditRecord of a change to an object made through
+// an audited Context. before is nil for a new object, and after is nil for a
+// deleted one. The change has already been made, so failing to record it is
+// logged rather than returned.
+func (c *Context) recordChange(objectType, objectID string, before, after []byte) {
+	if c.audit == nil {
+		return
+	}
+
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"type":  objectType,
+			"id":    objectID,
+			"error": err,
+		}).Error("unable to diff audited change")
+		return
+	}
+	for _, name := range auditIgnoredFields[objectType] {
+		delete(diff, name)
+	}
+	for _, name := range auditRedactedFields[objectType] {
+		if _, ok := diff[name]; ok {
+			diff[name] = AuditChange{Redacted: true}
+		}
+	}
+
+	action := AuditActionUpdate
+	switch {
+	case before == nil:
+		action = AuditActionCreate
+	case after == nil:
+		action = AuditActionDelete
+	case len(diff) == 0:
+		// saved without changes
+		return
+	}
+
+	now := time.Now()
+	record := &AuditRecord{
+		AuditSource: *c.audit,
+		ID:          fmt.Sprintf("%019d-%s", now.UnixNano(), uuid.New()),
+		Time:        now,
+		ObjectType:  objectType,
+		ObjectID:    objectID,
+		Action:      action,
+		Diff:        diff,
+	}
+	if err := c.saveAuditRecord(record); err != nil {
+		log.WithFields(log.Fields{
+			"record": record,
+			"error":  err,
+		}).Error("unable to record audited change")
+	}
+}
+
+// auditDiff returns the top level fields of two JSON objects that differ
+func auditDiff(before, after []byte) (map[string]AuditChange, error) {
+	fields := make([]map[string]json.RawMessage, 2)
+	for i, data := range [][]byte{before, after} {
+		fields[i] = make(map[string]json.RawMessage)
+		if data == nil {
+			continue
+		}
+		if err := json.Unmarshal(data, &fields[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	diff := make(map[string]AuditChange)
+	for name, value := range fields[0] {
+		if !bytes.Equal(value, fields[1][name]) {
+			diff[name] = AuditChange{Before: value, After: fields[1][name]}
+		}
+	}
+	for name, value := range fields[1] {
+		if _, ok := fields[0][name]; !ok {
+			diff[name] = AuditChange{After: value}
+		}
+	}
+	return diff, nil
+}
+
+// saveAuditRecord persists a new AuditRecord. Records are never overwritten.
+func (c *Context) saveAuditRecord(record *AuditRecord) error {
+	v, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = c.kv.Update(filepath.Join(AuditPath, record.ID), kv.Value{Data: v})
+	return err
+}
+
+// auditRecordTime returns the time of an AuditRecord from its id
+func auditRecordTime(id string) (time.Time, error) {
+	i := strings.Index(id, "-")
+	if i < 0 {
+		return time.Time{}, ErrInvalidAuditRecordID
+	}
+	nsec, err := strconv.ParseInt(id[:i], 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidAuditRecordID
+	}
+	return time.Unix(0, nsec), nil
+}
+
+// AuditRecord fetches an AuditRecord from the data store.
+func (c *Context) AuditRecord(id string) (*AuditRecord, error) {
+	if _, err := auditRecordTime(id); err != nil {
+		return nil, err
+	}
+	value, err := c.kv.Get(filepath.Join(AuditPath, id))
+	if err != nil {
+		return nil, err
+	}
+	record := &AuditRecord{}
+	if err := json.Unmarshal(value.Data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// auditRecordIDs returns the ids of the AuditRecords, oldest first
+func (c *Context) auditRecordIDs() ([]string, error) {
+	keys, err := c.kv.Keys(AuditPath)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = filepath.Base(k)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// AuditRecords returns the AuditRecords selected by the filter, oldest first.
+func (c *Context) AuditRecords(filter AuditFilter) (AuditRecords, error) {
+	ids, err := c.auditRecordIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	// walk newest first so only the records kept by the limit are fetched
+	records := make(AuditRecords, 0)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(records) == filter.Limit {
+			break
+		}
+		t, err := auditRecordTime(ids[i])
+		if err != nil {
+			continue
+		}
+		if !filter.Since.IsZero() && t.Before(filter.Since) {
+			// the rest are older
+			break
+		}
+		if !filter.Until.IsZero() && t.After(filter.Until) {
+			continue
+		}
+
+		record, err := c.AuditRecord(ids[i])
+		if err != nil {
+			if c.kv.IsKeyNotFound(err) {
+				// pruned meanwhile
+				continue
+			}
+			return nil, err
+		}
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, nil
+}
+
+// matches returns whether the filter selects the AuditRecord, other than by
+// time
+func (f AuditFilter) matches(record *AuditRecord) bool {
+	return (f.ObjectType == "" || f.ObjectType == record.ObjectType) &&
+		(f.ObjectID == "" || f.ObjectID == record.ObjectID) &&
+		(f.Actor == "" || f.Actor == record.Actor) &&
+		(f.RequestID == "" || f.RequestID == record.RequestID)
+}
+
+// PruneAuditRecords removes the AuditRecords older than before, returning how
+// many were removed.
+func (c *Context) PruneAuditRecords(before time.Time) (int, error) {
+	ids, err := c.auditRecordIDs()
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, id := range ids {
+		t, err := auditRecordTime(id)
+		if err != nil {
+			continue
+		}
+		if !t.Before(before) {
+			// the rest are newer
+			break
+		}
+		if err := c.kv.Delete(filepath.Join(AuditPath, id), false); err != nil && !c.kv.IsKeyNotFound(err) {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
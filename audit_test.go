@@ -0,0 +1,209 @@
+package lochness_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestAudit(t *testing.T) {
+	suite.Run(t, new(AuditSuite))
+}
+
+type AuditSuite struct {
+	common.Suite
+	Audited *lochness.Context
+	Source  lochness.AuditSource
+}
+
+func (s *AuditSuite) SetupTest() {
+	s.Suite.SetupTest()
+	s.Source = lochness.AuditSource{
+		Actor:     "alice",
+		SourceIP:  "192.168.1.1",
+		RequestID: "req-1",
+	}
+	s.Audited = s.Context.WithAudit(s.Source)
+}
+
+func (s *AuditSuite) TestRecordChanges() {
+	zone := s.Audited.NewZone()
+	zone.Name = "east"
+	s.Require().NoError(zone.Save())
+	s.Require().NoError(zone.Save(), "saving without changes should not be recorded")
+	zone.Name = "west"
+	s.Require().NoError(zone.Save())
+	s.Require().NoError(zone.Destroy())
+
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{ObjectID: zone.ID})
+	s.Require().NoError(err)
+	s.Require().Len(records, 3)
+
+	actions := []string{lochness.AuditActionCreate, lochness.AuditActionUpdate, lochness.AuditActionDelete}
+	for i, record := range records {
+		s.Equal(actions[i], record.Action)
+		s.Equal("zone", record.ObjectType)
+		s.Equal(s.Source, record.AuditSource)
+	}
+
+	var name string
+	s.Nil(records[0].Diff["name"].Before)
+	s.NoError(json.Unmarshal(records[0].Diff["name"].After, &name))
+	s.Equal("east", name)
+
+	s.Len(records[1].Diff, 1, "only changed fields should be recorded")
+	s.NoError(json.Unmarshal(records[1].Diff["name"].Before, &name))
+	s.Equal("east", name)
+	s.NoError(json.Unmarshal(records[1].Diff["name"].After, &name))
+	s.Equal("west", name)
+
+	s.NoError(json.Unmarshal(records[2].Diff["name"].Before, &name))
+	s.Equal("west", name)
+	s.Nil(records[2].Diff["name"].After)
+}
+
+func (s *AuditSuite) TestRedactedFields() {
+	guest, err := s.Audited.Guest(s.NewGuest().ID)
+	s.Require().NoError(err)
+	guest.UserData = "#cloud-config\npassword: hunter2\n"
+	s.Require().NoError(guest.Save())
+
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{ObjectID: guest.ID})
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+	s.Equal(lochness.AuditChange{Redacted: true}, records[0].Diff["user_data"], "only the change should be recorded")
+}
+
+func (s *AuditSuite) TestIgnoredFields() {
+	hypervisor, err := s.Audited.Hypervisor(s.NewHypervisor().ID)
+	s.Require().NoError(err)
+	hypervisor.AvailableResources.Memory--
+	s.Require().NoError(hypervisor.Save())
+
+	project := s.NewProject()
+	quota := s.Audited.NewQuota(project.ID)
+	s.Require().NoError(quota.Save())
+	guest, err := s.Audited.Guest(s.NewGuest().ID)
+	s.Require().NoError(err)
+	guest.ProjectID = project.ID
+	s.Require().NoError(guest.ChargeQuota())
+	s.Require().NoError(quota.SetLimits(lochness.QuotaResources{Guests: 2}))
+
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{ObjectID: hypervisor.ID})
+	s.NoError(err)
+	s.Len(records, 0, "bookkeeping updates should not be recorded")
+
+	records, err = s.Context.AuditRecords(lochness.AuditFilter{ObjectType: "quota"})
+	s.Require().NoError(err)
+	s.Require().Len(records, 2, "charges should not be recorded")
+	s.Equal(lochness.AuditActionCreate, records[0].Action)
+	s.Equal(lochness.AuditActionUpdate, records[1].Action)
+	s.Contains(records[1].Diff, "limits")
+	s.NotContains(records[1].Diff, "usage")
+}
+
+func (s *AuditSuite) TestUnaudited() {
+	s.NewZone()
+
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{})
+	s.NoError(err)
+	s.Len(records, 0)
+}
+
+func (s *AuditSuite) TestAuditRecord() {
+	zone := s.Audited.NewZone()
+	zone.Name = "east"
+	s.Require().NoError(zone.Save())
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", "1-asdf", true},
+		{"real id", records[0].ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		record, err := s.Context.AuditRecord(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(record, msg("failure shouldn't return a record"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.Equal(records[0].ID, record.ID, msg("success should return correct data"))
+		}
+	}
+}
+
+func (s *AuditSuite) TestAuditRecords() {
+	zone := s.Audited.NewZone()
+	zone.Name = "east"
+	s.Require().NoError(zone.Save())
+	middle := time.Now()
+	other := s.Context.WithAudit(lochness.AuditSource{Actor: "bob", RequestID: "req-2"})
+	flavor := other.NewFlavor()
+	flavor.Image = uuid.New()
+	flavor.Memory, flavor.Disk, flavor.CPU = 128, 1024, 1
+	s.Require().NoError(flavor.Save())
+	flavor.Memory = 256
+	s.Require().NoError(flavor.Save())
+
+	tests := []struct {
+		description string
+		filter      lochness.AuditFilter
+		expected    []string
+	}{
+		{"all", lochness.AuditFilter{}, []string{zone.ID, flavor.ID, flavor.ID}},
+		{"type", lochness.AuditFilter{ObjectType: "flavor"}, []string{flavor.ID, flavor.ID}},
+		{"object", lochness.AuditFilter{ObjectID: zone.ID}, []string{zone.ID}},
+		{"actor", lochness.AuditFilter{Actor: "alice"}, []string{zone.ID}},
+		{"request", lochness.AuditFilter{RequestID: "req-2"}, []string{flavor.ID, flavor.ID}},
+		{"since", lochness.AuditFilter{Since: middle}, []string{flavor.ID, flavor.ID}},
+		{"until", lochness.AuditFilter{Until: middle}, []string{zone.ID}},
+		{"limit", lochness.AuditFilter{Limit: 1}, []string{flavor.ID}},
+		{"limit order", lochness.AuditFilter{Limit: 2}, []string{flavor.ID, flavor.ID}},
+		{"limit filtered", lochness.AuditFilter{Actor: "alice", Limit: 1}, []string{zone.ID}},
+		{"no match", lochness.AuditFilter{Actor: "carol"}, []string{}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		records, err := s.Context.AuditRecords(test.filter)
+		s.NoError(err, msg("should succeed"))
+		ids := make([]string, len(records))
+		for i, record := range records {
+			ids[i] = record.ObjectID
+		}
+		s.Equal(test.expected, ids, msg("should return the selected records, oldest first"))
+	}
+}
+
+func (s *AuditSuite) TestPruneAuditRecords() {
+	zone := s.Audited.NewZone()
+	zone.Name = "east"
+	s.Require().NoError(zone.Save())
+	middle := time.Now()
+	zone.Name = "pruned"
+	s.Require().NoError(zone.Save())
+
+	pruned, err := s.Context.PruneAuditRecords(middle)
+	s.NoError(err)
+	s.Equal(1, pruned)
+
+	records, err := s.Context.AuditRecords(lochness.AuditFilter{})
+	s.NoError(err)
+	s.Require().Len(records, 1)
+	s.Equal(lochness.AuditActionUpdate, records[0].Action)
+}
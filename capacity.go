@@ -0,0 +1,146 @@
+package lochness
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type (
+	// ResourceRatio adjusts the physical amount of a resource to the capacity
+	// available to guests. Reserved is the fraction held back for the host
+	// and Overcommit multiplies what remains.
+	ResourceRatio struct {
+		Overcommit float64 `json:"overcommit"`
+		Reserved   float64 `json:"reserved"`
+	}
+
+	// ResourceRatios holds the ResourceRatio of each resource
+	ResourceRatios struct {
+		Memory ResourceRatio `json:"memory"`
+		Disk   ResourceRatio `json:"disk"`
+		CPU    ResourceRatio `json:"cpu"`
+	}
+)
+
+// DefaultResourceRatios are used for settings not found in the Hypervisor or
+// cluster config. A fifth of memory and disk is held back for the host, and
+// cpus are shared between guests. No fraction of a resource is held back by
+// default when the resource probe already holds back an amount of it, such as
+// with hostReservedMemory.
+var DefaultResourceRatios = ResourceRatios{
+	Memory: ResourceRatio{Overcommit: 1, Reserved: 0.2},
+	Disk:   ResourceRatio{Overcommit: 1, Reserved: 0.2},
+	CPU:    ResourceRatio{Overcommit: 4, Reserved: 0},
+}
+
+// forHost returns the ResourceRatios without the fractions held back for the
+// host of the resources the host already has an amount held back of, so the
+// two reservations do not stack.
+func (r ResourceRatios) forHost(host HostResources) ResourceRatios {
+	if host.Reserved.Memory > 0 {
+		r.Memory.Reserved = 0
+	}
+	if host.Reserved.Disk > 0 {
+		r.Disk.Reserved = 0
+	}
+	if host.Reserved.CPU > 0 {
+		r.CPU.Reserved = 0
+	}
+	return r
+}
+
+// capacity applies the ResourceRatio to a physical amount
+func (r ResourceRatio) capacity(physical uint64) uint64 {
+	return uint64(float64(physical) * (1 - r.Reserved) * r.Overcommit)
+}
+
+// Validate ensures a ResourceRatio is usable.
+func (r ResourceRatio) Validate() error {
+	if r.Overcommit <= 0 {
+		return fmt.Errorf("overcommit must be positive, not %v", r.Overcommit)
+	}
+	if r.Reserved < 0 || r.Reserved >= 1 {
+		return fmt.Errorf("reserved must be at least 0 and less than 1, not %v", r.Reserved)
+	}
+	return nil
+}
+
+// Capacity returns the resources available to guests out of the physical
+// resources.
+func (r ResourceRatios) Capacity(physical Resources) Resources {
+	return Resources{
+		Memory: r.Memory.capacity(physical.Memory),
+		Disk:   r.Disk.capacity(physical.Disk),
+		CPU:    uint32(r.CPU.capacity(uint64(physical.CPU))),
+	}
+}
+
+// setting looks up a single setting, first in the Hypervisor Config and then in
+// the cluster config. ok is false if neither has it.
+func (h *Hypervisor) setting(key string) (value string, ok bool, err error) {
+	if value, ok := h.Config[key]; ok {
+		return value, true, nil
+	}
+	value, err = h.context.GetConfig(key)
+	if err != nil {
+		if h.context.kv.IsKeyNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// resourceRatioSetting looks up a single ratio setting, first in the Hypervisor
+// Config and then in the cluster config. ok is false if neither has it.
+func (h *Hypervisor) resourceRatioSetting(key string) (value float64, ok bool, err error) {
+	s, ok, err := h.setting(key)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	value, err = strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid %s: %s", key, err)
+	}
+	return value, true, nil
+}
+
+// ResourceRatios returns the ResourceRatios of the Hypervisor. Each setting is
+// read from the Hypervisor Config, falling back to the cluster config and then
+// to DefaultResourceRatios. The keys are memoryOvercommit, memoryReserved,
+// diskOvercommit, diskReserved, cpuOvercommit, and cpuReserved.
+func (h *Hypervisor) ResourceRatios() (ResourceRatios, error) {
+	return h.resourceRatios(DefaultResourceRatios)
+}
+
+// resourceRatios returns the ResourceRatios of the Hypervisor, falling back to
+// defaults for settings found in neither config.
+func (h *Hypervisor) resourceRatios(defaults ResourceRatios) (ResourceRatios, error) {
+	ratios := defaults
+	settings := []struct {
+		name  string
+		ratio *ResourceRatio
+	}{
+		{"memory", &ratios.Memory},
+		{"disk", &ratios.Disk},
+		{"cpu", &ratios.CPU},
+	}
+
+	for _, s := range settings {
+		if v, ok, err := h.resourceRatioSetting(s.name + "Overcommit"); err != nil {
+			return ratios, err
+		} else if ok {
+			s.ratio.Overcommit = v
+		}
+		if v, ok, err := h.resourceRatioSetting(s.name + "Reserved"); err != nil {
+			return ratios, err
+		} else if ok {
+			s.ratio.Reserved = v
+		}
+		if err := s.ratio.Validate(); err != nil {
+			return ratios, fmt.Errorf("%s: %s", s.name, err)
+		}
+	}
+	return ratios, nil
+}
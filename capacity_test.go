@@ -0,0 +1,99 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCapacity(t *testing.T) {
+	suite.Run(t, new(CapacitySuite))
+}
+
+type CapacitySuite struct {
+	common.Suite
+}
+
+func (s *CapacitySuite) TestValidate() {
+	tests := []struct {
+		description string
+		ratio       lochness.ResourceRatio
+		expectedErr bool
+	}{
+		{"zero overcommit", lochness.ResourceRatio{}, true},
+		{"negative overcommit", lochness.ResourceRatio{Overcommit: -1}, true},
+		{"negative reserved", lochness.ResourceRatio{Overcommit: 1, Reserved: -0.1}, true},
+		{"all reserved", lochness.ResourceRatio{Overcommit: 1, Reserved: 1}, true},
+		{"no reserved", lochness.ResourceRatio{Overcommit: 1}, false},
+		{"overcommit and reserved", lochness.ResourceRatio{Overcommit: 4, Reserved: 0.5}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.ratio.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *CapacitySuite) TestCapacity() {
+	ratios := lochness.ResourceRatios{
+		Memory: lochness.ResourceRatio{Overcommit: 1, Reserved: 0.25},
+		Disk:   lochness.ResourceRatio{Overcommit: 2, Reserved: 0.5},
+		CPU:    lochness.ResourceRatio{Overcommit: 4},
+	}
+	physical := lochness.Resources{Memory: 1000, Disk: 1000, CPU: 8}
+	s.Equal(lochness.Resources{Memory: 750, Disk: 1000, CPU: 32}, ratios.Capacity(physical))
+}
+
+func (s *CapacitySuite) TestResourceRatios() {
+	hypervisor := s.NewHypervisor()
+
+	ratios, err := hypervisor.ResourceRatios()
+	s.NoError(err)
+	s.Equal(lochness.DefaultResourceRatios, ratios, "defaults should be used")
+
+	s.Require().NoError(s.Context.SetConfig("cpuOvercommit", "8"))
+	s.Require().NoError(s.Context.SetConfig("memoryOvercommit", "1.5"))
+	s.Require().NoError(hypervisor.SetConfig("memoryOvercommit", "2"))
+	s.Require().NoError(hypervisor.SetConfig("diskReserved", "0.1"))
+
+	ratios, err = hypervisor.ResourceRatios()
+	s.NoError(err)
+	s.Equal(8.0, ratios.CPU.Overcommit, "cluster config should override default")
+	s.Equal(2.0, ratios.Memory.Overcommit, "hypervisor config should override cluster config")
+	s.Equal(0.1, ratios.Disk.Reserved, "hypervisor config should override default")
+	s.Equal(lochness.DefaultResourceRatios.Memory.Reserved, ratios.Memory.Reserved)
+
+	s.Require().NoError(hypervisor.SetConfig("cpuReserved", "foobar"))
+	_, err = hypervisor.ResourceRatios()
+	s.Error(err, "unparseable setting should fail")
+
+	s.Require().NoError(hypervisor.SetConfig("cpuReserved", "1"))
+	_, err = hypervisor.ResourceRatios()
+	s.Error(err, "invalid setting should fail")
+}
+
+func (s *CapacitySuite) TestCandidateHasResourcesCPU() {
+	guest := s.NewGuest()
+	flavor, err := s.Context.Flavor(guest.FlavorID)
+	s.Require().NoError(err)
+	flavor.CPU = 4
+	s.Require().NoError(flavor.Save())
+
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+	}
+	hypervisors[0].AvailableResources.CPU = 2
+
+	candidates, err := lochness.CandidateHasResources(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 1, "cpu in use should be counted")
+	s.Equal(hypervisors[1].ID, candidates[0].ID)
+}
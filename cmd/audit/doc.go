@@ -0,0 +1,48 @@
+/*
+audit is the cli interface to the audit log of changes, kept by chypervisord.
+
+Usage
+
+	$ audit -h
+	audit is the cli interface to the audit log kept by chypervisord. All commands support arguments via command line or stdin.
+
+	Usage:
+	  audit [flags]
+	  audit [command]
+
+	Available Commands:
+	  list        List audit records, oldest first
+	  help        Help about any command
+
+	Flags:
+	  -h, --help=false: help for audit
+	  -j, --json=false: output in json
+	  -s, --server="http://localhost:17000/": server address to connect to
+
+	Use "audit help [command]" for more information about a command.
+
+List
+
+	$ audit list -h
+	List audit records, oldest first
+
+	Usage:
+	  audit list [<id>...] [flags]
+
+	Flags:
+	  -a, --actor="": only list changes made by this actor
+	  -n, --limit=0: only list this many of the most recent changes
+	  -o, --object="": only list changes to the object with this id
+	  -r, --request="": only list changes made by this request
+	  -S, --since="": only list changes made since this RFC3339 time
+	  -t, --type="": only list changes to objects of this type
+	  -U, --until="": only list changes made until this RFC3339 time
+
+	Global Flags:
+	  -j, --json=false: output in json
+	  -s, --server="http://localhost:17000/": server address to connect to
+
+Object types are flavor, fwgroup, guest, hypervisor, network, project, quota,
+snapshot, subnet, vlan, vlangroup, volume and zone.
+*/
+package main
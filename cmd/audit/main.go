@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/andrew-d/go-termutil"
+	"github.com/mistifyio/lochness/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	server     = "http://localhost:17000/"
+	jsonout    = false
+	objectType = ""
+	objectID   = ""
+	actor      = ""
+	requestID  = ""
+	since      = ""
+	until      = ""
+	limit      = 0
+)
+
+func help(cmd *cobra.Command, _ []string) {
+	if err := cmd.Help(); err != nil {
+		log.WithField("error", err).Fatal("help")
+	}
+}
+
+func getRecords(c *cli.Client) []cli.JMap {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"type":    objectType,
+		"id":      objectID,
+		"actor":   actor,
+		"request": requestID,
+		"since":   since,
+		"until":   until,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	endpoint := "audit"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	ret, _ := c.GetMany("audit records", endpoint)
+	records := make([]cli.JMap, len(ret))
+	for i := range ret {
+		records[i] = ret[i]
+	}
+	return records
+}
+
+func getRecord(c *cli.Client, id string) cli.JMap {
+	record, _ := c.Get("audit record", "audit/"+id)
+	return record
+}
+
+func list(cmd *cobra.Command, args []string) {
+	c := cli.NewClient(server)
+	records := []cli.JMap{}
+	if len(args) == 0 {
+		if termutil.Isatty(os.Stdin.Fd()) {
+			// records are listed oldest first
+			records = getRecords(c)
+		} else {
+			args = cli.Read(os.Stdin)
+		}
+	}
+	if len(records) == 0 {
+		for _, id := range args {
+			records = append(records, getRecord(c, id))
+		}
+	}
+
+	for _, record := range records {
+		record.Print(jsonout)
+	}
+}
+
+func main() {
+	root := &cobra.Command{
+		Use:  "audit",
+		Long: "audit is the cli interface to the audit log kept by chypervisord. All commands support arguments via command line or stdin.",
+		Run:  help,
+	}
+	root.PersistentFlags().BoolVarP(&jsonout, "json", "j", jsonout, "output in json")
+	root.PersistentFlags().StringVarP(&server, "server", "s", server, "server address to connect to")
+
+	cmdList := &cobra.Command{
+		Use:   "list [<id>...]",
+		Short: "List audit records, oldest first",
+		Run:   list,
+	}
+	cmdList.Flags().StringVarP(&objectType, "type", "t", objectType, "only list changes to objects of this type")
+	cmdList.Flags().StringVarP(&objectID, "object", "o", objectID, "only list changes to the object with this id")
+	cmdList.Flags().StringVarP(&actor, "actor", "a", actor, "only list changes made by this actor")
+	cmdList.Flags().StringVarP(&requestID, "request", "r", requestID, "only list changes made by this request")
+	cmdList.Flags().StringVarP(&since, "since", "S", since, "only list changes made since this RFC3339 time")
+	cmdList.Flags().StringVarP(&until, "until", "U", until, "only list changes made until this RFC3339 time")
+	cmdList.Flags().IntVarP(&limit, "limit", "n", limit, "only list this many of the most recent changes")
+	root.AddCommand(cmdList)
+
+	if err := root.Execute(); err != nil {
+		log.WithField("error", err).Fatal("failed to execute root command")
+	}
+}
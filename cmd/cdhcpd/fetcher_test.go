@@ -53,7 +53,7 @@ func (s *FetcherSuite) TestGuests() {
 	if !s.True(ok) {
 		return
 	}
-	s.Equal(guest.MAC, g.MAC)
+	s.Equal(guest.Interfaces[0].MAC, g.Interfaces[0].MAC)
 }
 
 func (s *FetcherSuite) TestSubnets() {
@@ -87,13 +87,13 @@ func (s *FetcherSuite) TestFetchAll() {
 
 	subnets, err := s.Fetcher.Subnets()
 	s.NoError(err)
-	_, ok = subnets[guest.SubnetID]
+	_, ok = subnets[guest.Interfaces[0].SubnetID]
 	s.True(ok)
 }
 
 func (s *FetcherSuite) TestIntegrateResponse() {
 	hypervisor, guest := s.NewHypervisorWithGuest()
-	subnet, _ := s.Context.Subnet(guest.SubnetID)
+	subnet, _ := s.Context.Subnet(guest.Interfaces[0].SubnetID)
 
 	hJSON, _ := json.Marshal(hypervisor)
 	gJSON, _ := json.Marshal(guest)
@@ -151,21 +151,31 @@ func (r *Refresher) genGuestsConf(w io.Writer, guests map[string]*lochness.Guest
 	// Loop through and build up the templateHelper
 	for _, id := range gkeys {
 		g := guests[id]
-		if g.HypervisorID == "" || g.SubnetID == "" {
+		if g.HypervisorID == "" {
 			continue
 		}
-		s, ok := subnets[g.SubnetID]
-		if !ok {
-			continue
+		for i, iface := range g.Interfaces {
+			if iface.SubnetID == "" {
+				continue
+			}
+			s, ok := subnets[iface.SubnetID]
+			if !ok {
+				continue
+			}
+			// host names must be unique, so additional interfaces get a suffix
+			hostID := g.ID
+			if i > 0 {
+				hostID = fmt.Sprintf("%s-%d", g.ID, i)
+			}
+			mask := s.CIDR.Mask
+			vals.Guests = append(vals.Guests, guestHelper{
+				ID:      hostID,
+				MAC:     strings.ToUpper(iface.MAC.String()),
+				IP:      iface.IP.String(),
+				Gateway: s.Gateway.String(),
+				CIDR:    fmt.Sprintf("%d.%d.%d.%d", mask[0], mask[1], mask[2], mask[3]),
+			})
 		}
-		mask := s.CIDR.Mask
-		vals.Guests = append(vals.Guests, guestHelper{
-			ID:      g.ID,
-			MAC:     strings.ToUpper(g.MAC.String()),
-			IP:      g.IP.String(),
-			Gateway: s.Gateway.String(),
-			CIDR:    fmt.Sprintf("%d.%d.%d.%d", mask[0], mask[1], mask[2], mask[3]),
-		})
 	}
 
 	// Execute template
@@ -0,0 +1,153 @@
+package main_test
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCDnsd(t *testing.T) {
+	suite.Run(t, new(CmdSuite))
+}
+
+type CmdSuite struct {
+	common.Suite
+	Port    uint
+	Addr    string
+	BinName string
+	Cmd     *common.Cmd
+}
+
+func (s *CmdSuite) SetupSuite() {
+	s.Suite.SetupSuite()
+	s.Port = 53530
+	s.Addr = fmt.Sprintf("127.0.0.1:%d", s.Port)
+
+	s.Require().NoError(common.Build())
+	s.BinName = "cdnsd"
+	args := []string{
+		"-d", "lochness.test",
+		"-k", s.KVURL,
+		"-p", strconv.Itoa(int(s.Port)),
+		"-l", "fatal",
+	}
+
+	var err error
+	s.Cmd, err = common.Start("./"+s.BinName, args...)
+	s.Require().NoError(err)
+	time.Sleep(1 * time.Second)
+}
+
+func (s *CmdSuite) TearDownSuite() {
+	_ = s.Cmd.Stop()
+	s.Suite.TearDownSuite()
+}
+
+// query asks the daemon for the records of a name
+func (s *CmdSuite) query(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	resp, err := dns.Exchange(m, s.Addr)
+	s.Require().NoError(err)
+	return resp
+}
+
+// answers returns the values of the records answering a query
+func (s *CmdSuite) answers(resp *dns.Msg) []string {
+	values := make([]string, 0, len(resp.Answer))
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			values = append(values, rr.A.String())
+		case *dns.AAAA:
+			values = append(values, rr.AAAA.String())
+		case *dns.PTR:
+			values = append(values, rr.Ptr)
+		}
+	}
+	return values
+}
+
+func (s *CmdSuite) TestRecords() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	s.Require().NoError(guest.Refresh())
+	guest.Hostname = "web-1"
+	s.Require().NoError(guest.Save())
+	s.Require().NoError(hypervisor.SetConfig("cbootstrapd", "true"))
+	s.Require().NoError(hypervisor.SetConfig("tftpd", "false"))
+	time.Sleep(1 * time.Second)
+
+	guestIP := guest.Interfaces[0].IP.String()
+	guestArpa, _ := dns.ReverseAddr(guestIP)
+	hypervisorArpa, _ := dns.ReverseAddr(hypervisor.IP.String())
+
+	tests := []struct {
+		description string
+		name        string
+		qtype       uint16
+		rcode       int
+		expected    []string
+	}{
+		{"guest id", guest.ID + ".guests.lochness.test.", dns.TypeA, dns.RcodeSuccess, []string{guestIP}},
+		{"guest hostname", "WEB-1.guests.lochness.test.", dns.TypeA, dns.RcodeSuccess, []string{guestIP}},
+		{"guest no ipv6", "web-1.guests.lochness.test.", dns.TypeAAAA, dns.RcodeSuccess, []string{}},
+		{"guest ptr", guestArpa, dns.TypePTR, dns.RcodeSuccess, []string{"web-1.guests.lochness.test."}},
+		{"hypervisor id", hypervisor.ID + ".nodes.lochness.test.", dns.TypeA, dns.RcodeSuccess, []string{hypervisor.IP.String()}},
+		{"hypervisor ptr", hypervisorArpa, dns.TypePTR, dns.RcodeSuccess, []string{hypervisor.ID + ".nodes.lochness.test."}},
+		{"enabled service", "ipxe.services.lochness.test.", dns.TypeA, dns.RcodeSuccess, []string{hypervisor.IP.String()}},
+		{"disabled service", "tftp.services.lochness.test.", dns.TypeA, dns.RcodeNameError, []string{}},
+		{"intermediate name", "guests.lochness.test.", dns.TypeA, dns.RcodeSuccess, []string{}},
+		{"missing name", "web-2.guests.lochness.test.", dns.TypeA, dns.RcodeNameError, []string{}},
+		{"missing ptr", "200.100.168.192.in-addr.arpa.", dns.TypePTR, dns.RcodeNameError, []string{}},
+		{"other domain", "example.com.", dns.TypeA, dns.RcodeRefused, []string{}},
+		{"other network ptr", "1.0.0.10.in-addr.arpa.", dns.TypePTR, dns.RcodeRefused, []string{}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		resp := s.query(test.name, test.qtype)
+		s.Equal(test.rcode, resp.Rcode, msg("unexpected rcode"))
+		s.Equal(test.expected, s.answers(resp), msg("unexpected answers"))
+		if test.rcode != dns.RcodeRefused {
+			s.True(resp.Authoritative, msg("should be authoritative"))
+		}
+	}
+}
+
+func (s *CmdSuite) TestWatch() {
+	_, guest := s.NewHypervisorWithGuest()
+	time.Sleep(1 * time.Second)
+
+	name := guest.ID + ".guests.lochness.test."
+	s.Len(s.query(name, dns.TypeA).Answer, 1, "new guest should be served")
+
+	s.Require().NoError(guest.Refresh())
+	guest.Hostname = "db-1"
+	s.Require().NoError(guest.Save())
+	time.Sleep(1 * time.Second)
+	s.Len(s.query("db-1.guests.lochness.test.", dns.TypeA).Answer, 1, "new hostname should be served")
+
+	s.Require().NoError(guest.Destroy())
+	time.Sleep(1 * time.Second)
+	s.Equal(dns.RcodeNameError, s.query(name, dns.TypeA).Rcode, "destroyed guest should not be served")
+}
+
+func (s *CmdSuite) TestDuplicateHostname() {
+	_, guest := s.NewHypervisorWithGuest()
+	_, other := s.NewHypervisorWithGuest()
+	for _, g := range []*lochness.Guest{guest, other} {
+		s.Require().NoError(g.Refresh())
+		g.Hostname = "dup"
+		s.Require().NoError(g.Save())
+	}
+	time.Sleep(1 * time.Second)
+
+	s.Equal(dns.RcodeNameError, s.query("dup.guests.lochness.test.", dns.TypeA).Rcode, "shared hostname should not be served")
+	s.Len(s.query(guest.ID+".guests.lochness.test.", dns.TypeA).Answer, 1, "guest id should still be served")
+}
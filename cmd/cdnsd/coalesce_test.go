@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCoalesce(t *testing.T) {
+	suite.Run(t, new(CoalesceSuite))
+}
+
+type CoalesceSuite struct {
+	suite.Suite
+	Changes chan struct{}
+	Reloads chan struct{}
+}
+
+func (s *CoalesceSuite) SetupTest() {
+	s.Changes = make(chan struct{}, 1)
+	s.Reloads = make(chan struct{}, 1000)
+	go coalesce(s.Changes, 5*time.Millisecond, 50*time.Millisecond, func() {
+		s.Reloads <- struct{}{}
+	})
+}
+
+func (s *CoalesceSuite) TearDownTest() {
+	close(s.Changes)
+}
+
+// reloaded waits for a reload
+func (s *CoalesceSuite) reloaded(msg string) {
+	select {
+	case <-s.Reloads:
+	case <-time.After(1 * time.Second):
+		s.Fail(msg)
+	}
+}
+
+func (s *CoalesceSuite) TestBurst() {
+	for i := 0; i < 10; i++ {
+		s.Changes <- struct{}{}
+	}
+	s.reloaded("burst should reload")
+	time.Sleep(20 * time.Millisecond)
+	s.Len(s.Reloads, 0, "burst should reload once")
+}
+
+func (s *CoalesceSuite) TestMaxDelay() {
+	stop := time.Now().Add(120 * time.Millisecond)
+	for time.Now().Before(stop) {
+		s.Changes <- struct{}{}
+		time.Sleep(1 * time.Millisecond)
+	}
+	s.True(len(s.Reloads) > 0, "steady changes should still reload")
+}
+
+func (s *CoalesceSuite) TestChangesAsDelayEnds() {
+	// changes spaced about the delay apart keep arriving as the wait ends
+	for i := 0; i < 200; i++ {
+		s.Changes <- struct{}{}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for len(s.Reloads) > 0 {
+		<-s.Reloads
+	}
+
+	s.Changes <- struct{}{}
+	s.reloaded("later changes should still reload")
+}
@@ -0,0 +1,56 @@
+/*
+cdnsd is an authoritative DNS server for the names of the guests, hypervisors
+and services of a lochness domain. Records are built from the kv and rebuilt as
+it changes.
+
+Names
+
+The following names are answered for, with A or AAAA records of their
+addresses:
+
+	<guest id>.guests.<domain>
+	<guest hostname>.guests.<domain>
+	<hypervisor id>.nodes.<domain>
+	<service>.services.<domain>
+
+A guest has the addresses of its interfaces. Guests that are deleted are not
+answered for, nor are hostnames shared by several guests. A service has the addresses of the hypervisors providing it,
+which are those whose config key for the service is set, and not to false. The
+services default to those the other lochness services expect, such as
+ipxe.services.<domain> for cbootstrapd.
+
+The reverse names of the addresses of the subnets and hypervisor networks are
+answered for with PTR records, pointing to the hostname of a guest, if it has
+one, or to the id name. Other names are refused.
+
+Usage
+
+The following arguments are accepted:
+
+	$ cdnsd -h
+	Usage of cdnsd:
+	  -d, --domain="": domain for lochness; required
+	  -k, --kv="http://127.0.0.1:4001": address of kv server
+	  -l, --log-level="warning": log level: debug/info/warning/error/critical/fatal
+	  -p, --port=53: port to listen on, udp and tcp
+	  -s, --service=[dhcp=dhcpd,dns=dns,ipxe=cbootstrapd,tftp=tftpd]: service name provided by the hypervisors with a config key, as name=key
+	  -t, --ttl=60: ttl of the records, in seconds
+
+Watched
+
+The following prefixes are watched for changes:
+
+	/lochness/hypervisors
+	/lochness/guests
+	/lochness/subnets
+
+Changes made close together, such as while a guest is placed, are coalesced
+into a single rebuild of the records.
+
+Example
+
+	$ hv config modify 18a0d6b8-8a9e-4ec7-a2fd-12345678abcd '{"cbootstrapd": "true"}'
+	$ dig +short @localhost ipxe.services.lochness.local
+	192.168.100.11
+*/
+package main
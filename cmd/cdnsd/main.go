@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/pkg/kv"
+	_ "github.com/mistifyio/lochness/pkg/kv/consul"
+	"github.com/mistifyio/lochness/pkg/watcher"
+	logx "github.com/mistifyio/mistify-logrus-ext"
+	flag "github.com/spf13/pflag"
+)
+
+// matchKeys matches the keys whose changes affect the zone, leaving out such
+// as heartbeats and reservations
+var matchKeys = regexp.MustCompile(`^/?lochness/(hypervisors|guests|subnets)/[^/]+(/metadata|/config/.*)?$`)
+
+// A burst of changes, such as while placing a guest, is coalesced into a single
+// reload of the zone once changes stop for reloadDelay, or after reloadMaxDelay
+// at most.
+const (
+	reloadDelay    = 100 * time.Millisecond
+	reloadMaxDelay = 1 * time.Second
+)
+
+// reloadZone reloads the zone after changes to its keys
+func reloadZone(ctx *lochness.Context, zone *Zone, changes <-chan struct{}) {
+	coalesce(changes, reloadDelay, reloadMaxDelay, func() {
+		if err := zone.Load(ctx); err != nil {
+			// keep answering from the previous records
+			log.WithFields(log.Fields{
+				"error": err,
+				"func":  "Zone.Load",
+			}).Error("could not reload zone")
+		}
+	})
+}
+
+// coalesce calls f once changes stop for delay, or maxDelay after the first of
+// them at most. It returns when changes is closed.
+func coalesce(changes <-chan struct{}, delay, maxDelay time.Duration, f func()) {
+	// a fresh channel for each wait, and nil while idle, so a wait that ended
+	// meanwhile can never be mistaken for the next one
+	var wait <-chan time.Time
+	var deadline time.Time
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+			now := time.Now()
+			if wait == nil {
+				deadline = now.Add(maxDelay)
+			}
+			d := delay
+			if left := deadline.Sub(now); left < d {
+				d = left
+			}
+			wait = time.After(d)
+		case <-wait:
+			wait = nil
+			f()
+		}
+	}
+}
+
+// parseServices parses service name to hypervisor config key mappings
+func parseServices(mappings []string) (map[string]string, error) {
+	services := make(map[string]string)
+	for _, mapping := range mappings {
+		parts := strings.SplitN(mapping, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid service %q, expected name=key", mapping)
+		}
+		services[parts[0]] = parts[1]
+	}
+	return services, nil
+}
+
+func main() {
+
+	// Command line options
+	var kvAddress, domain, logLevel string
+	var port, ttl uint
+	var serviceMappings []string
+	flag.StringVarP(&domain, "domain", "d", "", "domain for lochness; required")
+	flag.StringVarP(&kvAddress, "kv", "k", "http://127.0.0.1:4001", "address of kv server")
+	flag.UintVarP(&port, "port", "p", 53, "port to listen on, udp and tcp")
+	flag.UintVarP(&ttl, "ttl", "t", 60, "ttl of the records, in seconds")
+	flag.StringSliceVarP(&serviceMappings, "service", "s", []string{"dhcp=dhcpd", "dns=dns", "ipxe=cbootstrapd", "tftp=tftpd"}, "service name provided by the hypervisors with a config key, as name=key")
+	flag.StringVarP(&logLevel, "log-level", "l", "warning", "log level: debug/info/warning/error/critical/fatal")
+	flag.Parse()
+
+	// Domain is required
+	if domain == "" {
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Logging
+	if err := logx.DefaultSetup(logLevel); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "logx.DefaultSetup",
+		}).Fatal("could not set up logrus")
+	}
+
+	services, err := parseServices(serviceMappings)
+	if err != nil {
+		log.WithField("error", err).Fatal("invalid service flag")
+	}
+
+	KV, err := kv.New(kvAddress)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "kv.New",
+		}).Fatal("could not create kv client")
+	}
+	ctx := lochness.NewContext(KV)
+
+	// Load the zone before answering anything
+	zone := NewZone(domain, uint32(ttl), services)
+	if err := zone.Load(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "Zone.Load",
+		}).Fatal("could not load zone")
+	}
+
+	// Create the watcher
+	w, err := watcher.New(KV)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "watcher.New",
+		}).Fatal("could not create watcher")
+	}
+
+	// Start watching the necessary kv prefixes
+	prefixes := []string{"/lochness/hypervisors", "/lochness/guests", "/lochness/subnets"}
+	for _, prefix := range prefixes {
+		if err := w.Add(prefix); err != nil {
+			log.WithFields(log.Fields{
+				"error":  err,
+				"func":   "watcher.Add",
+				"prefix": prefix,
+			}).Fatal("could not add watch prefix")
+		}
+	}
+
+	changes := make(chan struct{}, 1)
+	go reloadZone(ctx, zone, changes)
+	go func() {
+		for w.Next() {
+			event := w.Event()
+			if !matchKeys.MatchString(event.Key) {
+				continue
+			}
+			log.WithFields(log.Fields{
+				"key":    event.Key,
+				"action": event.Type,
+			}).Debug("zone changed")
+			changes <- struct{}{}
+		}
+		if err := w.Err(); err != nil {
+			log.WithField("error", err).Fatal("watcher encountered an error")
+		}
+	}()
+
+	// Answer over both udp and tcp
+	servers := []*dns.Server{
+		{Addr: fmt.Sprintf(":%d", port), Net: "udp", Handler: zone},
+		{Addr: fmt.Sprintf(":%d", port), Net: "tcp", Handler: zone},
+	}
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			if err := server.ListenAndServe(); err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+					"func":  "dns.Server.ListenAndServe",
+					"net":   server.Net,
+				}).Fatal("ListenAndServe returned an error")
+			}
+		}(server)
+	}
+
+	// Handle signals for clean shutdown
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	s := <-sigs
+	log.WithField("signal", s).Info("signal received; shutting down")
+	for _, server := range servers {
+		_ = server.Shutdown()
+	}
+	_ = w.Close()
+	log.Info("exiting")
+}
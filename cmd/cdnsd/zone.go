@@ -0,0 +1,364 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+	"github.com/mistifyio/lochness"
+)
+
+type (
+	// Zone answers queries for the names of the guests, hypervisors and
+	// services of a lochness domain, and the reverse names of their addresses.
+	Zone struct {
+		domain   string
+		ttl      uint32
+		services map[string]string // hypervisor config key by service name
+
+		mu       sync.RWMutex
+		serial   uint32
+		names    map[string][]net.IP // addresses by name
+		existing map[string]bool     // names with records below them
+		ptrs     map[string][]string // names by reverse name
+		networks []*net.IPNet        // networks of the reverse names answered for
+	}
+
+	// records are the names of a Zone, built up while loading
+	records struct {
+		domain   string
+		names    map[string][]net.IP
+		existing map[string]bool
+		ptrs     map[string][]string
+		networks []*net.IPNet
+	}
+)
+
+// NewZone creates a new Zone for the domain. Each service named is provided by
+// the hypervisors enabling its config key.
+func NewZone(domain string, ttl uint32, services map[string]string) *Zone {
+	return &Zone{
+		domain:   dns.Fqdn(strings.ToLower(domain)),
+		ttl:      ttl,
+		services: services,
+		names:    make(map[string][]net.IP),
+		existing: make(map[string]bool),
+		ptrs:     make(map[string][]string),
+	}
+}
+
+// name returns a name in the zone from its labels
+func (z *Zone) name(labels ...string) string {
+	return strings.ToLower(strings.Join(labels, ".")) + "." + z.domain
+}
+
+// serviceEnabled returns whether a hypervisor config value enables a service.
+// Values that are not booleans, such as versions, enable it.
+func serviceEnabled(value string) bool {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		return enabled
+	}
+	return value != ""
+}
+
+// Load replaces the records of the Zone with the guests, hypervisors and
+// subnets in the config store. The previous records are kept on failure.
+func (z *Zone) Load(c *lochness.Context) error {
+	r := &records{
+		domain:   z.domain,
+		names:    make(map[string][]net.IP),
+		existing: make(map[string]bool),
+		ptrs:     make(map[string][]string),
+	}
+
+	err := c.ForEachHypervisor(func(h *lochness.Hypervisor) error {
+		if h.IP == nil {
+			return nil
+		}
+		name := z.name(h.ID, "nodes")
+		r.add(name, h.IP)
+		r.addPTR(h.IP, name)
+		if h.Netmask != nil {
+			mask := net.IPMask(h.Netmask)
+			if h.IP.To4() != nil && h.Netmask.To4() != nil {
+				mask = net.IPMask(h.Netmask.To4())
+			}
+			r.networks = append(r.networks, &net.IPNet{IP: h.IP.Mask(mask), Mask: mask})
+		}
+		for service, key := range z.services {
+			if serviceEnabled(h.Config[key]) {
+				r.add(z.name(service, "services"), h.IP)
+			}
+		}
+		return nil
+	})
+	if err != nil && !c.IsKeyNotFound(err) {
+		return err
+	}
+
+	err = c.ForEachSubnet(func(s *lochness.Subnet) error {
+		if s.CIDR != nil {
+			r.networks = append(r.networks, s.CIDR)
+		}
+		return nil
+	})
+	if err != nil && !c.IsKeyNotFound(err) {
+		return err
+	}
+
+	// a hostname shared by guests is served for none of them
+	guests := lochness.Guests{}
+	hostnames := make(map[string]int)
+	err = c.ForEachGuest(func(g *lochness.Guest) error {
+		if g.State == lochness.GuestStateDeleted || g.State == lochness.GuestStatePurging {
+			return nil
+		}
+		guests = append(guests, g)
+		if g.Hostname != "" {
+			hostnames[z.name(g.Hostname, "guests")]++
+		}
+		return nil
+	})
+	if err != nil && !c.IsKeyNotFound(err) {
+		return err
+	}
+
+	for _, g := range guests {
+		names := []string{z.name(g.ID, "guests")}
+		if g.Hostname != "" {
+			hostname := z.name(g.Hostname, "guests")
+			if hostnames[hostname] == 1 {
+				names = append(names, hostname)
+			} else {
+				log.WithFields(log.Fields{
+					"guest":    g.ID,
+					"hostname": g.Hostname,
+				}).Warning("hostname shared by other guests")
+			}
+		}
+		for _, iface := range g.Interfaces {
+			if iface == nil || iface.IP == nil {
+				continue
+			}
+			for _, name := range names {
+				r.add(name, iface.IP)
+			}
+			r.addPTR(iface.IP, names[len(names)-1])
+		}
+	}
+
+	z.mu.Lock()
+	z.names, z.existing, z.ptrs, z.networks = r.names, r.existing, r.ptrs, r.networks
+	// a new serial for each version of the zone
+	serial := uint32(time.Now().Unix())
+	if serial <= z.serial {
+		serial = z.serial + 1
+	}
+	z.serial = serial
+	z.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"names":  len(r.names),
+		"guests": len(guests),
+		"serial": serial,
+	}).Info("loaded zone")
+	return nil
+}
+
+// add adds an address to a name, and marks the names above it as existing
+func (r *records) add(name string, ip net.IP) {
+	for _, existing := range r.names[name] {
+		if existing.Equal(ip) {
+			return
+		}
+	}
+	r.names[name] = append(r.names[name], ip)
+	for n := name; n != r.domain && n != ""; {
+		r.existing[n] = true
+		i := strings.Index(n, ".")
+		if i < 0 {
+			break
+		}
+		n = n[i+1:]
+	}
+}
+
+// addPTR points the reverse name of an address to a name
+func (r *records) addPTR(ip net.IP, name string) {
+	arpa, err := dns.ReverseAddr(ip.String())
+	if err != nil {
+		return
+	}
+	for _, existing := range r.ptrs[arpa] {
+		if existing == name {
+			return
+		}
+	}
+	r.ptrs[arpa] = append(r.ptrs[arpa], name)
+	sort.Strings(r.ptrs[arpa])
+}
+
+// reverseIP returns the address of a reverse name, or nil if it is not the
+// reverse name of a whole address.
+func reverseIP(name string) net.IP {
+	name = strings.TrimSuffix(name, ".")
+	switch {
+	case strings.HasSuffix(name, ".in-addr.arpa"):
+		labels := strings.Split(strings.TrimSuffix(name, ".in-addr.arpa"), ".")
+		if len(labels) != net.IPv4len {
+			return nil
+		}
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		return net.ParseIP(strings.Join(labels, ".")).To4()
+	case strings.HasSuffix(name, ".ip6.arpa"):
+		nibbles := strings.Split(strings.TrimSuffix(name, ".ip6.arpa"), ".")
+		if len(nibbles) != 2*net.IPv6len {
+			return nil
+		}
+		ip := make(net.IP, net.IPv6len)
+		for i, nibble := range nibbles {
+			v, err := strconv.ParseUint(nibble, 16, 8)
+			if err != nil || len(nibble) != 1 {
+				return nil
+			}
+			// nibbles are least significant first
+			pos := len(nibbles) - 1 - i
+			if pos%2 == 0 {
+				ip[pos/2] |= byte(v) << 4
+			} else {
+				ip[pos/2] |= byte(v)
+			}
+		}
+		return ip
+	}
+	return nil
+}
+
+// ServeDNS answers a query
+func (z *Zone) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := z.answer(r)
+	if err := w.WriteMsg(m); err != nil {
+		log.WithFields(log.Fields{
+			"error":  err,
+			"func":   "dns.ResponseWriter.WriteMsg",
+			"remote": w.RemoteAddr(),
+		}).Error("failed to write response")
+	}
+}
+
+// answer builds the response to a query. Names outside the domain, and
+// reverse names outside the networks of the subnets and hypervisors, are
+// refused.
+func (z *Zone) answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	if r.Opcode != dns.OpcodeQuery {
+		return m.SetRcode(r, dns.RcodeNotImplemented)
+	}
+	if len(r.Question) != 1 {
+		return m.SetRcode(r, dns.RcodeFormatError)
+	}
+	q := r.Question[0]
+	if q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY {
+		return m.SetRcode(r, dns.RcodeRefused)
+	}
+	name := strings.ToLower(dns.Fqdn(q.Name))
+
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	if ip := reverseIP(name); ip != nil {
+		if !z.inNetworks(ip) {
+			return m.SetRcode(r, dns.RcodeRefused)
+		}
+		targets, ok := z.ptrs[name]
+		if ok {
+			m.SetReply(r)
+		} else {
+			m.SetRcode(r, dns.RcodeNameError)
+		}
+		m.Authoritative = true
+		if q.Qtype == dns.TypePTR || q.Qtype == dns.TypeANY {
+			for _, target := range targets {
+				m.Answer = append(m.Answer, &dns.PTR{
+					Hdr: z.header(q.Name, dns.TypePTR),
+					Ptr: target,
+				})
+			}
+		}
+		return m
+	}
+
+	if !dns.IsSubDomain(z.domain, name) {
+		return m.SetRcode(r, dns.RcodeRefused)
+	}
+
+	ips, ok := z.names[name]
+	if !ok && !z.existing[name] && name != z.domain {
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{z.soa()}
+		return m
+	}
+	m.SetReply(r)
+	m.Authoritative = true
+
+	if name == z.domain && (q.Qtype == dns.TypeSOA || q.Qtype == dns.TypeANY) {
+		m.Answer = append(m.Answer, z.soa())
+	}
+	for _, ip := range ips {
+		if ip4 := ip.To4(); ip4 != nil {
+			if q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY {
+				m.Answer = append(m.Answer, &dns.A{Hdr: z.header(q.Name, dns.TypeA), A: ip4})
+			}
+		} else if q.Qtype == dns.TypeAAAA || q.Qtype == dns.TypeANY {
+			m.Answer = append(m.Answer, &dns.AAAA{Hdr: z.header(q.Name, dns.TypeAAAA), AAAA: ip})
+		}
+	}
+	if len(m.Answer) == 0 {
+		// the name exists without records of the type
+		m.Ns = []dns.RR{z.soa()}
+	}
+	return m
+}
+
+// inNetworks returns whether an address is in a network of the subnets or
+// hypervisors
+func (z *Zone) inNetworks(ip net.IP) bool {
+	for _, network := range z.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// header returns the header of a record of the zone
+func (z *Zone) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{
+		Name:   name,
+		Rrtype: rrtype,
+		Class:  dns.ClassINET,
+		Ttl:    z.ttl,
+	}
+}
+
+// soa returns the start of authority record of the zone
+func (z *Zone) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     z.header(z.domain, dns.TypeSOA),
+		Ns:      z.name("dns", "services"),
+		Mbox:    z.name("hostmaster"),
+		Serial:  z.serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  z.ttl,
+	}
+}
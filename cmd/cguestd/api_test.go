@@ -1,10 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os/exec"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -105,6 +111,60 @@ func (s *APISuite) TestGuestsList() {
 	s.Equal(s.Guest.ID, guests[0].ID)
 }
 
+func (s *APISuite) TestGuestsListState() {
+	running := s.NewGuest()
+	running.State = lochness.GuestStateRunning
+	s.Require().NoError(running.Save())
+
+	tests := []struct {
+		description  string
+		query        string
+		expectedCode int
+		expectedIDs  []string
+	}{
+		{"invalid state", "?state=foo", http.StatusBadRequest, nil},
+		{"single state", "?state=running", http.StatusOK, []string{running.ID}},
+		{"multiple states", "?state=running,pending", http.StatusOK, []string{s.Guest.ID, running.ID}},
+		{"no match", "?state=stopped", http.StatusOK, []string{}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		if test.expectedCode != http.StatusOK {
+			var resp map[string]string
+			s.DoRequest("GET", s.APIURL+test.query, test.expectedCode, nil, &resp)
+			continue
+		}
+
+		var guests lochness.Guests
+		s.DoRequest("GET", s.APIURL+test.query, test.expectedCode, nil, &guests)
+		ids := make([]string, len(guests))
+		for i, g := range guests {
+			ids[i] = g.ID
+		}
+		sort.Strings(ids)
+		sort.Strings(test.expectedIDs)
+		s.Equal(test.expectedIDs, ids, msg("should list guests in the states"))
+	}
+}
+
+func (s *APISuite) TestGuestsListSelector() {
+	web := s.NewGuest()
+	web.Metadata["app"] = "web"
+	s.Require().NoError(web.Save())
+
+	var guests lochness.Guests
+	s.DoRequest("GET", s.APIURL+"?selector=app%3Dweb", http.StatusOK, nil, &guests)
+	s.Len(guests, 1)
+	s.Equal(web.ID, guests[0].ID)
+
+	s.DoRequest("GET", s.APIURL+"?selector=app%3Dweb&state=running", http.StatusOK, nil, &guests)
+	s.Len(guests, 0)
+
+	var msg map[string]string
+	s.DoRequest("GET", s.APIURL+"?selector=app+in+%28web", http.StatusBadRequest, nil, &msg)
+}
+
 func (s *APISuite) TestGuestAdd() {
 	s.Guest.ID = uuid.New()
 
@@ -115,6 +175,15 @@ func (s *APISuite) TestGuestAdd() {
 	s.Equal(s.Guest.ID, guestResp.ID)
 }
 
+func (s *APISuite) TestGuestAddRequestedAddress() {
+	s.Guest.ID = uuid.New()
+	s.Guest.Interfaces[0].IP = net.ParseIP("10.10.10.5")
+
+	var msg map[string]string
+	s.DoRequest("POST", s.APIURL, http.StatusBadRequest, s.Guest, &msg)
+	s.Contains(msg["message"], "10.10.10.5")
+}
+
 func (s *APISuite) TestGuestGet() {
 	var guest lochness.Guest
 	s.DoRequest("GET", fmt.Sprintf("%s/%s", s.APIURL, s.Guest.ID), http.StatusOK, nil, &guest)
@@ -123,7 +192,7 @@ func (s *APISuite) TestGuestGet() {
 }
 
 func (s *APISuite) TestGuestUpdate() {
-	s.Guest.MAC, _ = net.ParseMAC("01:23:45:67:89:ab")
+	s.Guest.Interfaces[0].MAC, _ = net.ParseMAC("01:23:45:67:89:ab")
 
 	var guestResp lochness.Guest
 	s.DoRequest("PATCH", fmt.Sprintf("%s/%s", s.APIURL, s.Guest.ID), http.StatusOK, s.Guest, &guestResp)
@@ -133,7 +202,7 @@ func (s *APISuite) TestGuestUpdate() {
 	// Make sure it actually saved
 	g, err := s.Context.Guest(s.Guest.ID)
 	s.NoError(err)
-	s.Equal(s.Guest.MAC, g.MAC)
+	s.Equal(s.Guest.Interfaces[0].MAC, g.Interfaces[0].MAC)
 }
 
 func (s *APISuite) TestGuestDestroy() {
@@ -142,17 +211,90 @@ func (s *APISuite) TestGuestDestroy() {
 	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
 
 	s.Equal(s.Guest.ID, guestResp.ID)
+	s.Equal(lochness.GuestStateDeleting, guestResp.State)
+
+	// Already being deleted
+	var msg map[string]string
+	s.DoRequest("DELETE", fmt.Sprintf("%s/%s", s.APIURL, s.Guest.ID), http.StatusBadRequest, nil, &msg)
 }
 
-func (s *APISuite) TestGuestAction() {
+func (s *APISuite) TestGuestUserData() {
+	url := fmt.Sprintf("%s/%s/user-data", s.APIURL, s.Guest.ID)
+
+	req, err := http.NewRequest("PUT", url, strings.NewReader("#cloud-config\n"))
+	s.Require().NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(url)
+	s.Require().NoError(err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("#cloud-config\n", string(body))
+
+	req, err = http.NewRequest("PUT", url, strings.NewReader(strings.Repeat("a", lochness.MaxUserDataSize+1)))
+	s.Require().NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusBadRequest, resp.StatusCode, "too much user data should be rejected")
+
+	s.NoError(s.Guest.Refresh())
+	s.Equal("#cloud-config\n", s.Guest.UserData)
+}
+
+func (s *APISuite) TestGuestUndelete() {
+	var msg map[string]string
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/undelete", s.APIURL, s.Guest.ID), http.StatusBadRequest, nil, &msg)
+
+	s.Guest.State = lochness.GuestStateDeleting
+	s.Require().NoError(s.Guest.Save())
+	s.Require().NoError(s.Guest.Trash())
+
 	var guestResp lochness.Guest
-	resp := s.DoRequest("POST", fmt.Sprintf("%s/%s/%s", s.APIURL, s.Guest.ID, "reboot"), http.StatusAccepted, nil, &guestResp)
-	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/undelete", s.APIURL, s.Guest.ID), http.StatusOK, nil, &guestResp)
+	s.Equal(lochness.GuestStateStopped, guestResp.State)
+	s.Nil(guestResp.PurgeAt)
 
-	s.Equal(s.Guest.ID, guestResp.ID)
+	s.NoError(s.Guest.Refresh())
+	s.Equal(lochness.GuestStateStopped, s.Guest.State)
+}
+
+func (s *APISuite) TestGuestAction() {
+	tests := []struct {
+		description  string
+		state        string
+		action       string
+		expectedCode int
+	}{
+		{"pending", lochness.GuestStatePending, "start", http.StatusBadRequest},
+		{"deleting", lochness.GuestStateDeleting, "start", http.StatusBadRequest},
+		{"stopped start", lochness.GuestStateStopped, "start", http.StatusAccepted},
+		{"running reboot", lochness.GuestStateRunning, "reboot", http.StatusAccepted},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest := s.NewGuest()
+		guest.State = test.state
+		s.Require().NoError(guest.Save(), msg("failed to save guest"))
+
+		var guestResp lochness.Guest
+		resp := s.DoRequest("POST", fmt.Sprintf("%s/%s/%s", s.APIURL, guest.ID, test.action), test.expectedCode, nil, &guestResp)
+		if test.expectedCode == http.StatusAccepted {
+			s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"), msg("should return a job id"))
+			s.Equal(guest.ID, guestResp.ID, msg("should return the guest"))
+		}
+	}
 }
 
 func (s *APISuite) TestGuestJob() {
+	s.Guest.State = lochness.GuestStateRunning
+	s.Require().NoError(s.Guest.Save())
+
 	var guestResp lochness.Guest
 	resp := s.DoRequest("POST", fmt.Sprintf("%s/%s/%s", s.APIURL, s.Guest.ID, "reboot"), http.StatusAccepted, nil, &guestResp)
 	jobID := resp.Header.Get("X-Guest-Job-ID")
@@ -162,3 +304,376 @@ func (s *APISuite) TestGuestJob() {
 
 	s.Equal(jobID, job.ID)
 }
+
+func (s *APISuite) TestGuestMigrate() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	target := s.NewHypervisor()
+
+	tests := []struct {
+		description  string
+		guestID      string
+		target       string
+		expectedCode int
+	}{
+		{"unplaced guest", s.Guest.ID, "", http.StatusBadRequest},
+		{"nonexistent target", guest.ID, uuid.New(), http.StatusBadRequest},
+		{"current hypervisor", guest.ID, hypervisor.ID, http.StatusBadRequest},
+		{"named target", guest.ID, target.ID, http.StatusAccepted},
+		{"selected target", guest.ID, "", http.StatusAccepted},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		url := fmt.Sprintf("%s/%s/migrate", s.APIURL, test.guestID)
+		var body interface{}
+		if test.target != "" {
+			body = map[string]string{"hypervisor": test.target}
+		}
+
+		if test.expectedCode != http.StatusAccepted {
+			var resp map[string]string
+			s.DoRequest("POST", url, test.expectedCode, body, &resp)
+			continue
+		}
+
+		var guestResp lochness.Guest
+		resp := s.DoRequest("POST", url, test.expectedCode, body, &guestResp)
+		s.Equal(guest.ID, guestResp.ID, msg("should return the guest"))
+
+		job, err := s.JobQueue.PeekJob(resp.Header.Get("X-Guest-Job-ID"))
+		s.NoError(err, msg("should queue a job"))
+		if job != nil {
+			s.Equal("migrate", job.Action, msg("should queue a migration"))
+			s.Equal(test.target, job.Args["target"], msg("should pass on the target"))
+		}
+	}
+}
+
+func (s *APISuite) TestGuestResize() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	bigger := s.NewFlavor()
+	bigger.Memory = 256
+	s.Require().NoError(bigger.Save())
+	huge := s.NewFlavor()
+	huge.Memory = hypervisor.TotalResources.Memory * 2
+	s.Require().NoError(huge.Save())
+
+	tests := []struct {
+		description    string
+		guestID        string
+		flavorID       string
+		expectedCode   int
+		expectedAction string
+	}{
+		{"unplaced guest", s.Guest.ID, bigger.ID, http.StatusBadRequest, ""},
+		{"missing flavor", guest.ID, "", http.StatusBadRequest, ""},
+		{"nonexistent flavor", guest.ID, uuid.New(), http.StatusBadRequest, ""},
+		{"same flavor", guest.ID, guest.FlavorID, http.StatusBadRequest, ""},
+		{"too big for hypervisor", guest.ID, huge.ID, http.StatusAccepted, "migrate"},
+		{"fits hypervisor", guest.ID, bigger.ID, http.StatusAccepted, "resize"},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		url := fmt.Sprintf("%s/%s/resize", s.APIURL, test.guestID)
+		body := map[string]string{"flavor": test.flavorID}
+
+		if test.expectedCode != http.StatusAccepted {
+			var resp map[string]string
+			s.DoRequest("POST", url, test.expectedCode, body, &resp)
+			continue
+		}
+
+		var guestResp lochness.Guest
+		resp := s.DoRequest("POST", url, test.expectedCode, body, &guestResp)
+		s.Equal(guest.FlavorID, guestResp.FlavorID, msg("should keep the flavor until resized"))
+
+		job, err := s.JobQueue.PeekJob(resp.Header.Get("X-Guest-Job-ID"))
+		s.NoError(err, msg("should queue a job"))
+		if job != nil {
+			s.Equal(test.expectedAction, job.Action, msg("should queue the right action"))
+			s.Equal(test.flavorID, job.Args["flavor"], msg("should pass on the flavor"))
+		}
+	}
+
+	s.NoError(hypervisor.Refresh())
+	s.Equal(uint64(256), hypervisor.Reservations[guest.ID].Memory, "resize should be reserved")
+}
+
+func (s *APISuite) TestVolumesList() {
+	volume := s.NewVolume()
+
+	var volumes lochness.Volumes
+	s.DoRequest("GET", s.volumeURL(""), http.StatusOK, nil, &volumes)
+
+	s.Len(volumes, 1)
+	s.Equal(volume.ID, volumes[0].ID)
+}
+
+func (s *APISuite) TestVolumeAdd() {
+	hypervisor := s.NewHypervisor()
+
+	tests := []struct {
+		description  string
+		size         uint64
+		hypervisorID string
+		expectedCode int
+	}{
+		{"missing size", 0, "", http.StatusBadRequest},
+		{"nonexistent hypervisor", 1024, uuid.New(), http.StatusBadRequest},
+		{"unpooled", 1024, "", http.StatusCreated},
+		{"pooled", 1024, hypervisor.ID, http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		volume := s.Context.NewVolume()
+		volume.Size = test.size
+		volume.HypervisorID = test.hypervisorID
+
+		var volumeResp lochness.Volume
+		s.DoRequest("POST", s.volumeURL(""), test.expectedCode, volume, &volumeResp)
+		if test.expectedCode != http.StatusCreated {
+			continue
+		}
+
+		s.Equal(volume.ID, volumeResp.ID, msg("wrong volume returned"))
+		_, err := s.Context.Volume(volume.ID)
+		s.NoError(err, msg("volume should have been saved"))
+	}
+}
+
+func (s *APISuite) TestVolumeGet() {
+	volume := s.NewVolume()
+
+	var volumeResp lochness.Volume
+	s.DoRequest("GET", s.volumeURL(volume.ID), http.StatusOK, nil, &volumeResp)
+
+	s.Equal(volume.ID, volumeResp.ID)
+}
+
+func (s *APISuite) TestVolumeUpdate() {
+	volume := s.NewVolume()
+	volume.Size = 2048
+	volume.Metadata["foo"] = "bar"
+
+	var volumeResp lochness.Volume
+	s.DoRequest("PATCH", s.volumeURL(volume.ID), http.StatusOK, volume, &volumeResp)
+	s.Equal(volume.Size, volumeResp.Size)
+
+	v, err := s.Context.Volume(volume.ID)
+	s.NoError(err)
+	s.Equal(volume.Size, v.Size)
+	s.Equal("bar", v.Metadata["foo"])
+
+	// Attached volumes may not be resized
+	s.NoError(v.Attach(s.Guest))
+	v.Size = 4096
+	var msg map[string]string
+	s.DoRequest("PATCH", s.volumeURL(v.ID), http.StatusBadRequest, v, &msg)
+	s.Contains(msg["message"], "attached")
+}
+
+func (s *APISuite) TestVolumeDestroy() {
+	volume := s.NewVolume()
+	s.NoError(volume.Attach(s.Guest))
+
+	var msg map[string]string
+	s.DoRequest("DELETE", s.volumeURL(volume.ID), http.StatusBadRequest, nil, &msg)
+
+	s.NoError(volume.Detach())
+	var volumeResp lochness.Volume
+	s.DoRequest("DELETE", s.volumeURL(volume.ID), http.StatusOK, nil, &volumeResp)
+	s.Equal(volume.ID, volumeResp.ID)
+
+	_, err := s.Context.Volume(volume.ID)
+	s.Error(err)
+}
+
+func (s *APISuite) TestGuestVolumeAttachDetach() {
+	volume := s.NewVolume()
+	url := fmt.Sprintf("%s/%s/volumes/%s", s.APIURL, s.Guest.ID, volume.ID)
+
+	// Unplaced guest, no job needed
+	var volumeResp lochness.Volume
+	s.DoRequest("POST", url, http.StatusOK, nil, &volumeResp)
+	s.Equal(s.Guest.ID, volumeResp.GuestID)
+	s.Equal(1, volumeResp.Device)
+
+	var msg map[string]string
+	s.DoRequest("POST", url, http.StatusBadRequest, nil, &msg)
+
+	s.DoRequest("DELETE", url, http.StatusOK, nil, &volumeResp)
+	s.Empty(volumeResp.GuestID)
+
+	s.DoRequest("DELETE", url, http.StatusBadRequest, nil, &msg)
+
+	// Placed guest, job queued
+	_, guest := s.NewHypervisorWithGuest()
+	url = fmt.Sprintf("%s/%s/volumes/%s", s.APIURL, guest.ID, volume.ID)
+	resp := s.DoRequest("POST", url, http.StatusAccepted, nil, &volumeResp)
+	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
+	s.Equal(guest.ID, volumeResp.GuestID)
+	s.Equal(guest.HypervisorID, volumeResp.HypervisorID)
+
+	resp = s.DoRequest("DELETE", url, http.StatusAccepted, nil, &volumeResp)
+	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
+}
+
+func (s *APISuite) TestGuestSnapshots() {
+	_, guest := s.NewHypervisorWithGuest()
+	url := fmt.Sprintf("%s/%s/snapshots", s.APIURL, guest.ID)
+
+	var msg map[string]string
+	s.DoRequest("POST", url, http.StatusBadRequest, nil, &msg)
+
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+
+	var snapshotResp lochness.Snapshot
+	resp := s.DoRequest("POST", url, http.StatusAccepted, map[string]string{"name": "before upgrade"}, &snapshotResp)
+	s.Equal("before upgrade", snapshotResp.Name)
+	s.Equal(lochness.SnapshotStatusPending, snapshotResp.Status)
+	job, err := s.JobQueue.PeekJob(resp.Header.Get("X-Guest-Job-ID"))
+	s.NoError(err)
+	if job != nil {
+		s.Equal("snapshot", job.Action)
+		s.Equal(snapshotResp.ID, job.Args["snapshot"])
+	}
+
+	var snapshots lochness.Snapshots
+	s.DoRequest("GET", url, http.StatusOK, nil, &snapshots)
+	s.Len(snapshots, 1)
+
+	snapshotURL := fmt.Sprintf("%s/%s", url, snapshotResp.ID)
+	s.DoRequest("GET", snapshotURL, http.StatusOK, nil, &snapshotResp)
+	s.DoRequest("GET", fmt.Sprintf("%s/%s/snapshots/%s", s.APIURL, s.Guest.ID, snapshotResp.ID), http.StatusNotFound, nil, &msg)
+
+	// pending snapshots can not be rolled back or deleted
+	s.DoRequest("POST", snapshotURL+"/rollback", http.StatusBadRequest, nil, &msg)
+	s.DoRequest("DELETE", snapshotURL, http.StatusBadRequest, nil, &msg)
+
+	snapshot, err := s.Context.Snapshot(snapshotResp.ID)
+	s.Require().NoError(err)
+	s.Require().NoError(snapshot.Complete(100))
+
+	resp = s.DoRequest("POST", snapshotURL+"/rollback", http.StatusAccepted, nil, &snapshotResp)
+	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
+
+	resp = s.DoRequest("DELETE", snapshotURL, http.StatusAccepted, nil, &snapshotResp)
+	s.NotEmpty(resp.Header.Get("X-Guest-Job-ID"))
+	s.Equal(lochness.SnapshotStatusDeleting, snapshotResp.Status)
+}
+
+func (s *APISuite) TestGuestsProject() {
+	project := s.NewProject()
+	owned := s.NewGuest()
+	owned.ProjectID = project.ID
+	s.Require().NoError(owned.Save())
+	foreign := s.NewGuest()
+	foreign.ProjectID = s.NewProject().ID
+	s.Require().NoError(foreign.Save())
+
+	var guests lochness.Guests
+	s.doProjectRequest("GET", s.APIURL, project.ID, http.StatusOK, nil, &guests)
+	ids := make([]string, len(guests))
+	for i, g := range guests {
+		ids[i] = g.ID
+	}
+	s.Contains(ids, owned.ID, "should list the project's guests")
+	s.NotContains(ids, s.Guest.ID, "should not list guests without a project")
+	s.NotContains(ids, foreign.ID, "should not list other projects' guests")
+
+	var guest lochness.Guest
+	s.doProjectRequest("GET", fmt.Sprintf("%s/%s", s.APIURL, owned.ID), project.ID, http.StatusOK, nil, &guest)
+	s.Equal(owned.ID, guest.ID)
+	var msg map[string]string
+	s.doProjectRequest("GET", fmt.Sprintf("%s/%s", s.APIURL, foreign.ID), project.ID, http.StatusNotFound, nil, &msg)
+	s.doProjectRequest("GET", fmt.Sprintf("%s/%s", s.APIURL, s.Guest.ID), project.ID, http.StatusNotFound, nil, &msg)
+
+	// new guests join the request's project
+	s.Guest.ID = uuid.New()
+	s.doProjectRequest("POST", s.APIURL, project.ID, http.StatusAccepted, s.Guest, &guest)
+	s.Equal(project.ID, guest.ProjectID)
+
+	s.Guest.ID = uuid.New()
+	s.Guest.ProjectID = foreign.ProjectID
+	s.doProjectRequest("POST", s.APIURL, project.ID, http.StatusBadRequest, s.Guest, &msg)
+
+	s.Guest.ID = uuid.New()
+	s.doProjectRequest("POST", s.APIURL, uuid.New(), http.StatusBadRequest, s.Guest, &msg)
+	s.Equal("project not found", msg["message"])
+}
+
+func (s *APISuite) TestQuota() {
+	project := s.NewProject()
+	quotaURL := fmt.Sprintf("http://localhost:%d/quotas/%s", s.Port, project.ID)
+
+	var msg map[string]string
+	s.DoRequest("GET", quotaURL, http.StatusNotFound, nil, &msg)
+	s.doProjectRequest("PUT", quotaURL, project.ID, http.StatusForbidden, lochness.QuotaResources{Guests: 1}, &msg)
+
+	// a new quota is charged for the project's existing guests
+	existing := s.NewGuest()
+	existing.ProjectID = project.ID
+	s.Require().NoError(existing.Save())
+
+	var quota lochness.Quota
+	s.DoRequest("PUT", quotaURL, http.StatusOK, lochness.QuotaResources{Guests: 2}, &quota)
+	s.Equal(uint64(2), quota.Limits.Guests)
+	s.Equal(uint64(1), quota.Usage.Guests)
+	s.Contains(quota.Guests, existing.ID)
+
+	s.Guest.ID = uuid.New()
+	var guest lochness.Guest
+	s.doProjectRequest("POST", s.APIURL, project.ID, http.StatusAccepted, s.Guest, &guest)
+
+	s.Guest.ID = uuid.New()
+	var exceeded QuotaExceededResponse
+	s.doProjectRequest("POST", s.APIURL, project.ID, http.StatusForbidden, s.Guest, &exceeded)
+	s.Equal("guests", exceeded.Dimension)
+	s.Equal(uint64(2), exceeded.Limit)
+	s.Equal(uint64(3), exceeded.Requested)
+
+	s.doProjectRequest("GET", quotaURL, project.ID, http.StatusOK, nil, &quota)
+	s.Equal(uint64(2), quota.Usage.Guests)
+	s.Contains(quota.Guests, guest.ID)
+	s.doProjectRequest("GET", quotaURL, s.NewProject().ID, http.StatusNotFound, nil, &msg)
+}
+
+// doProjectRequest makes a request scoped to a project and does basic
+// handling of the response
+func (s *APISuite) doProjectRequest(method, url, project string, expectedRespCode int, postBodyStruct interface{}, respBody interface{}) *http.Response {
+	var postBody io.Reader
+	if postBodyStruct != nil {
+		bodyBytes, _ := json.Marshal(postBodyStruct)
+		postBody = bytes.NewBuffer(bodyBytes)
+	}
+
+	req, err := http.NewRequest(method, url, postBody)
+	s.Require().NoError(err)
+	if postBody != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+	req.Header.Set(projectHeader, project)
+
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer func() { _ = resp.Body.Close() }()
+	if s.Equal(expectedRespCode, resp.StatusCode) {
+		s.NoError(json.NewDecoder(resp.Body).Decode(respBody))
+	}
+	return resp
+}
+
+func (s *APISuite) volumeURL(id string) string {
+	url := fmt.Sprintf("http://localhost:%d/volumes", s.Port)
+	if id != "" {
+		url = fmt.Sprintf("%s/%s", url, id)
+	}
+	return url
+}
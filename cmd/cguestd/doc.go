@@ -14,17 +14,51 @@ Usage
 HTTP API Endpoints
 
 	/guests
-		* GET  - Retrieve a list of guests
+		* GET  - Retrieve a list of guests, optionally filtered by the query
+		         parameters selector, a label selector on the metadata, and
+		         state, a comma separated list of states
 		* POST - Create a new guest - Async
 	/guests/{guestID}
 		* GET    - Retrieve information about a guest
 		* PATCH  - Update information for a guest
 		* DELETE - Delete a guest - Async
+	/guests/{guestID}/user-data
+		* GET - Retrieve the guest's raw user data
+		* PUT - Replace the guest's user data with the raw body, removing it
+		        if empty
+	/guests/{guestID}/undelete
+		* POST - Restore a deleted guest that has not been purged yet
 	/guests/{guestID}/{action}
 		* POST - Perform the action for the guest - Async
 			Actions: shutdown, reboot, restart, poweroff, start, suspend
+	/guests/{guestID}/migrate
+		* POST - Migrate the guest to another hypervisor - Async
+	/guests/{guestID}/resize
+		* POST - Resize the guest to another flavor - Async
+	/guests/{guestID}/snapshots
+		* GET  - Retrieve a list of the guest's snapshots, oldest first
+		* POST - Snapshot the guest - Async
+	/guests/{guestID}/snapshots/{snapshotID}
+		* GET    - Retrieve information about a snapshot
+		* DELETE - Delete a snapshot - Async
+	/guests/{guestID}/snapshots/{snapshotID}/rollback
+		* POST - Roll the guest back to the snapshot - Async
+	/guests/{guestID}/volumes/{volumeID}
+		* POST   - Attach a volume to the guest - Async if the guest is placed
+		* DELETE - Detach a volume from the guest - Async if the guest is placed
+	/volumes
+		* GET  - Retrieve a list of volumes
+		* POST - Create a new volume
+	/volumes/{volumeID}
+		* GET    - Retrieve information about a volume
+		* PATCH  - Update the metadata or, while detached, the size of a volume
+		* DELETE - Delete a detached volume
 	/jobs/{jobID}
 		* GET - Check job status
+	/quotas/{projectID}
+		* GET - Retrieve the limits and usage of a project's quota
+		* PUT - Set the limits of a project's quota, keeping its usage. A
+		        new quota is charged for the project's existing guests
 
 The endpoints labeled Async run asynchronous actions, such as creating or
 deleting a guest. In such a case, the return status will be `HTTP/1.1 202
@@ -32,6 +66,75 @@ Accepted` and a header `X-Guest-Job-Id` will be included for status lookups.
 Endpoints not labeled as async, such as getting a guest or updating the guest
 information, will occur synchronously before the response is sent.
 
+A guest's state follows its jobs as they progress. Actions not allowed by the
+current state, such as starting a guest while it is being deleted, are rejected
+with `HTTP/1.1 400 Bad Request`. The state can not be changed by updating the
+guest.
+
+A guest's hostname, ssh_keys and user_data are served to it by cmetadatad. The
+user data may be at most 64KB, and is set through its own endpoint as it is
+often not JSON.
+
+Deleting a guest stops it and moves it to the deleted state, keeping its
+addresses and resources. Its purge_at is when the delete retention, read from
+the cluster config key deleteRetention, passes and cworkerd purges it for good.
+Until then it can be undeleted, which leaves it stopped.
+
+Requests may be scoped to a project with a header `X-Project-ID`. A scoped
+request only lists and finds the project's guests, other guests, including
+those without a project, being not found, and a guest created by it belongs to
+the project. A guest stays in the project it was created in. The networks and
+firewall groups it uses may still be shared ones.
+
+A project's quota limits its guests, their memory, cpus and disk, and the
+addresses they take on each network, with a limit of zero being unlimited.
+Creating, updating or resizing a guest beyond its project's quota is rejected
+with `HTTP/1.1 403 Forbidden` and a body naming the exceeded dimension, such as
+{"message": "...", "dimension": "memory", "limit": 4096, "requested": 4224}.
+Address limits are by network id, and their dimension is addresses:<network id>.
+A quota can only be set by requests not scoped to a project.
+
+Every change made through the API is recorded in the audit log, attributed to
+the actor named by the X-Actor header, the request's source address, and the
+request id in the X-Request-ID header. A request without an id is given one,
+and the id is returned in the response's X-Request-ID header. The audit log is
+queried through chypervisord.
+
+A guest has an ordered list of network interfaces, each on its own network.
+When creating a guest, an interface's subnet and/or ip may be included to
+request a specific subnet or address within its network. The request is
+rejected if it can not be satisfied, such as the address already being taken.
+For compatibility, a guest with a single interface may also be created with the
+interface fields (network, subnet, mac, etc.) at the top level.
+
+A running or stopped guest may be migrated to another hypervisor. The body may
+name the target, as {"hypervisor": "<id>"}; otherwise one is selected the same
+way new guests are placed. The guest keeps its address on any interface whose
+subnet the target also bridges. While the migration is pending, the guest's
+migration field holds the target and the interfaces it will have there, and the
+migration can not be changed by updating the guest.
+
+A placed guest is given another flavor by resizing it, with a body of
+{"flavor": "<id>"}; updating the flavor of a placed guest has no effect. Memory
+and cpus may grow or shrink, but the disk may only grow. If the guest's
+hypervisor does not have room for it at the new size, the job returned migrates
+it to one that does, after which a resize job is queued. The guest keeps its
+flavor until the agent confirms the resize.
+
+A placed, running or stopped guest may be snapshotted. The body may name the
+snapshot and give it metadata, as {"name": "<name>", "metadata": {...}}. The
+snapshot is pending until the agent has taken it, and only then may it be
+deleted or rolled back to. A guest can only be rolled back while it has the
+flavor it had when the snapshot was taken. Setting a guest's snapshot_limit
+keeps only that many of its most recent snapshots, deleting the oldest as new
+ones are taken. A guest with snapshots can not be migrated.
+
+A volume is an additional disk that lives in a hypervisor's pool and is
+attached to at most one guest at a time. Attached volumes follow the flavor disk
+in the order they were attached. A volume created without a hypervisor joins
+the pool of the first guest it is attached to once that guest is placed, and
+outlives the guests it is attached to.
+
 Example Structs
 
 Guest - lochness.Guest
@@ -42,12 +145,34 @@ Guest - lochness.Guest
 		"type": "",
 		"flavor": "fe6de923-7230-416e-89d7-374b4b7b9362",
 		"hypervisor": "e88a75a6-7ae6-487c-9634-6553d3793437",
-		"network": "ac258bc2-4fc4-4713-a6fd-fc1afb65cd32",
-		"subnet": "c6430cba-648a-41aa-aee4-b59dacfc790d",
-		"fwgroup": "ecf5f19a-83e3-4dff-8f03-871d0d13ae65",
-		"mac": "01:23:45:67:89:ac",
-		"ip": "10.10.10.28",
-		"bridge": "br0"
+		"interfaces": [
+			{
+				"network": "ac258bc2-4fc4-4713-a6fd-fc1afb65cd32",
+				"subnet": "c6430cba-648a-41aa-aee4-b59dacfc790d",
+				"fwgroup": "ecf5f19a-83e3-4dff-8f03-871d0d13ae65",
+				"vlangroup": "",
+				"mac": "01:23:45:67:89:ac",
+				"ip": "10.10.10.28",
+				"bridge": "br0"
+			}
+		],
+		"state": "running",
+		"state_history": [
+			{"from": "pending", "to": "scheduled", "reason": "placed on hypervisor e88a75a6-7ae6-487c-9634-6553d3793437", "time": "2015-09-01T12:00:00Z"},
+			{"from": "scheduled", "to": "provisioning", "reason": "fetching image", "time": "2015-09-01T12:00:01Z"},
+			{"from": "provisioning", "to": "running", "reason": "create", "time": "2015-09-01T12:01:30Z"}
+		]
+	}
+
+Volume - lochness.Volume
+
+	{
+		"id": "0b7e4b9a-1f0a-4c1e-9f9e-3c3f3f2f5d6a",
+		"metadata": {},
+		"size": 10240,
+		"hypervisor": "e88a75a6-7ae6-487c-9634-6553d3793437",
+		"guest": "f2011319-ad59-42fb-9bad-92e261f0651c",
+		"device": 1
 	}
 
 Example Requests
@@ -56,30 +181,30 @@ GET /guests
 
 	$ curl http://localhost:18000/guests
 
-	[{"id":"f2011319-ad59-42fb-9bad-92e261f0651c","metadata":{},"type":"","flavor":"fe6de923-7230-416e-89d7-374b4b7b9362","hypervisor":"e88a75a6-7ae6-487c-9634-6553d3793437","network":"ac258bc2-4fc4-4713-a6fd-fc1afb65cd32","subnet":"c6430cba-648a-41aa-aee4-b59dacfc790d","fwgroup":"ecf5f19a-83e3-4dff-8f03-871d0d13ae65","mac":"01:23:45:67:89:ac","ip":"10.10.10.28","bridge":"br0"},{"id":"ad762efc-3c23-402b-8e1f-a248a005efb9","metadata":{},"type":"","flavor":"1f5acce3-96b4-4ccb-865f-e6c44f68900d","hypervisor":"e88a75a6-7ae6-487c-9634-6553d3793437","network":"ac258bc2-4fc4-4713-a6fd-fc1afb65cd32","subnet":"c6430cba-648a-41aa-aee4-b59dacfc790d","fwgroup":"9b2342a9-c1c1-4410-9b25-5984485cd247","mac":"01:23:45:67:89:ab","ip":"10.10.10.231","bridge":"br0"}]
+	[{"id":"f2011319-ad59-42fb-9bad-92e261f0651c","metadata":{},"type":"","flavor":"fe6de923-7230-416e-89d7-374b4b7b9362","hypervisor":"e88a75a6-7ae6-487c-9634-6553d3793437","interfaces":[{"network":"ac258bc2-4fc4-4713-a6fd-fc1afb65cd32","subnet":"c6430cba-648a-41aa-aee4-b59dacfc790d","fwgroup":"ecf5f19a-83e3-4dff-8f03-871d0d13ae65","vlangroup":"","mac":"01:23:45:67:89:ac","ip":"10.10.10.28","bridge":"br0"}]},{"id":"ad762efc-3c23-402b-8e1f-a248a005efb9","metadata":{},"type":"","flavor":"1f5acce3-96b4-4ccb-865f-e6c44f68900d","hypervisor":"e88a75a6-7ae6-487c-9634-6553d3793437","interfaces":[{"network":"ac258bc2-4fc4-4713-a6fd-fc1afb65cd32","subnet":"c6430cba-648a-41aa-aee4-b59dacfc790d","fwgroup":"9b2342a9-c1c1-4410-9b25-5984485cd247","vlangroup":"","mac":"01:23:45:67:89:ab","ip":"10.10.10.231","bridge":"br0"}]}]
 
 POST /guests
 
-	$ curl -v -XPOST http://localhost:18000/guests --data-binary '{"bridge":"br0", "flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234", "ip":"10.100.101.66", "mac":"A4-75-C1-6B-E3-49", "network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}'
+	$ curl -v -XPOST http://localhost:18000/guests --data-binary '{"flavor":"1","type":"foo","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"A4-75-C1-6B-E3-49","ip":"10.100.101.66","bridge":"br0"}]}'
 
 	...
 	< HTTP/1.1 202 Accepted
 	< X-Guest-Job-Id: 332a128a-ab00-49eb-aef6-8f12e15afe0c
 	...
 
-	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{},"type":"foo","flavor":"1","hypervisor":"","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}
+	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{},"type":"foo","flavor":"1","hypervisor":"","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}]}
 
 GET /guests/{guestID}
 
 	$ curl http://localhost:18000/guests/94ea0ba1-5ec2-460e-9c2e-8269593cdad3
 
-	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{},"type":"foo","flavor":"1","hypervisor":"","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}
+	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{},"type":"foo","flavor":"1","hypervisor":"","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}]}
 
 PATCH /guests/{guestID}
 
 	$ curl -X PATCH http://localhost:18000/guests/94ea0ba1-5ec2-460e-9c2e-8269593cdad3 --data-binary '{"metadata":{"foo":"bar"}}'
 
-	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{"foo":"bar"},"type":"foo","flavor":"1","hypervisor":"","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}
+	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{"foo":"bar"},"type":"foo","flavor":"1","hypervisor":"","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}]}
 
 DELETE /guests/{guestID}
 
@@ -90,7 +215,7 @@ DELETE /guests/{guestID}
 	< X-Guest-Job-Id: 332a128a-ab00-49eb-aef6-8f12e15afe0c
 	...
 
-	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{"foo":"bar"},"type":"foo","flavor":"1","hypervisor":"","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}
+	{"id":"94ea0ba1-5ec2-460e-9c2e-8269593cdad3","metadata":{"foo":"bar"},"type":"foo","flavor":"1","hypervisor":"","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}]}
 
 POST /guests/{guestID}/{action}
 
@@ -101,7 +226,28 @@ POST /guests/{guestID}/{action}
 	< X-Guest-Job-Id: a01ab1f7-2553-4d88-a8b0-887c7bf57ddd
 	...
 
-	{"id":"5f5538a9-c712-4dde-83d6-abdeebece444","metadata":{},"type":"foo","flavor":"1","hypervisor":"","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}
+	{"id":"5f5538a9-c712-4dde-83d6-abdeebece444","metadata":{},"type":"foo","flavor":"1","hypervisor":"","interfaces":[{"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":"","mac":"a4:75:c1:6b:e3:49","ip":"10.100.101.66","bridge":"br0"}]}
+
+POST /guests/{guestID}/volumes/{volumeID}
+
+	$ curl -v -XPOST http://localhost:18000/guests/5f5538a9-c712-4dde-83d6-abdeebece444/volumes/0b7e4b9a-1f0a-4c1e-9f9e-3c3f3f2f5d6a
+
+	...
+	< HTTP/1.1 202 Accepted
+	< X-Guest-Job-Id: 4c8e5cf4-6f4b-4d0e-a0b4-3c2b1a8f77e2
+	...
+
+	{"id":"0b7e4b9a-1f0a-4c1e-9f9e-3c3f3f2f5d6a","metadata":{},"size":10240,"hypervisor":"e88a75a6-7ae6-487c-9634-6553d3793437","guest":"5f5538a9-c712-4dde-83d6-abdeebece444","device":1}
+
+POST /volumes
+
+	$ curl -v -XPOST http://localhost:18000/volumes --data-binary '{"size":10240}'
+
+	...
+	< HTTP/1.1 201 Created
+	...
+
+	{"id":"0b7e4b9a-1f0a-4c1e-9f9e-3c3f3f2f5d6a","metadata":{},"size":10240,"hypervisor":"","guest":"","device":0}
 
 GET /jobs/{jobID}
 
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
@@ -25,6 +29,9 @@ func RegisterGuestRoutes(prefix string, router *mux.Router, m *metricsContext) {
 	sub.Handle("/{guestID}", guestMiddleware.Append(m.mmw.HandlerWrapper("get")).ThenFunc(GetGuest)).Methods("GET")
 	sub.Handle("/{guestID}", guestMiddleware.Append(m.mmw.HandlerWrapper("update")).ThenFunc(UpdateGuest)).Methods("PATCH")
 	sub.Handle("/{guestID}", guestMiddleware.Append(m.mmw.HandlerWrapper("destroy")).ThenFunc(DestroyGuest)).Methods("DELETE")
+	sub.Handle("/{guestID}/user-data", guestMiddleware.Append(m.mmw.HandlerWrapper("user-data-get")).ThenFunc(GetGuestUserData)).Methods("GET")
+	sub.Handle("/{guestID}/user-data", guestMiddleware.Append(m.mmw.HandlerWrapper("user-data-set")).ThenFunc(SetGuestUserData)).Methods("PUT")
+	sub.Handle("/{guestID}/undelete", guestMiddleware.Append(m.mmw.HandlerWrapper("undelete")).ThenFunc(UndeleteGuest)).Methods("POST")
 	// Limit actions and have specific action metrics while sharing a handler
 	for _, action := range []string{"shutdown", "reboot", "restart", "poweroff", "start", "suspend"} {
 		sub.Handle(fmt.Sprintf("/{guestID}/{action:%s}", action),
@@ -33,21 +40,62 @@ func RegisterGuestRoutes(prefix string, router *mux.Router, m *metricsContext) {
 				ThenFunc(GuestAction),
 		).Methods("POST")
 	}
+
+	sub.Handle("/{guestID}/migrate", guestMiddleware.Append(m.mmw.HandlerWrapper("migrate")).ThenFunc(MigrateGuest)).Methods("POST")
+	sub.Handle("/{guestID}/resize", guestMiddleware.Append(m.mmw.HandlerWrapper("resize")).ThenFunc(ResizeGuest)).Methods("POST")
+
+	sub.Handle("/{guestID}/snapshots", guestMiddleware.Append(m.mmw.HandlerWrapper("snapshot-list")).ThenFunc(ListGuestSnapshots)).Methods("GET")
+	sub.Handle("/{guestID}/snapshots", guestMiddleware.Append(m.mmw.HandlerWrapper("snapshot")).ThenFunc(CreateGuestSnapshot)).Methods("POST")
+	guestSnapshotMiddleware := guestMiddleware.Append(loadSnapshot)
+	sub.Handle("/{guestID}/snapshots/{snapshotID}", guestSnapshotMiddleware.Append(m.mmw.HandlerWrapper("snapshot-get")).ThenFunc(GetGuestSnapshot)).Methods("GET")
+	sub.Handle("/{guestID}/snapshots/{snapshotID}", guestSnapshotMiddleware.Append(m.mmw.HandlerWrapper("delete-snapshot")).ThenFunc(DeleteGuestSnapshot)).Methods("DELETE")
+	sub.Handle("/{guestID}/snapshots/{snapshotID}/rollback", guestSnapshotMiddleware.Append(m.mmw.HandlerWrapper("rollback")).ThenFunc(RollbackGuestSnapshot)).Methods("POST")
+
+	guestVolumeMiddleware := guestMiddleware.Append(loadVolume)
+	sub.Handle("/{guestID}/volumes/{volumeID}", guestVolumeMiddleware.Append(m.mmw.HandlerWrapper("attach-volume")).ThenFunc(AttachGuestVolume)).Methods("POST")
+	sub.Handle("/{guestID}/volumes/{volumeID}", guestVolumeMiddleware.Append(m.mmw.HandlerWrapper("detach-volume")).ThenFunc(DetachGuestVolume)).Methods("DELETE")
 }
 
-// ListGuests gets a list of all guests
+// ListGuests gets a list of all guests, optionally filtered by a label
+// selector and a comma separated list of states. Requests scoped to a project
+// only list its guests and shared ones
 func ListGuests(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	ctx := GetContext(r)
-	guests := make(lochness.Guests, 0)
-	err := ctx.ForEachGuest(func(g *lochness.Guest) error {
-		guests = append(guests, g)
-		return nil
-	})
+
+	selector, err := lochness.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	states := make(map[string]bool)
+	if query := r.URL.Query().Get("state"); query != "" {
+		for _, state := range strings.Split(query, ",") {
+			if !lochness.ValidGuestState(state) {
+				hr.JSONMsg(http.StatusBadRequest, fmt.Sprintf("invalid state %s", state))
+				return
+			}
+			states[state] = true
+		}
+	}
+
+	selected, err := ctx.SelectGuests(selector)
 	if err != nil {
 		hr.JSONError(http.StatusInternalServerError, err)
 		return
 	}
+
+	project := requestProject(r)
+	guests := make(lochness.Guests, 0, len(selected))
+	for _, g := range selected {
+		if !lochness.OwnedByProject(project, g.ProjectID) {
+			continue
+		}
+		if len(states) == 0 || states[g.State] {
+			guests = append(guests, g)
+		}
+	}
 	hr.JSON(http.StatusOK, guests)
 }
 
@@ -61,10 +109,38 @@ func CreateGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Hypervisor will be selected automatically
+	if !projectHelper(hr, r, guest) {
+		return
+	}
+
+	// Hypervisor and bridges will be selected automatically
 	guest.HypervisorID = ""
+	guest.State = lochness.GuestStatePending
+	guest.StateHistory = nil
+	for _, iface := range guest.Interfaces {
+		if iface == nil {
+			continue
+		}
+		iface.Bridge = ""
 
+		// A requested subnet or ip must be satisfiable
+		if iface.SubnetID != "" || iface.IP != nil {
+			if _, err := guest.SuitableSubnets(iface); err != nil {
+				hr.JSONMsg(http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	if err := guest.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !quotaHelper(hr, guest.ChargeQuota()) {
+		return
+	}
 	if !saveGuestHelper(hr, guest) {
+		_ = guest.ReleaseQuota()
 		return
 	}
 
@@ -81,6 +157,8 @@ func GetGuest(w http.ResponseWriter, r *http.Request) {
 func UpdateGuest(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	guest := GetRequestGuest(r)
+	state, stateHistory, migration, purgeAt := guest.State, guest.StateHistory, guest.Migration, guest.PurgeAt
+	flavorID, projectID := guest.FlavorID, guest.ProjectID
 
 	_, err := decodeGuest(r, guest)
 	if err != nil {
@@ -88,18 +166,106 @@ func UpdateGuest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// State, migrations and purging only change as jobs progress
+	guest.State, guest.StateHistory, guest.Migration, guest.PurgeAt = state, stateHistory, migration, purgeAt
+	// Guests stay in the project they were created in
+	guest.ProjectID = projectID
+	// A placed guest only changes flavor by being resized
+	if guest.HypervisorID != "" {
+		guest.FlavorID = flavorID
+	}
+
+	if err := guest.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	// Interfaces and the flavor of a pending guest count toward its quota
+	if !quotaHelper(hr, guest.ChargeQuota()) {
+		return
+	}
 	if !saveGuestHelper(hr, guest) {
+		// charge the guest as it is still saved
+		if saved, err := GetContext(r).Guest(guest.ID); err == nil {
+			_ = saved.ChargeQuota()
+		}
 		return
 	}
 	hr.JSON(http.StatusOK, guest)
 }
 
-// DestroyGuest removes a guest and frees its IP
+// DestroyGuest queues a job stopping a guest and moving it to the deleted
+// state. It keeps its IP and resources until it is purged once the delete
+// retention passes. If the job can not be queued the guest is marked failed,
+// so it can be deleted again.
 func DestroyGuest(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	guest := GetRequestGuest(r)
 
-	guestNewJobHelper(hr, r, guest, "delete")
+	if err := guest.CanPerform("delete"); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := guest.SetState(lochness.GuestStateDeleting, "delete requested"); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if !saveGuestHelper(hr, guest) {
+		return
+	}
+
+	job, err := GetJobQueue(r).AddJob(guest.ID, "delete")
+	if err != nil {
+		// a failed guest can be deleted again
+		_ = guest.UpdateState(lochness.GuestStateFailed, fmt.Sprintf("delete failed: %s", err))
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Header().Set("X-Guest-Job-ID", job.ID)
+	hr.JSON(http.StatusAccepted, guest)
+}
+
+// GetGuestUserData gets the raw user data of a guest
+func GetGuestUserData(w http.ResponseWriter, r *http.Request) {
+	guest := GetRequestGuest(r)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, guest.UserData)
+}
+
+// SetGuestUserData replaces the user data of a guest with the raw request
+// body. An empty body removes it.
+func SetGuestUserData(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+
+	// one byte more than allowed is enough for validation to reject it
+	userData, err := ioutil.ReadAll(io.LimitReader(r.Body, lochness.MaxUserDataSize+1))
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	guest.UserData = string(userData)
+	if !saveGuestHelper(hr, guest) {
+		return
+	}
+	hr.JSON(http.StatusOK, guest)
+}
+
+// UndeleteGuest restores a deleted guest that has not been purged yet. It is
+// left stopped.
+func UndeleteGuest(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+
+	if guest.State != lochness.GuestStateDeleted {
+		hr.JSONMsg(http.StatusBadRequest, fmt.Sprintf("guest can not undelete while %s", guest.State))
+		return
+	}
+	if err := guest.Undelete(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, guest)
 }
 
 // GuestAction handles all of the generic guest actions
@@ -109,5 +275,112 @@ func GuestAction(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
 
+	if err := guest.CanPerform(vars["action"]); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	guestNewJobHelper(hr, r, guest, vars["action"])
 }
+
+// MigrationRequest is the optional body of a guest migration request
+type MigrationRequest struct {
+	HypervisorID string `json:"hypervisor"` // target hypervisor. selected automatically if blank
+}
+
+// MigrateGuest queues a job moving a guest to another hypervisor
+func MigrateGuest(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	guest := GetRequestGuest(r)
+
+	var req MigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := guest.CanMigrate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	args := make(map[string]string)
+	if req.HypervisorID != "" {
+		hypervisor, err := ctx.Hypervisor(req.HypervisorID)
+		if err != nil {
+			hr.JSONMsg(http.StatusBadRequest, "hypervisor not found")
+			return
+		}
+		if hypervisor.ID == guest.HypervisorID {
+			hr.JSONMsg(http.StatusBadRequest, "guest is already on hypervisor")
+			return
+		}
+		args["target"] = hypervisor.ID
+	}
+
+	jobQueue := GetJobQueue(r)
+	job, err := jobQueue.AddJobWithArgs(guest.ID, "migrate", args)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Header().Set("X-Guest-Job-ID", job.ID)
+	hr.JSON(http.StatusAccepted, guest)
+}
+
+// ResizeRequest is the body of a guest resize request
+type ResizeRequest struct {
+	FlavorID string `json:"flavor"` // flavor to resize to
+}
+
+// ResizeGuest queues a job giving a guest a new flavor. A guest whose
+// hypervisor can not hold it at the new size is migrated first.
+func ResizeGuest(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	guest := GetRequestGuest(r)
+
+	var req ResizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.FlavorID == "" {
+		hr.JSONMsg(http.StatusBadRequest, "missing flavor")
+		return
+	}
+	if _, err := ctx.Flavor(req.FlavorID); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, "flavor not found")
+		return
+	}
+
+	if err := guest.CanResize(req.FlavorID); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !quotaHelper(hr, guest.ChargeResizeQuota(req.FlavorID)) {
+		return
+	}
+
+	action := "resize"
+	if err := guest.PrepareResize(req.FlavorID); err != nil {
+		if err != lochness.ErrInsufficientResources {
+			_ = guest.CancelResize()
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		// the guest is resized once it is on a hypervisor with room for it
+		action = "migrate"
+	}
+
+	jobQueue := GetJobQueue(r)
+	job, err := jobQueue.AddJobWithArgs(guest.ID, action, map[string]string{"flavor": req.FlavorID})
+	if err != nil {
+		_ = guest.CancelResize()
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Header().Set("X-Guest-Job-ID", job.ID)
+	hr.JSON(http.StatusAccepted, guest)
+}
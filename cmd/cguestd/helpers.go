@@ -10,7 +10,14 @@ import (
 	"github.com/pborman/uuid"
 )
 
-const guestKey = "guest"
+const (
+	guestKey    = "guest"
+	volumeKey   = "volume"
+	snapshotKey = "snapshot"
+
+	// projectHeader scopes a request to the guests of a project
+	projectHeader = "X-Project-ID"
+)
 
 // loadGuest is a middleware to load a guest into the request context and
 // handles sending a response in case of error
@@ -33,11 +40,125 @@ func loadGuest(h http.Handler) http.Handler {
 			hr.JSONError(http.StatusInternalServerError, err)
 			return
 		}
+		if !lochness.OwnedByProject(requestProject(r), guest.ProjectID) {
+			hr.JSONMsg(http.StatusNotFound, "guest not found")
+			return
+		}
 		SetRequestGuest(r, guest)
 		h.ServeHTTP(w, r)
 	})
 }
 
+// loadVolume is a middleware to load a volume into the request context and
+// handles sending a response in case of error
+func loadVolume(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hr := HTTPResponse{w}
+		ctx := GetContext(r)
+		vars := mux.Vars(r)
+		volumeID, ok := vars["volumeID"]
+		if !ok {
+			hr.JSONMsg(http.StatusBadRequest, "missing volume id")
+			return
+		}
+		if uuid.Parse(volumeID) == nil {
+			hr.JSONMsg(http.StatusBadRequest, "invalid volume id")
+			return
+		}
+		volume, err := ctx.Volume(volumeID)
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		SetRequestVolume(r, volume)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// loadSnapshot is a middleware to load a snapshot of the request guest into the
+// request context and handles sending a response in case of error
+func loadSnapshot(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hr := HTTPResponse{w}
+		ctx := GetContext(r)
+		vars := mux.Vars(r)
+		snapshotID, ok := vars["snapshotID"]
+		if !ok {
+			hr.JSONMsg(http.StatusBadRequest, "missing snapshot id")
+			return
+		}
+		if uuid.Parse(snapshotID) == nil {
+			hr.JSONMsg(http.StatusBadRequest, "invalid snapshot id")
+			return
+		}
+		snapshot, err := ctx.Snapshot(snapshotID)
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		if snapshot.GuestID != GetRequestGuest(r).ID {
+			hr.JSONMsg(http.StatusNotFound, "snapshot not found")
+			return
+		}
+		SetRequestSnapshot(r, snapshot)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestProject returns the project the request is scoped to, if any
+func requestProject(r *http.Request) string {
+	return r.Header.Get(projectHeader)
+}
+
+// projectHelper sets the project of a new guest from the request and ensures
+// it exists. It handles sending a response in case of error
+func projectHelper(hr HTTPResponse, r *http.Request, guest *lochness.Guest) bool {
+	if project := requestProject(r); project != "" {
+		if guest.ProjectID != "" && guest.ProjectID != project {
+			hr.JSONMsg(http.StatusBadRequest, "guest belongs to another project")
+			return false
+		}
+		guest.ProjectID = project
+	}
+	if guest.ProjectID == "" {
+		return true
+	}
+	if uuid.Parse(guest.ProjectID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid project")
+		return false
+	}
+
+	ctx := GetContext(r)
+	if _, err := ctx.Project(guest.ProjectID); err != nil {
+		if ctx.IsKeyNotFound(err) {
+			hr.JSONMsg(http.StatusBadRequest, "project not found")
+		} else {
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return false
+	}
+	return true
+}
+
+// quotaHelper handles sending a response in case charging a quota failed. A
+// request exceeding a quota is forbidden.
+func quotaHelper(hr HTTPResponse, err error) bool {
+	if err == nil {
+		return true
+	}
+	if e, ok := err.(lochness.ErrorQuotaExceeded); ok {
+		hr.JSON(http.StatusForbidden, QuotaExceededResponse{
+			Message:   e.Error(),
+			Dimension: e.Dimension,
+			Limit:     e.Limit,
+			Requested: e.Requested,
+		})
+		return false
+	}
+	hr.JSONError(http.StatusInternalServerError, err)
+	return false
+}
+
 // saveGuestHelper saves the guest object and handles sending a response in case
 // of error
 func saveGuestHelper(hr HTTPResponse, guest *lochness.Guest) bool {
@@ -67,6 +188,34 @@ func decodeGuest(r *http.Request, guest *lochness.Guest) (*lochness.Guest, error
 
 }
 
+// saveVolumeHelper saves the volume object and handles sending a response in
+// case of error
+func saveVolumeHelper(hr HTTPResponse, volume *lochness.Volume) bool {
+	if err := volume.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := volume.Save(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// decodeVolume decodes request body JSON into a volume object
+func decodeVolume(r *http.Request, volume *lochness.Volume) (*lochness.Volume, error) {
+	if volume == nil {
+		ctx := GetContext(r)
+		volume = ctx.NewVolume()
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(volume); err != nil {
+		return nil, err
+	}
+	return volume, nil
+}
+
 // guestNewJobHelper creates a new job for a guest action and handles sending a
 // response
 func guestNewJobHelper(hr HTTPResponse, r *http.Request, guest *lochness.Guest, action string) {
@@ -80,6 +229,32 @@ func guestNewJobHelper(hr HTTPResponse, r *http.Request, guest *lochness.Guest,
 	hr.JSON(http.StatusAccepted, guest)
 }
 
+// volumeJobHelper creates a new job for a guest volume action and handles
+// sending a response
+func volumeJobHelper(hr HTTPResponse, r *http.Request, guest *lochness.Guest, volume *lochness.Volume, action string) {
+	jobQueue := GetJobQueue(r)
+	job, err := jobQueue.AddJobWithArgs(guest.ID, action, map[string]string{"volume": volume.ID})
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Header().Set("X-Guest-Job-ID", job.ID)
+	hr.JSON(http.StatusAccepted, volume)
+}
+
+// snapshotJobHelper creates a new job for a guest snapshot action and handles
+// sending a response
+func snapshotJobHelper(hr HTTPResponse, r *http.Request, guest *lochness.Guest, snapshot *lochness.Snapshot, action string) {
+	jobQueue := GetJobQueue(r)
+	job, err := jobQueue.AddJobWithArgs(guest.ID, action, map[string]string{"snapshot": snapshot.ID})
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.Header().Set("X-Guest-Job-ID", job.ID)
+	hr.JSON(http.StatusAccepted, snapshot)
+}
+
 // SetRequestGuest saves the guest to the request context
 func SetRequestGuest(r *http.Request, g *lochness.Guest) {
 	context.Set(r, guestKey, g)
@@ -89,3 +264,23 @@ func SetRequestGuest(r *http.Request, g *lochness.Guest) {
 func GetRequestGuest(r *http.Request) *lochness.Guest {
 	return context.Get(r, guestKey).(*lochness.Guest)
 }
+
+// SetRequestVolume saves the volume to the request context
+func SetRequestVolume(r *http.Request, v *lochness.Volume) {
+	context.Set(r, volumeKey, v)
+}
+
+// GetRequestVolume retrieves the volume from the request context
+func GetRequestVolume(r *http.Request) *lochness.Volume {
+	return context.Get(r, volumeKey).(*lochness.Volume)
+}
+
+// SetRequestSnapshot saves the snapshot to the request context
+func SetRequestSnapshot(r *http.Request, s *lochness.Snapshot) {
+	context.Set(r, snapshotKey, s)
+}
+
+// GetRequestSnapshot retrieves the snapshot from the request context
+func GetRequestSnapshot(r *http.Request) *lochness.Snapshot {
+	return context.Get(r, snapshotKey).(*lochness.Snapshot)
+}
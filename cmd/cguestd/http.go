@@ -60,7 +60,10 @@ func Run(port uint, ctx *lochness.Context, jobQueue *jobqueue.Client, m *metrics
 		},
 		func(h http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				context.Set(r, ctxKey, ctx)
+				// changes made by the request are audited
+				source := lochness.RequestAuditSource(r)
+				w.Header().Set(lochness.AuditRequestIDHeader, source.RequestID)
+				context.Set(r, ctxKey, ctx.WithAudit(source))
 				context.Set(r, jQKey, jobQueue)
 				h.ServeHTTP(w, r)
 			})
@@ -73,7 +76,9 @@ func Run(port uint, ctx *lochness.Context, jobQueue *jobqueue.Client, m *metrics
 	// the main router before setting subhandlers on either main or subrouter
 
 	RegisterGuestRoutes("/guests", router, m)
+	RegisterVolumeRoutes("/volumes", router, m)
 	RegisterJobRoutes("/jobs", router, m)
+	RegisterQuotaRoutes("/quotas", router, m)
 
 	router.HandleFunc("/metrics",
 		func(w http.ResponseWriter, r *http.Request) {
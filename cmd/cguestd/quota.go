@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/lochness"
+	"github.com/pborman/uuid"
+)
+
+// QuotaExceededResponse is the body of a request forbidden by a quota
+type QuotaExceededResponse struct {
+	Message   string `json:"message"`
+	Dimension string `json:"dimension"`
+	Limit     uint64 `json:"limit"`
+	Requested uint64 `json:"requested"`
+}
+
+// RegisterQuotaRoutes registers the quota routes and handlers
+func RegisterQuotaRoutes(prefix string, router *mux.Router, m *metricsContext) {
+	// TODO: Figure out a cleaner way to do middleware on the subrouter
+	sub := router.PathPrefix(prefix).Subrouter()
+
+	sub.Handle("/{projectID}", m.mmw.HandlerFunc(GetQuota, "quota-get")).Methods("GET")
+	sub.Handle("/{projectID}", m.mmw.HandlerFunc(SetQuota, "quota-set")).Methods("PUT")
+}
+
+// GetQuota reports the limits and usage of a project's quota
+func GetQuota(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	projectID := mux.Vars(r)["projectID"]
+	if uuid.Parse(projectID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid project id")
+		return
+	}
+	if !lochness.InProject(requestProject(r), projectID) {
+		hr.JSONMsg(http.StatusNotFound, "quota not found")
+		return
+	}
+
+	quota, err := ctx.Quota(projectID)
+	if err != nil {
+		if ctx.IsKeyNotFound(err) {
+			hr.JSONMsg(http.StatusNotFound, "quota not found")
+		} else {
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	hr.JSON(http.StatusOK, quota)
+}
+
+// SetQuota sets the limits of a project's quota, creating it if needed. Usage
+// is kept, and a new quota is charged for the project's existing guests.
+// Projects can not set their own quota.
+func SetQuota(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	projectID := mux.Vars(r)["projectID"]
+	if uuid.Parse(projectID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid project id")
+		return
+	}
+	if requestProject(r) != "" {
+		hr.JSONMsg(http.StatusForbidden, "quotas can not be set by projects")
+		return
+	}
+	if _, err := ctx.Project(projectID); err != nil {
+		if ctx.IsKeyNotFound(err) {
+			hr.JSONMsg(http.StatusNotFound, "project not found")
+		} else {
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	var limits lochness.QuotaResources
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	quota, err := ctx.Quota(projectID)
+	if err != nil && !ctx.IsKeyNotFound(err) {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	created := quota == nil
+	if created {
+		quota = ctx.NewQuota(projectID)
+		if err := quota.ChargeGuests(); err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	quota.Limits = limits
+	if err := quota.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	if created {
+		err = quota.Save()
+	} else {
+		err = quota.SetLimits(limits)
+	}
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, quota)
+}
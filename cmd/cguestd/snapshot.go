@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/mistifyio/lochness"
+)
+
+// SnapshotRequest is the optional body of a guest snapshot request
+type SnapshotRequest struct {
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ListGuestSnapshots gets a list of a guest's snapshots, oldest first
+func ListGuestSnapshots(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+
+	snapshots, err := guest.Snapshots()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, snapshots)
+}
+
+// CreateGuestSnapshot queues a job snapshotting a guest's disks
+func CreateGuestSnapshot(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+
+	var req SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := guest.CanSnapshot(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	snapshot, err := guest.NewSnapshot(req.Name)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	if req.Metadata != nil {
+		snapshot.Metadata = req.Metadata
+		if err := snapshot.Save(); err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	snapshotJobHelper(hr, r, guest, snapshot, "snapshot")
+}
+
+// GetGuestSnapshot gets a particular snapshot of a guest
+func GetGuestSnapshot(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hr.JSON(http.StatusOK, GetRequestSnapshot(r))
+}
+
+// DeleteGuestSnapshot queues a job deleting a guest snapshot
+func DeleteGuestSnapshot(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+	snapshot := GetRequestSnapshot(r)
+
+	if snapshot.Status != lochness.SnapshotStatusCreated {
+		hr.JSONMsg(http.StatusBadRequest, "snapshot is "+snapshot.Status)
+		return
+	}
+	if err := snapshot.SetDeleting(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	snapshotJobHelper(hr, r, guest, snapshot, "delete-snapshot")
+}
+
+// RollbackGuestSnapshot queues a job restoring a guest's disks to a snapshot
+func RollbackGuestSnapshot(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+	snapshot := GetRequestSnapshot(r)
+
+	if err := snapshot.CanRollback(guest); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	snapshotJobHelper(hr, r, guest, snapshot, "rollback")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/mistifyio/lochness"
+)
+
+// RegisterVolumeRoutes registers the volume routes and handlers
+func RegisterVolumeRoutes(prefix string, router *mux.Router, m *metricsContext) {
+	volumeMiddleware := alice.New(
+		loadVolume,
+	)
+
+	router.Handle(prefix, m.mmw.HandlerFunc(ListVolumes, "volume-list")).Methods("GET")
+	router.Handle(prefix, m.mmw.HandlerFunc(CreateVolume, "volume-create")).Methods("POST")
+
+	// TODO: Figure out a cleaner way to do middleware on the subrouter
+	sub := router.PathPrefix(prefix).Subrouter()
+
+	sub.Handle("/{volumeID}", volumeMiddleware.Append(m.mmw.HandlerWrapper("volume-get")).ThenFunc(GetVolume)).Methods("GET")
+	sub.Handle("/{volumeID}", volumeMiddleware.Append(m.mmw.HandlerWrapper("volume-update")).ThenFunc(UpdateVolume)).Methods("PATCH")
+	sub.Handle("/{volumeID}", volumeMiddleware.Append(m.mmw.HandlerWrapper("volume-destroy")).ThenFunc(DestroyVolume)).Methods("DELETE")
+}
+
+// ListVolumes gets a list of all volumes
+func ListVolumes(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	volumes := make(lochness.Volumes, 0)
+	err := ctx.ForEachVolume(func(v *lochness.Volume) error {
+		volumes = append(volumes, v)
+		return nil
+	})
+	if err != nil && !ctx.IsKeyNotFound(err) {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, volumes)
+}
+
+// CreateVolume creates a new volume
+func CreateVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+
+	volume, err := decodeVolume(r, nil)
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Volumes are only attached through the guest routes
+	volume.GuestID = ""
+	volume.Device = 0
+
+	// A requested hypervisor pool must exist
+	if volume.HypervisorID != "" {
+		if _, err := ctx.Hypervisor(volume.HypervisorID); err != nil {
+			hr.JSONMsg(http.StatusBadRequest, "hypervisor not found")
+			return
+		}
+	}
+
+	if !saveVolumeHelper(hr, volume) {
+		return
+	}
+	hr.JSON(http.StatusCreated, volume)
+}
+
+// GetVolume gets a particular volume
+func GetVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hr.JSON(http.StatusOK, GetRequestVolume(r))
+}
+
+// UpdateVolume updates an existing volume. Only the metadata and, while the
+// volume is detached, the size may be changed.
+func UpdateVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	volume := GetRequestVolume(r)
+	orig := *volume
+
+	if _, err := decodeVolume(r, volume); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if volume.Size != orig.Size && orig.GuestID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "cannot resize an attached volume")
+		return
+	}
+	volume.ID = orig.ID
+	volume.HypervisorID = orig.HypervisorID
+	volume.GuestID = orig.GuestID
+	volume.Device = orig.Device
+
+	if !saveVolumeHelper(hr, volume) {
+		return
+	}
+	hr.JSON(http.StatusOK, volume)
+}
+
+// DestroyVolume removes a detached volume
+func DestroyVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	volume := GetRequestVolume(r)
+
+	if volume.GuestID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "volume is attached")
+		return
+	}
+
+	if err := volume.Destroy(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, volume)
+}
+
+// AttachGuestVolume attaches a volume to a guest. A placed guest has the disk
+// hot attached by a job; an unplaced guest simply gets the disk when created.
+func AttachGuestVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+	volume := GetRequestVolume(r)
+
+	if volume.GuestID != "" {
+		hr.JSONMsg(http.StatusBadRequest, "volume is already attached")
+		return
+	}
+
+	if err := volume.Attach(guest); err != nil {
+		if _, ok := err.(lochness.ErrorQuotaExceeded); ok {
+			quotaHelper(hr, err)
+			return
+		}
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if guest.HypervisorID == "" {
+		hr.JSON(http.StatusOK, volume)
+		return
+	}
+	volumeJobHelper(hr, r, guest, volume, "attach-volume")
+}
+
+// DetachGuestVolume detaches a volume from a guest. A placed guest has the disk
+// hot detached by a job, which finishes the detach on success.
+func DetachGuestVolume(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	guest := GetRequestGuest(r)
+	volume := GetRequestVolume(r)
+
+	if volume.GuestID != guest.ID {
+		hr.JSONMsg(http.StatusBadRequest, "volume is not attached to guest")
+		return
+	}
+
+	if guest.HypervisorID == "" {
+		if err := volume.Detach(); err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		hr.JSON(http.StatusOK, volume)
+		return
+	}
+	volumeJobHelper(hr, r, guest, volume, "detach-volume")
+}
@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os/exec"
 	"testing"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/kr/beanstalk"
 	"github.com/mistifyio/lochness"
 	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/mistifyio/lochness/pkg/jobqueue"
 	"github.com/stretchr/testify/suite"
 	"github.com/tylerb/graceful"
 )
@@ -20,10 +23,14 @@ func TestCHypervisordAPI(t *testing.T) {
 
 type APISuite struct {
 	common.Suite
-	Port       uint
-	APIServer  *graceful.Server
-	Hypervisor *lochness.Hypervisor
-	APIURL     string
+	Port           uint
+	BeanstalkdCmd  *exec.Cmd
+	BeanstalkdPath string
+	JobQueue       *jobqueue.Client
+	APIServer      *graceful.Server
+	Hypervisor     *lochness.Hypervisor
+	APIURL         string
+	ZonesURL       string
 }
 
 func (s *APISuite) SetupSuite() {
@@ -32,8 +39,28 @@ func (s *APISuite) SetupSuite() {
 	log.SetLevel(log.FatalLevel)
 	s.Port = 51123
 	s.APIURL = fmt.Sprintf("http://localhost:%d/hypervisors", s.Port)
+	s.ZonesURL = fmt.Sprintf("http://localhost:%d/zones", s.Port)
+
+	// Beanstalkd
+	port := "59873"
+	s.BeanstalkdPath = fmt.Sprintf("127.0.0.1:%s", port)
+	s.BeanstalkdCmd = exec.Command("beanstalkd", "-p", port)
+	s.Require().NoError(s.BeanstalkdCmd.Start())
+
+	beanstalkdReady := false
+	for i := 0; i < 10; i++ {
+		if _, err := beanstalk.Dial("tcp", s.BeanstalkdPath); err == nil {
+			beanstalkdReady = true
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	s.Require().True(beanstalkdReady)
+
+	// Jobqueue
+	s.JobQueue, _ = jobqueue.NewClient(s.BeanstalkdPath, s.KV)
 
-	s.APIServer = Run(s.Port, s.Context)
+	s.APIServer = Run(s.Port, s.Context, s.JobQueue)
 	time.Sleep(100 * time.Millisecond)
 }
 
@@ -48,6 +75,9 @@ func (s *APISuite) TearDownSuite() {
 	s.APIServer.Stop(5 * time.Second)
 	<-stopChan
 
+	_ = s.BeanstalkdCmd.Process.Kill()
+	_ = s.BeanstalkdCmd.Wait()
+
 	s.Suite.TearDownSuite()
 }
 
@@ -59,6 +89,24 @@ func (s *APISuite) TestHypervisorsList() {
 	s.Equal(s.Hypervisor.ID, hypervisors[0].ID)
 }
 
+func (s *APISuite) TestHypervisorsListSelector() {
+	labeled := s.NewHypervisor()
+	labeled.Metadata["rack"] = "a1"
+	s.Require().NoError(labeled.Save())
+
+	var hypervisors lochness.Hypervisors
+	s.DoRequest("GET", s.APIURL+"?selector=rack%3Da1", http.StatusOK, nil, &hypervisors)
+	s.Len(hypervisors, 1)
+	s.Equal(labeled.ID, hypervisors[0].ID)
+
+	s.DoRequest("GET", s.APIURL+"?selector=%21rack", http.StatusOK, nil, &hypervisors)
+	s.Len(hypervisors, 1)
+	s.Equal(s.Hypervisor.ID, hypervisors[0].ID)
+
+	var msg map[string]string
+	s.DoRequest("GET", s.APIURL+"?selector=rack%3D%28", http.StatusBadRequest, nil, &msg)
+}
+
 func (s *APISuite) TestHypervisorAdd() {
 	hypervisor := s.Context.NewHypervisor()
 	hypervisor.IP = net.ParseIP("192.168.100.12")
@@ -157,7 +205,7 @@ func (s *APISuite) TestHypervisorSubnetUpdate() {
 func (s *APISuite) TestHypervisorSubnetRemove() {
 	hypervisor, guest := s.NewHypervisorWithGuest()
 	var subnets map[string]string
-	s.DoRequest("DELETE", fmt.Sprintf("%s/%s/subnets/%s", s.APIURL, hypervisor.ID, guest.SubnetID), http.StatusOK, nil, &subnets)
+	s.DoRequest("DELETE", fmt.Sprintf("%s/%s/subnets/%s", s.APIURL, hypervisor.ID, guest.Interfaces[0].SubnetID), http.StatusOK, nil, &subnets)
 
 	s.Len(subnets, 0)
 
@@ -174,3 +222,210 @@ func (s *APISuite) TestHypervisorGuestList() {
 	s.Len(guests, 1)
 	s.Equal(guest.ID, guests[0])
 }
+
+func (s *APISuite) TestHypervisorTaints() {
+	taintsURL := fmt.Sprintf("%s/%s/taints", s.APIURL, s.Hypervisor.ID)
+	dedicated := lochness.Taint{Key: "dedicated", Value: "db", Effect: lochness.TaintNoSchedule}
+	nvme := lochness.Taint{Key: "nvme", Effect: lochness.TaintPreferNoSchedule}
+
+	var taints lochness.Taints
+	s.DoRequest("PATCH", taintsURL, http.StatusOK, lochness.Taints{dedicated, nvme}, &taints)
+	s.Equal(lochness.Taints{dedicated, nvme}, taints)
+
+	var msg map[string]string
+	s.DoRequest("PATCH", taintsURL, http.StatusBadRequest, lochness.Taints{{Key: "foo"}}, &msg)
+
+	// a taint with the same key and effect is replaced
+	dedicated.Value = "web"
+	s.DoRequest("PATCH", taintsURL, http.StatusOK, lochness.Taints{dedicated}, &taints)
+	s.Equal(lochness.Taints{nvme, dedicated}, taints)
+
+	s.DoRequest("GET", taintsURL, http.StatusOK, nil, &taints)
+	s.Equal(lochness.Taints{nvme, dedicated}, taints)
+
+	// taints are not changed by a hypervisor update
+	h, err := s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	h.Taints = nil
+	var hypervisorResp lochness.Hypervisor
+	s.DoRequest("PATCH", fmt.Sprintf("%s/%s", s.APIURL, h.ID), http.StatusOK, h, &hypervisorResp)
+	s.Len(hypervisorResp.Taints, 2)
+
+	s.DoRequest("DELETE", taintsURL+"/nvme", http.StatusOK, nil, &taints)
+	s.Equal(lochness.Taints{dedicated}, taints)
+	h, err = s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	s.Equal(lochness.Taints{dedicated}, h.Taints)
+}
+
+func (s *APISuite) TestHypervisorCordon() {
+	var hypervisorResp lochness.Hypervisor
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/cordon", s.APIURL, s.Hypervisor.ID), http.StatusOK, nil, &hypervisorResp)
+	s.True(hypervisorResp.Unschedulable)
+
+	// cordoning is not changed by a hypervisor update
+	h, err := s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	s.True(h.Unschedulable)
+	h.Unschedulable = false
+	hypervisorResp = lochness.Hypervisor{}
+	s.DoRequest("PATCH", fmt.Sprintf("%s/%s", s.APIURL, h.ID), http.StatusOK, h, &hypervisorResp)
+	s.True(hypervisorResp.Unschedulable)
+
+	hypervisorResp = lochness.Hypervisor{}
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/uncordon", s.APIURL, s.Hypervisor.ID), http.StatusOK, nil, &hypervisorResp)
+	s.False(hypervisorResp.Unschedulable)
+	h, err = s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	s.False(h.Unschedulable)
+}
+
+func (s *APISuite) TestHypervisorDrain() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	drainURL := fmt.Sprintf("%s/%s/drain", s.APIURL, hypervisor.ID)
+
+	var status DrainStatus
+	s.DoRequest("GET", drainURL, http.StatusOK, nil, &status)
+	s.False(status.Unschedulable)
+	s.Equal(1, status.Remaining)
+	s.Len(status.Guests, 0)
+
+	s.DoRequest("POST", drainURL, http.StatusAccepted, nil, &status)
+	s.True(status.Unschedulable)
+	s.Equal(1, status.Remaining)
+	s.Len(status.Blocked, 0)
+	s.Require().Len(status.Guests, 1)
+	guestStatus := status.Guests[guest.ID]
+	s.Require().NotNil(guestStatus)
+	s.Equal("migrate", guestStatus.Action)
+	s.Equal(jobqueue.JobStatusNew, guestStatus.Status)
+	s.Equal(hypervisor.ID, guestStatus.HypervisorID)
+	jobID := guestStatus.JobID
+
+	job, err := s.JobQueue.Job(jobID)
+	s.Require().NoError(err)
+	s.Empty(job.Args["hypervisor"], "cplacerd should pick the target")
+
+	// a guest already being moved is not queued again
+	status = DrainStatus{}
+	s.DoRequest("POST", drainURL, http.StatusAccepted, nil, &status)
+	s.Equal(jobID, status.Guests[guest.ID].JobID)
+
+	h, err := s.Context.Hypervisor(hypervisor.ID)
+	s.Require().NoError(err)
+	s.True(h.Unschedulable)
+	s.Equal(map[string]string{guest.ID: jobID}, h.DrainJobs())
+
+	// a failed migration is only followed by recreating the guest when asked
+	job.Status = jobqueue.JobStatusError
+	s.Require().NoError(job.Save(60 * time.Second))
+	status = DrainStatus{}
+	s.DoRequest("POST", drainURL, http.StatusAccepted, nil, &status)
+	s.Equal(jobID, status.Guests[guest.ID].JobID)
+	s.Contains(status.Blocked, guest.ID)
+
+	var msg map[string]string
+	s.DoRequest("POST", drainURL+"?recreate=asdf", http.StatusBadRequest, nil, &msg)
+
+	status = DrainStatus{}
+	s.DoRequest("POST", drainURL+"?recreate=true", http.StatusAccepted, nil, &status)
+	s.Len(status.Blocked, 0)
+	s.Require().Contains(status.Guests, guest.ID)
+	s.Equal("evacuate", status.Guests[guest.ID].Action)
+	s.NotEqual(jobID, status.Guests[guest.ID].JobID)
+
+	// guests with pooled volumes are never recreated
+	other, pooled := s.NewHypervisorWithGuest()
+	volume := s.NewVolume()
+	s.Require().NoError(volume.Attach(pooled))
+	status = DrainStatus{}
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/drain?recreate=true", s.APIURL, other.ID), http.StatusAccepted, nil, &status)
+	s.Len(status.Guests, 0)
+	s.Contains(status.Blocked, pooled.ID)
+}
+
+func (s *APISuite) TestZoneCRUD() {
+	zone := s.Context.NewZone()
+	zone.Name = "rack-a"
+
+	var zoneResp lochness.Zone
+	s.DoRequest("POST", s.ZonesURL, http.StatusCreated, zone, &zoneResp)
+	s.Equal(zone.ID, zoneResp.ID)
+
+	var msg map[string]string
+	s.DoRequest("POST", s.ZonesURL, http.StatusBadRequest, s.Context.NewZone(), &msg)
+
+	var zones lochness.Zones
+	s.DoRequest("GET", s.ZonesURL, http.StatusOK, nil, &zones)
+	s.Len(zones, 1)
+
+	zone.Name = "rack-b"
+	s.DoRequest("PATCH", fmt.Sprintf("%s/%s", s.ZonesURL, zone.ID), http.StatusOK, zone, &zoneResp)
+	s.Equal("rack-b", zoneResp.Name)
+
+	s.DoRequest("GET", fmt.Sprintf("%s/%s", s.ZonesURL, zone.ID), http.StatusOK, nil, &zoneResp)
+	s.Equal("rack-b", zoneResp.Name)
+
+	s.DoRequest("DELETE", fmt.Sprintf("%s/%s", s.ZonesURL, zone.ID), http.StatusOK, nil, &zoneResp)
+	s.DoRequest("GET", fmt.Sprintf("%s/%s", s.ZonesURL, zone.ID), http.StatusNotFound, nil, &msg)
+}
+
+func (s *APISuite) TestZoneHypervisors() {
+	zone := s.NewZone()
+	other := s.NewZone()
+	zoneURL := fmt.Sprintf("%s/%s", s.ZonesURL, zone.ID)
+
+	var hypervisors []string
+	s.DoRequest("POST", fmt.Sprintf("%s/hypervisors/%s", zoneURL, s.Hypervisor.ID), http.StatusOK, nil, &hypervisors)
+	s.Equal([]string{s.Hypervisor.ID}, hypervisors)
+
+	var msg map[string]string
+	s.DoRequest("POST", fmt.Sprintf("%s/%s/hypervisors/%s", s.ZonesURL, other.ID, s.Hypervisor.ID), http.StatusBadRequest, nil, &msg)
+	s.DoRequest("DELETE", zoneURL, http.StatusBadRequest, nil, &msg)
+
+	var capacity lochness.ZoneCapacity
+	s.DoRequest("GET", zoneURL+"/capacity", http.StatusOK, nil, &capacity)
+	s.Equal(1, capacity.Hypervisors)
+	s.Equal(s.Hypervisor.TotalResources, capacity.TotalResources)
+	s.Equal(s.Hypervisor.AvailableResources, capacity.AvailableResources)
+
+	// zone membership is not changed by a hypervisor update
+	h, err := s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	s.Equal(zone.ID, h.ZoneID)
+	h.ZoneID = other.ID
+	var hypervisorResp lochness.Hypervisor
+	s.DoRequest("PATCH", fmt.Sprintf("%s/%s", s.APIURL, h.ID), http.StatusOK, h, &hypervisorResp)
+	s.Equal(zone.ID, hypervisorResp.ZoneID)
+
+	s.DoRequest("DELETE", fmt.Sprintf("%s/hypervisors/%s", zoneURL, s.Hypervisor.ID), http.StatusOK, nil, &hypervisors)
+	s.Len(hypervisors, 0)
+	h, err = s.Context.Hypervisor(s.Hypervisor.ID)
+	s.Require().NoError(err)
+	s.Empty(h.ZoneID)
+}
+
+func (s *APISuite) TestAudit() {
+	auditURL := fmt.Sprintf("http://localhost:%d/audit", s.Port)
+	zone := s.Context.NewZone()
+	zone.Name = "rack-a"
+	var zoneResp lochness.Zone
+	s.DoRequest("POST", s.ZonesURL, http.StatusCreated, zone, &zoneResp)
+
+	var records lochness.AuditRecords
+	s.DoRequest("GET", auditURL+"?type=zone", http.StatusOK, nil, &records)
+	s.Require().Len(records, 1)
+	s.Equal(zone.ID, records[0].ObjectID)
+	s.Equal(lochness.AuditActionCreate, records[0].Action)
+	s.Equal("127.0.0.1", records[0].SourceIP)
+	s.NotEmpty(records[0].RequestID)
+
+	var record lochness.AuditRecord
+	s.DoRequest("GET", fmt.Sprintf("%s/%s", auditURL, records[0].ID), http.StatusOK, nil, &record)
+	s.Equal(records[0].ID, record.ID)
+
+	var msg map[string]string
+	s.DoRequest("GET", auditURL+"/asdf", http.StatusBadRequest, nil, &msg)
+	s.DoRequest("GET", auditURL+"/1-asdf", http.StatusNotFound, nil, &msg)
+	s.DoRequest("GET", auditURL+"?since=yesterday", http.StatusBadRequest, nil, &msg)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/lochness"
+)
+
+// RegisterAuditRoutes registers the audit routes and handlers
+func RegisterAuditRoutes(prefix string, router *mux.Router) {
+	router.HandleFunc(prefix, ListAuditRecords).Methods("GET")
+	sub := router.PathPrefix(prefix).Subrouter()
+	sub.HandleFunc("/{recordID}", GetAuditRecord).Methods("GET")
+}
+
+// ListAuditRecords gets a list of audit records, oldest first, optionally
+// filtered by the query parameters type, id, actor, request, since, until and
+// limit. Times are RFC3339.
+func ListAuditRecords(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	query := r.URL.Query()
+
+	filter := lochness.AuditFilter{
+		ObjectType: query.Get("type"),
+		ObjectID:   query.Get("id"),
+		Actor:      query.Get("actor"),
+		RequestID:  query.Get("request"),
+	}
+	for name, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			hr.JSONMsg(http.StatusBadRequest, "invalid "+name)
+			return
+		}
+		*t = parsed
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			hr.JSONMsg(http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	records, err := ctx.AuditRecords(filter)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, records)
+}
+
+// GetAuditRecord gets a particular audit record
+func GetAuditRecord(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	record, err := ctx.AuditRecord(mux.Vars(r)["recordID"])
+	if err != nil {
+		switch {
+		case err == lochness.ErrInvalidAuditRecordID:
+			hr.JSONMsg(http.StatusBadRequest, err.Error())
+		case ctx.IsKeyNotFound(err):
+			hr.JSONMsg(http.StatusNotFound, "record not found")
+		default:
+			hr.JSONError(http.StatusInternalServerError, err)
+		}
+		return
+	}
+	hr.JSON(http.StatusOK, record)
+}
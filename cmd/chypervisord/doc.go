@@ -8,6 +8,8 @@ The following arguments are understood:
 
 	$ chypervisord -h
 	Usage of chypervisord:
+	-a, --audit-retention=720h0m0s: how long audit records are kept, 0 to keep them forever
+	-b, --beanstalk="127.0.0.1:11300": address of beanstalkd server
 	-k, --kv="http://localhost:4001": address of kv machine
 	-l, --log-level="warn": log level
 	-p, --port=17000: listen port
@@ -15,7 +17,8 @@ The following arguments are understood:
 HTTP API Endpoints
 
 	/hypervisors
-		* GET  - Retrieve a list of hypervisors
+		* GET  - Retrieve a list of hypervisors, optionally filtered by the
+		         query parameter selector, a label selector on the metadata
 		* POST - Add a new hypervisor
 
 	/hypervisors/{hypervisorID}
@@ -37,6 +40,66 @@ HTTP API Endpoints
 	/hypervisors/{hypervisorID}/guests
 		* GET - Retrieve a list of guests running under the hypervisor
 
+	/hypervisors/{hypervisorID}/taints
+		* GET   - Retrieve a list of taints of the hypervisor
+		* PATCH - Add taints to the hypervisor, replacing those with the same
+		          key and effect
+
+	/hypervisors/{hypervisorID}/taints/{key}
+		* DELETE - Remove the taints with a key from a hypervisor
+
+	/hypervisors/{hypervisorID}/cordon
+		* POST - Stop placing new guests on the hypervisor
+
+	/hypervisors/{hypervisorID}/uncordon
+		* POST - Resume placing new guests on the hypervisor
+
+	/hypervisors/{hypervisorID}/drain
+		* GET  - Retrieve the progress of draining the hypervisor
+		* POST - Cordon the hypervisor and queue jobs migrating each of
+		         its guests to another hypervisor picked by cplacerd.
+		         Guests that can not be migrated, or whose migration
+		         failed, are recreated from scratch instead, losing their
+		         disks, so that is only done with the recreate=true query
+		         parameter, and never if they have volumes in the
+		         hypervisor's pool. Guests left behind are listed in
+		         "blocked" with the reason. Deleted guests are left until
+		         they are purged
+
+	/zones
+		* GET  - Retrieve a list of zones
+		* POST - Add a new zone
+
+	/zones/{zoneID}
+		* GET 	 - Retrieve information about a zone
+		* PATCH	 - Update a zone's information
+		* DELETE - Remove an empty zone
+
+	/zones/{zoneID}/capacity
+		* GET - Retrieve the combined resources of the zone's hypervisors
+
+	/zones/{zoneID}/hypervisors
+		* GET - Retrieve a list of hypervisors in the zone
+
+	/zones/{zoneID}/hypervisors/{hypervisorID}
+		* POST   - Add a hypervisor to the zone
+		* DELETE - Remove a hypervisor from the zone
+
+	/audit
+		* GET - Retrieve a list of audit records, oldest first, optionally
+		        filtered by the query parameters type, id (of the object),
+		        actor, request, since and until (RFC3339 times), and limit (the
+		        number of most recent records)
+
+	/audit/{recordID}
+		* GET - Retrieve an audit record
+
+Every change made through the API is recorded in the audit log, attributed to
+the actor named by the X-Actor header, the request's source address, and the
+request id in the X-Request-ID header. A request without an id is given one,
+and the id is returned in the response's X-Request-ID header. Records older
+than the audit retention are pruned hourly.
+
 Example Structs
 
 Hypervisor - lochness.Hypervisor
@@ -60,6 +123,63 @@ Hypervisor - lochness.Hypervisor
 		}
 	}
 
+Zone - lochness.Zone
+
+	{
+		"id": "c0ffee00-abcd-1234-abcd-1234abcd1234",
+		"name": "rack-a",
+		"metadata": {}
+	}
+
+AuditRecord - lochness.AuditRecord
+
+	{
+		"actor": "alice",
+		"source_ip": "10.100.101.10",
+		"request_id": "8f0c3f0e-abcd-1234-abcd-1234abcd1234",
+		"id": "1476784800000000000-2d4b0e5e-abcd-1234-abcd-1234abcd1234",
+		"time": "2016-10-18T10:00:00Z",
+		"object_type": "zone",
+		"object_id": "c0ffee00-abcd-1234-abcd-1234abcd1234",
+		"action": "update",
+		"diff": {
+			"name": {
+				"before": "rack-a",
+				"after": "rack-b"
+			}
+		}
+	}
+
+Taints - lochness.Taints
+
+	[
+		{
+			"key": "dedicated",
+			"value": "db",
+			"effect": "NoSchedule"
+		}
+	]
+
+DrainStatus - progress of a drain, keyed by guest id
+
+	{
+		"id": "abcd1234-abcd-1234-abcd-1234abcd1234",
+		"unschedulable": true,
+		"remaining": 1,
+		"guests": {
+			"94ea0ba1-5ec2-460e-9c2e-8269593cdad3": {
+				"job": "fbd0c7c2-5532-4abc-b6d8-c0cef0e8c1eb",
+				"action": "migrate",
+				"status": "working",
+				"hypervisor": "abcd1234-abcd-1234-abcd-1234abcd1234",
+				"state": "running"
+			}
+		},
+		"blocked": {
+			"5b4c4b3e-29b0-4a7e-a4a4-b4fbcbdf0b65": "guest has volumes in the hypervisor's pool"
+		}
+	}
+
 Config - map of string keys and string values
 
 	{
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/pkg/jobqueue"
+)
+
+type (
+	// DrainStatus is the progress of draining a hypervisor
+	DrainStatus struct {
+		ID            string                       `json:"id"`
+		Unschedulable bool                         `json:"unschedulable"`
+		Remaining     int                          `json:"remaining"`         // guests still on the hypervisor
+		Guests        map[string]*DrainGuestStatus `json:"guests"`            // keyed by guest id
+		Blocked       map[string]string            `json:"blocked,omitempty"` // reasons guests were left by a drain request, keyed by guest id
+	}
+
+	// DrainGuestStatus is the progress of moving a single guest off a
+	// drained hypervisor
+	DrainGuestStatus struct {
+		JobID        string `json:"job"`
+		Action       string `json:"action"`
+		Status       string `json:"status"`
+		Error        string `json:"error,omitempty"`
+		HypervisorID string `json:"hypervisor"` // the guest's current hypervisor
+		State        string `json:"state"`      // the guest's state. blank if it was deleted
+	}
+)
+
+// CordonHypervisor marks a hypervisor unschedulable
+func CordonHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := hypervisor.Cordon(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor)
+}
+
+// UncordonHypervisor marks a hypervisor schedulable
+func UncordonHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if err := hypervisor.Uncordon(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, hypervisor)
+}
+
+// DrainHypervisor cordons a hypervisor and queues jobs to migrate each of its
+// guests elsewhere. Guests that can not be migrated, or whose migration failed,
+// are recreated from scratch instead, losing their disks, so that is only done
+// when asked for with recreate=true, and never for guests with volumes in the
+// hypervisor's pool. Guests already being moved are left alone, so it may be
+// repeated to retry failed moves.
+func DrainHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	jobQueue := GetJobQueue(r)
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	var recreate bool
+	if query := r.URL.Query().Get("recreate"); query != "" {
+		var err error
+		if recreate, err = strconv.ParseBool(query); err != nil {
+			hr.JSONMsg(http.StatusBadRequest, "invalid recreate")
+			return
+		}
+	}
+
+	if err := hypervisor.Cordon(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	blocked := make(map[string]string)
+	drainJobs := hypervisor.DrainJobs()
+	for _, guestID := range hypervisor.Guests() {
+		var migrateFailed bool
+		if jobID, ok := drainJobs[guestID]; ok {
+			job, err := jobQueue.PeekJob(jobID)
+			if err != nil && !ctx.IsKeyNotFound(err) {
+				hr.JSONError(http.StatusInternalServerError, err)
+				return
+			}
+			if job != nil && (job.Status == jobqueue.JobStatusNew || job.Status == jobqueue.JobStatusWorking) {
+				continue
+			}
+			migrateFailed = job != nil && job.Action == "migrate" && job.Status == jobqueue.JobStatusError
+		}
+
+		guest, err := ctx.Guest(guestID)
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		// deleted guests leave when they are purged
+		switch guest.State {
+		case lochness.GuestStateDeleting, lochness.GuestStateDeleted, lochness.GuestStatePurging:
+			continue
+		}
+
+		volumes, err := guest.Volumes()
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		if len(volumes) > 0 {
+			blocked[guest.ID] = "guest has volumes in the hypervisor's pool"
+			continue
+		}
+
+		// migrate without a target hypervisor so cplacerd picks one
+		action := "migrate"
+		migrateErr := guest.CanMigrate()
+		if migrateErr == nil && migrateFailed {
+			migrateErr = errors.New("migration failed")
+		}
+		if migrateErr != nil {
+			if !recreate {
+				blocked[guest.ID] = fmt.Sprintf("unable to migrate: %s. recreating the guest would lose its disks", migrateErr)
+				continue
+			}
+			action = "evacuate"
+		}
+
+		job, err := jobQueue.AddJobWithArgs(guest.ID, action, make(map[string]string))
+		if err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+		if err := hypervisor.SetDrainJob(guest.ID, job.ID); err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	status, err := drainStatus(ctx, jobQueue, hypervisor)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	status.Blocked = blocked
+	hr.JSON(http.StatusAccepted, status)
+}
+
+// GetHypervisorDrain reports the progress of draining a hypervisor
+func GetHypervisorDrain(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	status, err := drainStatus(GetContext(r), GetJobQueue(r), hypervisor)
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, status)
+}
+
+// drainStatus gathers the progress of the jobs moving guests off a hypervisor
+func drainStatus(ctx *lochness.Context, jobQueue *jobqueue.Client, hypervisor *lochness.Hypervisor) (*DrainStatus, error) {
+	status := &DrainStatus{
+		ID:            hypervisor.ID,
+		Unschedulable: hypervisor.Unschedulable,
+		Remaining:     len(hypervisor.Guests()),
+		Guests:        make(map[string]*DrainGuestStatus),
+	}
+
+	for guestID, jobID := range hypervisor.DrainJobs() {
+		guestStatus := &DrainGuestStatus{JobID: jobID}
+
+		job, err := jobQueue.PeekJob(jobID)
+		if err != nil && !ctx.IsKeyNotFound(err) {
+			return nil, err
+		}
+		if job != nil {
+			guestStatus.Action = job.Action
+			guestStatus.Status = job.Status
+			guestStatus.Error = job.Error
+		}
+
+		guest, err := ctx.Guest(guestID)
+		if err != nil && !ctx.IsKeyNotFound(err) {
+			return nil, err
+		}
+		if guest != nil {
+			guestStatus.HypervisorID = guest.HypervisorID
+			guestStatus.State = guest.State
+		}
+
+		status.Guests[guestID] = guestStatus
+	}
+	return status, nil
+}
@@ -58,3 +58,57 @@ func decodeHypervisor(r *http.Request, hypervisor *lochness.Hypervisor) (*lochne
 	}
 	return hypervisor, nil
 }
+
+// getZoneHelper gets the zone object and handles sending a response in case of
+// error
+func getZoneHelper(hr HTTPResponse, r *http.Request) (*lochness.Zone, bool) {
+	ctx := GetContext(r)
+	vars := mux.Vars(r)
+	zoneID, ok := vars["zoneID"]
+	if !ok {
+		hr.JSONMsg(http.StatusBadRequest, "missing zone id")
+		return nil, false
+	}
+	if uuid.Parse(zoneID) == nil {
+		hr.JSONMsg(http.StatusBadRequest, "invalid zone id")
+		return nil, false
+	}
+	zone, err := ctx.Zone(zoneID)
+	if err != nil {
+		if ctx.IsKeyNotFound(err) {
+			hr.JSONMsg(http.StatusNotFound, "zone not found")
+			return nil, false
+		}
+		hr.JSONError(http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return zone, true
+}
+
+// saveZoneHelper saves the zone object and handles sending a response in case
+// of error
+func saveZoneHelper(hr HTTPResponse, zone *lochness.Zone) bool {
+	if err := zone.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return false
+	}
+	// Save
+	if err := zone.Save(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return false
+	}
+	return true
+}
+
+// decodeZone decodes request body JSON into a zone object
+func decodeZone(r *http.Request, zone *lochness.Zone) (*lochness.Zone, error) {
+	if zone == nil {
+		ctx := GetContext(r)
+		zone = ctx.NewZone()
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(zone); err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
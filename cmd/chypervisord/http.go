@@ -17,10 +17,14 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/pkg/jobqueue"
 	"github.com/tylerb/graceful"
 )
 
-const ctxKey string = "lochnessContext"
+const (
+	ctxKey string = "lochnessContext"
+	jQKey  string = "lochnessJobQueue"
+)
 
 type (
 	// HTTPResponse is a wrapper for http.ResponseWriter which provides access
@@ -38,7 +42,7 @@ type (
 )
 
 // Run starts the server
-func Run(port uint, ctx *lochness.Context) *graceful.Server {
+func Run(port uint, ctx *lochness.Context, jobQueue *jobqueue.Client) *graceful.Server {
 	router := mux.NewRouter()
 	router.StrictSlash(true)
 
@@ -56,7 +60,11 @@ func Run(port uint, ctx *lochness.Context) *graceful.Server {
 		},
 		func(h http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				context.Set(r, ctxKey, ctx)
+				// changes made by the request are audited
+				source := lochness.RequestAuditSource(r)
+				w.Header().Set(lochness.AuditRequestIDHeader, source.RequestID)
+				context.Set(r, ctxKey, ctx.WithAudit(source))
+				context.Set(r, jQKey, jobQueue)
 				h.ServeHTTP(w, r)
 			})
 		},
@@ -68,6 +76,8 @@ func Run(port uint, ctx *lochness.Context) *graceful.Server {
 	// the main router before setting subhandlers on either main or subrouter
 
 	RegisterHypervisorRoutes("/hypervisors", router)
+	RegisterZoneRoutes("/zones", router)
+	RegisterAuditRoutes("/audit", router)
 
 	server := &graceful.Server{
 		Timeout: 5 * time.Second,
@@ -141,3 +151,11 @@ func GetContext(r *http.Request) *lochness.Context {
 	}
 	return nil
 }
+
+// GetJobQueue retrieves a jobqueue.Client value for a request
+func GetJobQueue(r *http.Request) *jobqueue.Client {
+	if value := context.Get(r, jQKey); value != nil {
+		return value.(*jobqueue.Client)
+	}
+	return nil
+}
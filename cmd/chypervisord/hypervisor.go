@@ -22,17 +22,28 @@ func RegisterHypervisorRoutes(prefix string, router *mux.Router) {
 	sub.HandleFunc("/{hypervisorID}/subnets", AddHypervisorSubnets).Methods("PATCH")
 	sub.HandleFunc("/{hypervisorID}/subnets/{subnetID}", RemoveHypervisorSubnet).Methods("DELETE")
 	sub.HandleFunc("/{hypervisorID}/guests", ListHypervisorGuests).Methods("GET")
+	sub.HandleFunc("/{hypervisorID}/taints", ListHypervisorTaints).Methods("GET")
+	sub.HandleFunc("/{hypervisorID}/taints", SetHypervisorTaints).Methods("PATCH")
+	sub.HandleFunc("/{hypervisorID}/taints/{key}", RemoveHypervisorTaint).Methods("DELETE")
+	sub.HandleFunc("/{hypervisorID}/cordon", CordonHypervisor).Methods("POST")
+	sub.HandleFunc("/{hypervisorID}/uncordon", UncordonHypervisor).Methods("POST")
+	sub.HandleFunc("/{hypervisorID}/drain", GetHypervisorDrain).Methods("GET")
+	sub.HandleFunc("/{hypervisorID}/drain", DrainHypervisor).Methods("POST")
 }
 
-// ListHypervisors gets a list of all hypervisors
+// ListHypervisors gets a list of all hypervisors, optionally filtered by a
+// label selector
 func ListHypervisors(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	ctx := GetContext(r)
-	hypervisors := make(lochness.Hypervisors, 0)
-	err := ctx.ForEachHypervisor(func(h *lochness.Hypervisor) error {
-		hypervisors = append(hypervisors, h)
-		return nil
-	})
+
+	selector, err := lochness.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hypervisors, err := ctx.SelectHypervisors(selector)
 	if err != nil {
 		hr.JSONError(http.StatusInternalServerError, err)
 		return
@@ -59,6 +70,8 @@ func CreateHypervisor(w http.ResponseWriter, r *http.Request) {
 		hr.JSONMsg(http.StatusBadRequest, err.Error())
 		return
 	}
+	// hypervisors join zones through the zone routes
+	hypervisor.ZoneID = ""
 
 	if !saveHypervisorHelper(hr, hypervisor) {
 		return
@@ -75,11 +88,15 @@ func UpdateHypervisor(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse Request
+	// reservations are managed by guest placement, and zones, taints, and
+	// cordoning through their own routes, so none can be updated
+	reservations, zoneID, taints, unschedulable := hypervisor.Reservations, hypervisor.ZoneID, hypervisor.Taints, hypervisor.Unschedulable
 	_, err := decodeHypervisor(r, hypervisor)
 	if err != nil {
 		hr.JSONMsg(http.StatusBadRequest, err.Error())
 		return
 	}
+	hypervisor.Reservations, hypervisor.ZoneID, hypervisor.Taints, hypervisor.Unschedulable = reservations, zoneID, taints, unschedulable
 
 	if !saveHypervisorHelper(hr, hypervisor) {
 		return
@@ -209,3 +226,60 @@ func ListHypervisorGuests(w http.ResponseWriter, r *http.Request) {
 
 	hr.JSON(http.StatusOK, hypervisor.Guests())
 }
+
+// ListHypervisorTaints lists the taints of a hypervisor
+func ListHypervisorTaints(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	hr.JSON(http.StatusOK, hypervisor.Taints)
+}
+
+// SetHypervisorTaints adds taints to a hypervisor, replacing those with the
+// same key and effect
+func SetHypervisorTaints(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	var taints lochness.Taints
+	if err := json.NewDecoder(r.Body).Decode(&taints); err != nil {
+		hr.JSONError(http.StatusBadRequest, err)
+		return
+	}
+	if err := taints.Validate(); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, taint := range taints {
+		if err := hypervisor.SetTaint(taint); err != nil {
+			hr.JSONError(http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	hr.JSON(http.StatusOK, hypervisor.Taints)
+}
+
+// RemoveHypervisorTaint removes the taints with a key from a hypervisor
+func RemoveHypervisorTaint(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := hypervisor.RemoveTaint(vars["key"]); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+
+	hr.JSON(http.StatusOK, hypervisor.Taints)
+}
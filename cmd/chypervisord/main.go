@@ -1,8 +1,11 @@
 package main
 
 import (
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/pkg/jobqueue"
 	"github.com/mistifyio/lochness/pkg/kv"
 	_ "github.com/mistifyio/lochness/pkg/kv/consul"
 	logx "github.com/mistifyio/mistify-logrus-ext"
@@ -13,11 +16,14 @@ const defaultKVAddr = "http://localhost:4001"
 
 func main() {
 	var port uint
-	var kvAddr, logLevel string
+	var kvAddr, bstalk, logLevel string
+	var auditRetention time.Duration
 
 	flag.UintVarP(&port, "port", "p", 17000, "listen port")
 	flag.StringVarP(&kvAddr, "kv", "k", defaultKVAddr, "address of kv machine")
+	flag.StringVarP(&bstalk, "beanstalk", "b", "127.0.0.1:11300", "address of beanstalkd server")
 	flag.StringVarP(&logLevel, "log-level", "l", "warn", "log level")
+	flag.DurationVarP(&auditRetention, "audit-retention", "a", 30*24*time.Hour, "how long audit records are kept, 0 to keep them forever")
 	flag.Parse()
 
 	if err := logx.DefaultSetup(logLevel); err != nil {
@@ -39,7 +45,36 @@ func main() {
 
 	ctx := lochness.NewContext(KV)
 
-	server := Run(port, ctx)
+	log.WithField("address", bstalk).Info("connection to beanstalk")
+	jobQueue, err := jobqueue.NewClient(bstalk, KV)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error":   err,
+			"address": bstalk,
+		}).Fatal("failed to create jobQueue client")
+	}
+
+	if auditRetention > 0 {
+		go pruneAudit(ctx, auditRetention)
+	}
+
+	server := Run(port, ctx, jobQueue)
 	// Block until the server is stopped
 	<-server.StopChan()
 }
+
+// pruneAudit periodically removes the audit records older than the retention
+func pruneAudit(ctx *lochness.Context, retention time.Duration) {
+	for {
+		pruned, err := ctx.PruneAuditRecords(time.Now().Add(-retention))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"func":  "lochness.PruneAuditRecords",
+			}).Error("failed to prune audit records")
+		} else if pruned > 0 {
+			log.WithField("pruned", pruned).Info("pruned audit records")
+		}
+		time.Sleep(time.Hour)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/lochness"
+)
+
+// RegisterZoneRoutes registers the zone routes and handlers
+func RegisterZoneRoutes(prefix string, router *mux.Router) {
+	router.HandleFunc(prefix, ListZones).Methods("GET")
+	router.HandleFunc(prefix, CreateZone).Methods("POST")
+	sub := router.PathPrefix(prefix).Subrouter()
+	sub.HandleFunc("/{zoneID}", GetZone).Methods("GET")
+	sub.HandleFunc("/{zoneID}", UpdateZone).Methods("PATCH")
+	sub.HandleFunc("/{zoneID}", DestroyZone).Methods("DELETE")
+	sub.HandleFunc("/{zoneID}/capacity", GetZoneCapacity).Methods("GET")
+	sub.HandleFunc("/{zoneID}/hypervisors", ListZoneHypervisors).Methods("GET")
+	sub.HandleFunc("/{zoneID}/hypervisors/{hypervisorID}", AddZoneHypervisor).Methods("POST")
+	sub.HandleFunc("/{zoneID}/hypervisors/{hypervisorID}", RemoveZoneHypervisor).Methods("DELETE")
+}
+
+// ListZones gets a list of all zones
+func ListZones(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	ctx := GetContext(r)
+	zones := make(lochness.Zones, 0)
+	err := ctx.ForEachZone(func(z *lochness.Zone) error {
+		zones = append(zones, z)
+		return nil
+	})
+	if err != nil && !ctx.IsKeyNotFound(err) {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zones)
+}
+
+// CreateZone creates a new zone
+func CreateZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+
+	zone, err := decodeZone(r, nil)
+	if err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !saveZoneHelper(hr, zone) {
+		return
+	}
+	hr.JSON(http.StatusCreated, zone)
+}
+
+// GetZone gets a particular zone
+func GetZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// UpdateZone updates an existing zone
+func UpdateZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	id := zone.ID
+
+	if _, err := decodeZone(r, zone); err != nil {
+		hr.JSONMsg(http.StatusBadRequest, err.Error())
+		return
+	}
+	zone.ID = id
+
+	if !saveZoneHelper(hr, zone) {
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// DestroyZone deletes an existing zone without hypervisors
+func DestroyZone(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if len(zone.Hypervisors()) != 0 {
+		hr.JSONMsg(http.StatusBadRequest, "zone has hypervisors")
+		return
+	}
+
+	if err := zone.Destroy(); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zone)
+}
+
+// GetZoneCapacity gets the total and available resources of the hypervisors in
+// a zone
+func GetZoneCapacity(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	capacity, err := zone.Capacity()
+	if err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, capacity)
+}
+
+// ListZoneHypervisors lists the hypervisors in a zone
+func ListZoneHypervisors(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	hr.JSON(http.StatusOK, zone.Hypervisors())
+}
+
+// AddZoneHypervisor adds a hypervisor to a zone
+func AddZoneHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if hypervisor.ZoneID != "" && hypervisor.ZoneID != zone.ID {
+		hr.JSONMsg(http.StatusBadRequest, "hypervisor belongs to another zone")
+		return
+	}
+
+	if err := zone.AddHypervisor(hypervisor); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zone.Hypervisors())
+}
+
+// RemoveZoneHypervisor removes a hypervisor from a zone
+func RemoveZoneHypervisor(w http.ResponseWriter, r *http.Request) {
+	hr := HTTPResponse{w}
+	zone, ok := getZoneHelper(hr, r)
+	if !ok {
+		return
+	}
+	hypervisor, ok := getHypervisorHelper(hr, r)
+	if !ok {
+		return
+	}
+
+	if hypervisor.ZoneID != zone.ID {
+		hr.JSONMsg(http.StatusBadRequest, "hypervisor does not belong to zone")
+		return
+	}
+
+	if err := zone.RemoveHypervisor(hypervisor); err != nil {
+		hr.JSONError(http.StatusInternalServerError, err)
+		return
+	}
+	hr.JSON(http.StatusOK, zone.Hypervisors())
+}
@@ -0,0 +1,143 @@
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	logx "github.com/mistifyio/mistify-logrus-ext"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestCMetadatadAPI(t *testing.T) {
+	suite.Run(t, new(APISuite))
+}
+
+type APISuite struct {
+	common.Suite
+	Port    uint
+	APIURL  string
+	Guest   *lochness.Guest
+	GuestIP string
+	BinName string
+	Cmd     *common.Cmd
+}
+
+func (s *APISuite) SetupSuite() {
+	s.Suite.SetupSuite()
+
+	log.SetLevel(log.FatalLevel)
+	s.Port = 51425
+	s.APIURL = fmt.Sprintf("http://localhost:%d", s.Port)
+
+	// Run API
+	s.Require().NoError(common.Build())
+	s.BinName = "cmetadatad"
+	args := []string{
+		"-k", s.KVURL,
+		"-p", strconv.Itoa(int(s.Port)),
+		"-f",
+	}
+
+	var err error
+	s.Cmd, err = common.Start("./"+s.BinName, args...)
+	s.Require().NoError(err)
+	time.Sleep(1 * time.Second)
+}
+
+func (s *APISuite) SetupTest() {
+	_, s.Guest = s.NewHypervisorWithGuest()
+	s.Require().NoError(s.Guest.Refresh())
+	s.Guest.Hostname = "web-1"
+	s.Guest.SSHKeys = []string{"ssh-rsa AAAA user@host"}
+	s.Guest.UserData = "#cloud-config\n"
+	s.Require().NoError(s.Guest.Save())
+	s.GuestIP = s.Guest.Interfaces[0].IP.String()
+}
+
+func (s *APISuite) TearDownSuite() {
+	_ = s.Cmd.Stop()
+	s.Suite.TearDownSuite()
+}
+
+// get requests a path as if from the address, returning the status and body
+func (s *APISuite) get(path, ip string) (int, string) {
+	req, err := http.NewRequest("GET", s.APIURL+path, nil)
+	s.Require().NoError(err)
+	req.Header.Set("X-Forwarded-For", ip)
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	defer logx.LogReturnedErr(resp.Body.Close, nil, "failed to close resp body")
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func (s *APISuite) TestUnknownGuest() {
+	code, _ := s.get("/latest/meta-data/instance-id", "10.0.0.1")
+	s.Equal(http.StatusNotFound, code)
+}
+
+func (s *APISuite) TestEC2() {
+	tests := []struct {
+		description  string
+		path         string
+		expectedCode int
+		expectedBody string
+	}{
+		{"versions", "/", http.StatusOK, "1.0\n2009-04-04\nlatest"},
+		{"index", "/latest", http.StatusOK, "meta-data/\nuser-data"},
+		{"unknown version", "/2000-01-01/meta-data/instance-id", http.StatusNotFound, ""},
+		{"meta-data", "/latest/meta-data/", http.StatusOK,
+			"hostname\ninstance-id\ninstance-type\nlocal-hostname\nlocal-ipv4\nmac\nplacement/\npublic-keys/"},
+		{"instance-id", "/2009-04-04/meta-data/instance-id", http.StatusOK, s.Guest.ID},
+		{"hostname", "/latest/meta-data/local-hostname", http.StatusOK, "web-1"},
+		{"local-ipv4", "/latest/meta-data/local-ipv4", http.StatusOK, s.GuestIP},
+		{"mac", "/latest/meta-data/mac", http.StatusOK, s.Guest.Interfaces[0].MAC.String()},
+		{"public-keys", "/latest/meta-data/public-keys/", http.StatusOK, "0=key-0"},
+		{"public key", "/latest/meta-data/public-keys/0/openssh-key", http.StatusOK, s.Guest.SSHKeys[0]},
+		{"missing public key", "/latest/meta-data/public-keys/1/openssh-key", http.StatusNotFound, ""},
+		{"missing entry", "/latest/meta-data/foo", http.StatusNotFound, ""},
+		{"user-data", "/latest/user-data", http.StatusOK, s.Guest.UserData},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		code, body := s.get(test.path, s.GuestIP)
+		s.Equal(test.expectedCode, code, msg("unexpected status"))
+		if test.expectedCode == http.StatusOK {
+			s.Equal(test.expectedBody, body, msg("unexpected body"))
+		}
+	}
+}
+
+func (s *APISuite) TestOpenStack() {
+	code, body := s.get("/openstack/latest/meta_data.json", s.GuestIP)
+	s.Require().Equal(http.StatusOK, code)
+
+	var metaData map[string]interface{}
+	s.Require().NoError(json.Unmarshal([]byte(body), &metaData))
+	s.Equal(s.Guest.ID, metaData["uuid"])
+	s.Equal("web-1", metaData["hostname"])
+	s.Equal(map[string]interface{}{"key-0": s.Guest.SSHKeys[0]}, metaData["public_keys"])
+
+	code, body = s.get("/openstack/2012-08-10/user_data", s.GuestIP)
+	s.Equal(http.StatusOK, code)
+	s.Equal(s.Guest.UserData, body)
+
+	code, body = s.get("/openstack/latest/vendor_data.json", s.GuestIP)
+	s.Equal(http.StatusOK, code)
+	s.JSONEq("{}", body)
+
+	s.Guest.UserData = ""
+	s.Require().NoError(s.Guest.Save())
+	code, _ = s.get("/openstack/latest/user_data", s.GuestIP)
+	s.Equal(http.StatusNotFound, code, "missing user data should not be found")
+}
@@ -0,0 +1,108 @@
+/*
+cmetadatad is the metadata service for guests. It lets a guest learn its own
+configuration at boot, such as its hostname, ssh keys and user data, in the
+formats cloud-init reads from EC2 and OpenStack.
+
+A guest is identified by the source address of its request, which is looked up
+in the address reservations of the subnets. Requests from addresses held by no
+guest are not found. When running behind a proxy, such as one answering on
+169.254.169.254 on each hypervisor, the --forwarded flag identifies guests by
+the X-Forwarded-For header instead.
+
+Usage
+
+The following arguments are understood:
+
+	$ cmetadatad -h
+	Usage of cmetadatad:
+	-f, --forwarded=false: identify guests by the X-Forwarded-For header, when behind a proxy
+	-k, --kv="http://127.0.0.1:4001": address of kv machine
+	-l, --log-level="warn": log level
+	-p, --port=8775: address to listen
+	-s, --statsd="": statsd address
+
+HTTP API Endpoints
+
+All versions serve the same data. Directories list their entries one per line,
+with subdirectories ending in a slash.
+
+	/
+		* GET - List the EC2 versions: 1.0, 2009-04-04 and latest
+
+	/{version}
+		* GET - List meta-data/ and, if the guest has any, user-data
+
+	/{version}/meta-data/{path}
+		EC2 meta-data tree
+		* GET - Get an entry: hostname, instance-id, instance-type (the
+		        flavor), local-hostname, local-ipv4, mac,
+		        placement/availability-zone (the zone of the hypervisor),
+		        and public-keys/{index}/openssh-key
+
+	/{version}/user-data
+		* GET - Get the guest's user data
+
+	/openstack
+		* GET - List the OpenStack versions: 2012-08-10 and latest
+
+	/openstack/{version}/meta_data.json
+		* GET - Get the guest's metadata document
+
+	/openstack/{version}/user_data
+		* GET - Get the guest's user data
+
+	/openstack/{version}/vendor_data.json
+		* GET - Get the (empty) vendor data
+
+	/metrics
+		* GET - Get the service metrics
+
+The hostname defaults to the guest id. The hostname, ssh keys and user data are
+set on the guest through cguestd.
+
+Example Requests
+
+GET /latest/meta-data/
+
+	$ curl http://169.254.169.254/latest/meta-data/
+
+	hostname
+	instance-id
+	instance-type
+	local-hostname
+	local-ipv4
+	mac
+	placement/
+	public-keys/
+
+GET /latest/meta-data/public-keys/
+
+	$ curl http://169.254.169.254/latest/meta-data/public-keys/
+
+	0=key-0
+
+GET /openstack/latest/meta_data.json
+
+	$ curl http://169.254.169.254/openstack/latest/meta_data.json
+
+	{
+		"uuid": "94ea0ba1-5ec2-460e-9c2e-8269593cdad3",
+		"name": "web-1",
+		"hostname": "web-1",
+		"availability_zone": "c0ffee00-abcd-1234-abcd-1234abcd1234",
+		"project_id": "",
+		"launch_index": 0,
+		"public_keys": {
+			"key-0": "ssh-rsa AAAA... user@host"
+		},
+		"keys": [
+			{
+				"name": "key-0",
+				"type": "ssh",
+				"data": "ssh-rsa AAAA... user@host"
+			}
+		],
+		"meta": {}
+	}
+*/
+package main
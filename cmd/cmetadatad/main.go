@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	metrics "github.com/armon/go-metrics"
+	mapsink "github.com/bakins/go-metrics-map"
+	"github.com/bakins/go-metrics-middleware"
+	"github.com/bakins/net-http-recover"
+	"github.com/gorilla/context"
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+	"github.com/justinas/alice"
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/pkg/kv"
+	_ "github.com/mistifyio/lochness/pkg/kv/consul"
+	logx "github.com/mistifyio/mistify-logrus-ext"
+	flag "github.com/ogier/pflag"
+)
+
+const (
+	serverKey string = "_server_"
+	guestKey  string = "_guest_"
+)
+
+type server struct {
+	ctx       *lochness.Context
+	forwarded bool
+}
+
+func main() {
+	port := flag.UintP("port", "p", 8775, "address to listen")
+	kvAddr := flag.StringP("kv", "k", "http://127.0.0.1:4001", "address of kv machine")
+	logLevel := flag.StringP("log-level", "l", "warn", "log level")
+	forwarded := flag.BoolP("forwarded", "f", false, "identify guests by the X-Forwarded-For header, when behind a proxy")
+	statsd := flag.StringP("statsd", "s", "", "statsd address")
+
+	flag.Parse()
+
+	if err := logx.DefaultSetup(*logLevel); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "logx.DefaultSetup",
+			"level": *logLevel,
+		}).Fatal("unable to set up logrus")
+	}
+
+	KV, err := kv.New(*kvAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	s := &server{
+		ctx:       lochness.NewContext(KV),
+		forwarded: *forwarded,
+	}
+
+	router := mux.NewRouter()
+	router.StrictSlash(true)
+
+	chain := alice.New(
+		func(h http.Handler) http.Handler {
+			return recovery.Handler(os.Stderr, h, true)
+		},
+		func(h http.Handler) http.Handler {
+			return handlers.CombinedLoggingHandler(os.Stdout, h)
+		},
+		handlers.CompressHandler,
+	)
+
+	sink := mapsink.New()
+	fanout := metrics.FanoutSink{sink}
+
+	if *statsd != "" {
+		ss, _ := metrics.NewStatsdSink(*statsd)
+		fanout = append(fanout, ss)
+	}
+
+	conf := metrics.DefaultConfig("cmetadatad")
+	conf.EnableHostname = false
+	m, _ := metrics.New(conf, fanout)
+	mw := mmw.New(m)
+
+	router.Handle("/metrics", chain.Append(mw.HandlerWrapper("metrics")).ThenFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			if err := json.NewEncoder(w).Encode(sink); err != nil {
+				log.WithField("error", err).Error(err)
+			}
+		}))
+
+	chain = chain.Append(func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			context.Set(r, serverKey, s)
+			h.ServeHTTP(w, r)
+		})
+	}, loadGuest)
+
+	// the openstack tree is registered first so its prefix is not taken for
+	// an ec2 version
+	router.Handle("/openstack", chain.Append(mw.HandlerWrapper("openstack-versions")).ThenFunc(openStackVersionsHandler))
+	router.Handle("/openstack/{version}", chain.Append(mw.HandlerWrapper("openstack-index")).ThenFunc(openStackIndexHandler))
+	router.Handle("/openstack/{version}/meta_data.json", chain.Append(mw.HandlerWrapper("openstack-meta-data")).ThenFunc(openStackMetaDataHandler))
+	router.Handle("/openstack/{version}/user_data", chain.Append(mw.HandlerWrapper("openstack-user-data")).ThenFunc(userDataHandler))
+	router.Handle("/openstack/{version}/vendor_data.json", chain.Append(mw.HandlerWrapper("openstack-vendor-data")).ThenFunc(openStackVendorDataHandler))
+
+	router.Handle("/", chain.Append(mw.HandlerWrapper("ec2-versions")).ThenFunc(ec2VersionsHandler))
+	router.Handle("/{version}", chain.Append(mw.HandlerWrapper("ec2-index")).ThenFunc(ec2IndexHandler))
+	router.Handle("/{version}/user-data", chain.Append(mw.HandlerWrapper("ec2-user-data")).ThenFunc(userDataHandler))
+	// directories are served with a trailing slash rather than redirected
+	router.Handle("/{version}/meta-data/{path:.*}", chain.Append(mw.HandlerWrapper("ec2-meta-data")).ThenFunc(ec2MetaDataHandler))
+	router.Handle("/{version}/meta-data", chain.Append(mw.HandlerWrapper("ec2-meta-data")).ThenFunc(ec2MetaDataHandler))
+
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", *port), router); err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "http.ListenAndServe",
+		}).Fatal("ListenAndServe returned an error")
+	}
+}
+
+// sourceIP returns the address of the guest making the request. Behind a
+// proxy it is the first address of the X-Forwarded-For header.
+func (s *server) sourceIP(r *http.Request) net.IP {
+	if s.forwarded {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return net.ParseIP(strings.TrimSpace(strings.Split(forwarded, ",")[0]))
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// loadGuest identifies the guest making the request by its address and saves
+// it to the request context. Requests from other addresses are not found.
+func loadGuest(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := context.Get(r, serverKey).(*server)
+
+		ip := s.sourceIP(r)
+		if ip == nil {
+			http.Error(w, "invalid address", http.StatusBadRequest)
+			return
+		}
+		guest, err := s.ctx.GuestByIP(ip)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"ip":    ip,
+				"func":  "lochness.GuestByIP",
+			}).Error("failed to look up guest")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if guest == nil {
+			http.Error(w, "guest not found", http.StatusNotFound)
+			return
+		}
+
+		context.Set(r, guestKey, &requestGuest{Guest: guest, ip: ip})
+		h.ServeHTTP(w, r)
+	})
+}
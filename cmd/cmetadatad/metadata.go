@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"github.com/mistifyio/lochness"
+)
+
+// ec2Versions and openStackVersions are the metadata versions served. They
+// all serve the same data.
+var (
+	ec2Versions       = []string{"1.0", "2009-04-04", "latest"}
+	openStackVersions = []string{"2012-08-10", "latest"}
+)
+
+type (
+	// requestGuest is the guest making a request, and the address it made it
+	// from
+	requestGuest struct {
+		*lochness.Guest
+		ip net.IP
+	}
+
+	// ec2PublicKeys is the ec2 public-keys directory, listed as index=name
+	ec2PublicKeys []string
+
+	// openStackMetaData is the openstack meta_data.json document
+	openStackMetaData struct {
+		UUID             string            `json:"uuid"`
+		Name             string            `json:"name"`
+		Hostname         string            `json:"hostname"`
+		AvailabilityZone string            `json:"availability_zone"`
+		ProjectID        string            `json:"project_id"`
+		LaunchIndex      int               `json:"launch_index"`
+		PublicKeys       map[string]string `json:"public_keys"`
+		Keys             []openStackKey    `json:"keys"`
+		Meta             map[string]string `json:"meta"`
+	}
+
+	// openStackKey is a public key of the openstack meta_data.json document
+	openStackKey struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Data string `json:"data"`
+	}
+)
+
+// getRequestGuest returns the guest making the request
+func getRequestGuest(r *http.Request) *requestGuest {
+	return context.Get(r, guestKey).(*requestGuest)
+}
+
+// validVersion returns whether version is one of the versions served
+func validVersion(versions []string, version string) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText sends a plain text response
+func writeText(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, text)
+}
+
+// writeJSON sends a json response
+func writeJSON(w http.ResponseWriter, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		log.WithField("error", err).Error(err)
+	}
+}
+
+// availabilityZone returns the zone of the guest's hypervisor, or the zone it
+// requested if it is not placed
+func availabilityZone(ctx *lochness.Context, guest *lochness.Guest) string {
+	if guest.HypervisorID == "" {
+		return guest.ZoneID
+	}
+	hypervisor, err := ctx.Hypervisor(guest.HypervisorID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"func":  "lochness.Hypervisor",
+			"id":    guest.HypervisorID,
+		}).Error("failed to load hypervisor")
+		return guest.ZoneID
+	}
+	return hypervisor.ZoneID
+}
+
+func ec2VersionsHandler(w http.ResponseWriter, r *http.Request) {
+	writeText(w, strings.Join(ec2Versions, "\n"))
+}
+
+func ec2IndexHandler(w http.ResponseWriter, r *http.Request) {
+	if !validVersion(ec2Versions, mux.Vars(r)["version"]) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	entries := []string{"meta-data/"}
+	if getRequestGuest(r).UserData != "" {
+		entries = append(entries, "user-data")
+	}
+	writeText(w, strings.Join(entries, "\n"))
+}
+
+// ec2MetaData builds the ec2 meta-data tree of the guest. Directories are maps
+// and files are strings.
+func ec2MetaData(ctx *lochness.Context, guest *requestGuest) map[string]interface{} {
+	var localIP, mac string
+	if iface := guest.InterfaceByIP(guest.ip); iface != nil {
+		localIP, mac = iface.IP.String(), iface.MAC.String()
+	}
+	return map[string]interface{}{
+		"hostname":       guest.LocalHostname(),
+		"instance-id":    guest.ID,
+		"instance-type":  guest.FlavorID,
+		"local-hostname": guest.LocalHostname(),
+		"local-ipv4":     localIP,
+		"mac":            mac,
+		"placement": map[string]interface{}{
+			"availability-zone": availabilityZone(ctx, guest.Guest),
+		},
+		"public-keys": ec2PublicKeys(guest.SSHKeys),
+	}
+}
+
+// ec2Lookup walks the meta-data tree down the path, returning the node found
+func ec2Lookup(node interface{}, path []string) (interface{}, bool) {
+	for _, name := range path {
+		if name == "" {
+			continue
+		}
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[name]
+			if !ok {
+				return nil, false
+			}
+			node = child
+		case ec2PublicKeys:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			node = map[string]interface{}{"openssh-key": n[i]}
+		default:
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// ec2Render renders a meta-data node. A directory lists its entries, with
+// subdirectories ending in a slash.
+func ec2Render(node interface{}) string {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		entries := make([]string, 0, len(n))
+		for name, child := range n {
+			switch child.(type) {
+			case map[string]interface{}, ec2PublicKeys:
+				name += "/"
+			}
+			entries = append(entries, name)
+		}
+		sort.Strings(entries)
+		return strings.Join(entries, "\n")
+	case ec2PublicKeys:
+		entries := make([]string, len(n))
+		for i := range n {
+			entries[i] = fmt.Sprintf("%d=key-%d", i, i)
+		}
+		return strings.Join(entries, "\n")
+	default:
+		return fmt.Sprint(n)
+	}
+}
+
+func ec2MetaDataHandler(w http.ResponseWriter, r *http.Request) {
+	s := context.Get(r, serverKey).(*server)
+	vars := mux.Vars(r)
+	if !validVersion(ec2Versions, vars["version"]) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+
+	node, ok := ec2Lookup(ec2MetaData(s.ctx, getRequestGuest(r)), strings.Split(vars["path"], "/"))
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	writeText(w, ec2Render(node))
+}
+
+// userDataHandler serves the guest's user data, for both ec2 and openstack
+func userDataHandler(w http.ResponseWriter, r *http.Request) {
+	version := mux.Vars(r)["version"]
+	if !validVersion(ec2Versions, version) && !validVersion(openStackVersions, version) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	guest := getRequestGuest(r)
+	if guest.UserData == "" {
+		http.Error(w, "user data not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.WriteString(w, guest.UserData)
+}
+
+func openStackVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	writeText(w, strings.Join(openStackVersions, "\n"))
+}
+
+func openStackIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if !validVersion(openStackVersions, mux.Vars(r)["version"]) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	entries := []string{"meta_data.json", "vendor_data.json"}
+	if getRequestGuest(r).UserData != "" {
+		entries = append(entries, "user_data")
+	}
+	writeText(w, strings.Join(entries, "\n"))
+}
+
+func openStackMetaDataHandler(w http.ResponseWriter, r *http.Request) {
+	s := context.Get(r, serverKey).(*server)
+	if !validVersion(openStackVersions, mux.Vars(r)["version"]) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	guest := getRequestGuest(r)
+
+	metaData := openStackMetaData{
+		UUID:             guest.ID,
+		Name:             guest.LocalHostname(),
+		Hostname:         guest.LocalHostname(),
+		AvailabilityZone: availabilityZone(s.ctx, guest.Guest),
+		ProjectID:        guest.ProjectID,
+		PublicKeys:       make(map[string]string, len(guest.SSHKeys)),
+		Keys:             make([]openStackKey, len(guest.SSHKeys)),
+		Meta:             guest.Metadata,
+	}
+	for i, key := range guest.SSHKeys {
+		name := fmt.Sprintf("key-%d", i)
+		metaData.PublicKeys[name] = key
+		metaData.Keys[i] = openStackKey{Name: name, Type: "ssh", Data: key}
+	}
+	if metaData.Meta == nil {
+		metaData.Meta = make(map[string]string)
+	}
+	writeJSON(w, metaData)
+}
+
+// openStackVendorDataHandler serves empty vendor data, which cloud-init expects
+// to find
+func openStackVendorDataHandler(w http.ResponseWriter, r *http.Request) {
+	if !validVersion(openStackVersions, mux.Vars(r)["version"]) {
+		http.Error(w, "version not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, map[string]interface{}{})
+}
@@ -39,6 +39,16 @@ HTTP API endpoints
 		* GET - Retrieve a list of VLAN tags the VLAN group contains
 		* POST - Set the list of VLAN tags the VLAN group contains
 
+Requests may be scoped to a project with a header `X-Project-ID`. A scoped
+request only lists and finds the project's VLAN groups and shared ones, and a
+VLAN group created by it belongs to the project.
+
+Every change made through the API is recorded in the audit log, attributed to
+the actor named by the X-Actor header, the request's source address, and the
+request id in the X-Request-ID header. A request without an id is given one,
+and the id is returned in the response's X-Request-ID header. The audit log is
+queried through chypervisord.
+
 Example Structs
 
 VLAN tag - lochness.VLAN
@@ -53,7 +63,8 @@ VLAN Group - lochness.VLANGroup
 	{
 		"id": "122be0b1-d621-4bf5-8b6b-6d0ce41d7c11",
 		"description": "foobar",
-		"metadata": {}
+		"metadata": {},
+		"project": ""
 	}
 
 Example Requests
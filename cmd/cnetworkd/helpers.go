@@ -11,6 +11,14 @@ import (
 	"github.com/mistifyio/lochness"
 )
 
+// projectHeader scopes a request to the objects of a project
+const projectHeader = "X-Project-ID"
+
+// requestProject returns the project the request is scoped to, if any
+func requestProject(r *http.Request) string {
+	return r.Header.Get(projectHeader)
+}
+
 func getVLANHelper(hr HTTPResponse, r *http.Request) (*lochness.VLAN, bool) {
 	ctx := GetContext(r)
 	vars := mux.Vars(r)
@@ -84,6 +92,10 @@ func getVLANGroupHelper(hr HTTPResponse, r *http.Request) (*lochness.VLANGroup,
 		}
 		return nil, false
 	}
+	if !lochness.InProject(requestProject(r), vlanGroup.ProjectID) {
+		hr.JSONMsg(http.StatusNotFound, "group not found")
+		return nil, false
+	}
 	return vlanGroup, true
 }
 
@@ -56,7 +56,10 @@ func Run(port uint, ctx *lochness.Context) *graceful.Server {
 		},
 		func(h http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				context.Set(r, ctxKey, ctx)
+				// changes made by the request are audited
+				source := lochness.RequestAuditSource(r)
+				w.Header().Set(lochness.AuditRequestIDHeader, source.RequestID)
+				context.Set(r, ctxKey, ctx.WithAudit(source))
 				h.ServeHTTP(w, r)
 			})
 		},
@@ -25,8 +25,12 @@ func RegisterVLANGroupRoutes(prefix string, router *mux.Router) {
 func ListVLANGroups(w http.ResponseWriter, r *http.Request) {
 	hr := HTTPResponse{w}
 	ctx := GetContext(r)
+	project := requestProject(r)
 	vlanGroups := make(lochness.VLANGroups, 0)
 	err := ctx.ForEachVLANGroup(func(vlanGroup *lochness.VLANGroup) error {
+		if !lochness.InProject(project, vlanGroup.ProjectID) {
+			return nil
+		}
 		vlanGroups = append(vlanGroups, vlanGroup)
 		return nil
 	})
@@ -56,6 +60,14 @@ func CreateVLANGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if project := requestProject(r); project != "" {
+		if vlanGroup.ProjectID != "" && vlanGroup.ProjectID != project {
+			hr.JSONMsg(http.StatusBadRequest, "group belongs to another project")
+			return
+		}
+		vlanGroup.ProjectID = project
+	}
+
 	if !saveVLANGroupHelper(hr, vlanGroup) {
 		return
 	}
@@ -70,7 +82,7 @@ func UpdateVLANGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	groupID := vlanGroup.ID
+	groupID, projectID := vlanGroup.ID, vlanGroup.ProjectID
 
 	_, err := decodeVLANGroup(r, vlanGroup)
 	if err != nil {
@@ -78,8 +90,8 @@ func UpdateVLANGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Don't allow ID redefinition
-	vlanGroup.ID = groupID
+	// Don't allow ID or project redefinition
+	vlanGroup.ID, vlanGroup.ProjectID = groupID, projectID
 
 	if !saveVLANGroupHelper(hr, vlanGroup) {
 		return
@@ -1,7 +1,6 @@
 package main_test
 
 import (
-	"fmt"
 	"os/exec"
 	"strconv"
 	"testing"
@@ -33,9 +32,13 @@ func (s *CmdSuite) SetupSuite() {
 	s.BinName = "cplacerd"
 	s.Port = "45362"
 
-	bPort := "59872"
-	s.BeanstalkdPath = fmt.Sprintf("127.0.0.1:%s", bPort)
-	s.BeanstalkdCmd = exec.Command("beanstalkd", "-p", bPort)
+	s.BeanstalkdPath = "127.0.0.1:59872"
+}
+
+func (s *CmdSuite) SetupTest() {
+	s.Suite.SetupTest()
+
+	s.BeanstalkdCmd = exec.Command("beanstalkd", "-p", "59872")
 	s.Require().NoError(s.BeanstalkdCmd.Start())
 	beanstalkdReady := false
 	for i := 0; i < 10; i++ {
@@ -71,18 +74,19 @@ func (s *CmdSuite) TestCmd() {
 		jobStatus    string
 		jobAction    string
 		hypervisorID string
+		guestState   string
 		expectedErr  bool
 	}{
 		{"wrong job status",
-			"foobar", "select-hypervisor", "", true},
+			"foobar", "select-hypervisor", "", lochness.GuestStatePending, true},
 		{"wrong job action",
-			jobqueue.JobStatusNew, "foobar", "", true},
+			jobqueue.JobStatusNew, "foobar", "", lochness.GuestStatePending, true},
 		{"guest has hypervisor id",
-			jobqueue.JobStatusNew, "select-hypervisor", hypervisor.ID, true},
+			jobqueue.JobStatusNew, "select-hypervisor", hypervisor.ID, lochness.GuestStatePending, true},
 		{"no live hypervisors",
-			jobqueue.JobStatusNew, "select-hypervisor", "", true},
+			jobqueue.JobStatusNew, "select-hypervisor", "", lochness.GuestStateFailed, true},
 		{"valid",
-			jobqueue.JobStatusNew, "select-hypervisor", "", false},
+			jobqueue.JobStatusNew, "select-hypervisor", "", lochness.GuestStateScheduled, false},
 	}
 
 	for _, test := range tests {
@@ -92,7 +96,7 @@ func (s *CmdSuite) TestCmd() {
 		}
 
 		guest := s.NewGuest()
-		guest.NetworkID = network.ID
+		guest.Interfaces[0].NetworkID = network.ID
 		if test.hypervisorID != "" {
 			guest.HypervisorID = test.hypervisorID
 		}
@@ -134,6 +138,7 @@ func (s *CmdSuite) TestCmd() {
 		}
 
 		_ = guest.Refresh()
+		s.Equal(test.guestState, guest.State, msg("should have the right guest state"))
 		workStats, _ := s.JobQueue.StatsWork()
 		totalWorkJobs, _ := strconv.Atoi(workStats["current-jobs-total"])
 		if test.expectedErr {
@@ -161,3 +166,61 @@ func (s *CmdSuite) TestCmd() {
 	}
 
 }
+
+func (s *CmdSuite) TestCmdMigrate() {
+	source, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+
+	// the target bridges the same subnet, so the guest keeps its address
+	target := s.NewHypervisor()
+	subnet, err := s.Context.Subnet(guest.Interfaces[0].SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+	for _, h := range []*lochness.Hypervisor{source, target} {
+		_, _ = lochness.SetHypervisorID(h.ID)
+		s.Require().NoError(h.Heartbeat(1 * time.Hour))
+	}
+
+	job, err := s.JobQueue.AddJob(guest.ID, "migrate")
+	s.Require().NoError(err)
+
+	args := []string{
+		"-p", s.Port,
+		"-k", s.KVURL,
+		"-b", s.BeanstalkdPath,
+		"-l", "fatal",
+	}
+	cmd, err := common.Start("./"+s.BinName, args...)
+	s.Require().NoError(err)
+
+	// Wait for processing
+	for i := 0; i < 10; i++ {
+		time.Sleep(1 * time.Second)
+		if err := job.Refresh(); err != nil {
+			continue
+		}
+		if job.Status == jobqueue.JobStatusError || job.Args["hypervisor"] != "" {
+			break
+		}
+		s.Require().NoError(job.Release())
+	}
+
+	s.Empty(job.Error, "should not have error msg")
+	s.Equal("migrate", job.Action, "should not have changed actions")
+	s.Equal(target.ID, job.Args["hypervisor"], "should have selected the target")
+
+	s.NoError(guest.Refresh())
+	s.Equal(source.ID, guest.HypervisorID, "should not have moved the guest yet")
+	if s.NotNil(guest.Migration, "should have prepared the migration") {
+		s.Equal(target.ID, guest.Migration.HypervisorID)
+		s.Equal(guest.Interfaces[0].IP, guest.Migration.Interfaces[0].IP, "should have kept the address")
+		s.Equal("br1", guest.Migration.Interfaces[0].Bridge)
+	}
+
+	workStats, _ := s.JobQueue.StatsWork()
+	totalWorkJobs, _ := strconv.Atoi(workStats["current-jobs-total"])
+	s.Equal(1, totalWorkJobs, "should have created new work task")
+
+	_ = cmd.Stop()
+}
@@ -1,9 +1,19 @@
 /*
 cplacerd is the guest placement daemon. It monitors a beanstalk queue for
 requests to create new guests. It then decides which hypervisor a new guest
-should be created under based on a variety of criteria. It does not actually
+should be created under, filtering the hypervisors based on a variety of criteria,
+including the guest's affinity rules and requested zone, and picking the best
+ranked by weighted scores (see the lochness package
+documentation for the "placement/weights/" config keys). If the resources of the
+best are taken by another placement first, the next best is tried. It does not actually
 communicate with the hypervisor, but creates the job for `cworkerd` to process.
 
+Migrate jobs are handled the same way, except the guest's current hypervisor is
+never picked. A target named in the job only has to be alive and able to hold
+the guest. The guest's move is prepared on the target before the job is passed
+on. A guest migrated to make room for a resize is placed at its new size, and is
+charged to its project's quota at its current size again if it can not be.
+
 Usage
 
 The following arguments are understood:
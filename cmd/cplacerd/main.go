@@ -191,13 +191,19 @@ func checkJobStatus(jobQueue *jobqueue.Client, t *jobqueue.Task) (bool, error) {
 	if t.Job.Status != jobqueue.JobStatusNew {
 		return true, fmt.Errorf("bad job status: %s", t.Job.Status)
 	}
-	if t.Job.Action != "select-hypervisor" {
+	if t.Job.Action != "select-hypervisor" && t.Job.Action != "migrate" {
 		return true, fmt.Errorf("bad action: %s", t.Job.Action)
 	}
 	return false, nil
 }
 
 func checkGuestStatus(jobQueue *jobqueue.Client, t *jobqueue.Task) (bool, error) {
+	if t.Job.Action == "migrate" {
+		if err := t.Guest.CanMigrate(); err != nil {
+			return true, fmt.Errorf("unable to migrate guest %s - %s", t.Guest.ID, err)
+		}
+		return false, nil
+	}
 
 	if t.Guest.HypervisorID != "" {
 		return true, fmt.Errorf("guest already has a hypervisor %s - %s", t.Guest.ID, t.Guest.HypervisorID)
@@ -206,27 +212,150 @@ func checkGuestStatus(jobQueue *jobqueue.Client, t *jobqueue.Task) (bool, error)
 }
 
 func selectHypervisor(jobQueue *jobqueue.Client, t *jobqueue.Task) (bool, error) {
-	candidates, err := t.Guest.Candidates(lochness.DefaultCandidateFunctions...)
+	if t.Job.Action == "migrate" {
+		return selectMigrationTarget(t)
+	}
+
+	candidates, err := t.Guest.RankedCandidates(lochness.DefaultCandidateFunctions...)
 	if err != nil {
-		return true, fmt.Errorf("unable to select candidate %s - %s", t.Guest.ID, err)
+		return true, failGuest(t, fmt.Errorf("unable to select candidate %s - %s", t.Guest.ID, err))
 	}
 
 	if len(candidates) == 0 {
-		return true, fmt.Errorf("no candidates found for %s", t.Guest.ID)
+		return true, failGuest(t, fmt.Errorf("no candidates found for %s", t.Guest.ID))
+	}
+
+	// candidates are ranked best first. one whose resources were taken by a
+	// concurrent placement since it was ranked is passed over for the next
+	var h *lochness.Hypervisor
+	for _, candidate := range candidates {
+		// the API for selecting a candidate and then adding to a hypervisor is clunky
+		err := candidate.AddGuest(t.Guest)
+		if err == nil {
+			h = candidate
+			break
+		}
+		if err != lochness.ErrInsufficientResources {
+			return true, failGuest(t, fmt.Errorf("unable to add guest %s to %s - %s", t.Guest.ID, candidate.ID, err))
+		}
+		log.WithFields(log.Fields{
+			"guest":      t.Guest.ID,
+			"hypervisor": candidate.ID,
+			"error":      err,
+		}).Info("candidate lost its resources; trying the next")
+	}
+	if h == nil {
+		return true, failGuest(t, fmt.Errorf("no candidates with resources left for %s", t.Guest.ID))
+	}
+
+	if err := t.Guest.UpdateState(lochness.GuestStateScheduled, fmt.Sprintf("placed on hypervisor %s", h.ID)); err != nil {
+		log.WithFields(log.Fields{
+			"task":  t,
+			"error": err,
+		}).Error("unable to update guest state")
+	}
+
+	return false, nil
+}
+
+// targetCandidateFunctions are the candidate functions a hypervisor named as
+// a migration target must pass. Placement preferences such as cordons, taints,
+// zones and affinity are left to whoever named it.
+var targetCandidateFunctions = []lochness.CandidateFunction{
+	lochness.CandidateIsAlive,
+	lochness.CandidateHasVolumes,
+	lochness.CandidateHasSubnet,
+	lochness.CandidateHasResources,
+}
+
+// candidateIs returns a candidate function keeping only the hypervisor with the
+// id
+func candidateIs(hypervisorID string) lochness.CandidateFunction {
+	return func(g *lochness.Guest, hs lochness.Hypervisors) (lochness.Hypervisors, error) {
+		for _, h := range hs {
+			if h.ID == hypervisorID {
+				return lochness.Hypervisors{h}, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// selectMigrationTarget picks the hypervisor a guest is migrated to, or checks
+// the one named in the job, and prepares the guest's move there. The guest
+// stays where it is if this fails, so it is not failed like a new guest.
+func selectMigrationTarget(t *jobqueue.Task) (bool, error) {
+	functions := lochness.DefaultCandidateFunctions
+	if target := t.Job.Args["target"]; target != "" {
+		functions = append(targetCandidateFunctions, candidateIs(target))
+	}
+
+	// a guest moved to make room for a resize is placed at its new size
+	guest := t.Guest
+	flavorID := t.Job.Args["flavor"]
+	if flavorID != "" {
+		resized := *t.Guest
+		resized.FlavorID = flavorID
+		guest = &resized
+	}
+
+	candidates, err := guest.MigrationCandidates(functions...)
+	if err != nil {
+		return true, failMigration(t, fmt.Errorf("unable to select migration target %s - %s", t.Guest.ID, err))
 	}
 
+	// candidates are ranked best first
 	h := candidates[0]
 
-	// the API for selecting a candidate and then adding to a hypervisor is clunky
-	if err := h.AddGuest(t.Guest); err != nil {
-		return true, fmt.Errorf("unable to add guest %s to %s - %s", t.Guest.ID, h.ID, err)
+	if flavorID != "" {
+		err = t.Guest.PrepareResizeMigration(h, flavorID)
+	} else {
+		err = t.Guest.PrepareMigration(h)
+	}
+	if err != nil {
+		return true, failMigration(t, fmt.Errorf("unable to migrate guest %s to %s - %s", t.Guest.ID, h.ID, err))
 	}
 
+	if t.Job.Args == nil {
+		t.Job.Args = make(map[string]string)
+	}
+	t.Job.Args["hypervisor"] = h.ID
 	return false, nil
 }
 
+// failGuest marks the guest as failed to be placed and returns the placement
+// error
+func failGuest(t *jobqueue.Task, placeErr error) error {
+	if err := t.Guest.UpdateState(lochness.GuestStateFailed, placeErr.Error()); err != nil {
+		log.WithFields(log.Fields{
+			"task":  t,
+			"error": err,
+		}).Error("unable to update guest state")
+	}
+	return placeErr
+}
+
+// failMigration charges a guest that could not be moved to make room for a
+// resize to its quota at its current size again, and returns the placement
+// error
+func failMigration(t *jobqueue.Task, placeErr error) error {
+	if t.Job.Args["flavor"] == "" {
+		return placeErr
+	}
+	if err := t.Guest.ChargeQuota(); err != nil {
+		log.WithFields(log.Fields{
+			"task":  t,
+			"error": err,
+		}).Error("unable to charge quota")
+	}
+	return placeErr
+}
+
 func changeJobAction(jobQueue *jobqueue.Client, t *jobqueue.Task) (bool, error) {
-	t.Job.Action = "fetch"
+	// migrations keep their action and carry the selected target instead
+	if t.Job.Action == "select-hypervisor" {
+		t.Job.Action = "fetch"
+	}
 	if err := t.Job.Save(24 * time.Hour); err != nil {
 		return true, fmt.Errorf("unable to change job action - %s", err)
 	}
@@ -2,7 +2,6 @@ package main_test
 
 import (
 	"encoding/json"
-	"fmt"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -46,9 +45,13 @@ func (s *CmdSuite) SetupSuite() {
 	s.BinName = "cworkerd"
 	s.Port = "45363"
 
-	bPort := "59873"
-	s.BeanstalkdPath = fmt.Sprintf("127.0.0.1:%s", bPort)
-	s.BeanstalkdCmd = exec.Command("beanstalkd", "-p", bPort)
+	s.BeanstalkdPath = "127.0.0.1:59873"
+}
+
+func (s *CmdSuite) SetupTest() {
+	s.Suite.SetupTest()
+
+	s.BeanstalkdCmd = exec.Command("beanstalkd", "-p", "59873")
 	s.Require().NoError(s.BeanstalkdCmd.Start())
 	beanstalkdReady := false
 	for i := 0; i < 10; i++ {
@@ -63,10 +66,6 @@ func (s *CmdSuite) SetupSuite() {
 	jobQueue, err := jobqueue.NewClient(s.BeanstalkdPath, s.KV)
 	s.Require().NoError(err)
 	s.JobQueue = jobQueue
-}
-
-func (s *CmdSuite) SetupTest() {
-	s.Suite.SetupTest()
 
 	s.Agent = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.Contains(r.URL.Path, "guest") {
@@ -88,6 +87,8 @@ func (s *CmdSuite) SetupTest() {
 	s.Hypervisor, s.Guest = s.NewHypervisorWithGuest()
 	s.Hypervisor.IP = net.IP{127, 0, 0, 1}
 	_ = s.Hypervisor.Save()
+	s.Guest.State = lochness.GuestStateStopped
+	_ = s.Guest.Save()
 }
 
 func (s *CmdSuite) TearDownTest() {
@@ -98,26 +99,38 @@ func (s *CmdSuite) TearDownTest() {
 }
 
 func (s *CmdSuite) TestCmd() {
+	attachVolume := s.NewVolume()
+	s.Require().NoError(attachVolume.Attach(s.Guest))
+	detachVolume := s.NewVolume()
+	s.Require().NoError(detachVolume.Attach(s.Guest))
+	unattachedVolume := s.NewVolume()
 
 	tests := []struct {
 		description string
 		jobStatus   string
 		jobAction   string
 		guestID     string
+		args        map[string]string
 		expectedErr bool
 	}{
 		{"bad job action",
-			jobqueue.JobStatusNew, "foobar", s.Guest.ID, true},
+			jobqueue.JobStatusNew, "foobar", s.Guest.ID, nil, true},
 		{"nonexistent guest id",
-			jobqueue.JobStatusNew, "reboot", uuid.New(), true},
+			jobqueue.JobStatusNew, "reboot", uuid.New(), nil, true},
 		{"valid",
-			jobqueue.JobStatusNew, "reboot", s.Guest.ID, false},
+			jobqueue.JobStatusNew, "reboot", s.Guest.ID, nil, false},
+		{"attach volume",
+			jobqueue.JobStatusNew, "attach-volume", s.Guest.ID, map[string]string{"volume": attachVolume.ID}, false},
+		{"attach unattached volume",
+			jobqueue.JobStatusNew, "attach-volume", s.Guest.ID, map[string]string{"volume": unattachedVolume.ID}, true},
+		{"detach volume",
+			jobqueue.JobStatusNew, "detach-volume", s.Guest.ID, map[string]string{"volume": detachVolume.ID}, false},
 	}
 
 	for _, test := range tests {
 		msg := s.Messager(test.description)
 
-		job, err := s.JobQueue.AddJob(test.guestID, test.jobAction)
+		job, err := s.JobQueue.AddJobWithArgs(test.guestID, test.jobAction, test.args)
 		s.Require().NoError(err)
 		if test.jobStatus != jobqueue.JobStatusNew {
 			job.Status = test.jobStatus
@@ -170,4 +183,66 @@ func (s *CmdSuite) TestCmd() {
 		s.Equal(-1, status, msg("expected status code to be that of a killed process"))
 	}
 
+	s.NoError(attachVolume.Refresh())
+	s.Equal(s.Guest.ID, attachVolume.GuestID, "attached volume should remain attached")
+	s.NoError(detachVolume.Refresh())
+	s.Empty(detachVolume.GuestID, "detached volume should no longer be attached")
+
+	s.NoError(s.Guest.Refresh())
+	s.Equal(lochness.GuestStateRunning, s.Guest.State, "rebooted guest should be running")
+
+}
+
+func (s *CmdSuite) TestCmdMigrate() {
+	target := s.NewHypervisor()
+	target.IP = net.IP{127, 0, 0, 1}
+	s.Require().NoError(target.Save())
+	subnet, err := s.Context.Subnet(s.Guest.Interfaces[0].SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+	s.Require().NoError(s.Guest.PrepareMigration(target))
+	ip := s.Guest.Interfaces[0].IP
+
+	job, err := s.JobQueue.AddJobWithArgs(s.Guest.ID, "migrate", map[string]string{"hypervisor": target.ID})
+	s.Require().NoError(err)
+
+	args := []string{
+		"-p", s.Port,
+		"-k", s.KVURL,
+		"-b", s.BeanstalkdPath,
+		"-a", s.AgentPort,
+		"-l", "fatal",
+	}
+	cmd, err := common.Start("./"+s.BinName, args...)
+	s.Require().NoError(err)
+
+	// Wait for processing
+	for i := 0; i < 10; i++ {
+		time.Sleep(1 * time.Second)
+		if err := job.Refresh(); err != nil {
+			continue
+		}
+		if job.Status == jobqueue.JobStatusError || job.Status == jobqueue.JobStatusDone {
+			break
+		}
+		s.Require().NoError(job.Release())
+	}
+
+	s.Equal(jobqueue.JobStatusDone, job.Status, "should not have errored")
+	s.Empty(job.Error, "should not have error msg")
+	s.Equal("false", job.Args["live"], "stopped guest should migrate cold")
+
+	s.NoError(s.Guest.Refresh())
+	s.Equal(target.ID, s.Guest.HypervisorID, "should have cut over to the target")
+	s.Nil(s.Guest.Migration, "should have finished the migration")
+	s.Equal(ip, s.Guest.Interfaces[0].IP, "should have kept the address")
+	s.Equal("br1", s.Guest.Interfaces[0].Bridge)
+
+	s.NoError(s.Hypervisor.Refresh())
+	s.NotContains(s.Hypervisor.Guests(), s.Guest.ID)
+	s.NotContains(s.Hypervisor.Reservations, s.Guest.ID)
+	s.NoError(target.Refresh())
+	s.Contains(target.Guests(), s.Guest.ID)
+
+	_ = cmd.Stop()
 }
@@ -13,10 +13,39 @@ The following arguments are understood:
 	-b, --beanstalk="127.0.0.1:11300": address of beanstalkd server
 	-k, --kv="http://127.0.0.1:4001": address of kv server
 	-p, --http=7544: http port to publish metrics. set to 0 to disable
+	-i, --purge-interval=1m0s: how often deleted guests are checked for purging. set to 0 to disable
 	-l, --log-level="warn": log level
 
 Multiple instances may be run at the same time.
 
+A delete job only powers the guest off and moves it to the deleted state, where
+it keeps its addresses and resources in case it is undeleted. Each worker
+periodically looks for deleted guests whose retention has passed and queues a
+purge job for them, which deletes the guest from its hypervisor and then
+removes it for good. Only one worker queues the purge of a guest.
+
+An evacuate job, queued when a hypervisor is drained, deletes the guest from its
+hypervisor and then queues a new placement job for it.
+
+A migrate job asks the agent on the guest's hypervisor to move it to the target
+selected by cplacerd. The move is live if the guest is running and both
+hypervisors have the "liveMigration" config set to "true", and cold otherwise.
+Once the agent is done the guest is cut over to the target; if it fails, what
+was reserved on the target is released and the guest stays where it was. A
+guest migrated to make room for a resize has a resize job queued once it is
+cut over.
+
+A resize job asks the agent to apply the memory, cpus, disk and I/O limits of
+the guest's new flavor. Once the agent confirms, the guest is given the flavor
+and only what it needs is kept reserved and charged to its project's quota; if
+it fails, the guest keeps its flavor.
+
+Snapshot, delete-snapshot and rollback jobs ask the agent to act on a guest
+snapshot. Once a snapshot is taken its disk usage is recorded, and delete jobs
+are queued for any of the guest's snapshots beyond its snapshot limit. A
+snapshot that failed to be taken is removed, while one that failed to be deleted
+is kept.
+
 Guest Action Workflow
 https://github.com/mistifyio/lochness/wiki/Guest-Action-%22Workflows%22
 */
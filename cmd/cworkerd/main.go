@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -23,6 +24,7 @@ import (
 func main() {
 	var port, agentPort uint
 	var kvAddr, bstalk, logLevel string
+	var purgeInterval time.Duration
 
 	// Command line flags
 	flag.StringVarP(&bstalk, "beanstalk", "b", "127.0.0.1:11300", "address of beanstalkd server")
@@ -30,6 +32,7 @@ func main() {
 	flag.StringVarP(&kvAddr, "kv", "k", "http://127.0.0.1:4001", "address of kv server")
 	flag.UintVarP(&agentPort, "agent-port", "a", uint(lochness.AgentPort), "port on which agents listen")
 	flag.UintVarP(&port, "http", "p", 7544, "http port to publish metrics. set to 0 to disable")
+	flag.DurationVarP(&purgeInterval, "purge-interval", "i", time.Minute, "how often deleted guests are checked for purging. set to 0 to disable")
 	flag.Parse()
 
 	// Set up logger
@@ -67,13 +70,17 @@ func main() {
 
 	agent := ctx.NewMistifyAgent(int(agentPort))
 
+	if purgeInterval > 0 {
+		go purgeGuests(ctx, jobQueue, purgeInterval)
+	}
+
 	// Start consuming
 	for {
-		consume(jobQueue, agent, m)
+		consume(ctx, jobQueue, agent, m)
 	}
 }
 
-func consume(jobQueue *jobqueue.Client, agent *lochness.MistifyAgent, m *metrics.Metrics) {
+func consume(ctx *lochness.Context, jobQueue *jobqueue.Client, agent *lochness.MistifyAgent, m *metrics.Metrics) {
 	// Wait for and reserve a job
 	task, err := jobQueue.NextWorkTask()
 	if err != nil {
@@ -118,7 +125,7 @@ func consume(jobQueue *jobqueue.Client, agent *lochness.MistifyAgent, m *metrics
 	}
 
 	// Handle the task in its current state. Remove task when appropriate.
-	removeTask, err := processTask(task, agent)
+	removeTask, err := processTask(ctx, jobQueue, task, agent)
 
 	if removeTask {
 		if err != nil {
@@ -173,7 +180,7 @@ func setupMetrics(port uint) *metrics.Metrics {
 	return m
 }
 
-func processTask(task *jobqueue.Task, agent *lochness.MistifyAgent) (bool, error) {
+func processTask(ctx *lochness.Context, jobQueue *jobqueue.Client, task *jobqueue.Task, agent *lochness.MistifyAgent) (bool, error) {
 	logFields := log.Fields{
 		"task": task,
 	}
@@ -181,16 +188,12 @@ func processTask(task *jobqueue.Task, agent *lochness.MistifyAgent) (bool, error
 
 	switch task.Job.Status {
 	case jobqueue.JobStatusDone:
-		var err error
-		if task.Job.Action == "delete" {
-			err = postDelete(task)
-		}
-		return true, err
+		return true, postJob(ctx, jobQueue, task, nil)
 	case jobqueue.JobStatusError:
 		return true, nil
 	case jobqueue.JobStatusNew:
 		if err := startJob(task, agent); err != nil {
-			return true, err
+			return true, postJob(ctx, jobQueue, task, err)
 		}
 	case jobqueue.JobStatusWorking:
 		if done, err := checkWorkingJob(task, agent); done || err != nil {
@@ -198,10 +201,7 @@ func processTask(task *jobqueue.Task, agent *lochness.MistifyAgent) (bool, error
 				"task": task.ID,
 			}).Info("JOB DONE")
 
-			if err == nil && task.Job.Action == "delete" {
-				err = postDelete(task)
-			}
-			return true, err
+			return true, postJob(ctx, jobQueue, task, err)
 		}
 	}
 
@@ -223,7 +223,28 @@ func startJob(task *jobqueue.Task, agent *lochness.MistifyAgent) error {
 	case "create":
 		jobID, err = agent.CreateGuest(task.Guest.ID)
 	case "delete":
+		// a deleted guest is only stopped until it is purged
+		jobID, err = agent.GuestAction(task.Guest.ID, "poweroff")
+	case "purge", "evacuate":
 		jobID, err = agent.DeleteGuest(task.Guest.ID)
+	case "attach-volume":
+		jobID, err = agent.AttachVolume(task.Guest.ID, job.Args["volume"])
+	case "detach-volume":
+		jobID, err = agent.DetachVolume(task.Guest.ID, job.Args["volume"])
+	case "migrate":
+		var live bool
+		if live, err = task.Guest.CanLiveMigrate(); err == nil {
+			job.Args["live"] = strconv.FormatBool(live)
+			jobID, err = agent.MigrateGuest(task.Guest.ID, live)
+		}
+	case "resize":
+		jobID, err = agent.ResizeGuest(task.Guest.ID, job.Args["flavor"])
+	case "snapshot":
+		jobID, err = agent.CreateSnapshot(task.Guest.ID, job.Args["snapshot"])
+	case "delete-snapshot":
+		jobID, err = agent.DeleteSnapshot(task.Guest.ID, job.Args["snapshot"])
+	case "rollback":
+		jobID, err = agent.RollbackSnapshot(task.Guest.ID, job.Args["snapshot"])
 	default:
 		if _, ok := config.ValidActions[job.Action]; !ok {
 			return errors.New("invalid action")
@@ -236,6 +257,10 @@ func startJob(task *jobqueue.Task, agent *lochness.MistifyAgent) error {
 	}
 	task.Job.RemoteID = jobID
 	updateJobStatus(task, jobqueue.JobStatusWorking, nil)
+
+	if job.Action == "fetch" {
+		updateGuestState(task, lochness.GuestStateProvisioning, "fetching image")
+	}
 	return nil
 }
 
@@ -257,6 +282,19 @@ func checkWorkingJob(task *jobqueue.Task, agent *lochness.MistifyAgent) (bool, e
 		}
 	}
 
+	// the snapshot's disk usage is only known once it is taken. it is kept
+	// even if the usage can not be looked up.
+	if err == nil && done && task.Job.Action == "snapshot" {
+		size, sizeErr := agent.SnapshotSize(task.Guest.ID, task.Job.Args["snapshot"])
+		if sizeErr != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": sizeErr,
+			}).Error("unable to get snapshot size")
+		}
+		task.Job.Args["size"] = strconv.FormatUint(size, 10)
+	}
+
 	return done, err
 }
 
@@ -281,13 +319,338 @@ func updateJobStatus(task *jobqueue.Task, status string, e error) {
 	}
 }
 
+// postJob runs any follow up work for a finished job. jobErr is the error the
+// job finished with, if any, and is returned unless the follow up fails.
+func postJob(ctx *lochness.Context, jobQueue *jobqueue.Client, task *jobqueue.Task, jobErr error) error {
+	if task.Guest == nil {
+		return jobErr
+	}
+
+	postGuestState(task, jobErr)
+
+	switch task.Job.Action {
+	case "delete":
+		if jobErr == nil {
+			return postDelete(task)
+		}
+	case "purge":
+		if jobErr == nil {
+			return postPurge(task)
+		}
+	case "evacuate":
+		if jobErr == nil {
+			return postEvacuate(ctx, jobQueue, task)
+		}
+	case "detach-volume":
+		if jobErr == nil {
+			return postDetachVolume(ctx, task)
+		}
+	case "migrate":
+		return postMigrate(jobQueue, task, jobErr)
+	case "resize":
+		return postResize(task, jobErr)
+	case "snapshot":
+		return postSnapshot(ctx, jobQueue, task, jobErr)
+	case "delete-snapshot":
+		return postDeleteSnapshot(ctx, task, jobErr)
+	case "attach-volume":
+		if jobErr != nil {
+			// the attachment was recorded when the job was queued, so undo it
+			if err := postDetachVolume(ctx, task); err != nil {
+				log.WithFields(log.Fields{
+					"task":  task,
+					"error": err,
+				}).Error("unable to undo volume attachment")
+			}
+		}
+	}
+	return jobErr
+}
+
+// postGuestState moves the guest to the state a finished job leaves it in. A
+// failed provisioning, delete or purge job fails the guest, while a failed power
+// action leaves it as it was.
+func postGuestState(task *jobqueue.Task, jobErr error) {
+	action := task.Job.Action
+
+	var state, reason string
+	switch {
+	case jobErr != nil:
+		if action != "fetch" && action != "create" && action != "delete" && action != "purge" {
+			return
+		}
+		state, reason = lochness.GuestStateFailed, fmt.Sprintf("%s failed: %s", action, jobErr)
+	case action == "create":
+		state, reason = lochness.GuestStateRunning, action
+	default:
+		var ok bool
+		// a deleted guest is trashed by postDelete
+		if state, ok = lochness.GuestActionState(action); !ok || state == lochness.GuestStateDeleting {
+			return
+		}
+		reason = action
+	}
+
+	updateGuestState(task, state, reason)
+}
+
+// updateGuestState records the guest's new state. Failures are logged rather
+// than failing the job.
+func updateGuestState(task *jobqueue.Task, state, reason string) {
+	if err := task.Guest.UpdateState(state, reason); err != nil {
+		log.WithFields(log.Fields{
+			"task":  task,
+			"state": state,
+			"error": err,
+		}).Error("unable to update guest state")
+	}
+}
+
+// postDelete moves a guest stopped for deletion to the deleted state, where it
+// is kept until it is purged or undeleted
 func postDelete(task *jobqueue.Task) error {
 	log.WithFields(log.Fields{
 		"task": task,
 	}).Info("post delete")
+	return task.Guest.Trash()
+}
+
+// postPurge removes a guest deleted from its hypervisor for good, freeing its
+// addresses and resources
+func postPurge(task *jobqueue.Task) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post purge")
 	return task.Guest.Destroy()
 }
 
+// purgeGuests periodically queues purge jobs for the deleted guests whose
+// retention has passed. Moving a guest to purging is a compare and swap, so
+// only one of several workers queues its job.
+func purgeGuests(ctx *lochness.Context, jobQueue *jobqueue.Client, interval time.Duration) {
+	for {
+		guests, err := ctx.ExpiredGuests(time.Now())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"func":  "lochness.ExpiredGuests",
+			}).Error("failed to find expired guests")
+		}
+		for _, guest := range guests {
+			if err := guest.SetState(lochness.GuestStatePurging, "delete retention passed"); err != nil {
+				continue
+			}
+			if err := guest.Save(); err != nil {
+				// purged by another worker, or changed meanwhile
+				continue
+			}
+			if _, err := jobQueue.AddJob(guest.ID, "purge"); err != nil {
+				log.WithFields(log.Fields{
+					"guest": guest.ID,
+					"error": err,
+				}).Error("failed to queue purge job")
+				// a failed guest can be deleted again
+				if err := guest.UpdateState(lochness.GuestStateFailed, fmt.Sprintf("purge failed: %s", err)); err != nil {
+					log.WithFields(log.Fields{
+						"guest": guest.ID,
+						"error": err,
+					}).Error("unable to update guest state")
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// postEvacuate removes a guest deleted from its hypervisor by a drain and queues
+// it to be placed and created again elsewhere
+func postEvacuate(ctx *lochness.Context, jobQueue *jobqueue.Client, task *jobqueue.Task) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post evacuate")
+
+	hypervisor, err := ctx.Hypervisor(task.Guest.HypervisorID)
+	if err != nil {
+		return err
+	}
+	if err := hypervisor.RemoveGuest(task.Guest); err != nil {
+		return err
+	}
+	updateGuestState(task, lochness.GuestStatePending, fmt.Sprintf("evacuated from hypervisor %s", hypervisor.ID))
+
+	job, err := jobQueue.AddJob(task.Guest.ID, "select-hypervisor")
+	if err != nil {
+		return err
+	}
+	// the drain follows the guest through its placement
+	return hypervisor.SetDrainJob(task.Guest.ID, job.ID)
+}
+
+// postMigrate cuts a guest over to the hypervisor it was migrated to. If the
+// migration failed the guest stays where it was, and what was reserved for it
+// on the target is given back. A guest moved to make room for a resize is
+// queued to be resized on its new hypervisor.
+func postMigrate(jobQueue *jobqueue.Client, task *jobqueue.Task, jobErr error) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post migrate")
+
+	if err := task.RefreshGuest(); err != nil {
+		return err
+	}
+
+	if jobErr != nil {
+		if err := task.Guest.CancelMigration(); err != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": err,
+			}).Error("unable to cancel migration")
+		}
+		return jobErr
+	}
+
+	var flavorID string
+	if task.Guest.Migration != nil {
+		flavorID = task.Guest.Migration.FlavorID
+	}
+	if err := task.Guest.CompleteMigration(); err != nil {
+		return err
+	}
+	if flavorID == "" {
+		return nil
+	}
+
+	if err := task.Guest.PrepareResize(flavorID); err != nil {
+		if err := task.Guest.CancelResize(); err != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": err,
+			}).Error("unable to cancel resize")
+		}
+		return err
+	}
+	job, err := jobQueue.AddJobWithArgs(task.Guest.ID, "resize", map[string]string{"flavor": flavorID})
+	if err != nil {
+		return err
+	}
+	// the resize can be followed from the migration
+	task.Job.Args["resize-job"] = job.ID
+	return nil
+}
+
+// postResize gives a guest its new flavor once the agent has resized it. If
+// the resize failed the guest keeps its flavor and the extra reserved for it is
+// given back.
+func postResize(task *jobqueue.Task, jobErr error) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post resize")
+
+	if err := task.RefreshGuest(); err != nil {
+		return err
+	}
+
+	if jobErr != nil {
+		if err := task.Guest.CancelResize(); err != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": err,
+			}).Error("unable to cancel resize")
+		}
+		return jobErr
+	}
+	return task.Guest.CompleteResize(task.Job.Args["flavor"])
+}
+
+// postSnapshot records a snapshot taken by the agent and queues the deletion of
+// any of the guest's snapshots beyond its limit. A snapshot that failed is
+// removed.
+func postSnapshot(ctx *lochness.Context, jobQueue *jobqueue.Client, task *jobqueue.Task, jobErr error) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post snapshot")
+
+	snapshot, err := ctx.Snapshot(task.Job.Args["snapshot"])
+	if err != nil {
+		return err
+	}
+	if jobErr != nil {
+		if err := snapshot.Destroy(); err != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": err,
+			}).Error("unable to remove failed snapshot")
+		}
+		return jobErr
+	}
+
+	var size uint64
+	if s, ok := task.Job.Args["size"]; ok {
+		if size, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return err
+		}
+	}
+	if err := snapshot.Complete(size); err != nil {
+		return err
+	}
+
+	if err := task.RefreshGuest(); err != nil {
+		return err
+	}
+	expired, err := task.Guest.ExpiredSnapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range expired {
+		if err := s.SetDeleting(); err != nil {
+			return err
+		}
+		if _, err := jobQueue.AddJobWithArgs(task.Guest.ID, "delete-snapshot", map[string]string{"snapshot": s.ID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postDeleteSnapshot removes a snapshot deleted by the agent. A snapshot that
+// failed to delete is kept.
+func postDeleteSnapshot(ctx *lochness.Context, task *jobqueue.Task, jobErr error) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post delete snapshot")
+
+	snapshot, err := ctx.Snapshot(task.Job.Args["snapshot"])
+	if err != nil {
+		return err
+	}
+	if jobErr != nil {
+		snapshot.Status = lochness.SnapshotStatusCreated
+		if err := snapshot.Save(); err != nil {
+			log.WithFields(log.Fields{
+				"task":  task,
+				"error": err,
+			}).Error("unable to restore snapshot")
+		}
+		return jobErr
+	}
+	return snapshot.Destroy()
+}
+
+func postDetachVolume(ctx *lochness.Context, task *jobqueue.Task) error {
+	log.WithFields(log.Fields{
+		"task": task,
+	}).Info("post detach volume")
+
+	volume, err := ctx.Volume(task.Job.Args["volume"])
+	if err != nil {
+		return err
+	}
+	if volume.GuestID != task.Guest.ID {
+		return nil
+	}
+	return volume.Detach()
+}
+
 func updateMetrics(task *jobqueue.Task, m *metrics.Metrics) {
 	job := task.Job
 	m.MeasureSince([]string{"action", job.Action, "time"}, job.StartedAt)
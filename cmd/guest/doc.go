@@ -15,12 +15,15 @@ The following arguments are understood:
 	create      Create guests asynchronously
 	modify      Modify guests
 	delete      Delete guests asynchronously
+	undelete    Restore deleted guests before they are purged
 	shutdown    Shutdown guests asynchronously
 	reboot      Reboot guests asynchronously
 	restart     Restart guests asynchronously
 	poweroff    Poweroff guests asynchronously
 	start       Start guests asynchronously
 	suspend     Suspend guests asynchronously
+	migrate     Migrate guests to another hypervisor asynchronously
+	resize      Resize guests to another flavor asynchronously
 	job         Check status of guest jobs
 	help        Help about any command
 
@@ -48,6 +51,18 @@ a lochness.Guest for synchronous actions or the following for async actions:
 
 The job command either returns the job id or a JSON jobqueue.Job.
 
+The list command accepts --state (-t), a comma separated list of states, to only
+list guests in those states. A guest's state and recent state history are
+included in its JSON. It also accepts --selector (-l), a label selector such as
+"app=web,env in (prod,staging)", to only list guests with matching metadata.
+
+The migrate command accepts --hypervisor (-H) to name the hypervisor to migrate
+to; otherwise one is selected.
+
+The resize command takes pairs of guest and flavor ids. A guest whose
+hypervisor can not hold it at the new size is migrated first, so the job
+returned may be a migration.
+
 Examples
 
 List guests
@@ -57,20 +72,26 @@ List guests
 	e41a5a67-b37b-4591-8f74-c1bd997ade84
 
 	$ guest list -j
-	{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"1d1af312-1100-49e2-b3ad-09532ffc4e77","ip":"10.100.101.34","mac":"e3:80:38:b2:28:a1","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}
-	{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"e41a5a67-b37b-4591-8f74-c1bd997ade84","ip":"10.100.101.55","mac":"7f:e3:d6:59:22:bd","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}
+	{"flavor":"1","hypervisor":"","id":"1d1af312-1100-49e2-b3ad-09532ffc4e77","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.34","mac":"e3:80:38:b2:28:a1","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"foo"}
+	{"flavor":"1","hypervisor":"","id":"e41a5a67-b37b-4591-8f74-c1bd997ade84","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.55","mac":"7f:e3:d6:59:22:bd","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"foo"}
+
+	$ guest list --state running,stopped
+	1d1af312-1100-49e2-b3ad-09532ffc4e77
+
+	$ guest list -l app=web
+	e41a5a67-b37b-4591-8f74-c1bd997ade84
 
 	$ guest list -j 1d1af312-1100-49e2-b3ad-09532ffc4e77
-	{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"1d1af312-1100-49e2-b3ad-09532ffc4e77","ip":"10.100.101.34","mac":"e3:80:38:b2:28:a1","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}
+	{"flavor":"1","hypervisor":"","id":"1d1af312-1100-49e2-b3ad-09532ffc4e77","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.34","mac":"e3:80:38:b2:28:a1","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"foo"}
 
 Create guests
 
-	$ guest create '{"bridge":"br0", "flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234", "ip":"10.100.101.66", "mac":"A4-75-C1-6B-E3-49", "network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}' '{"bridge":"br0", "flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234", "ip":"10.100.101.66", "mac":"A4-75-C1-6B-E3-49", "network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}'
+	$ guest create '{"flavor":"1","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"A4-75-C1-6B-E3-49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"type":"foo"}' '{"flavor":"1","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"A4-75-C1-6B-E3-49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"type":"foo"}'
 	fbd0c7c2-5532-4abc-b6d8-c0cef0e8c1eb
 	52a27964-aeb8-49b5-9267-b3e98571e32d
 
-	$ guest create -j '{"bridge":"br0", "flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234", "ip":"10.100.101.66", "mac":"A4-75-C1-6B-E3-49", "network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}'
-	{"id":"fbd0c7c2-5532-4abc-b6d8-c0cef0e8c1eb","guest":{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"e217e622-b30b-41c1-87ac-a249152b3f32","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"foo"}}
+	$ guest create -j '{"flavor":"1","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"A4-75-C1-6B-E3-49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"type":"foo"}'
+	{"id":"fbd0c7c2-5532-4abc-b6d8-c0cef0e8c1eb","guest":{"flavor":"1","hypervisor":"","id":"e217e622-b30b-41c1-87ac-a249152b3f32","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"foo"}}
 
 Modify guests
 
@@ -79,7 +100,7 @@ Modify guests
 	41a7d3ca-685e-4a57-bc61-dce3e33b6b09
 
 	$ guest modify -j e2aae131-eff7-41ae-8541-73a48eb5295d '{"type":"qwerty"}'
-	{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"e2aae131-eff7-41ae-8541-73a48eb5295d","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"qwerty"}
+	{"flavor":"1","hypervisor":"","id":"e2aae131-eff7-41ae-8541-73a48eb5295d","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"qwerty"}
 
 Delete guests (also applies to shutdown, reboot, restart, poweroff, start,
 suspend)
@@ -88,7 +109,12 @@ suspend)
 	14e13848-e449-405a-ae04-b4bbc9016ac5
 
 	$ guest delete -j e2aae131-eff7-41ae-8541-73a48eb5295d
-	{"id":"14e13848-e449-405a-ae04-b4bbc9016ac5","guest":{"bridge":"br0","flavor":"1","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","hypervisor":"","id":"e2aae131-eff7-41ae-8541-73a48eb5295d","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","metadata":{},"network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","type":"qwerty"}}
+	{"id":"14e13848-e449-405a-ae04-b4bbc9016ac5","guest":{"flavor":"1","hypervisor":"","id":"e2aae131-eff7-41ae-8541-73a48eb5295d","interfaces":[{"bridge":"br0","fwgroup":"1234asdf-1234-asdf-1234-asdf1234asdf1234","ip":"10.100.101.66","mac":"a4:75:c1:6b:e3:49","network":"1234asdf-1234-asdf-1234-asdf1234asdf1234","subnet":"1234asdf-1234-asdf-1234-asdf1234asdf1234","vlangroup":""}],"metadata":{},"type":"qwerty"}}
+
+Undelete guests
+
+	$ guest undelete e2aae131-eff7-41ae-8541-73a48eb5295d
+	e2aae131-eff7-41ae-8541-73a48eb5295d
 
 Job status
 
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"sort"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -14,9 +16,12 @@ import (
 )
 
 var (
-	server  = "http://localhost:18000/"
-	jsonout = false
-	t       = "application/json"
+	server   = "http://localhost:18000/"
+	jsonout  = false
+	t        = "application/json"
+	states   = ""
+	selector = ""
+	target   = ""
 )
 
 func help(cmd *cobra.Command, _ []string) {
@@ -25,8 +30,19 @@ func help(cmd *cobra.Command, _ []string) {
 	}
 }
 
-func getGuests(c *cli.Client) []cli.JMap {
-	ret, _ := c.GetMany("guests", "guests")
+func getGuests(c *cli.Client, states, selector string) []cli.JMap {
+	query := url.Values{}
+	if states != "" {
+		query.Set("state", states)
+	}
+	if selector != "" {
+		query.Set("selector", selector)
+	}
+	endpoint := "guests"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	ret, _ := c.GetMany("guests", endpoint)
 	guests := make([]cli.JMap, len(ret))
 	for i := range ret {
 		guests[i] = ret[i]
@@ -72,6 +88,31 @@ func guestAction(c *cli.Client, id, action string) cli.JMap {
 	return j
 }
 
+func migrateGuest(c *cli.Client, id, hypervisor string) cli.JMap {
+	body := ""
+	if hypervisor != "" {
+		body = fmt.Sprintf(`{"hypervisor":%q}`, hypervisor)
+	}
+	guest, resp := c.Post("guest", fmt.Sprintf("guests/%s/migrate", id), body)
+	j := cli.JMap{
+		"id":    resp.Header.Get("x-guest-job-id"),
+		"guest": guest,
+	}
+
+	return j
+}
+
+func resizeGuest(c *cli.Client, id, flavor string) cli.JMap {
+	body := fmt.Sprintf(`{"flavor":%q}`, flavor)
+	guest, resp := c.Post("guest", fmt.Sprintf("guests/%s/resize", id), body)
+	j := cli.JMap{
+		"id":    resp.Header.Get("x-guest-job-id"),
+		"guest": guest,
+	}
+
+	return j
+}
+
 func getJob(c *cli.Client, id string) cli.JMap {
 	job, _ := c.Get("job", "jobs/"+id)
 	return job
@@ -82,16 +123,27 @@ func list(cmd *cobra.Command, args []string) {
 	guests := []cli.JMap{}
 	if len(args) == 0 {
 		if termutil.Isatty(os.Stdin.Fd()) {
-			guests = getGuests(c)
+			guests = getGuests(c, states, selector)
 			sort.Sort(cli.JMapSlice(guests))
 		} else {
 			args = cli.Read(os.Stdin)
 		}
 	}
 	if len(guests) == 0 {
+		wanted := make(map[string]bool)
+		for _, state := range strings.Split(states, ",") {
+			wanted[state] = true
+		}
+		sel := cli.AssertSelector(selector)
 		for _, id := range args {
 			cli.AssertID(id)
-			guests = append(guests, getGuest(c, id))
+			guest := getGuest(c, id)
+			if state, _ := guest["state"].(string); states != "" && !wanted[state] {
+				continue
+			}
+			if sel.Matches(guest.Labels()) {
+				guests = append(guests, guest)
+			}
 		}
 	}
 
@@ -146,6 +198,19 @@ func del(cmd *cobra.Command, ids []string) {
 	}
 }
 
+func undelete(cmd *cobra.Command, ids []string) {
+	c := cli.NewClient(server)
+	if len(ids) == 0 {
+		ids = cli.Read(os.Stdin)
+	}
+
+	for _, id := range ids {
+		cli.AssertID(id)
+		guest, _ := c.Post("guest", fmt.Sprintf("guests/%s/undelete", id), "")
+		cli.JMap(guest).Print(jsonout)
+	}
+}
+
 func generateActionHandler(action string) func(*cobra.Command, []string) {
 	return func(cmd *cobra.Command, ids []string) {
 		c := cli.NewClient(server)
@@ -161,6 +226,42 @@ func generateActionHandler(action string) func(*cobra.Command, []string) {
 	}
 }
 
+func migrate(cmd *cobra.Command, ids []string) {
+	c := cli.NewClient(server)
+	if len(ids) == 0 {
+		ids = cli.Read(os.Stdin)
+	}
+	if target != "" {
+		cli.AssertID(target)
+	}
+
+	for _, id := range ids {
+		cli.AssertID(id)
+		j := migrateGuest(c, id, target)
+		j.Print(jsonout)
+	}
+}
+
+func resize(cmd *cobra.Command, args []string) {
+	c := cli.NewClient(server)
+	if len(args) == 0 {
+		args = cli.Read(os.Stdin)
+	}
+	if len(args)%2 != 0 {
+		log.WithField("num", len(args)).Fatal("expected an even number of args")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		id := args[i]
+		cli.AssertID(id)
+		flavor := args[i+1]
+		cli.AssertID(flavor)
+
+		j := resizeGuest(c, id, flavor)
+		j.Print(jsonout)
+	}
+}
+
 func job(cmd *cobra.Command, ids []string) {
 	c := cli.NewClient(server)
 	if len(ids) == 0 {
@@ -188,6 +289,8 @@ func main() {
 		Short: "List the guests",
 		Run:   list,
 	}
+	cmdList.Flags().StringVarP(&states, "state", "t", states, "only list guests in these comma separated states")
+	cmdList.Flags().StringVarP(&selector, "selector", "l", selector, "only list guests with metadata matching this label selector")
 	root.AddCommand(cmdList)
 
 	cmdCreate := &cobra.Command{
@@ -209,10 +312,18 @@ func main() {
 	cmdDelete := &cobra.Command{
 		Use:   "delete <id>...",
 		Short: "Delete guests asynchronously",
+		Long:  "Delete guest(s) asynchronously. A deleted guest is stopped and kept, along with its addresses and resources, until the delete retention passes and it is purged.",
 		Run:   del,
 	}
 	root.AddCommand(cmdDelete)
 
+	cmdUndelete := &cobra.Command{
+		Use:   "undelete <id>...",
+		Short: "Restore deleted guests before they are purged",
+		Run:   undelete,
+	}
+	root.AddCommand(cmdUndelete)
+
 	for _, action := range []string{"shutdown", "reboot", "restart", "poweroff", "start", "suspend"} {
 		a, n := utf8.DecodeRuneInString(action)
 		cmdAction := &cobra.Command{
@@ -223,6 +334,23 @@ func main() {
 		root.AddCommand(cmdAction)
 	}
 
+	cmdMigrate := &cobra.Command{
+		Use:   "migrate <id>...",
+		Short: "Migrate guests to another hypervisor asynchronously",
+		Long:  "Migrate guest(s) to another hypervisor, keeping their addresses where the hypervisor bridges the same subnets. The hypervisor is selected automatically unless given.",
+		Run:   migrate,
+	}
+	cmdMigrate.Flags().StringVarP(&target, "hypervisor", "H", target, "hypervisor to migrate to")
+	root.AddCommand(cmdMigrate)
+
+	cmdResize := &cobra.Command{
+		Use:   "resize (<id> <flavor>)...",
+		Short: "Resize guests to another flavor asynchronously",
+		Long:  "Resize guest(s) to another flavor, migrating them first if their hypervisor can not hold the new size.",
+		Run:   resize,
+	}
+	root.AddCommand(cmdResize)
+
 	cmdJob := &cobra.Command{
 		Use:   "job <id>...",
 		Short: "Check status of guest jobs",
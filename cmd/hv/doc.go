@@ -1,13 +1,17 @@
 /*
 hv is the command line interface to chypervisord, the hypervisor management
 service. hv can list/modify/delete hypervisors, hypervisor guests, hypervisors
-subnets, and hypervisor configs.
+subnets, and hypervisor configs, and take hypervisors out of service for
+maintenance.
 
 All commands support dual output formats, a tree like output for humans
 (default) or a json output for further processing.
 
 Most commands accept 0 or many arguments, a couple require at least 1 argument.
 
+The list command accepts --selector (-l), a label selector such as
+"rack in (a1,a2)", to only list hypervisors with matching metadata.
+
 Usage
 
 The following arguments are understood:
@@ -24,6 +28,9 @@ The following arguments are understood:
 	create      Create new hypervisors
 	delete      Delete hypervisors
 	modify      Modify hypervisors
+	cordon      Stop placing new guests on hypervisors
+	uncordon    Resume placing new guests on hypervisors
+	drain       Move all guests off hypervisors
 	guests      Operate on hypervisor guests
 	config      Operate on hypervisor config
 	subnets     Operate on hypervisor subnets
@@ -46,6 +53,9 @@ List hypervisors
 	f403a417-f973-48f1-bea4-0283da8645a2
 	f718449c-ed60-4e70-ac70-9b7710d2d68d
 
+	$ hv list -l 'rack in (a1,a2)'
+	aa44c6e8-3ee3-4671-86da-31b6b060795c
+
 	$ hv list -j
 	{"available_resources":{"cpu":0,"disk":0,"memory":0},"gateway":"","id":"aa44c6e8-3ee3-4671-86da-31b6b060795c","ip":"10.100.101.34","mac":"01:23:45:67:89:ab","metadata":{},"netmask":"","total_resources":{"cpu":0,"disk":0,"memory":0}}
 	{"available_resources":{"cpu":0,"disk":0,"memory":0},"gateway":"","id":"f403a417-f973-48f1-bea4-0283da8645a2","ip":"10.100.101.34","mac":"01:23:45:67:89:ab","metadata":{},"netmask":"","total_resources":{"cpu":0,"disk":0,"memory":0}}
@@ -119,6 +129,26 @@ Delete hypervisors
 	$ hv delete f403a417-f973-48f1-bea4-0283da8645a2
 	f403a417-f973-48f1-bea4-0283da8645a2
 
+Take hypervisors out of service
+
+	# cordon stops new guests from being placed, drain also moves existing
+	# guests elsewhere
+	$ hv cordon aa44c6e8-3ee3-4671-86da-31b6b060795c
+	aa44c6e8-3ee3-4671-86da-31b6b060795c
+
+	$ hv drain aa44c6e8-3ee3-4671-86da-31b6b060795c
+	aa44c6e8-3ee3-4671-86da-31b6b060795c (2 remaining)
+	├── 333434fe-2743-4b35-87cc-13fd62ba13fc:evacuate new
+	└── 9c931fd1-9851-4658-83c3-0cb994266264:evacuate new
+
+	$ hv drain --status aa44c6e8-3ee3-4671-86da-31b6b060795c
+	aa44c6e8-3ee3-4671-86da-31b6b060795c (1 remaining)
+	├── 333434fe-2743-4b35-87cc-13fd62ba13fc:create working
+	└── 9c931fd1-9851-4658-83c3-0cb994266264:evacuate working
+
+	$ hv uncordon aa44c6e8-3ee3-4671-86da-31b6b060795c
+	aa44c6e8-3ee3-4671-86da-31b6b060795c
+
 List subnets for hypervisors
 
 	$ hv subnets list
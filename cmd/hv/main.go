@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"sort"
 
@@ -12,8 +13,10 @@ import (
 )
 
 var (
-	server  = "http://localhost:17000"
-	jsonout = false
+	server      = "http://localhost:17000"
+	jsonout     = false
+	selector    = ""
+	drainStatus = false
 )
 
 func printTreeMap(id, key string, m map[string]interface{}) {
@@ -75,8 +78,12 @@ func help(cmd *cobra.Command, _ []string) {
 	}
 }
 
-func getHVs(c *cli.Client) []cli.JMap {
-	ret, _ := c.GetMany("hypervisors", "hypervisors")
+func getHVs(c *cli.Client, selector string) []cli.JMap {
+	endpoint := "hypervisors"
+	if selector != "" {
+		endpoint += "?selector=" + url.QueryEscape(selector)
+	}
+	ret, _ := c.GetMany("hypervisors", endpoint)
 	// wasteful you say?
 	hvs := make([]cli.JMap, len(ret))
 	for i := range ret {
@@ -125,21 +132,61 @@ func deleteSubnet(c *cli.Client, hv, subnet string) cli.JMap {
 	return sub
 }
 
+func cordonHV(c *cli.Client, id string, cordon bool) cli.JMap {
+	action := "cordon"
+	if !cordon {
+		action = "uncordon"
+	}
+	hv, _ := c.Post("hypervisor", "hypervisors/"+id+"/"+action, "")
+	return hv
+}
+
+func getDrain(c *cli.Client, id string) cli.JMap {
+	status, _ := c.Get("drain", "hypervisors/"+id+"/drain")
+	return status
+}
+
+func drainHV(c *cli.Client, id string) cli.JMap {
+	status, _ := c.Post("drain", "hypervisors/"+id+"/drain", "")
+	return status
+}
+
+// printDrain prints the progress of a drain, with the job action and status
+// of each guest being moved
+func printDrain(status cli.JMap) {
+	if jsonout {
+		fmt.Println(status)
+		return
+	}
+
+	progress := map[string]interface{}{}
+	guests, _ := status["guests"].(map[string]interface{})
+	for id, g := range guests {
+		guest, _ := g.(map[string]interface{})
+		progress[id] = fmt.Sprintf("%v %v", guest["action"], guest["status"])
+	}
+	printTreeMap(fmt.Sprintf("%s (%v remaining)", status.ID(), status["remaining"]), "guests", progress)
+}
+
 func list(cmd *cobra.Command, args []string) {
 	c := cli.NewClient(server)
 	hvs := []cli.JMap{}
 	if len(args) == 0 {
 		if termutil.Isatty(os.Stdin.Fd()) {
-			hvs = getHVs(c)
+			hvs = getHVs(c, selector)
 			sort.Sort(cli.JMapSlice(hvs))
 		} else {
 			args = cli.Read(os.Stdin)
 		}
 	}
 	if len(hvs) == 0 {
+		sel := cli.AssertSelector(selector)
 		for _, id := range args {
 			cli.AssertID(id)
-			hvs = append(hvs, getHV(c, id))
+			hv := getHV(c, id)
+			if sel.Matches(hv.Labels()) {
+				hvs = append(hvs, hv)
+			}
 		}
 	}
 
@@ -198,7 +245,7 @@ func guests(cmd *cobra.Command, ids []string) {
 	c := cli.NewClient(server)
 	if len(ids) == 0 {
 		if termutil.Isatty(os.Stdin.Fd()) {
-			for _, hv := range getHVs(c) {
+			for _, hv := range getHVs(c, "") {
 				ids = append(ids, hv["id"].(string))
 			}
 		} else {
@@ -221,7 +268,7 @@ func config(cmd *cobra.Command, ids []string) {
 	c := cli.NewClient(server)
 	if len(ids) == 0 {
 		if termutil.Isatty(os.Stdin.Fd()) {
-			for _, hv := range getHVs(c) {
+			for _, hv := range getHVs(c, "") {
 				ids = append(ids, hv["id"].(string))
 			}
 		} else {
@@ -264,7 +311,7 @@ func subnets(cmd *cobra.Command, ids []string) {
 	c := cli.NewClient(server)
 	if len(ids) == 0 {
 		if termutil.Isatty(os.Stdin.Fd()) {
-			for _, hv := range getHVs(c) {
+			for _, hv := range getHVs(c, "") {
 				ids = append(ids, hv["id"].(string))
 			}
 		} else {
@@ -323,6 +370,50 @@ func subnetsDel(cmd *cobra.Command, args []string) {
 	}
 }
 
+func cordon(cmd *cobra.Command, ids []string) {
+	c := cli.NewClient(server)
+	if len(ids) == 0 {
+		ids = cli.Read(os.Stdin)
+	}
+
+	for _, id := range ids {
+		cli.AssertID(id)
+		hv := cordonHV(c, id, true)
+		hv.Print(jsonout)
+	}
+}
+
+func uncordon(cmd *cobra.Command, ids []string) {
+	c := cli.NewClient(server)
+	if len(ids) == 0 {
+		ids = cli.Read(os.Stdin)
+	}
+
+	for _, id := range ids {
+		cli.AssertID(id)
+		hv := cordonHV(c, id, false)
+		hv.Print(jsonout)
+	}
+}
+
+func drain(cmd *cobra.Command, ids []string) {
+	c := cli.NewClient(server)
+	if len(ids) == 0 {
+		ids = cli.Read(os.Stdin)
+	}
+
+	for _, id := range ids {
+		cli.AssertID(id)
+		var status cli.JMap
+		if drainStatus {
+			status = getDrain(c, id)
+		} else {
+			status = drainHV(c, id)
+		}
+		printDrain(status)
+	}
+}
+
 func main() {
 	root := &cobra.Command{
 		Use:  "hv",
@@ -337,6 +428,7 @@ func main() {
 		Short: "List the hypervisors",
 		Run:   list,
 	}
+	cmdList.Flags().StringVarP(&selector, "selector", "l", selector, "only list hypervisors with metadata matching this label selector")
 	cmdCreate := &cobra.Command{
 		Use:   "create <spec>...",
 		Short: "Create new hypervisors",
@@ -402,11 +494,33 @@ valid json and contain the required fields, "mac" and "ip".`,
 		Short: "Delete hypervisor subnets",
 		Run:   subnetsDel,
 	}
+	cmdCordon := &cobra.Command{
+		Use:   "cordon <hv>...",
+		Short: "Stop placing new guests on hypervisors",
+		Run:   cordon,
+	}
+	cmdUncordon := &cobra.Command{
+		Use:   "uncordon <hv>...",
+		Short: "Resume placing new guests on hypervisors",
+		Run:   uncordon,
+	}
+	cmdDrain := &cobra.Command{
+		Use:   "drain <hv>...",
+		Short: "Move all guests off hypervisors",
+		Long: `Cordon the given hypervisors and queue jobs recreating each of their guests on
+another hypervisor, then print the progress of every guest being moved. Draining
+again retries the guests whose jobs failed.`,
+		Run: drain,
+	}
+	cmdDrain.Flags().BoolVarP(&drainStatus, "status", "S", drainStatus, "only print the progress of an earlier drain")
 
 	root.AddCommand(cmdList,
 		cmdCreate,
 		cmdDel,
 		cmdMod,
+		cmdCordon,
+		cmdUncordon,
+		cmdDrain,
 		cmdGuestsRoot,
 		cmdConfigRoot,
 		cmdSubnetsRoot)
@@ -72,7 +72,13 @@ Download image
 
 Delete image
 
+Images used by flavors are not deleted unless forced. The flavors are looked up
+in the kv server given by -k/--kv.
+
 	$ img delete 95f012e0-56a5-47e0-96df-38b806feda63
 	95f012e0-56a5-47e0-96df-38b806feda63
+
+	$ img delete -f 27925fad-2243-4dd3-99e1-ea5f5df33c6b
+	27925fad-2243-4dd3-99e1-ea5f5df33c6b
 */
 package main
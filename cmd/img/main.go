@@ -14,7 +14,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/andrew-d/go-termutil"
+	"github.com/mistifyio/lochness"
 	"github.com/mistifyio/lochness/internal/cli"
+	"github.com/mistifyio/lochness/pkg/kv"
+	_ "github.com/mistifyio/lochness/pkg/kv/consul"
 	"github.com/mistifyio/mistify-image-service/metadata"
 	logx "github.com/mistifyio/mistify-logrus-ext"
 	netutil "github.com/mistifyio/util/net"
@@ -25,6 +28,8 @@ var (
 	server      = "image.services.lochness.local"
 	jsonout     = false
 	downloadDir = os.TempDir()
+	kvAddress   = "http://127.0.0.1:4001"
+	force       = false
 )
 
 func help(cmd *cobra.Command, _ []string) {
@@ -249,14 +254,52 @@ func download(cmd *cobra.Command, ids []string) {
 	}
 }
 
+// assertUnused exits if any flavor uses the image
+func assertUnused(ctx *lochness.Context, id string) {
+	flavors, err := ctx.ImageFlavors(id)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+			"id":    id,
+			"func":  "lochness.Context.ImageFlavors",
+		}).Fatal("failed to check image flavors")
+	}
+	if len(flavors) == 0 {
+		return
+	}
+	flavorIDs := make([]string, len(flavors))
+	for i, flavor := range flavors {
+		flavorIDs[i] = flavor.ID
+	}
+	log.WithFields(log.Fields{
+		"id":      id,
+		"flavors": flavorIDs,
+	}).Fatal("image is used by flavors; use --force to delete anyway")
+}
+
 func del(cmd *cobra.Command, ids []string) {
 	c := cli.NewClient(getServerURL())
 	if len(ids) == 0 {
 		ids = cli.Read(os.Stdin)
 	}
 
+	var ctx *lochness.Context
+	if !force {
+		KV, err := kv.New(kvAddress)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err,
+				"func":  "kv.New",
+			}).Fatal("failed to create kv client")
+		}
+		ctx = lochness.NewContext(KV)
+	}
+
 	for _, id := range ids {
 		cli.AssertID(id)
+		if !force {
+			assertUnused(ctx, id)
+		}
 		image, _ := c.Delete("image", "images/"+id)
 		cli.JMap(image).Print(jsonout)
 	}
@@ -326,8 +369,11 @@ func main() {
 	cmdDelete := &cobra.Command{
 		Use:   "delete <id>...",
 		Short: "Delete images",
+		Long:  "Delete images. Images used by flavors are not deleted unless forced.",
 		Run:   del,
 	}
+	cmdDelete.Flags().StringVarP(&kvAddress, "kv", "k", kvAddress, "address of kv server, to check for flavors using the images")
+	cmdDelete.Flags().BoolVarP(&force, "force", "f", force, "delete images even if flavors use them")
 	root.AddCommand(cmdDelete)
 
 	if err := root.Execute(); err != nil {
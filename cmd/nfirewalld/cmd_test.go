@@ -44,7 +44,7 @@ func (s *CmdSuite) SetupTest() {
 	s.Hypervisor, s.Guest = s.NewHypervisorWithGuest()
 	s.FWGroup = s.NewFWGroup()
 	s.Require().NoError(newFWRule(s.FWGroup, "deny", "192.168.1.100/16", 2000, 3000), "failed to add FWRule")
-	s.Guest.FWGroupID = s.FWGroup.ID
+	s.Guest.Interfaces[0].FWGroupID = s.FWGroup.ID
 	s.Require().NoError(s.Guest.Save(), "failed to save guest with FWGroup ID")
 }
 
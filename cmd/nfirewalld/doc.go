@@ -3,6 +3,11 @@ nfirewalld is a simple firewall daemon that monitors a kv for firewall configura
 The firewall is implemented using nftables.
 When guests or firewall groups are added, modified, or removed, a new firewall configuration is generated and nftables is reloaded.
 
+Each firewall group becomes a chain of its ingress rules and a chain of its egress rules, in rule order, with allow, deny and reject actions mapped to nftables verdicts.
+Traffic to a guest jumps to the ingress chain of its group, and is rejected unless a rule allows it.
+Traffic from a guest jumps to the egress chain of its group first, so guest to guest traffic passes the egress rules of the sender and the ingress rules of the receiver.
+A group with an allow egress rule rejects the egress traffic its rules do not allow, while a group without one lets out all the traffic its deny and reject rules do not block; traffic of guests without a firewall group is not forwarded.
+
 Usage
 
 The following arguments are understood:
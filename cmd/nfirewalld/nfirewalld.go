@@ -20,15 +20,32 @@ import (
 )
 
 const (
-	nftSinglePort = "%s dport %d %s"
-	nftPortRange  = "%s dport %d - %d %s"
+	nftSinglePort = "%s dport %d"
+	nftPortRange  = "%s dport %d - %d"
 )
 
+// nftVerdicts are the nft verdicts of FWRule actions. Allowed egress traffic
+// returns rather than accepts, so the ingress rules of the receiving guest
+// still apply.
+var nftVerdicts = map[string]map[string]string{
+	ln.FWDirectionIngress: {
+		ln.FWActionAllow:  "accept",
+		ln.FWActionDeny:   "drop",
+		ln.FWActionReject: "reject",
+	},
+	ln.FWDirectionEgress: {
+		ln.FWActionAllow:  "return",
+		ln.FWActionDeny:   "drop",
+		ln.FWActionReject: "reject",
+	},
+}
+
 type groupVal struct {
-	num   int
-	id    string
-	ips   []string
-	rules []string
+	num     int
+	id      string
+	ips     []string
+	ingress []string
+	egress  []string
 }
 
 type templateData struct {
@@ -52,33 +69,46 @@ func (g groupMap) Index(id string) int {
 
 type guestMap map[string]int
 
-// genNFRules iterates through each FWRule and creates the nft rule line
-func genNFRules(groups groupMap, fwrules ln.FWRules) []string {
-	var nftrules []string
+// genNFRules iterates through each FWRule and creates the nft rule lines, in
+// order, of each direction. Egress ends with a reject if any egress rule
+// allows traffic, making the allowed traffic the only traffic let out.
+func genNFRules(groups groupMap, fwrules ln.FWRules) (ingress, egress []string) {
+	var egressAllowed bool
 	for _, rule := range fwrules {
-		source := ""
-		if rule.Group != "" {
-			source += "ip saddr @s" + strconv.Itoa(groups.Index(rule.Group))
+		direction := rule.Direction
+		if direction == "" {
+			direction = ln.FWDirectionIngress
 		}
-		if rule.Source != nil {
-			if source != "" {
-				source += " "
-			}
-			source += "ip saddr " + rule.Source.String()
+		action := rule.Action
+		if action == "" {
+			action = ln.FWActionAllow
+		}
+		verdict, ok := nftVerdicts[direction][action]
+		if !ok {
+			log.WithFields(log.Fields{
+				"direction": rule.Direction,
+				"action":    rule.Action,
+				"error":     "invalid rule",
+			}).Error("invalid direction or action specified")
+			continue
 		}
 
-		nftRule := ""
+		// the remote end is the source of ingress and the destination of egress
+		remote := "ip saddr "
+		if direction == ln.FWDirectionEgress {
+			remote = "ip daddr "
+		}
+
+		var parts []string
 		if rule.PortStart == rule.PortEnd {
-			nftRule = fmt.Sprintf(nftSinglePort,
+			parts = append(parts, fmt.Sprintf(nftSinglePort,
 				rule.Protocol,
-				rule.PortEnd,
-				source)
+				rule.PortEnd))
 		} else if rule.PortStart < rule.PortEnd {
-			nftRule = fmt.Sprintf(nftPortRange,
+			parts = append(parts, fmt.Sprintf(nftPortRange,
 				rule.Protocol,
 				rule.PortStart,
-				rule.PortEnd,
-				source)
+				rule.PortEnd))
 		} else {
 			log.WithFields(log.Fields{
 				"start": rule.PortStart,
@@ -87,9 +117,26 @@ func genNFRules(groups groupMap, fwrules ln.FWRules) []string {
 			}).Error("invalid port range specified")
 			continue
 		}
-		nftrules = append(nftrules, nftRule)
+		if rule.Group != "" {
+			parts = append(parts, remote+"@s"+strconv.Itoa(groups.Index(rule.Group)))
+		}
+		if rule.Source != nil {
+			parts = append(parts, remote+rule.Source.String())
+		}
+		parts = append(parts, verdict)
+
+		nftRule := strings.Join(parts, " ")
+		if direction == ln.FWDirectionEgress {
+			egress = append(egress, nftRule)
+			egressAllowed = egressAllowed || action == ln.FWActionAllow
+		} else {
+			ingress = append(ingress, nftRule)
+		}
 	}
-	return nftrules
+	if egressAllowed {
+		egress = append(egress, "reject")
+	}
+	return ingress, egress
 }
 
 func getGuestsFWGroups(c *ln.Context, hv *ln.Hypervisor) (groupMap, guestMap) {
@@ -98,35 +145,42 @@ func getGuestsFWGroups(c *ln.Context, hv *ln.Hypervisor) (groupMap, guestMap) {
 	n := len(groups)
 
 	_ = hv.ForEachGuest(func(guest *ln.Guest) error {
-		// check if in cache
-		g, ok := groups[guest.FWGroupID]
-		if ok {
-			// link the guest to the FWGroup, via the FWGroup's index
-			guests[guest.IP.String()] = g.num
-			return nil
-		}
+		for _, iface := range guest.Interfaces {
+			// interfaces without a FWGroup are left to the default rules
+			if iface.IP == nil || iface.FWGroupID == "" {
+				continue
+			}
 
-		// nope not cached
-		fw, err := c.FWGroup(guest.FWGroupID)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"error": err,
-				"func":  "context.FWGroup",
-				"group": guest.FWGroupID,
-			}).Error("failed to get firewall group")
-			return err
-		}
+			// check if in cache
+			g, ok := groups[iface.FWGroupID]
+			if ok {
+				// link the interface to the FWGroup, via the FWGroup's index
+				guests[iface.IP.String()] = g.num
+				continue
+			}
 
-		g = groupVal{
-			num:   n,
-			id:    fw.ID,
-			rules: genNFRules(groups, fw.Rules),
-		}
-		n++
-		groups[guest.FWGroupID] = g
+			// nope not cached
+			fw, err := c.FWGroup(iface.FWGroupID)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"error": err,
+					"func":  "context.FWGroup",
+					"group": iface.FWGroupID,
+				}).Error("failed to get firewall group")
+				return err
+			}
+
+			g = groupVal{
+				num: n,
+				id:  fw.ID,
+			}
+			g.ingress, g.egress = genNFRules(groups, fw.Rules)
+			n++
+			groups[iface.FWGroupID] = g
 
-		// link the guest to the FWGroup, via the FWGroup's index
-		guests[guest.IP.String()] = g.num
+			// link the interface to the FWGroup, via the FWGroup's index
+			guests[iface.IP.String()] = g.num
+		}
 		return nil
 	})
 	return groups, guests
@@ -134,16 +188,19 @@ func getGuestsFWGroups(c *ln.Context, hv *ln.Hypervisor) (groupMap, guestMap) {
 
 func populateGroupMembers(c *ln.Context, groups groupMap) {
 	_ = c.ForEachGuest(func(guest *ln.Guest) error {
-		group, ok := groups[guest.FWGroupID]
-		if !ok {
-			// not a FWGroup referenced by any guest's FWGroup
-			return nil
-		}
+		for _, iface := range guest.Interfaces {
+			if iface.IP == nil {
+				continue
+			}
+			group, ok := groups[iface.FWGroupID]
+			if !ok {
+				// not a FWGroup referenced by any guest's FWGroup
+				continue
+			}
 
-		ips := group.ips
-		ips = append(ips, guest.IP.String())
-		group.ips = ips
-		groups[guest.FWGroupID] = group
+			group.ips = append(group.ips, iface.IP.String())
+			groups[iface.FWGroupID] = group
+		}
 		return nil
 	})
 }
@@ -20,74 +20,142 @@ func nftWrite(w io.Writer, ip string, groups groupMap, guests guestMap) error {
 //line nftables.ego:7
 		_, _ = fmt.Fprintf(w, "%v", fwg.num)
 //line nftables.ego:7
-		_, _ = fmt.Fprintf(w, " {")
+		_, _ = fmt.Fprintf(w, "_in {")
 //line nftables.ego:7
-		for _, rule := range fwg.rules {
+		for _, rule := range fwg.ingress {
 //line nftables.ego:8
 			_, _ = fmt.Fprintf(w, "\n      ")
 //line nftables.ego:8
 			_, _ = fmt.Fprintf(w, "%v", rule)
 //line nftables.ego:8
-			_, _ = fmt.Fprintf(w, " accept ")
+			_, _ = fmt.Fprintf(w, " ")
 //line nftables.ego:8
 		}
 //line nftables.ego:9
-		_, _ = fmt.Fprintf(w, "\n  }\n  set s")
+		_, _ = fmt.Fprintf(w, "\n  }\n  chain g")
 //line nftables.ego:10
 		_, _ = fmt.Fprintf(w, "%v", fwg.num)
 //line nftables.ego:10
-		_, _ = fmt.Fprintf(w, " {\n    type ipv4_addr")
+		_, _ = fmt.Fprintf(w, "_out {")
+//line nftables.ego:10
+		for _, rule := range fwg.egress {
 //line nftables.ego:11
-		if len(fwg.ips) > 0 {
+			_, _ = fmt.Fprintf(w, "\n      ")
+//line nftables.ego:11
+			_, _ = fmt.Fprintf(w, "%v", rule)
+//line nftables.ego:11
+			_, _ = fmt.Fprintf(w, " ")
+//line nftables.ego:11
+		}
 //line nftables.ego:12
+		_, _ = fmt.Fprintf(w, "\n  }\n  set s")
+//line nftables.ego:13
+		_, _ = fmt.Fprintf(w, "%v", fwg.num)
+//line nftables.ego:13
+		_, _ = fmt.Fprintf(w, " {\n    type ipv4_addr")
+//line nftables.ego:14
+		if len(fwg.ips) > 0 {
+//line nftables.ego:15
 			_, _ = fmt.Fprintf(w, "\n    elements = { ")
-//line nftables.ego:12
+//line nftables.ego:15
 			for _, ip := range fwg.ips {
-//line nftables.ego:13
+//line nftables.ego:16
 				_, _ = fmt.Fprintf(w, "\n      ")
-//line nftables.ego:13
+//line nftables.ego:16
 				_, _ = fmt.Fprintf(w, "%v", ip)
-//line nftables.ego:13
+//line nftables.ego:16
 				_, _ = fmt.Fprintf(w, ", ")
-//line nftables.ego:13
+//line nftables.ego:16
 			}
-//line nftables.ego:14
+//line nftables.ego:17
 			_, _ = fmt.Fprintf(w, "\n    }")
-//line nftables.ego:14
+//line nftables.ego:17
 		}
-//line nftables.ego:15
+//line nftables.ego:18
 		_, _ = fmt.Fprintf(w, "\n  }\n  ")
-//line nftables.ego:16
+//line nftables.ego:19
 	}
-//line nftables.ego:17
-	_, _ = fmt.Fprintf(w, "\n  chain input {\n    type filter hook input priority 0;\n\n    # allow established/related connections\n    ct state {established, related} accept\n\n    # early drop of invalid connections\n    ct state invalid drop\n\n    # allow from loopback\n    iifname lo accept\n\n    # allow icmp\n    ip protocol icmp accept\n\n    # allow lochness hv traffic\n    ip daddr ")
-//line nftables.ego:33
+//line nftables.ego:20
+	_, _ = fmt.Fprintf(w, "\n  set guests {\n    type ipv4_addr")
+//line nftables.ego:21
+	if len(guests) > 0 {
+//line nftables.ego:22
+		_, _ = fmt.Fprintf(w, "\n    elements = { ")
+//line nftables.ego:22
+		for ip := range guests {
+//line nftables.ego:23
+			_, _ = fmt.Fprintf(w, "\n      ")
+//line nftables.ego:23
+			_, _ = fmt.Fprintf(w, "%v", ip)
+//line nftables.ego:23
+			_, _ = fmt.Fprintf(w, ", ")
+//line nftables.ego:23
+		}
+//line nftables.ego:24
+		_, _ = fmt.Fprintf(w, "\n    }")
+//line nftables.ego:24
+	}
+//line nftables.ego:25
+	_, _ = fmt.Fprintf(w, "\n  }\n\n  chain input {\n    type filter hook input priority 0;\n\n    # allow established/related connections\n    ct state {established, related} accept\n\n    # early drop of invalid connections\n    ct state invalid drop\n\n    # allow from loopback\n    iifname lo accept\n\n    # allow icmp\n    ip protocol icmp accept\n\n    # allow lochness hv traffic\n    ip daddr ")
+//line nftables.ego:43
 	_, _ = fmt.Fprintf(w, "%v", ip)
-//line nftables.ego:33
-	_, _ = fmt.Fprintf(w, " accept\n\n  }\n\n  chain forward {\n    type filter hook forward priority 0;\n    drop\n  }\n\n  chain output {\n    type filter hook output priority 0;\n  }\n}\n\n")
-//line nftables.ego:47
+//line nftables.ego:43
+	_, _ = fmt.Fprintf(w, " accept\n\n  }\n\n  chain forward {\n    type filter hook forward priority 0;\n\n    # allow established/related connections\n    ct state {established, related} accept\n\n    # early drop of invalid connections\n    ct state invalid drop\n\n  }\n\n  chain output {\n    type filter hook output priority 0;\n  }\n}\n\n")
+//line nftables.ego:63
 	if len(guests) > 0 {
-//line nftables.ego:48
-		_, _ = fmt.Fprintf(w, "\n# Allow traffic to guests as specified by FWGroups\nadd rule filter input ip daddr vmap { ")
-//line nftables.ego:49
+//line nftables.ego:64
+		_, _ = fmt.Fprintf(w, "\n# Filter traffic from guests as specified by FWGroups\nadd rule filter forward ip saddr vmap { ")
+//line nftables.ego:65
 		for ip, fwgIndex := range guests {
-//line nftables.ego:50
+//line nftables.ego:66
 			_, _ = fmt.Fprintf(w, "\n    ")
-//line nftables.ego:50
+//line nftables.ego:66
 			_, _ = fmt.Fprintf(w, "%v", ip)
-//line nftables.ego:50
+//line nftables.ego:66
 			_, _ = fmt.Fprintf(w, " : jump g")
-//line nftables.ego:50
+//line nftables.ego:66
 			_, _ = fmt.Fprintf(w, "%v", fwgIndex)
-//line nftables.ego:50
-			_, _ = fmt.Fprintf(w, ", ")
-//line nftables.ego:50
+//line nftables.ego:66
+			_, _ = fmt.Fprintf(w, "_out, ")
+//line nftables.ego:66
+		}
+//line nftables.ego:67
+		_, _ = fmt.Fprintf(w, "\n}\n\n# Allow traffic to guests as specified by FWGroups\nadd rule filter input ip daddr vmap { ")
+//line nftables.ego:70
+		for ip, fwgIndex := range guests {
+//line nftables.ego:71
+			_, _ = fmt.Fprintf(w, "\n    ")
+//line nftables.ego:71
+			_, _ = fmt.Fprintf(w, "%v", ip)
+//line nftables.ego:71
+			_, _ = fmt.Fprintf(w, " : jump g")
+//line nftables.ego:71
+			_, _ = fmt.Fprintf(w, "%v", fwgIndex)
+//line nftables.ego:71
+			_, _ = fmt.Fprintf(w, "_in, ")
+//line nftables.ego:71
+		}
+//line nftables.ego:72
+		_, _ = fmt.Fprintf(w, "\n}\nadd rule filter forward ip daddr vmap { ")
+//line nftables.ego:73
+		for ip, fwgIndex := range guests {
+//line nftables.ego:74
+			_, _ = fmt.Fprintf(w, "\n    ")
+//line nftables.ego:74
+			_, _ = fmt.Fprintf(w, "%v", ip)
+//line nftables.ego:74
+			_, _ = fmt.Fprintf(w, " : jump g")
+//line nftables.ego:74
+			_, _ = fmt.Fprintf(w, "%v", fwgIndex)
+//line nftables.ego:74
+			_, _ = fmt.Fprintf(w, "_in, ")
+//line nftables.ego:74
 		}
-//line nftables.ego:51
+//line nftables.ego:75
 		_, _ = fmt.Fprintf(w, "\n}\n")
-//line nftables.ego:52
+//line nftables.ego:76
 	}
-//line nftables.ego:53
-	_, _ = fmt.Fprintf(w, "\n\n# reject everything else\nadd rule filter input reject with icmp type port-unreachable\n")
+//line nftables.ego:77
+	_, _ = fmt.Fprintf(w, "\n\n# reject traffic to guests not allowed by their ingress rules\nadd rule filter forward ip daddr @guests reject\n\n# allow the rest of the traffic from guests, which passed their egress rules\nadd rule filter forward ip saddr @guests accept\n\n# reject everything else\nadd rule filter input reject with icmp type port-unreachable\nadd rule filter forward drop\n")
 	return nil
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	ln "github.com/mistifyio/lochness"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestNFTables(t *testing.T) {
+	suite.Run(t, new(NFTablesSuite))
+}
+
+type NFTablesSuite struct {
+	suite.Suite
+}
+
+// cidr parses a network for a rule source
+func cidr(s string) *net.IPNet {
+	_, n, _ := net.ParseCIDR(s)
+	return n
+}
+
+func (s *NFTablesSuite) TestGenNFRules() {
+	groups := groupMap{}
+	self := uuid.New()
+	other := uuid.New()
+	s.Equal(0, groups.Index(self))
+
+	rules := ln.FWRules{
+		{Protocol: "tcp", PortStart: 22, PortEnd: 22},
+		{Protocol: "tcp", PortStart: 80, PortEnd: 90, Source: cidr("10.0.0.0/8"), Action: ln.FWActionDeny},
+		{Protocol: "udp", PortStart: 53, PortEnd: 53, Group: other, Action: ln.FWActionReject, Direction: ln.FWDirectionIngress},
+		{Protocol: "tcp", PortStart: 443, PortEnd: 443, Group: self, Direction: ln.FWDirectionEgress},
+		{Protocol: "tcp", PortStart: 25, PortEnd: 25, Source: cidr("0.0.0.0/0"), Action: ln.FWActionDeny, Direction: ln.FWDirectionEgress},
+		{Protocol: "tcp", PortStart: 2, PortEnd: 1},
+		{Protocol: "tcp", PortStart: 1, PortEnd: 1, Action: "log"},
+		{Protocol: "tcp", PortStart: 1, PortEnd: 1, Direction: "sideways"},
+	}
+
+	ingress, egress := genNFRules(groups, rules)
+	s.Equal([]string{
+		"tcp dport 22 accept",
+		"tcp dport 80 - 90 ip saddr 10.0.0.0/8 drop",
+		"udp dport 53 ip saddr @s1 reject",
+	}, ingress, "ingress rules should keep their order and actions")
+	s.Equal([]string{
+		"tcp dport 443 ip daddr @s0 return",
+		"tcp dport 25 ip daddr 0.0.0.0/0 drop",
+		"reject",
+	}, egress, "egress rules should match the destination, rejecting what they do not allow")
+	s.Equal(1, groups.Index(other), "referenced group should be indexed")
+
+	_, egress = genNFRules(groups, ln.FWRules{
+		{Protocol: "tcp", PortStart: 25, PortEnd: 25, Action: ln.FWActionDeny, Direction: ln.FWDirectionEgress},
+	})
+	s.Equal([]string{"tcp dport 25 drop"}, egress, "deny rules alone should not reject other egress")
+}
+
+func (s *NFTablesSuite) TestNFTWrite() {
+	groups := groupMap{}
+	id := uuid.New()
+	g := groups[id]
+	g.num = groups.Index(id)
+	g.ips = []string{"192.168.100.2", "192.168.100.3"}
+	g.ingress, g.egress = genNFRules(groups, ln.FWRules{
+		{Protocol: "tcp", PortStart: 22, PortEnd: 22, Group: id},
+		{Protocol: "tcp", PortStart: 22, PortEnd: 22, Action: ln.FWActionReject},
+		{Protocol: "tcp", PortStart: 3306, PortEnd: 3306, Group: id, Direction: ln.FWDirectionEgress},
+	})
+	groups[id] = g
+	guests := guestMap{"192.168.100.2": g.num}
+
+	buf := &bytes.Buffer{}
+	s.Require().NoError(nftWrite(buf, "192.168.100.11", groups, guests))
+	ruleset := buf.String()
+
+	for _, expected := range []string{
+		"# FWGroupID=" + id,
+		"chain g0_in {\n      tcp dport 22 ip saddr @s0 accept \n      tcp dport 22 reject \n  }",
+		"chain g0_out {\n      tcp dport 3306 ip daddr @s0 return \n      reject \n  }",
+		"set s0 {\n    type ipv4_addr\n    elements = { \n      192.168.100.2, \n      192.168.100.3, \n    }\n  }",
+		"set guests {\n    type ipv4_addr\n    elements = { \n      192.168.100.2, \n    }\n  }",
+		"ip daddr 192.168.100.11 accept",
+		"add rule filter forward ip saddr vmap { \n    192.168.100.2 : jump g0_out, \n}",
+		"add rule filter input ip daddr vmap { \n    192.168.100.2 : jump g0_in, \n}",
+		"add rule filter forward ip daddr vmap { \n    192.168.100.2 : jump g0_in, \n}",
+		"add rule filter forward ip daddr @guests reject",
+		"add rule filter forward ip saddr @guests accept",
+		"add rule filter input reject with icmp type port-unreachable\nadd rule filter forward drop\n",
+	} {
+		s.Contains(ruleset, expected)
+	}
+}
+
+func (s *NFTablesSuite) TestNFTWriteForwardOrder() {
+	groups := groupMap{}
+	id := uuid.New()
+	g := groups[id]
+	g.num = groups.Index(id)
+	g.ips = []string{"192.168.100.2"}
+	groups[id] = g
+	guests := guestMap{"192.168.100.2": g.num}
+
+	buf := &bytes.Buffer{}
+	s.Require().NoError(nftWrite(buf, "192.168.100.11", groups, guests))
+
+	var forward []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "add rule filter forward ") {
+			forward = append(forward, strings.TrimPrefix(line, "add rule filter forward "))
+		}
+	}
+	s.Equal([]string{
+		"ip saddr vmap { ",
+		"ip daddr vmap { ",
+		"ip daddr @guests reject",
+		"ip saddr @guests accept",
+		"drop",
+	}, forward, "traffic to guests should be decided by their ingress rules before traffic from guests is accepted")
+}
+
+func (s *NFTablesSuite) TestNFTWriteNoGuests() {
+	groups := groupMap{}
+	id := uuid.New()
+	g := groups[id]
+	g.num = groups.Index(id)
+	groups[id] = g
+
+	buf := &bytes.Buffer{}
+	s.Require().NoError(nftWrite(buf, "192.168.100.11", groups, guestMap{}))
+	ruleset := buf.String()
+
+	s.Contains(ruleset, "chain g0_out {\n  }", "no egress rules should allow all egress")
+	s.Contains(ruleset, "set guests {\n    type ipv4_addr\n  }")
+	s.NotContains(ruleset, "vmap")
+	s.Contains(ruleset, "add rule filter forward drop")
+}
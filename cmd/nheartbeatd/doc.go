@@ -1,5 +1,6 @@
 /*
 nheartbeatd periodically confirms that the hypervisor node is alive and updates the resource usage in a kv.
+The reported capacity honors the hypervisor's reservation and overcommit settings.
 
 Usage
 
@@ -6,7 +6,8 @@ import (
 
 // Context carries around data/structs needed for operations
 type Context struct {
-	kv kv.KV
+	kv    kv.KV
+	audit *AuditSource // set when changes are audited
 }
 
 // NewContext creates a new context
@@ -5,7 +5,27 @@ Loch Ness is a simple virtual machine manager ("cloud controller").  It is a pro
 
 Data Model
 
-A Hypervisor is a physical machine
+A Hypervisor is a physical machine. Adding a guest to a hypervisor atomically
+reserves the memory and disk of the guest's flavor, so concurrent placements can
+not overcommit it; removing the guest releases them. The periodic resource
+update reconciles the available resources with these reservations.
+
+A hypervisor's total resources are the capacity available to guests: a
+reserved fraction of each physical resource is held back for the host, and the
+rest is multiplied by an overcommit ratio. The settings are read from the
+hypervisor config keys memoryReserved, memoryOvercommit, diskReserved,
+diskOvercommit, cpuReserved and cpuOvercommit, falling back to the same keys in
+the cluster config. By default a fifth of memory and disk is reserved and cpus
+are overcommitted four times.
+
+The physical resources are found by the hypervisor's resource probe, which
+reads memory, cpus, NUMA nodes and huge pages from /proc and sysfs, and
+measures disk as the size of the filesystem of guestDiskDir or, with diskProbe
+set to zfs, as the space of the guestDataset ZFS dataset. An amount of memory
+and cpus, hostReservedMemory (in MB) and hostReservedCPU (one by default), is
+held back for the host before the ratios apply. A resource with an amount held
+back this way has no fraction reserved by default, so the two do not stack. What
+the probe found is saved with the hypervisor.
 
 A subnet is an actual  IP subnet with a range of usable IP addresses. A
 hypervisor can have one of more subnets, while a subnet can span multiple
@@ -15,12 +35,155 @@ A Network is a logical collection of subnets. It is generally used by guest
 creation to decide what logical segment to place a guest on.
 
 A flavor is a virtual resource "Template" for guest creation. A guest has a
-single flavor.
+single flavor. A flavor may also limit the disk iops and throughput, and the
+nic bandwidth, of each disk and nic of its guests, so noisy guests can not
+saturate shared disks and uplinks. The limits are passed to the agent when the
+guest is created, and again when it is resized.
+
+A flavor's image is kept in the image service, the same one the img command
+talks to. When the cluster config key imageService holds its address, saving a
+flavor checks that the image exists, is completely downloaded and is of the kvm
+type, and img delete refuses to delete an image a flavor uses unless forced.
 
-A FW Group is a collection of firewall rules for incoming IP traffic.  A Guest
-has a single fwgroup.
+A FW Group is a collection of firewall rules for IP traffic to and from
+guests.  Each Guest interface has a single fwgroup. Each rule has a direction,
+ingress (the default) or egress, and an action, allow (the default), deny or
+reject. The first rule matching the traffic decides it. Ingress traffic no rule
+allows is rejected; egress traffic is only restricted once the fwgroup has an
+egress rule, after which traffic no egress rule allows is rejected.
 
 A guest is a virtual machine.  At creation time, a network, fwgroup, and network
 is required.
+
+A guest has one or more network interfaces, each on its own network, and is only
+placed on a hypervisor with a subnet for every one of them. An interface may
+also request a specific subnet and/or IP address within its network. It will
+then only be placed on a hypervisor bridging that subnet, and placement fails if
+the address is already taken.
+
+A volume is an additional disk held in a hypervisor's pool. It can be attached
+to one guest at a time, following the flavor disk, and outlives the guest. A
+guest with pooled volumes is only placed on the hypervisor holding them.
+
+A guest has a lifecycle state (pending, scheduled, provisioning, running,
+stopped, failed, deleting, deleted or purging) along with a history of its most
+recent transitions. Only certain transitions are allowed, so a guest can not,
+for example, be started while it is being deleted. The state is updated by the
+placer and workers as the guest's jobs progress.
+
+Deleting a guest stops it and moves it to the deleted state, where it keeps its
+hypervisor, addresses and quota charge. Until its delete retention passes it
+can be undeleted, returning it to stopped; after that it is purged, removing it
+from its hypervisor and the config store for good. The retention is read from
+the cluster config key deleteRetention as a duration, such as "72h", and
+defaults to a day.
+
+The metadata of guests and hypervisors doubles as labels, which are indexed in
+the config store and can be queried with a label selector. A selector is a comma
+separated list of requirements which must all match: equality (app=web,
+app==web, app!=web), set-based (env in (prod,staging), env notin (dev)) and
+existence (app, !app).
+
+A zone is a failure domain, such as a rack or a room, that hypervisors belong
+to. A hypervisor is in at most one zone, and a zone reports the combined
+capacity of its hypervisors.
+
+A project is a tenant. Guests, networks, subnets, fwgroups and VLAN groups may
+belong to one project, and those without a project are shared by all of them.
+An object of a project may only reference objects of the same project or shared
+ones, so a guest can not use another tenant's network or fwgroup, nor a fwgroup
+rule allow another tenant's group. A project can only be destroyed once it no
+longer owns anything.
+
+A project may have a quota limiting the number of guests, their total memory,
+cpus and disk, and the addresses they take on each network. Guests are charged
+to their project's quota as they are admitted, such as when created, updated or
+resized, and charging fails with an ErrorQuotaExceeded naming the dimension a
+guest would take beyond its limit. A resize is charged the larger of the two
+flavors until it completes or is cancelled. Usage is given back when a guest is
+destroyed, and a project without a quota is unlimited.
+
+Changes made through a context with an audit source, such as the contexts of
+the API daemons' requests, are recorded in an append-only audit log. Each
+record names who made the change (actor, source address and request id), the
+type and id of the object, whether it was created, updated or deleted, and the
+before and after values of each changed field. Guest user data is redacted, only
+recording that it changed, and the reservation and quota charge bookkeeping is
+left out. Saving an object without other changes is not recorded. Records can be
+queried by object, actor, request and time, and are pruned once older than a
+retention period.
+
+A guest may have a hostname, ssh keys and cloud-init style user data, which it
+learns at boot from the metadata service. The service identifies a guest by the
+source address of its request, through the address reservations of the subnets.
+
+Guests and hypervisors are named under the cluster's domain, a guest as
+<hostname>.guests.<domain> and <id>.guests.<domain>, and a hypervisor as
+<id>.nodes.<domain>. A service, such as ipxe.services.<domain>, names the
+hypervisors enabling it in their config. The DNS service answers for these
+names, and the reverse names of their addresses, from the config store.
+
+Placement
+
+A guest is placed in two stages. Candidate functions first filter out the
+hypervisors that can not run it. The remaining candidates are then ranked by the
+weighted sum of scorer functions, each scoring a hypervisor between 0 and 1, and
+the guest is placed on the best. The default scorers are least-allocated (spread
+guests by remaining resources), most-allocated (bin-pack), fewest-guests and
+image-cached (prefer hypervisors already running the guest's image). Their
+weights can be changed with config keys such as
+"placement/weights/most-allocated"; a weight of 0 disables a scorer.
+
+A guest may have affinity rules relating it to other guests, selected by label
+selector and/or server group, or to hypervisors, selected by label selector.
+Affinity places the guest with the related guests or on a matching hypervisor,
+while anti-affinity keeps it away from them, such as to never run two replicas
+of a service on the same hypervisor. Hard rules are enforced by the
+CandidateAffinity candidate function, and soft rules are preferences scored by
+the affinity scorer.
+
+A guest may request a zone, and is then only placed on that zone's hypervisors.
+A guest in a server group may also set a zone spread policy to spread the group
+across zones: a soft policy prefers the zones running the fewest members of the
+group, while a hard policy only allows them. Hypervisors without a zone count as
+one zone.
+
+A hypervisor may be tainted to dedicate it, such as to a team or to flavors
+needing fast local disk. A taint has a key, value and effect. Guests are never
+placed on a hypervisor with a NoSchedule taint unless the guest or its flavor
+has a matching toleration, and hypervisors with PreferNoSchedule taints are
+scored lower by the tolerated scorer. A toleration with no value or effect
+matches any.
+
+A hypervisor is taken out of service by cordoning it, after which no new guests
+are placed on it. Draining a hypervisor cordons it and recreates each of its
+guests elsewhere through the job queue: an evacuate job deletes the guest from
+the hypervisor, which returns it to pending, and a new placement job places and
+creates it on another hypervisor. The hypervisor records the latest job of each
+guest so the drain's progress can be followed.
+
+A placed guest may instead be migrated to another hypervisor without being
+recreated. Preparing the migration reserves the guest's resources on the target
+and gives each interface a bridge there, keeping its address when the target
+bridges the same subnet and reserving a new one otherwise. The guest stays on
+its hypervisor until the migration is completed, which moves it between the
+hypervisors' guests and releases what it held on the old one. The agent moves
+running guests live when both hypervisors have the "liveMigration" config set to
+"true", and cold otherwise.
+
+A placed guest is resized by giving it another flavor. Preparing the resize
+reserves the larger of the two flavors in each dimension on its hypervisor, so
+completing or cancelling it only gives resources back. ErrInsufficientResources
+is returned if the hypervisor can not hold it, in which case the guest may be
+migrated at its new size to one that can.
+
+A placed guest may be snapshotted. Snapshots are kept on the guest's
+hypervisor, and the disk they use is taken from the hypervisor's available
+resources once they are created. It is given back when the hypervisor next
+updates its resources after they are destroyed. A guest's SnapshotLimit caps
+how many of its snapshots are kept; ExpiredSnapshots returns the oldest ones
+beyond it.
+Snapshots are removed along with the guest from its hypervisor, and a guest
+with snapshots can not be migrated.
 */
 package lochness
@@ -0,0 +1,83 @@
+package lochness
+
+import (
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Cordon marks the Hypervisor unschedulable so no new Guests are placed on it.
+// Guests already on it keep running.
+func (h *Hypervisor) Cordon() error {
+	return h.casUpdate(func() error {
+		h.Unschedulable = true
+		return nil
+	})
+}
+
+// Uncordon marks the Hypervisor schedulable again and forgets the jobs of any
+// previous drain.
+func (h *Hypervisor) Uncordon() error {
+	err := h.casUpdate(func() error {
+		h.Unschedulable = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := h.context.kv.Delete(h.drainKey(""), true); err != nil && !h.context.kv.IsKeyNotFound(err) {
+		return err
+	}
+	h.drainJobs = make(map[string]string)
+	return nil
+}
+
+// drainKey is a helper to generate the config store key recording the job
+// moving a Guest off the Hypervisor during a drain
+func (h *Hypervisor) drainKey(guestID string) string {
+	return filepath.Join(HypervisorPath, h.ID, "drain", guestID)
+}
+
+// SetDrainJob records the job moving a Guest off the Hypervisor during a
+// drain, replacing any earlier job for the Guest.
+func (h *Hypervisor) SetDrainJob(guestID, jobID string) error {
+	if err := h.context.kv.Set(h.drainKey(guestID), jobID); err != nil {
+		return err
+	}
+	h.drainJobs[guestID] = jobID
+	return nil
+}
+
+// DrainJobs returns the jobs moving Guests off the Hypervisor, keyed by Guest
+// id.
+func (h *Hypervisor) DrainJobs() map[string]string {
+	return h.drainJobs
+}
+
+// CandidateSchedulable returns Hypervisors that have not been cordoned.
+func CandidateSchedulable(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateSchedulable",
+	}
+
+	var hypervisors Hypervisors
+	for _, h := range hs {
+		if !h.Unschedulable {
+			hypervisors = append(hypervisors, h)
+		} else {
+			log.WithFields(logFields).WithFields(log.Fields{
+				"hypervisorID": h.ID,
+			}).Debug("hypervisor candidate failed")
+		}
+	}
+
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
@@ -0,0 +1,72 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestDrain(t *testing.T) {
+	suite.Run(t, new(DrainSuite))
+}
+
+type DrainSuite struct {
+	common.Suite
+}
+
+func (s *DrainSuite) TestCordon() {
+	hypervisor := s.NewHypervisor()
+	s.False(hypervisor.Unschedulable)
+
+	s.NoError(hypervisor.Cordon())
+	s.True(hypervisor.Unschedulable)
+	h, err := s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.True(h.Unschedulable, "cordon should be saved")
+
+	// updates to other fields keep the hypervisor cordoned
+	h.Metadata["foo"] = "bar"
+	s.NoError(h.Save())
+	s.NoError(hypervisor.Refresh())
+	s.True(hypervisor.Unschedulable)
+
+	s.NoError(hypervisor.Uncordon())
+	s.False(hypervisor.Unschedulable)
+	h, err = s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.False(h.Unschedulable, "uncordon should be saved")
+}
+
+func (s *DrainSuite) TestDrainJobs() {
+	hypervisor := s.NewHypervisor()
+	s.Len(hypervisor.DrainJobs(), 0)
+
+	guestID, jobID := uuid.New(), uuid.New()
+	s.NoError(hypervisor.SetDrainJob(guestID, jobID))
+	s.Equal(map[string]string{guestID: jobID}, hypervisor.DrainJobs())
+
+	// a later job replaces the earlier one
+	jobID = uuid.New()
+	s.NoError(hypervisor.SetDrainJob(guestID, jobID))
+	h, err := s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Equal(map[string]string{guestID: jobID}, h.DrainJobs())
+
+	s.NoError(h.Uncordon(), "uncordon should forget the drain")
+	s.Len(h.DrainJobs(), 0)
+	s.NoError(hypervisor.Refresh())
+	s.Len(hypervisor.DrainJobs(), 0)
+}
+
+func (s *DrainSuite) TestCandidateSchedulable() {
+	hypervisors := lochness.Hypervisors{s.NewHypervisor(), s.NewHypervisor()}
+	s.Require().NoError(hypervisors[0].Cordon())
+
+	candidates, err := lochness.CandidateSchedulable(s.NewGuest(), hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	s.Equal(hypervisors[1].ID, candidates[0].ID)
+}
@@ -3,6 +3,7 @@ package lochness
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"path/filepath"
 
 	"github.com/mistifyio/lochness/pkg/kv"
@@ -22,7 +23,9 @@ type (
 		ID            string            `json:"id"`
 		Image         string            `json:"image"`
 		Metadata      map[string]string `json:"metadata"`
+		Tolerations   Tolerations       `json:"tolerations"` // taints tolerated by guests of the flavor
 		Resources
+		IOLimits
 	}
 
 	// Flavors is an alias to a slice of *Flavor
@@ -34,8 +37,34 @@ type (
 		Disk   uint64 `json:"disk"`   // disk in MB
 		CPU    uint32 `json:"cpu"`    // virtual cpus
 	}
+
+	// IOLimits cap the I/O of each disk and nic of a guest, so it can not
+	// starve its neighbors of shared disks and uplinks. Zero is unlimited.
+	IOLimits struct {
+		DiskIOPS       uint64 `json:"disk_iops"`       // disk operations per second
+		DiskThroughput uint64 `json:"disk_throughput"` // disk throughput in MB/s
+		NicBandwidth   uint64 `json:"nic_bandwidth"`   // nic bandwidth in Mbit/s
+	}
 )
 
+// MinDiskIOPS is the lowest disk iops limit a guest can still boot with
+const MinDiskIOPS = 10
+
+// Validate ensures IOLimits are either unlimited or high enough to be usable.
+func (l IOLimits) Validate() error {
+	if l.DiskIOPS != 0 && l.DiskIOPS < MinDiskIOPS {
+		return fmt.Errorf("disk iops must be 0 (unlimited) or at least %d", MinDiskIOPS)
+	}
+	return nil
+}
+
+// add adds other to the Resources
+func (r *Resources) add(other Resources) {
+	r.Memory += other.Memory
+	r.Disk += other.Disk
+	r.CPU += other.CPU
+}
+
 // NewFlavor creates a blank Flavor
 func (c *Context) NewFlavor() *Flavor {
 	f := &Flavor{
@@ -103,15 +132,22 @@ func (f *Flavor) Validate() error {
 	if uuid.Parse(f.Image) == nil {
 		return errors.New("flavor image must be uuid")
 	}
-	return nil
+	if err := f.IOLimits.Validate(); err != nil {
+		return err
+	}
+	return f.Tolerations.Validate()
 }
 
 // Save persists a Flavor.
-// It will call Validate.
+// It will call Validate, and check the image with the image service if one is
+// configured.
 func (f *Flavor) Save() error {
 	if err := f.Validate(); err != nil {
 		return err
 	}
+	if err := f.verifyImage(); err != nil {
+		return err
+	}
 
 	v, err := json.Marshal(f)
 
@@ -119,9 +155,36 @@ func (f *Flavor) Save() error {
 		return err
 	}
 
+	before, err := f.context.auditSaved(f.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := f.context.kv.Update(f.key(), kv.Value{Data: v, Index: f.modifiedIndex})
-	if err == nil {
-		f.modifiedIndex = index
+	if err != nil {
+		return err
+	}
+	f.modifiedIndex = index
+	f.context.recordChange("flavor", f.ID, before, v)
+	return nil
+}
+
+// ForEachFlavor will run f on each Flavor. It will stop iteration if f returns
+// an error.
+func (c *Context) ForEachFlavor(f func(*Flavor) error) error {
+	keys, err := c.kv.Keys(FlavorPath)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		flavor, err := c.Flavor(filepath.Base(k))
+		if err != nil {
+			return err
+		}
+
+		if err := f(flavor); err != nil {
+			return err
+		}
 	}
-	return err
+	return nil
 }
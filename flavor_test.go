@@ -1,6 +1,7 @@
 package lochness_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/mistifyio/lochness"
@@ -77,6 +78,12 @@ func (s *FlavorSuite) TestValidate() {
 		{"missing image", &lochness.Flavor{ID: uuid.New()}, true},
 		{"invalid image", &lochness.Flavor{ID: uuid.New(), Image: "asdf"}, true},
 		{"valid id and image", &lochness.Flavor{ID: uuid.New(), Image: uuid.New()}, false},
+		{"too few iops", &lochness.Flavor{ID: uuid.New(), Image: uuid.New(), IOLimits: lochness.IOLimits{DiskIOPS: 1}}, true},
+		{"valid io limits", &lochness.Flavor{ID: uuid.New(), Image: uuid.New(), IOLimits: lochness.IOLimits{
+			DiskIOPS:       lochness.MinDiskIOPS,
+			DiskThroughput: 100,
+			NicBandwidth:   1000,
+		}}, false},
 	}
 
 	for _, test := range tests {
@@ -118,3 +125,28 @@ func (s *FlavorSuite) TestSave() {
 		}
 	}
 }
+
+func (s *FlavorSuite) TestForEachFlavor() {
+	flavor := s.NewFlavor()
+	flavor2 := s.NewFlavor()
+	expectedFound := map[string]bool{
+		flavor.ID:  true,
+		flavor2.ID: true,
+	}
+
+	resultFound := make(map[string]bool)
+
+	err := s.Context.ForEachFlavor(func(f *lochness.Flavor) error {
+		resultFound[f.ID] = true
+		return nil
+	})
+	s.NoError(err)
+	s.True(assert.ObjectsAreEqual(expectedFound, resultFound))
+
+	returnErr := errors.New("an error")
+	err = s.Context.ForEachFlavor(func(f *lochness.Flavor) error {
+		return returnErr
+	})
+	s.Error(err)
+	s.Equal(returnErr, err)
+}
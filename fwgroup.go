@@ -3,6 +3,7 @@ package lochness
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net"
 	"path/filepath"
 
@@ -15,18 +16,38 @@ var (
 	FWGroupPath = "lochness/fwgroups/"
 )
 
+// Actions of a FWRule, applied to the traffic it matches
+const (
+	FWActionAllow  = "allow"  // let the traffic through
+	FWActionDeny   = "deny"   // silently drop the traffic
+	FWActionReject = "reject" // drop the traffic and tell the sender
+)
+
+// Directions of a FWRule, relative to the guest
+const (
+	FWDirectionIngress = "ingress" // traffic to the guest
+	FWDirectionEgress  = "egress"  // traffic from the guest
+)
+
 // XXX: should individual rules be their own keys??
 
 type (
 
-	// FWRule represents a single firewall rule
+	// FWRule represents a single firewall rule. The rules of a FWGroup are
+	// applied in order, and the first one matching the traffic decides it.
+	// Source and Group match the remote end: the sender of ingress traffic,
+	// or the receiver of egress traffic. Ingress traffic not allowed by a
+	// rule is rejected. Egress traffic is only rejected by default if the
+	// FWGroup has an allow egress rule; deny and reject egress rules alone
+	// block just the traffic they match.
 	FWRule struct {
 		Source    *net.IPNet `json:"source,omitempty"`
 		Group     string     `json:"group"`
 		PortStart uint       `json:"portStart"`
 		PortEnd   uint       `json:"portEnd"`
 		Protocol  string     `json:"protocol"`
-		Action    string     `json:"action"`
+		Action    string     `json:"action"`    // allow if blank
+		Direction string     `json:"direction"` // ingress if blank
 	}
 
 	// FWRules is an alias to a slice of *FWRule
@@ -39,6 +60,7 @@ type (
 		ID            string            `json:"id"`
 		Metadata      map[string]string `json:"metadata"`
 		Rules         FWRules           `json:"rules"`
+		ProjectID     string            `json:"project"` // owning project. blank if not owned by one
 	}
 
 	// FWGroups is an alias to FWGroup slices
@@ -51,21 +73,24 @@ type (
 		PortEnd   uint   `json:"portEnd"`
 		Protocol  string `json:"protocol"`
 		Action    string `json:"action"`
+		Direction string `json:"direction,omitempty"`
 	}
 
 	fwGroupJSON struct {
-		ID       string            `json:"id"`
-		Metadata map[string]string `json:"metadata"`
-		Rules    []*fwRuleJSON     `json:"rules"`
+		ID        string            `json:"id"`
+		Metadata  map[string]string `json:"metadata"`
+		Rules     []*fwRuleJSON     `json:"rules"`
+		ProjectID string            `json:"project"`
 	}
 )
 
 // MarshalJSON is a helper for marshalling a FWGroup
 func (f FWGroup) MarshalJSON() ([]byte, error) {
 	data := fwGroupJSON{
-		ID:       f.ID,
-		Metadata: f.Metadata,
-		Rules:    make([]*fwRuleJSON, 0, len(f.Rules)),
+		ID:        f.ID,
+		Metadata:  f.Metadata,
+		Rules:     make([]*fwRuleJSON, 0, len(f.Rules)),
+		ProjectID: f.ProjectID,
 	}
 
 	for _, r := range f.Rules {
@@ -75,6 +100,7 @@ func (f FWGroup) MarshalJSON() ([]byte, error) {
 			PortEnd:   r.PortEnd,
 			Protocol:  r.Protocol,
 			Action:    r.Action,
+			Direction: r.Direction,
 		}
 
 		if r.Source != nil {
@@ -96,6 +122,7 @@ func (f *FWGroup) UnmarshalJSON(input []byte) error {
 
 	f.ID = data.ID
 	f.Metadata = data.Metadata
+	f.ProjectID = data.ProjectID
 	f.Rules = make(FWRules, 0, len(data.Rules))
 
 	for _, r := range data.Rules {
@@ -105,6 +132,7 @@ func (f *FWGroup) UnmarshalJSON(input []byte) error {
 			PortEnd:   r.PortEnd,
 			Protocol:  r.Protocol,
 			Action:    r.Action,
+			Direction: r.Direction,
 		}
 
 		if r.Source != "" {
@@ -120,6 +148,21 @@ func (f *FWGroup) UnmarshalJSON(input []byte) error {
 
 }
 
+// Validate ensures a FWRule has a known action and direction.
+func (r *FWRule) Validate() error {
+	switch r.Action {
+	case "", FWActionAllow, FWActionDeny, FWActionReject:
+	default:
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	switch r.Direction {
+	case "", FWDirectionIngress, FWDirectionEgress:
+	default:
+		return fmt.Errorf("invalid direction %q", r.Direction)
+	}
+	return nil
+}
+
 // NewFWGroup creates a new, blank FWGroup
 func (c *Context) NewFWGroup() *FWGroup {
 	f := &FWGroup{
@@ -177,6 +220,30 @@ func (f *FWGroup) Validate() error {
 	if _, err := canonicalizeUUID(f.ID); err != nil {
 		return errors.New("invalid ID")
 	}
+	if err := validateProjectID(f.ProjectID); err != nil {
+		return err
+	}
+	for i, r := range f.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
+	if f.ProjectID == "" {
+		return nil
+	}
+	// rules may only allow groups of the same project or shared ones
+	for i, r := range f.Rules {
+		if r.Group == "" || r.Group == f.ID {
+			continue
+		}
+		group, err := f.context.FWGroup(r.Group)
+		if err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+		if err := checkProjectReference(f.ProjectID, "fwgroup", group.ID, group.ProjectID); err != nil {
+			return fmt.Errorf("rule %d: %s", i, err)
+		}
+	}
 	return nil
 }
 
@@ -194,6 +261,15 @@ func (f *FWGroup) Save() error {
 		return err
 	}
 
+	project, err := f.context.savedProject(f.key(), f.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := f.context.auditSaved(f.key())
+	if err != nil {
+		return err
+	}
+
 	// if we changed something, don't clobber
 	index, err := f.context.kv.Update(f.key(), kv.Value{Data: v, Index: f.modifiedIndex})
 	if err != nil {
@@ -201,5 +277,6 @@ func (f *FWGroup) Save() error {
 	}
 
 	f.modifiedIndex = index
-	return nil
+	f.context.recordChange("fwgroup", f.ID, before, v)
+	return f.context.updateProjectLink(projectFWGroups, f.ID, project, f.ProjectID)
 }
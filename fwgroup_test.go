@@ -74,16 +74,24 @@ func (s *FWGroupSuite) TestValidate() {
 	tests := []struct {
 		description string
 		ID          string
+		rule        *lochness.FWRule
 		expectedErr bool
 	}{
-		{"missing ID", "", true},
-		{"non uuid ID", "asdf", true},
-		{"uuid ID", uuid.New(), false},
+		{"missing ID", "", nil, true},
+		{"non uuid ID", "asdf", nil, true},
+		{"uuid ID", uuid.New(), nil, false},
+		{"default rule", uuid.New(), &lochness.FWRule{}, false},
+		{"egress reject rule", uuid.New(), &lochness.FWRule{Action: lochness.FWActionReject, Direction: lochness.FWDirectionEgress}, false},
+		{"invalid action", uuid.New(), &lochness.FWRule{Action: "log"}, true},
+		{"invalid direction", uuid.New(), &lochness.FWRule{Direction: "both"}, true},
 	}
 
 	for _, test := range tests {
 		msg := s.Messager(test.description)
 		fg := &lochness.FWGroup{ID: test.ID}
+		if test.rule != nil {
+			fg.Rules = lochness.FWRules{test.rule}
+		}
 		err := fg.Validate()
 		if test.expectedErr {
 			s.Error(err, msg("should be invalid"))
@@ -126,6 +134,8 @@ func (s *FWGroupSuite) TestJSON() {
 		Source:    n,
 		PortStart: 1000,
 		PortEnd:   2000,
+		Action:    lochness.FWActionDeny,
+		Direction: lochness.FWDirectionEgress,
 	}
 	fwgroup.Rules = lochness.FWRules{fwrule}
 
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"net"
 	"path/filepath"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/mistifyio/lochness/pkg/kv"
@@ -24,37 +25,90 @@ type (
 	Guest struct {
 		context       *Context
 		modifiedIndex uint64
-		ID            string            `json:"id"`
-		Metadata      map[string]string `json:"metadata"`
-		Type          string            `json:"type"`       // type of guest. currently just kvm
-		FlavorID      string            `json:"flavor"`     // resource flavor
-		HypervisorID  string            `json:"hypervisor"` // hypervisor. may be blank if not assigned yet
-		NetworkID     string            `json:"network"`
-		SubnetID      string            `json:"subnet"`
-		FWGroupID     string            `json:"fwgroup"`
-		VLANGroupID   string            `json:"vlangroup"`
-		MAC           net.HardwareAddr  `json:"mac"`
-		IP            net.IP            `json:"ip"`
-		Bridge        string            `json:"bridge"`
+		ID            string                 `json:"id"`
+		Metadata      map[string]string      `json:"metadata"`
+		Type          string                 `json:"type"`           // type of guest. currently just kvm
+		FlavorID      string                 `json:"flavor"`         // resource flavor
+		HypervisorID  string                 `json:"hypervisor"`     // hypervisor. may be blank if not assigned yet
+		Interfaces    GuestInterfaces        `json:"interfaces"`     // network interfaces, in device order
+		State         string                 `json:"state"`          // lifecycle state
+		StateHistory  []GuestStateTransition `json:"state_history"`  // most recent state transitions, oldest first
+		ServerGroup   string                 `json:"server_group"`   // group of related guests, such as replicas
+		Affinity      AffinityRules          `json:"affinity"`       // placement relative to other guests and hypervisors
+		ZoneID        string                 `json:"zone"`           // requested zone. may be blank for any
+		ZoneSpread    string                 `json:"zone_spread"`    // policy for spreading the server group across zones
+		Tolerations   Tolerations            `json:"tolerations"`    // hypervisor taints tolerated, in addition to the flavor's
+		Migration     *GuestMigration        `json:"migration"`      // pending move to another hypervisor, if any
+		SnapshotLimit int                    `json:"snapshot_limit"` // most snapshots kept, oldest deleted first. 0 for no limit
+		ProjectID     string                 `json:"project"`        // owning project. blank if not owned by one
+		PurgeAt       *time.Time             `json:"purge_at"`       // when a deleted guest is purged, if it is deleted
+		Hostname      string                 `json:"hostname"`       // served by the metadata service. the id if blank
+		SSHKeys       []string               `json:"ssh_keys"`       // public keys served by the metadata service
+		UserData      string                 `json:"user_data"`      // cloud-init style user data
 	}
 
 	// Guests is an alias to a slice of *Guest
 	Guests []*Guest
 
+	// GuestInterface is a network interface of a Guest. Before the Guest is
+	// placed, SubnetID and IP may be set to request a specific subnet and/or
+	// address. Bridge is set when the Guest is placed on a Hypervisor.
+	GuestInterface struct {
+		NetworkID   string           `json:"network"`
+		SubnetID    string           `json:"subnet"`
+		FWGroupID   string           `json:"fwgroup"`
+		VLANGroupID string           `json:"vlangroup"`
+		MAC         net.HardwareAddr `json:"mac"`
+		IP          net.IP           `json:"ip"`
+		Bridge      string           `json:"bridge"`
+	}
+
+	// GuestInterfaces is an alias to a slice of *GuestInterface
+	GuestInterfaces []*GuestInterface
+
+	// guestInterfaceJSON is used to ease json marshal/unmarshal
+	guestInterfaceJSON struct {
+		NetworkID   string `json:"network"`
+		SubnetID    string `json:"subnet"`
+		FWGroupID   string `json:"fwgroup"`
+		VLANGroupID string `json:"vlangroup"`
+		MAC         string `json:"mac"`
+		IP          net.IP `json:"ip"`
+		Bridge      string `json:"bridge"`
+	}
+
 	// guestJSON is used to ease json marshal/unmarshal
 	guestJSON struct {
-		ID           string            `json:"id"`
-		Metadata     map[string]string `json:"metadata"`
-		Type         string            `json:"type"`       // type of guest. currently just kvm
-		FlavorID     string            `json:"flavor"`     // resource flavor
-		HypervisorID string            `json:"hypervisor"` // hypervisor. may be blank if not assigned yet
-		NetworkID    string            `json:"network"`
-		SubnetID     string            `json:"subnet"`
-		FWGroupID    string            `json:"fwgroup"`
-		VLANGroupID  string            `json:"vlangroup"`
-		MAC          string            `json:"mac"`
-		IP           net.IP            `json:"ip"`
-		Bridge       string            `json:"bridge"`
+		ID            string                 `json:"id"`
+		Metadata      map[string]string      `json:"metadata"`
+		Type          string                 `json:"type"`       // type of guest. currently just kvm
+		FlavorID      string                 `json:"flavor"`     // resource flavor
+		HypervisorID  string                 `json:"hypervisor"` // hypervisor. may be blank if not assigned yet
+		Interfaces    GuestInterfaces        `json:"interfaces"`
+		State         string                 `json:"state"`
+		StateHistory  []GuestStateTransition `json:"state_history"`
+		ServerGroup   string                 `json:"server_group"`
+		Affinity      AffinityRules          `json:"affinity"`
+		ZoneID        string                 `json:"zone"`
+		ZoneSpread    string                 `json:"zone_spread"`
+		Tolerations   Tolerations            `json:"tolerations"`
+		Migration     *GuestMigration        `json:"migration"`
+		SnapshotLimit int                    `json:"snapshot_limit"`
+		ProjectID     string                 `json:"project"`
+		PurgeAt       *time.Time             `json:"purge_at"`
+		Hostname      string                 `json:"hostname"`
+		SSHKeys       []string               `json:"ssh_keys"`
+		UserData      string                 `json:"user_data"`
+
+		// single interface fields are still accepted and apply to the first
+		// interface
+		NetworkID   string `json:"network,omitempty"`
+		SubnetID    string `json:"subnet,omitempty"`
+		FWGroupID   string `json:"fwgroup,omitempty"`
+		VLANGroupID string `json:"vlangroup,omitempty"`
+		MAC         string `json:"mac,omitempty"`
+		IP          net.IP `json:"ip,omitempty"`
+		Bridge      string `json:"bridge,omitempty"`
 	}
 
 	// CandidateFunction is used to select hypervisors that can run the given guest.
@@ -64,18 +118,26 @@ type (
 // MarshalJSON is a helper for marshalling a Guest
 func (g *Guest) MarshalJSON() ([]byte, error) {
 	data := guestJSON{
-		ID:           g.ID,
-		Metadata:     g.Metadata,
-		Type:         g.Type,
-		FlavorID:     g.FlavorID,
-		NetworkID:    g.NetworkID,
-		SubnetID:     g.SubnetID,
-		FWGroupID:    g.FWGroupID,
-		VLANGroupID:  g.VLANGroupID,
-		HypervisorID: g.HypervisorID,
-		IP:           g.IP,
-		MAC:          g.MAC.String(),
-		Bridge:       g.Bridge,
+		ID:            g.ID,
+		Metadata:      g.Metadata,
+		Type:          g.Type,
+		FlavorID:      g.FlavorID,
+		HypervisorID:  g.HypervisorID,
+		Interfaces:    g.Interfaces,
+		State:         g.State,
+		StateHistory:  g.StateHistory,
+		ServerGroup:   g.ServerGroup,
+		Affinity:      g.Affinity,
+		ZoneID:        g.ZoneID,
+		ZoneSpread:    g.ZoneSpread,
+		Tolerations:   g.Tolerations,
+		Migration:     g.Migration,
+		SnapshotLimit: g.SnapshotLimit,
+		ProjectID:     g.ProjectID,
+		PurgeAt:       g.PurgeAt,
+		Hostname:      g.Hostname,
+		SSHKeys:       g.SSHKeys,
+		UserData:      g.UserData,
 	}
 
 	return json.Marshal(data)
@@ -101,38 +163,200 @@ func (g *Guest) UnmarshalJSON(input []byte) error {
 	if data.FlavorID != "" {
 		g.FlavorID = data.FlavorID
 	}
+	if data.HypervisorID != "" {
+		g.HypervisorID = data.HypervisorID
+	}
+	if data.Interfaces != nil {
+		g.Interfaces = data.Interfaces
+	}
+	if data.State != "" {
+		g.State = data.State
+	}
+	if data.StateHistory != nil {
+		g.StateHistory = data.StateHistory
+	}
+	if data.ServerGroup != "" {
+		g.ServerGroup = data.ServerGroup
+	}
+	if data.Affinity != nil {
+		g.Affinity = data.Affinity
+	}
+	if data.ZoneID != "" {
+		g.ZoneID = data.ZoneID
+	}
+	if data.ZoneSpread != "" {
+		g.ZoneSpread = data.ZoneSpread
+	}
+	if data.Tolerations != nil {
+		g.Tolerations = data.Tolerations
+	}
+	if data.Migration != nil {
+		g.Migration = data.Migration
+	}
+	if data.SnapshotLimit != 0 {
+		g.SnapshotLimit = data.SnapshotLimit
+	}
+	if data.ProjectID != "" {
+		g.ProjectID = data.ProjectID
+	}
+	if data.PurgeAt != nil {
+		g.PurgeAt = data.PurgeAt
+	}
+	if data.Hostname != "" {
+		g.Hostname = data.Hostname
+	}
+	if data.SSHKeys != nil {
+		g.SSHKeys = data.SSHKeys
+	}
+	if data.UserData != "" {
+		g.UserData = data.UserData
+	}
+
+	return g.unmarshalSingleInterface(data)
+}
+
+// unmarshalSingleInterface applies the single interface fields to the first
+// interface, creating it if needed
+func (g *Guest) unmarshalSingleInterface(data guestJSON) error {
+	if data.NetworkID == "" && data.SubnetID == "" && data.FWGroupID == "" &&
+		data.VLANGroupID == "" && data.MAC == "" && data.IP == nil && data.Bridge == "" {
+		return nil
+	}
+
+	if len(g.Interfaces) == 0 {
+		g.Interfaces = GuestInterfaces{&GuestInterface{}}
+	}
+	iface := g.Interfaces[0]
+
 	if data.NetworkID != "" {
-		g.NetworkID = data.NetworkID
+		iface.NetworkID = data.NetworkID
 	}
 	if data.SubnetID != "" {
-		g.SubnetID = data.SubnetID
+		iface.SubnetID = data.SubnetID
 	}
 	if data.FWGroupID != "" {
-		g.FWGroupID = data.FWGroupID
+		iface.FWGroupID = data.FWGroupID
 	}
 	if data.VLANGroupID != "" {
-		g.VLANGroupID = data.VLANGroupID
-	}
-	if data.HypervisorID != "" {
-		g.HypervisorID = data.HypervisorID
+		iface.VLANGroupID = data.VLANGroupID
 	}
 	if data.IP != nil {
-		g.IP = data.IP
+		iface.IP = data.IP
 	}
 	if data.Bridge != "" {
-		g.Bridge = data.Bridge
+		iface.Bridge = data.Bridge
+	}
+	if data.MAC != "" {
+		a, err := net.ParseMAC(data.MAC)
+		if err != nil {
+			return err
+		}
+
+		iface.MAC = a
+	}
+	return nil
+}
+
+// MarshalJSON is a helper for marshalling a GuestInterface
+func (i *GuestInterface) MarshalJSON() ([]byte, error) {
+	data := guestInterfaceJSON{
+		NetworkID:   i.NetworkID,
+		SubnetID:    i.SubnetID,
+		FWGroupID:   i.FWGroupID,
+		VLANGroupID: i.VLANGroupID,
+		MAC:         i.MAC.String(),
+		IP:          i.IP,
+		Bridge:      i.Bridge,
 	}
 
+	return json.Marshal(data)
+}
+
+// UnmarshalJSON is a helper for unmarshalling a GuestInterface
+func (i *GuestInterface) UnmarshalJSON(input []byte) error {
+	data := guestInterfaceJSON{}
+
+	if err := json.Unmarshal(input, &data); err != nil {
+		return err
+	}
+
+	i.NetworkID = data.NetworkID
+	i.SubnetID = data.SubnetID
+	i.FWGroupID = data.FWGroupID
+	i.VLANGroupID = data.VLANGroupID
+	i.IP = data.IP
+	i.Bridge = data.Bridge
+	i.MAC = nil
+
 	if data.MAC != "" {
 		a, err := net.ParseMAC(data.MAC)
 		if err != nil {
 			return err
 		}
 
-		g.MAC = a
+		i.MAC = a
+	}
+	return nil
+}
+
+// Validate ensures a GuestInterface has reasonable data.
+func (i *GuestInterface) Validate() error {
+	if _, err := canonicalizeUUID(i.NetworkID); err != nil {
+		return errors.New("missing or invalid network")
 	}
+	if i.MAC == nil {
+		return errors.New("missing MAC")
+	}
+	if i.SubnetID != "" {
+		if _, err := canonicalizeUUID(i.SubnetID); err != nil {
+			return errors.New("invalid subnet")
+		}
+	}
+	if i.IP != nil && i.IP.To4() == nil {
+		return errors.New("invalid ip")
+	}
+
 	return nil
+}
 
+// validateInterfaceProject ensures an interface of the Guest only uses objects
+// of the Guest's project or shared ones.
+func (g *Guest) validateInterfaceProject(i *GuestInterface) error {
+	network, err := g.context.Network(i.NetworkID)
+	if err != nil {
+		return err
+	}
+	if err := checkProjectReference(g.ProjectID, "network", network.ID, network.ProjectID); err != nil {
+		return err
+	}
+	if i.SubnetID != "" {
+		subnet, err := g.context.Subnet(i.SubnetID)
+		if err != nil {
+			return err
+		}
+		if err := checkProjectReference(g.ProjectID, "subnet", subnet.ID, subnet.ProjectID); err != nil {
+			return err
+		}
+	}
+	if i.FWGroupID != "" {
+		fwgroup, err := g.context.FWGroup(i.FWGroupID)
+		if err != nil {
+			return err
+		}
+		if err := checkProjectReference(g.ProjectID, "fwgroup", fwgroup.ID, fwgroup.ProjectID); err != nil {
+			return err
+		}
+	}
+	if i.VLANGroupID != "" {
+		vlanGroup, err := g.context.VLANGroup(i.VLANGroupID)
+		if err != nil {
+			return err
+		}
+		if err := checkProjectReference(g.ProjectID, "vlangroup", vlanGroup.ID, vlanGroup.ProjectID); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // NewGuest create a new blank Guest
@@ -141,10 +365,30 @@ func (c *Context) NewGuest() *Guest {
 		context:  c,
 		ID:       uuid.New(),
 		Metadata: make(map[string]string),
+		State:    GuestStatePending,
+	}
+
+	return g
+}
+
+// AddInterface appends a new interface on a Network to the Guest. A MAC is
+// generated based on the Guest ID and may be overwritten later.
+func (g *Guest) AddInterface(networkID string) *GuestInterface {
+	iface := &GuestInterface{
+		NetworkID: networkID,
+		MAC:       g.generateMAC(len(g.Interfaces)),
 	}
+	g.Interfaces = append(g.Interfaces, iface)
+	return iface
+}
 
-	// Generate a MAC based on the ID. May be overwritten later.
-	md5ID := md5.Sum([]byte(g.ID))
+// generateMAC generates a MAC for the nth interface based on the Guest ID
+func (g *Guest) generateMAC(n int) net.HardwareAddr {
+	seed := g.ID
+	if n > 0 {
+		seed = fmt.Sprintf("%s/%d", g.ID, n)
+	}
+	md5ID := md5.Sum([]byte(seed))
 	mac := fmt.Sprintf("02:%02x:%02x:%02x:%02x:%02x",
 		md5ID[0],
 		md5ID[1],
@@ -152,9 +396,8 @@ func (c *Context) NewGuest() *Guest {
 		md5ID[3],
 		md5ID[4],
 	)
-	g.MAC, _ = net.ParseMAC(mac)
-
-	return g
+	a, _ := net.ParseMAC(mac)
+	return a
 }
 
 // Guest fetches a Guest from the config store
@@ -195,6 +438,14 @@ func (g *Guest) Refresh() error {
 		return err
 	}
 
+	// optional fields that may have been cleared, such as a finished
+	// migration or an undeleted guest's purge time, are no longer in the data
+	g.ServerGroup, g.ZoneID, g.ZoneSpread = "", "", ""
+	g.Affinity, g.Tolerations = nil, nil
+	g.Migration, g.PurgeAt = nil, nil
+	g.SnapshotLimit = 0
+	g.ProjectID = ""
+	g.Hostname, g.SSHKeys, g.UserData = "", nil, ""
 	return g.fromResponse(resp)
 }
 
@@ -206,18 +457,83 @@ func (g *Guest) Validate() error {
 	if _, err := canonicalizeUUID(g.FlavorID); err != nil {
 		return errors.New("missing or invalid flavor")
 	}
-	if _, err := canonicalizeUUID(g.NetworkID); err != nil {
-		return errors.New("missing or invalid network")
+	if g.State != "" && !ValidGuestState(g.State) {
+		return errors.New("invalid state")
 	}
-	if g.MAC == nil {
-		return errors.New("missing MAC")
+	if len(g.Interfaces) == 0 {
+		return errors.New("missing interfaces")
+	}
+	macs := make(map[string]bool, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		if iface == nil {
+			return fmt.Errorf("interface %d: missing", i)
+		}
+		if err := iface.Validate(); err != nil {
+			return fmt.Errorf("interface %d: %s", i, err)
+		}
+		if macs[iface.MAC.String()] {
+			return fmt.Errorf("interface %d: duplicate MAC", i)
+		}
+		macs[iface.MAC.String()] = true
+	}
+	for i, rule := range g.Affinity {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("affinity rule %d: %s", i, err)
+		}
+	}
+	if g.ZoneID != "" {
+		if _, err := canonicalizeUUID(g.ZoneID); err != nil {
+			return errors.New("invalid zone")
+		}
+	}
+	switch g.ZoneSpread {
+	case ZoneSpreadNone:
+	case ZoneSpreadSoft, ZoneSpreadHard:
+		if g.ServerGroup == "" {
+			return errors.New("zone spread requires a server group")
+		}
+	default:
+		return errors.New("invalid zone spread")
+	}
+	if err := g.Tolerations.Validate(); err != nil {
+		return err
+	}
+	if g.SnapshotLimit < 0 {
+		return errors.New("invalid snapshot limit")
+	}
+	if err := g.validateInstanceData(); err != nil {
+		return err
+	}
+	if err := validateProjectID(g.ProjectID); err != nil {
+		return err
+	}
+	if g.ProjectID != "" {
+		for i, iface := range g.Interfaces {
+			if err := g.validateInterfaceProject(iface); err != nil {
+				return fmt.Errorf("interface %d: %s", i, err)
+			}
+		}
+	}
+	if g.Migration != nil {
+		if _, err := canonicalizeUUID(g.Migration.HypervisorID); err != nil {
+			return errors.New("missing or invalid migration hypervisor")
+		}
+		if len(g.Migration.Interfaces) != len(g.Interfaces) {
+			return errors.New("migration interfaces do not match interfaces")
+		}
 	}
 
 	return nil
 }
 
-// Save persists the Guest to the data store.
+// Save persists the Guest to the data store. Interfaces without a MAC are
+// given one generated from the Guest ID.
 func (g *Guest) Save() error {
+	for i, iface := range g.Interfaces {
+		if iface != nil && iface.MAC == nil {
+			iface.MAC = g.generateMAC(i)
+		}
+	}
 
 	if err := g.Validate(); err != nil {
 		return err
@@ -229,12 +545,29 @@ func (g *Guest) Save() error {
 		return err
 	}
 
+	labels, err := g.context.savedLabels(g.key(), g.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	project, err := g.context.savedProject(g.key(), g.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := g.context.auditSaved(g.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := g.context.kv.Update(g.key(), kv.Value{Data: v, Index: g.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	g.modifiedIndex = index
-	return nil
+	g.context.recordChange("guest", g.ID, before, v)
+	if err := g.context.updateProjectLink(projectGuests, g.ID, project, g.ProjectID); err != nil {
+		return err
+	}
+	return g.context.updateLabelIndex(guestLabelKind, g.ID, labels, g.Metadata)
 }
 
 // Destroy removes a guest
@@ -254,9 +587,38 @@ func (g *Guest) Destroy() error {
 		}
 	}
 
+	// volumes outlive the guest
+	volumes, err := g.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if err := v.Detach(); err != nil {
+			return err
+		}
+	}
+
+	labels, err := g.context.savedLabels(g.key(), g.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := g.context.auditSaved(g.key())
+	if err != nil {
+		return err
+	}
 	if err := g.context.kv.Remove(g.key(), g.modifiedIndex); err != nil {
 		return err
 	}
+	g.context.recordChange("guest", g.ID, before, nil)
+	if err := g.context.updateLabelIndex(guestLabelKind, g.ID, labels, nil); err != nil {
+		return err
+	}
+	if err := g.context.updateProjectLink(projectGuests, g.ID, g.ProjectID, ""); err != nil {
+		return err
+	}
+	if err := g.ReleaseQuota(); err != nil {
+		return err
+	}
 	return g.context.kv.Delete(filepath.Join(GuestPath, g.ID), true)
 }
 
@@ -315,15 +677,39 @@ func CandidateIsAlive(g *Guest, hs Hypervisors) (Hypervisors, error) {
 	return hypervisors, nil
 }
 
+// requiredResources returns the resources a Hypervisor must have available to
+// run the Guest: those of its Flavor plus the disk of any attached Volumes not
+// yet in a Hypervisor pool
+func (g *Guest) requiredResources() (Resources, error) {
+	f, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return Resources{}, err
+	}
+
+	volumes, err := g.Volumes()
+	if err != nil {
+		return Resources{}, err
+	}
+
+	need := f.Resources
+	for _, v := range volumes {
+		if v.HypervisorID == "" {
+			need.Disk += v.Size
+		}
+	}
+	return need, nil
+}
+
 // CandidateHasResources returns Hypervisors that have available resources
-// based on the request Flavor of the Guest.
+// based on the request Flavor of the Guest and any attached Volumes not yet in
+// a Hypervisor pool.
 func CandidateHasResources(g *Guest, hs Hypervisors) (Hypervisors, error) {
 	logFields := log.Fields{
 		"guestID": g.ID,
 		"func":    "CandidateHasResources",
 	}
 
-	f, err := g.context.Flavor(g.FlavorID)
+	need, err := g.requiredResources()
 	if err != nil {
 		return nil, err
 	}
@@ -331,17 +717,17 @@ func CandidateHasResources(g *Guest, hs Hypervisors) (Hypervisors, error) {
 	var hypervisors Hypervisors
 	for _, h := range hs {
 		avail := h.AvailableResources
-		if avail.Disk < f.Disk {
+		if avail.Disk < need.Disk {
 			log.WithFields(logFields).WithFields(log.Fields{
 				"hypervisorID": h.ID,
 				"resource":     "disk",
 			}).Debug("hypervisor candidate failed")
-		} else if avail.Memory < f.Memory {
+		} else if avail.Memory < need.Memory {
 			log.WithFields(logFields).WithFields(log.Fields{
 				"hypervisorID": h.ID,
 				"resource":     "memory",
 			}).Debug("hypervisor candidate failed")
-		} else if avail.CPU < f.CPU {
+		} else if avail.CPU < need.CPU {
 			log.WithFields(logFields).WithFields(log.Fields{
 				"hypervisorID": h.ID,
 				"resource":     "cpu",
@@ -360,44 +746,144 @@ func CandidateHasResources(g *Guest, hs Hypervisors) (Hypervisors, error) {
 	return hypervisors, nil
 }
 
-// CandidateHasSubnet returns Hypervisors that have subnets with available addresses
-// in the request Network of the Guest.
+// SuitableSubnets returns the Subnets in the Network of a Guest interface that
+// can provide it an address. Before a Guest is placed, a set SubnetID and/or IP
+// are treated as a request for that subnet and/or address; an error is returned
+// if such a request cannot be satisfied.
+func (g *Guest) SuitableSubnets(iface *GuestInterface) (Subnets, error) {
+	n, err := g.context.Network(iface.NetworkID)
+	if err != nil {
+		return nil, err
+	}
+
+	var subnets Subnets
+	inNetwork, matched := false, false
+	for _, k := range n.Subnets() {
+		if iface.SubnetID != "" && k != iface.SubnetID {
+			continue
+		}
+		inNetwork = true
+		subnet, err := g.context.Subnet(k)
+		if err != nil {
+			return nil, err
+		}
+
+		if iface.IP == nil {
+			// only include subnets that have available addresses
+			if len(subnet.AvailableAddresses()) > 0 {
+				subnets = append(subnets, subnet)
+			}
+			continue
+		}
+
+		if !subnet.CIDR.Contains(iface.IP) {
+			continue
+		}
+		matched = true
+		if subnet.AddressAvailable(iface.IP) {
+			subnets = append(subnets, subnet)
+		}
+	}
+
+	switch {
+	case len(subnets) > 0:
+	case iface.IP != nil && matched:
+		return nil, fmt.Errorf("requested address %s is not available", iface.IP)
+	case iface.IP != nil && iface.SubnetID != "":
+		return nil, fmt.Errorf("requested address %s is not in subnet %s of network %s", iface.IP, iface.SubnetID, iface.NetworkID)
+	case iface.IP != nil:
+		return nil, fmt.Errorf("requested address %s is not in network %s", iface.IP, iface.NetworkID)
+	case iface.SubnetID != "" && !inNetwork:
+		return nil, fmt.Errorf("requested subnet %s is not in network %s", iface.SubnetID, iface.NetworkID)
+	case iface.SubnetID != "":
+		return nil, fmt.Errorf("requested subnet %s has no available addresses", iface.SubnetID)
+	}
+
+	return subnets, nil
+}
+
+// CandidateHasSubnet returns Hypervisors that, for every interface of the
+// Guest, have a subnet with available addresses in the requested Network. If an
+// interface requests a specific subnet or address, only Hypervisors that bridge
+// a subnet satisfying it are returned.
 func CandidateHasSubnet(g *Guest, hs Hypervisors) (Hypervisors, error) {
 	logFields := log.Fields{
 		"guestID": g.ID,
 		"func":    "CandidateHasSubnet",
 	}
 
-	n, err := g.context.Network(g.NetworkID)
-	if err != nil {
-		return nil, err
+	ifaceSubnets := make([]map[string]bool, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		s, err := g.SuitableSubnets(iface)
+		if err != nil {
+			return nil, err
+		}
+		subnets := make(map[string]bool, len(s))
+		for _, subnet := range s {
+			subnets[subnet.ID] = true
+		}
+		ifaceSubnets[i] = subnets
 	}
-	s := n.Subnets()
-	subnets := make(map[string]bool, len(s))
 
 	var hypervisors Hypervisors
 
-	for _, k := range s {
-		subnet, err := g.context.Subnet(k)
-		if err != nil {
-			return nil, err
+	for _, h := range hs {
+		hvSubnets := h.Subnets()
+		hasSubnets := true
+		for _, subnets := range ifaceSubnets {
+			hasSubnet := false
+			for k := range hvSubnets {
+				if _, ok := subnets[k]; ok {
+					hasSubnet = true
+					break
+				}
+			}
+			if !hasSubnet {
+				hasSubnets = false
+				break
+			}
 		}
-		// only include subnets that have available addresses
-		avail := subnet.AvailableAddresses()
-		if len(avail) > 0 {
-			subnets[k] = true
+		if hasSubnets {
+			hypervisors = append(hypervisors, h)
+		} else {
+			log.WithFields(logFields).WithFields(log.Fields{
+				"hypervisorID": h.ID,
+			}).Debug("hypervisor candidate failed")
 		}
 	}
 
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
+
+// CandidateHasVolumes returns Hypervisors whose pool holds every attached
+// Volume of the Guest that is already in a pool.
+func CandidateHasVolumes(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateHasVolumes",
+	}
+
+	volumes, err := g.Volumes()
+	if err != nil {
+		return nil, err
+	}
+
+	var hypervisors Hypervisors
 	for _, h := range hs {
-		hasSubnet := false
-		for k := range h.Subnets() {
-			if _, ok := subnets[k]; ok {
-				hasSubnet = true
+		hasVolumes := true
+		for _, v := range volumes {
+			if v.HypervisorID != "" && v.HypervisorID != h.ID {
+				hasVolumes = false
 				break
 			}
 		}
-		if hasSubnet {
+		if hasVolumes {
 			hypervisors = append(hypervisors, h)
 		} else {
 			log.WithFields(logFields).WithFields(log.Fields{
@@ -433,8 +919,14 @@ func randomizeHypervisors(s Hypervisors) Hypervisors {
 // DefaultCandidateFunctions is a default list of CandidateFunctions for general use
 var DefaultCandidateFunctions = []CandidateFunction{
 	CandidateIsAlive,
+	CandidateSchedulable,
+	CandidateHasVolumes,
 	CandidateHasSubnet,
 	CandidateHasResources,
+	CandidateTolerated,
+	CandidateInZone,
+	CandidateZoneSpread,
+	CandidateAffinity,
 	CandidateRandomize,
 }
 
@@ -25,14 +25,33 @@ type GuestSuite struct {
 
 func (s *GuestSuite) TestJSON() {
 	guest := s.NewGuest()
+	guest.ServerGroup = "web"
+	guest.Affinity = lochness.AffinityRules{{Kind: lochness.AffinityGuests, ServerGroup: "web", Anti: true}}
 
 	guestBytes, err := json.Marshal(guest)
 	s.NoError(err)
 
 	guestFromJSON := &lochness.Guest{}
 	s.NoError(json.Unmarshal(guestBytes, guestFromJSON))
-	s.Equal(guest.MAC, guestFromJSON.MAC)
-	s.Equal(guest.IP, guestFromJSON.IP)
+	s.Len(guestFromJSON.Interfaces, len(guest.Interfaces))
+	s.Equal(guest.Interfaces[0].MAC, guestFromJSON.Interfaces[0].MAC)
+	s.Equal(guest.Interfaces[0].IP, guestFromJSON.Interfaces[0].IP)
+	s.Equal(guest.ServerGroup, guestFromJSON.ServerGroup)
+	s.Equal(guest.Affinity, guestFromJSON.Affinity)
+}
+
+func (s *GuestSuite) TestJSONSingleInterface() {
+	network := uuid.New()
+	input := fmt.Sprintf(`{"id":"%s","network":"%s","mac":"4c:3f:b1:7e:54:64","ip":"192.168.100.5"}`, uuid.New(), network)
+
+	guest := &lochness.Guest{}
+	s.NoError(json.Unmarshal([]byte(input), guest))
+	if !s.Len(guest.Interfaces, 1) {
+		return
+	}
+	s.Equal(network, guest.Interfaces[0].NetworkID)
+	s.Equal("4c:3f:b1:7e:54:64", guest.Interfaces[0].MAC.String())
+	s.Equal("192.168.100.5", guest.Interfaces[0].IP.String())
 }
 
 func (s *GuestSuite) TestNewGuest() {
@@ -80,6 +99,33 @@ func (s *GuestSuite) TestRefresh() {
 	s.Error(NewGuest.Refresh(), "unsaved guest refresh should fail")
 }
 
+func (s *GuestSuite) TestRefreshClearedFields() {
+	guest := s.NewGuest()
+	guestCopy := &lochness.Guest{}
+	*guestCopy = *guest
+
+	guest.ServerGroup = "web"
+	guest.ZoneSpread = lochness.ZoneSpreadSoft
+	guest.SnapshotLimit = 3
+	guest.Hostname = "web-1"
+	guest.SSHKeys = []string{"ssh-rsa AAAA"}
+	guest.UserData = "#cloud-config"
+	s.Require().NoError(guest.Save())
+	s.Require().NoError(guestCopy.Refresh())
+	s.Equal("web-1", guestCopy.Hostname)
+
+	guest.ServerGroup, guest.ZoneSpread, guest.SnapshotLimit = "", "", 0
+	guest.Hostname, guest.SSHKeys, guest.UserData = "", nil, ""
+	s.Require().NoError(guest.Save())
+	s.Require().NoError(guestCopy.Refresh())
+	s.Empty(guestCopy.ServerGroup, "cleared server group should not be kept")
+	s.Empty(guestCopy.ZoneSpread, "cleared zone spread should not be kept")
+	s.Zero(guestCopy.SnapshotLimit, "cleared snapshot limit should not be kept")
+	s.Empty(guestCopy.Hostname, "cleared hostname should not be kept")
+	s.Empty(guestCopy.SSHKeys, "cleared ssh keys should not be kept")
+	s.Empty(guestCopy.UserData, "cleared user data should not be kept")
+}
+
 func (s *GuestSuite) TestValidate() {
 	mac, _ := net.ParseMAC("4C:3F:B1:7E:54:64")
 	tests := []struct {
@@ -103,10 +149,14 @@ func (s *GuestSuite) TestValidate() {
 	for _, test := range tests {
 		msg := s.Messager(test.description)
 		g := &lochness.Guest{
-			ID:        test.id,
-			FlavorID:  test.flavor,
-			NetworkID: test.network,
-			MAC:       test.mac,
+			ID:       test.id,
+			FlavorID: test.flavor,
+			Interfaces: lochness.GuestInterfaces{
+				&lochness.GuestInterface{
+					NetworkID: test.network,
+					MAC:       test.mac,
+				},
+			},
 		}
 		err := g.Validate()
 		if test.expectedErr {
@@ -117,14 +167,40 @@ func (s *GuestSuite) TestValidate() {
 	}
 }
 
+func (s *GuestSuite) TestValidateInterfaces() {
+	guest := s.NewGuest()
+	s.NoError(guest.Validate(), "single interface should be valid")
+
+	guest.AddInterface(uuid.New())
+	s.NoError(guest.Validate(), "multiple interfaces should be valid")
+
+	guest.Interfaces[1].MAC = guest.Interfaces[0].MAC
+	s.Error(guest.Validate(), "duplicate MAC should be invalid")
+
+	guest.Interfaces = nil
+	s.Error(guest.Validate(), "no interfaces should be invalid")
+}
+
+func (s *GuestSuite) TestAddInterface() {
+	guest := s.Context.NewGuest()
+	network := uuid.New()
+	first := guest.AddInterface(network)
+	second := guest.AddInterface(network)
+
+	s.Len(guest.Interfaces, 2)
+	s.Equal(network, first.NetworkID)
+	s.NotNil(first.MAC)
+	s.NotNil(second.MAC)
+	s.NotEqual(first.MAC.String(), second.MAC.String(), "should generate distinct MACs")
+}
+
 func (s *GuestSuite) TestSave() {
 	goodGuest := s.Context.NewGuest()
 	flavor := s.NewFlavor()
 	network := s.NewNetwork()
 	mac, _ := net.ParseMAC("4C:3F:B1:7E:54:64")
 	goodGuest.FlavorID = flavor.ID
-	goodGuest.NetworkID = network.ID
-	goodGuest.MAC = mac
+	goodGuest.AddInterface(network.ID).MAC = mac
 
 	clobberGuest := *goodGuest
 
@@ -184,7 +260,7 @@ func (s *GuestSuite) TestDestroy() {
 func (s *GuestSuite) TestCandidates() {
 	guest := s.NewGuest()
 	subnet := s.NewSubnet()
-	network, _ := s.Context.Network(guest.NetworkID)
+	network, _ := s.Context.Network(guest.Interfaces[0].NetworkID)
 	_ = network.AddSubnet(subnet)
 
 	hypervisors := lochness.Hypervisors{
@@ -261,6 +337,101 @@ func (s *GuestSuite) TestCandidateHasSubnet() {
 
 }
 
+func (s *GuestSuite) TestCandidateHasSubnetInterfaces() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	backSubnet := s.NewSubnet()
+	backNetwork := s.NewNetwork()
+	s.Require().NoError(backNetwork.AddSubnet(backSubnet))
+	guest.AddInterface(backNetwork.ID)
+
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		hypervisor,
+	}
+
+	candidates, err := lochness.CandidateHasSubnet(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 0, "should require a subnet for every interface")
+
+	s.Require().NoError(hypervisor.AddSubnet(backSubnet, "mistify1"))
+	candidates, err = lochness.CandidateHasSubnet(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	s.Equal(hypervisor.ID, candidates[0].ID)
+}
+
+func (s *GuestSuite) TestCandidateHasSubnetRequested() {
+	guest := s.NewGuest()
+	network, _ := s.Context.Network(guest.Interfaces[0].NetworkID)
+	subnets := []*lochness.Subnet{s.NewSubnet(), s.NewSubnet()}
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+	}
+	for i, subnet := range subnets {
+		s.Require().NoError(network.AddSubnet(subnet))
+		s.Require().NoError(hypervisors[i].AddSubnet(subnet, "mistify0"))
+	}
+	s.Require().NoError(subnets[1].ReserveSpecificAddress("foo", net.ParseIP("192.168.100.5")))
+
+	tests := []struct {
+		description string
+		subnetID    string
+		ip          net.IP
+		expected    lochness.Hypervisors
+		expectedErr bool
+	}{
+		{"subnet", subnets[1].ID, nil, hypervisors[1:], false},
+		{"subnet not in network", s.NewSubnet().ID, nil, nil, true},
+		{"ip", "", net.ParseIP("192.168.100.6"), hypervisors, false},
+		{"ip taken in one subnet", "", net.ParseIP("192.168.100.5"), hypervisors[:1], false},
+		{"subnet and ip", subnets[0].ID, net.ParseIP("192.168.100.5"), hypervisors[:1], false},
+		{"subnet and ip taken", subnets[1].ID, net.ParseIP("192.168.100.5"), nil, true},
+		{"ip not in network", "", net.ParseIP("10.10.10.5"), nil, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest.Interfaces[0].SubnetID = test.subnetID
+		guest.Interfaces[0].IP = test.ip
+		candidates, err := lochness.CandidateHasSubnet(guest, hypervisors)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			continue
+		}
+		s.NoError(err, msg("should succeed"))
+		s.Len(candidates, len(test.expected), msg("should return correct number of candidates"))
+		for i, h := range test.expected {
+			s.Equal(h.ID, candidates[i].ID, msg("should return correct candidates"))
+		}
+	}
+}
+
+func (s *GuestSuite) TestCandidateHasVolumes() {
+	guest := s.NewGuest()
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+	}
+
+	unpooled := s.NewVolume()
+	s.Require().NoError(unpooled.Attach(guest))
+
+	candidates, err := lochness.CandidateHasVolumes(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 2, "unpooled volumes fit anywhere")
+
+	pooled := s.NewVolume()
+	pooled.HypervisorID = hypervisors[1].ID
+	s.Require().NoError(pooled.Save())
+	s.Require().NoError(pooled.Attach(guest))
+
+	candidates, err = lochness.CandidateHasVolumes(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	s.Equal(hypervisors[1].ID, candidates[0].ID)
+}
+
 func (s *GuestSuite) TestCandidateRandomize() {
 	guest := s.Context.NewGuest()
 	candidates := make(lochness.Hypervisors, 10)
@@ -0,0 +1,131 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Guest lifecycle states
+const (
+	GuestStatePending      = "pending"      // created, waiting to be placed
+	GuestStateScheduled    = "scheduled"    // placed on a hypervisor
+	GuestStateProvisioning = "provisioning" // being created on its hypervisor
+	GuestStateRunning      = "running"
+	GuestStateStopped      = "stopped"
+	GuestStateFailed       = "failed"
+	GuestStateDeleting     = "deleting"
+	GuestStateDeleted      = "deleted" // stopped and kept until purged, in case it is undeleted
+	GuestStatePurging      = "purging" // being removed for good
+)
+
+// MaxGuestStateHistory is the number of most recent state transitions kept on
+// a Guest
+const MaxGuestStateHistory = 20
+
+// GuestStateTransition is a single change of a Guest's state
+type GuestStateTransition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// guestStateTransitions lists the states each state may move to. A placed
+// guest returns to pending when it is evacuated to be placed again, and a
+// deleted guest returns to stopped when it is undeleted.
+var guestStateTransitions = map[string][]string{
+	GuestStatePending:      {GuestStateScheduled, GuestStateFailed, GuestStateDeleting},
+	GuestStateScheduled:    {GuestStatePending, GuestStateProvisioning, GuestStateFailed, GuestStateDeleting},
+	GuestStateProvisioning: {GuestStatePending, GuestStateRunning, GuestStateFailed, GuestStateDeleting},
+	GuestStateRunning:      {GuestStatePending, GuestStateRunning, GuestStateStopped, GuestStateFailed, GuestStateDeleting},
+	GuestStateStopped:      {GuestStatePending, GuestStateRunning, GuestStateStopped, GuestStateFailed, GuestStateDeleting},
+	GuestStateFailed:       {GuestStatePending, GuestStateRunning, GuestStateStopped, GuestStateDeleting},
+	GuestStateDeleting:     {GuestStateDeleted, GuestStateFailed},
+	GuestStateDeleted:      {GuestStateStopped, GuestStatePurging},
+	GuestStatePurging:      {GuestStateFailed},
+}
+
+// guestActionStates maps the user requested guest actions to the state the
+// guest moves to
+var guestActionStates = map[string]string{
+	"start":    GuestStateRunning,
+	"reboot":   GuestStateRunning,
+	"restart":  GuestStateRunning,
+	"shutdown": GuestStateStopped,
+	"poweroff": GuestStateStopped,
+	"suspend":  GuestStateStopped,
+	"delete":   GuestStateDeleting,
+}
+
+// ValidGuestState returns whether state is a known Guest state.
+func ValidGuestState(state string) bool {
+	_, ok := guestStateTransitions[state]
+	return ok
+}
+
+// GuestActionState returns the state a Guest moves to by performing action.
+func GuestActionState(action string) (string, bool) {
+	state, ok := guestActionStates[action]
+	return state, ok
+}
+
+// CanTransition returns whether the Guest may move to state. Guests saved
+// before states existed have no state and may move to any state.
+func (g *Guest) CanTransition(state string) bool {
+	if !ValidGuestState(state) {
+		return false
+	}
+	if g.State == "" {
+		return true
+	}
+	for _, s := range guestStateTransitions[g.State] {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// CanPerform returns an error if the Guest's state does not allow action.
+func (g *Guest) CanPerform(action string) error {
+	state, ok := GuestActionState(action)
+	if !ok {
+		return errors.New("invalid action")
+	}
+	if !g.CanTransition(state) {
+		return fmt.Errorf("guest can not %s while %s", action, g.State)
+	}
+	return nil
+}
+
+// SetState moves the Guest to state and records the transition in its
+// history. It does not save the Guest.
+func (g *Guest) SetState(state, reason string) error {
+	if !g.CanTransition(state) {
+		return fmt.Errorf("invalid state transition from %s to %s", g.State, state)
+	}
+
+	g.StateHistory = append(g.StateHistory, GuestStateTransition{
+		From:   g.State,
+		To:     state,
+		Reason: reason,
+		Time:   time.Now(),
+	})
+	if len(g.StateHistory) > MaxGuestStateHistory {
+		g.StateHistory = g.StateHistory[len(g.StateHistory)-MaxGuestStateHistory:]
+	}
+	g.State = state
+	return nil
+}
+
+// UpdateState refreshes the Guest, moves it to state, and saves it.
+func (g *Guest) UpdateState(state, reason string) error {
+	if err := g.Refresh(); err != nil {
+		return err
+	}
+	if err := g.SetState(state, reason); err != nil {
+		return err
+	}
+	return g.Save()
+}
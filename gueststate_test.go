@@ -0,0 +1,130 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestGuestState(t *testing.T) {
+	suite.Run(t, new(GuestStateSuite))
+}
+
+type GuestStateSuite struct {
+	common.Suite
+}
+
+func (s *GuestStateSuite) TestNewGuestState() {
+	g := s.Context.NewGuest()
+	s.Equal(lochness.GuestStatePending, g.State)
+	s.Empty(g.StateHistory)
+}
+
+func (s *GuestStateSuite) TestValidate() {
+	guest := s.NewGuest()
+	guest.State = "foobar"
+	s.Error(guest.Validate(), "unknown state should be invalid")
+
+	guest.State = ""
+	s.NoError(guest.Validate(), "missing state should be valid")
+}
+
+func (s *GuestStateSuite) TestCanTransition() {
+	tests := []struct {
+		description string
+		from        string
+		to          string
+		expected    bool
+	}{
+		{"unknown state", lochness.GuestStatePending, "foobar", false},
+		{"no state", "", lochness.GuestStateRunning, true},
+		{"pending to scheduled", lochness.GuestStatePending, lochness.GuestStateScheduled, true},
+		{"pending to running", lochness.GuestStatePending, lochness.GuestStateRunning, false},
+		{"provisioning to running", lochness.GuestStateProvisioning, lochness.GuestStateRunning, true},
+		{"running to running", lochness.GuestStateRunning, lochness.GuestStateRunning, true},
+		{"stopped to deleting", lochness.GuestStateStopped, lochness.GuestStateDeleting, true},
+		{"deleting to running", lochness.GuestStateDeleting, lochness.GuestStateRunning, false},
+		{"deleting to failed", lochness.GuestStateDeleting, lochness.GuestStateFailed, true},
+		{"running to pending", lochness.GuestStateRunning, lochness.GuestStatePending, true},
+		{"deleting to pending", lochness.GuestStateDeleting, lochness.GuestStatePending, false},
+		{"deleting to deleted", lochness.GuestStateDeleting, lochness.GuestStateDeleted, true},
+		{"deleted to stopped", lochness.GuestStateDeleted, lochness.GuestStateStopped, true},
+		{"deleted to running", lochness.GuestStateDeleted, lochness.GuestStateRunning, false},
+		{"deleted to purging", lochness.GuestStateDeleted, lochness.GuestStatePurging, true},
+		{"purging to stopped", lochness.GuestStatePurging, lochness.GuestStateStopped, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		g := &lochness.Guest{State: test.from}
+		s.Equal(test.expected, g.CanTransition(test.to), msg("unexpected transition result"))
+	}
+}
+
+func (s *GuestStateSuite) TestCanPerform() {
+	tests := []struct {
+		description string
+		state       string
+		action      string
+		expectedErr bool
+	}{
+		{"invalid action", lochness.GuestStateRunning, "foobar", true},
+		{"start while deleting", lochness.GuestStateDeleting, "start", true},
+		{"start while provisioning", lochness.GuestStateProvisioning, "start", true},
+		{"start while stopped", lochness.GuestStateStopped, "start", false},
+		{"reboot while running", lochness.GuestStateRunning, "reboot", false},
+		{"delete while pending", lochness.GuestStatePending, "delete", false},
+		{"delete while deleting", lochness.GuestStateDeleting, "delete", true},
+		{"delete while deleted", lochness.GuestStateDeleted, "delete", true},
+		{"start while deleted", lochness.GuestStateDeleted, "start", true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		g := &lochness.Guest{State: test.state}
+		err := g.CanPerform(test.action)
+		if test.expectedErr {
+			s.Error(err, msg("should not be allowed"))
+		} else {
+			s.NoError(err, msg("should be allowed"))
+		}
+	}
+}
+
+func (s *GuestStateSuite) TestSetState() {
+	guest := s.Context.NewGuest()
+
+	s.Error(guest.SetState(lochness.GuestStateRunning, "skip ahead"))
+	s.Equal(lochness.GuestStatePending, guest.State, "failed transition should not change state")
+	s.Empty(guest.StateHistory, "failed transition should not be recorded")
+
+	s.NoError(guest.SetState(lochness.GuestStateScheduled, "placed"))
+	s.Equal(lochness.GuestStateScheduled, guest.State)
+	s.Len(guest.StateHistory, 1)
+	s.Equal(lochness.GuestStatePending, guest.StateHistory[0].From)
+	s.Equal(lochness.GuestStateScheduled, guest.StateHistory[0].To)
+	s.Equal("placed", guest.StateHistory[0].Reason)
+	s.False(guest.StateHistory[0].Time.IsZero())
+
+	s.NoError(guest.SetState(lochness.GuestStateProvisioning, ""))
+	s.NoError(guest.SetState(lochness.GuestStateRunning, ""))
+	for i := 0; i < lochness.MaxGuestStateHistory; i++ {
+		s.NoError(guest.SetState(lochness.GuestStateRunning, "reboot"))
+	}
+	s.Len(guest.StateHistory, lochness.MaxGuestStateHistory, "history should be trimmed")
+	s.Equal("reboot", guest.StateHistory[0].Reason, "oldest transitions should be dropped")
+}
+
+func (s *GuestStateSuite) TestUpdateState() {
+	guest := s.NewGuest()
+
+	s.Error(guest.UpdateState(lochness.GuestStateRunning, ""))
+
+	s.NoError(guest.UpdateState(lochness.GuestStateScheduled, "placed"))
+	g, err := s.Context.Guest(guest.ID)
+	s.NoError(err)
+	s.Equal(lochness.GuestStateScheduled, g.State, "state should be saved")
+	s.Len(g.StateHistory, 1, "history should be saved")
+}
@@ -1,16 +1,13 @@
 package lochness
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/mistifyio/lochness/pkg/kv"
@@ -29,16 +26,24 @@ type (
 	Hypervisor struct {
 		context            *Context
 		modifiedIndex      uint64
-		ID                 string            `json:"id"`
-		Metadata           map[string]string `json:"metadata"`
-		IP                 net.IP            `json:"ip"`
-		Netmask            net.IP            `json:"netmask"`
-		Gateway            net.IP            `json:"gateway"`
-		MAC                net.HardwareAddr  `json:"mac"`
-		TotalResources     Resources         `json:"total_resources"`
-		AvailableResources Resources         `json:"available_resources"`
+		ID                 string               `json:"id"`
+		Metadata           map[string]string    `json:"metadata"`
+		IP                 net.IP               `json:"ip"`
+		Netmask            net.IP               `json:"netmask"`
+		Gateway            net.IP               `json:"gateway"`
+		MAC                net.HardwareAddr     `json:"mac"`
+		TotalResources     Resources            `json:"total_resources"`
+		AvailableResources Resources            `json:"available_resources"`
+		Reservations       map[string]Resources `json:"reservations"`  // keyed by guest id
+		ZoneID             string               `json:"zone"`          // failure domain. may be blank
+		Taints             Taints               `json:"taints"`        // restrict the guests placed on it
+		Unschedulable      bool                 `json:"unschedulable"` // cordoned. no new guests are placed on it
+		Host               HostResources        `json:"host"`          // physical resources found by the last probe
 		subnets            map[string]string
 		guests             []string
+		volumes            []string
+		snapshots          []string
+		drainJobs          map[string]string
 		alive              bool
 		heart              kv.EphemeralKey
 		// Config is a set of key/values for driving various config options. writes should
@@ -51,14 +56,19 @@ type (
 
 	// hypervisorJSON is used to ease json marshal/unmarshal
 	hypervisorJSON struct {
-		ID                 string            `json:"id"`
-		Metadata           map[string]string `json:"metadata"`
-		IP                 net.IP            `json:"ip"`
-		Netmask            net.IP            `json:"netmask"`
-		Gateway            net.IP            `json:"gateway"`
-		MAC                string            `json:"mac"`
-		TotalResources     Resources         `json:"total_resources"`
-		AvailableResources Resources         `json:"available_resources"`
+		ID                 string               `json:"id"`
+		Metadata           map[string]string    `json:"metadata"`
+		IP                 net.IP               `json:"ip"`
+		Netmask            net.IP               `json:"netmask"`
+		Gateway            net.IP               `json:"gateway"`
+		MAC                string               `json:"mac"`
+		TotalResources     Resources            `json:"total_resources"`
+		AvailableResources Resources            `json:"available_resources"`
+		Reservations       map[string]Resources `json:"reservations"`
+		ZoneID             string               `json:"zone"`
+		Taints             Taints               `json:"taints"`
+		Unschedulable      bool                 `json:"unschedulable"`
+		Host               HostResources        `json:"host"`
 	}
 )
 
@@ -73,6 +83,11 @@ func (h *Hypervisor) MarshalJSON() ([]byte, error) {
 		MAC:                h.MAC.String(),
 		TotalResources:     h.TotalResources,
 		AvailableResources: h.AvailableResources,
+		Reservations:       h.Reservations,
+		ZoneID:             h.ZoneID,
+		Taints:             h.Taints,
+		Unschedulable:      h.Unschedulable,
+		Host:               h.Host,
 	}
 
 	return json.Marshal(data)
@@ -110,6 +125,23 @@ func (h *Hypervisor) UnmarshalJSON(input []byte) error {
 		h.AvailableResources = data.AvailableResources
 	}
 
+	if data.Reservations != nil {
+		h.Reservations = data.Reservations
+	}
+	if data.ZoneID != "" {
+		h.ZoneID = data.ZoneID
+	}
+	if data.Taints != nil {
+		h.Taints = data.Taints
+	}
+	if data.Unschedulable {
+		h.Unschedulable = data.Unschedulable
+	}
+	h.Host = data.Host
+	if h.Reservations == nil {
+		h.Reservations = make(map[string]Resources)
+	}
+
 	if data.MAC != "" {
 		a, err := net.ParseMAC(data.MAC)
 		if err != nil {
@@ -130,12 +162,14 @@ func (h *Hypervisor) UnmarshalJSON(input []byte) error {
 // blankHypervisor is a helper for creating a blank Hypervisor.
 func (c *Context) blankHypervisor(id string) *Hypervisor {
 	h := &Hypervisor{
-		context:  c,
-		ID:       id,
-		Metadata: make(map[string]string),
-		subnets:  make(map[string]string),
-		Config:   make(map[string]string),
-		guests:   make([]string, 0, 0),
+		context:      c,
+		ID:           id,
+		Metadata:     make(map[string]string),
+		subnets:      make(map[string]string),
+		Config:       make(map[string]string),
+		guests:       make([]string, 0, 0),
+		Reservations: make(map[string]Resources),
+		drainJobs:    make(map[string]string),
 	}
 
 	if id == "" {
@@ -188,6 +222,12 @@ func (h *Hypervisor) Refresh() error {
 		return errors.New("metadata key is missing")
 	}
 
+	// reservations, zone, taints, and cordoning are replaced as a whole so
+	// stale ones are never kept
+	h.Reservations = nil
+	h.ZoneID = ""
+	h.Taints = nil
+	h.Unschedulable = false
 	if err := json.Unmarshal(value.Data, &h); err != nil {
 		return err
 	}
@@ -206,6 +246,9 @@ func (h *Hypervisor) Refresh() error {
 	config := map[string]string{}
 	guests := []string{}
 	subnets := map[string]string{}
+	volumes := []string{}
+	snapshots := []string{}
+	drainJobs := map[string]string{}
 
 	// TODO(needs tests)
 	for k, v := range nodes {
@@ -218,62 +261,27 @@ func (h *Hypervisor) Refresh() error {
 			subnets[base] = string(v.Data)
 		case "guests":
 			guests = append(guests, base)
+		case "volumes":
+			volumes = append(volumes, base)
+		case "snapshots":
+			snapshots = append(snapshots, base)
 		case "config":
 			config[base] = string(v.Data)
+		case "drain":
+			drainJobs[base] = string(v.Data)
 		}
 	}
 
 	h.Config = config
 	h.guests = guests
 	h.subnets = subnets
+	h.volumes = volumes
+	h.snapshots = snapshots
+	h.drainJobs = drainJobs
 
 	return nil
 }
 
-// TODO: figure out safe amount of memory to report and how to limit it
-func memory() (uint64, error) {
-	f, err := os.Open("/proc/meminfo")
-	if err != nil {
-		return 0, err
-	}
-	scanner := bufio.NewScanner(f)
-	mem := 0
-	for scanner.Scan() {
-		if !strings.HasPrefix(scanner.Text(), "MemTotal:") {
-			continue
-		}
-		vals := strings.Split(scanner.Text(), " ")
-		mem, err = strconv.Atoi(vals[len(vals)-2])
-		if err != nil {
-			return 0, err
-		}
-	}
-	return uint64(mem) * 80 / 100 / 1024, scanner.Err()
-}
-
-// TODO: parameterize this
-func disk(path string) (uint64, error) {
-	stat := &syscall.Statfs_t{}
-	err := syscall.Statfs(path, stat)
-	return uint64(stat.Bsize) * stat.Bavail * 80 / 100 / 1024 / 1024, err
-}
-
-// cpu gets number of CPU's.
-func cpu() (uint32, error) {
-	f, err := os.Open("/proc/cpuinfo")
-	if err != nil {
-		return 0, err
-	}
-	scanner := bufio.NewScanner(f)
-	count := 0
-	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "processor") {
-			count++
-		}
-	}
-	return uint32(count - 1), scanner.Err()
-}
-
 // canonicalizeUUID is a helper to ensure UUID's are in a single form and case
 func canonicalizeUUID(id string) (string, error) {
 	i := uuid.Parse(id)
@@ -334,64 +342,274 @@ func (h *Hypervisor) VerifyOnHV() error {
 	return nil
 }
 
-// calcGuestsUsage calculates total resource usage of managed guests.
-// Note that CPU "usage" is intentionally ignored as cores are not directly allocated to guests.
+// flavorReservation returns the resources reserved for a Guest of a Flavor.
+func flavorReservation(f *Flavor) Resources {
+	return f.Resources
+}
+
+// calcGuestsUsage calculates total resource usage of managed guests, including
+// guests being added with resources already reserved. Reservations are
+// reconciled along the way: guests added without one get one from their flavor,
+// and ones for guests that no longer exist are dropped.
 func (h *Hypervisor) calcGuestsUsage() (Resources, error) {
-	usage := Resources{}
-	err := h.ForEachGuest(func(guest *Guest) error {
+	added := make(map[string]bool, len(h.guests))
+	for _, id := range h.guests {
+		added[id] = true
+		if _, ok := h.Reservations[id]; ok {
+			continue
+		}
+		guest, err := h.context.Guest(id)
+		if err != nil {
+			return Resources{}, err
+		}
 		// cache?
 		flavor, err := h.context.Flavor(guest.FlavorID)
 		if err != nil {
-			return err
+			return Resources{}, err
 		}
-		usage.Memory += flavor.Memory
-		usage.Disk += flavor.Disk
-		return nil
-	})
-	if err != nil {
-		return Resources{}, err
+		h.Reservations[id] = flavorReservation(flavor)
+	}
+
+	usage := Resources{}
+	for id, r := range h.Reservations {
+		if !added[id] {
+			if _, err := h.context.Guest(id); err != nil {
+				if h.context.kv.IsKeyNotFound(err) {
+					delete(h.Reservations, id)
+					continue
+				}
+				return Resources{}, err
+			}
+		}
+		usage.Memory += r.Memory
+		usage.Disk += r.Disk
+		usage.CPU += r.CPU
+	}
+	return usage, nil
+}
+
+// calcVolumesUsage calculates total disk usage of volumes in the Hypervisor pool.
+func (h *Hypervisor) calcVolumesUsage() (Resources, error) {
+	usage := Resources{}
+	for _, id := range h.volumes {
+		v, err := h.context.Volume(id)
+		if err != nil {
+			return Resources{}, err
+		}
+		usage.Disk += v.Size
+	}
+	return usage, nil
+}
+
+// calcSnapshotsUsage calculates total disk usage of guest snapshots held by the
+// Hypervisor.
+func (h *Hypervisor) calcSnapshotsUsage() (Resources, error) {
+	usage := Resources{}
+	for _, id := range h.snapshots {
+		s, err := h.context.Snapshot(id)
+		if err != nil {
+			return Resources{}, err
+		}
+		usage.Disk += s.Size
 	}
 	return usage, nil
 }
 
 // UpdateResources syncs Hypervisor resource usage to the data store.
+// TotalResources is set to the capacity available to guests, per the ResourceRatios,
+// out of the resources found by the Hypervisor's ResourceProbe.
 // It should only be ran on the actual hypervisor.
 func (h *Hypervisor) UpdateResources() error {
 	if err := h.VerifyOnHV(); err != nil {
 		return err
 	}
 
-	m, err := memory()
+	probe, err := h.ResourceProbe()
 	if err != nil {
 		return err
 	}
-	guestDiskDir, ok := h.Config["guestDiskDir"]
-	if !ok {
-		guestDiskDir = "/mistify/guests"
-	}
-	d, err := disk(guestDiskDir)
+	return h.UpdateResourcesFrom(probe)
+}
+
+// UpdateResourcesFrom syncs Hypervisor resource usage to the data store, with
+// the resources found by probe.
+func (h *Hypervisor) UpdateResourcesFrom(probe ResourceProbe) error {
+	host, err := probe.Probe()
 	if err != nil {
 		return err
 	}
-	c, err := cpu()
-	if err != nil {
-		return err
+	physical := host.Available()
+
+	// recalculate from the latest guests and reservations so placements made
+	// since the last update are not clobbered
+	return h.casUpdate(func() error {
+		ratios, err := h.resourceRatios(DefaultResourceRatios.forHost(host))
+		if err != nil {
+			return err
+		}
+		total := ratios.Capacity(physical)
+		h.TotalResources = total
+		h.Host = host
+
+		usage, err := h.calcGuestsUsage()
+		if err != nil {
+			return err
+		}
+		volumeUsage, err := h.calcVolumesUsage()
+		if err != nil {
+			return err
+		}
+		usage.Disk += volumeUsage.Disk
+		snapshotUsage, err := h.calcSnapshotsUsage()
+		if err != nil {
+			return err
+		}
+		usage.Disk += snapshotUsage.Disk
+
+		h.AvailableResources = Resources{
+			Memory: remainder(total.Memory, usage.Memory),
+			Disk:   remainder(total.Disk, usage.Disk),
+			CPU:    uint32(remainder(uint64(total.CPU), uint64(usage.CPU))),
+		}
+		return nil
+	})
+}
+
+// remainder subtracts without going below zero
+func remainder(total, used uint64) uint64 {
+	if used > total {
+		return 0
 	}
+	return total - used
+}
 
-	h.TotalResources = Resources{Memory: m, Disk: d, CPU: c}
+// maxUpdateAttempts is the number of times casUpdate tries to save a
+// Hypervisor before giving up
+const maxUpdateAttempts = 10
 
-	usage, err := h.calcGuestsUsage()
-	if err != nil {
-		return err
+// casUpdate refreshes the Hypervisor, applies f, and saves it. If the save
+// loses a race with another update, it starts over. Other errors are returned
+// right away.
+func (h *Hypervisor) casUpdate(f func() error) error {
+	var err error
+	for i := 0; i < maxUpdateAttempts; i++ {
+		if err = h.Refresh(); err != nil {
+			return err
+		}
+		if err = f(); err != nil {
+			return err
+		}
+		if err = h.Save(); err == nil || !h.context.kv.IsCASFailed(err) {
+			return err
+		}
 	}
+	return err
+}
 
-	h.AvailableResources = Resources{
-		Memory: h.TotalResources.Memory - usage.Memory,
-		Disk:   h.TotalResources.Disk - usage.Disk,
-		CPU:    h.TotalResources.CPU - usage.CPU,
+// reserveResources takes the resources a Guest needs from those available,
+// failing with ErrInsufficientResources if the Hypervisor does not have enough.
+func (h *Hypervisor) reserveResources(g *Guest, need Resources) error {
+	return h.casUpdate(func() error {
+		if _, ok := h.Reservations[g.ID]; ok {
+			return nil
+		}
+		avail := h.AvailableResources
+		if avail.Memory < need.Memory || avail.Disk < need.Disk || avail.CPU < need.CPU {
+			return ErrInsufficientResources
+		}
+		h.AvailableResources = Resources{
+			Memory: avail.Memory - need.Memory,
+			Disk:   avail.Disk - need.Disk,
+			CPU:    avail.CPU - need.CPU,
+		}
+		h.Reservations[g.ID] = need
+		return nil
+	})
+}
+
+// releaseResources gives the resources reserved for a Guest back.
+func (h *Hypervisor) releaseResources(g *Guest) error {
+	return h.casUpdate(func() error {
+		r, ok := h.Reservations[g.ID]
+		if !ok {
+			return nil
+		}
+		avail := h.AvailableResources
+		h.AvailableResources = Resources{
+			Memory: avail.Memory + r.Memory,
+			Disk:   avail.Disk + r.Disk,
+			CPU:    avail.CPU + r.CPU,
+		}
+		delete(h.Reservations, g.ID)
+		return nil
+	})
+}
+
+// poolVolumeDisk moves the disk of volumes that joined the Hypervisor pool out
+// of the reservation of a Guest, as the pool usage now counts it, or back into
+// the reservation if they left the pool again.
+func (h *Hypervisor) poolVolumeDisk(g *Guest, disk uint64, joined bool) error {
+	if disk == 0 {
+		return nil
 	}
+	return h.casUpdate(func() error {
+		r, ok := h.Reservations[g.ID]
+		if !ok {
+			return nil
+		}
+		if joined {
+			r.Disk = remainder(r.Disk, disk)
+		} else {
+			r.Disk += disk
+		}
+		h.Reservations[g.ID] = r
+		return nil
+	})
+}
+
+// reserveVolumeDisk takes the disk of a volume joining the Hypervisor pool
+// from the available disk and holds it in the reservation of the Guest it is
+// attached to, until poolVolumeDisk hands it to the pool usage.
+func (h *Hypervisor) reserveVolumeDisk(g *Guest, disk uint64) error {
+	return h.casUpdate(func() error {
+		if h.AvailableResources.Disk < disk {
+			return ErrInsufficientResources
+		}
+		h.AvailableResources.Disk -= disk
+		if r, ok := h.Reservations[g.ID]; ok {
+			r.Disk += disk
+			h.Reservations[g.ID] = r
+		}
+		return nil
+	})
+}
 
-	return h.Save()
+// releaseVolumeDisk gives back the disk taken by reserveVolumeDisk for a volume
+// that did not join the pool after all.
+func (h *Hypervisor) releaseVolumeDisk(g *Guest, disk uint64) error {
+	return h.casUpdate(func() error {
+		h.AvailableResources.Disk += disk
+		if r, ok := h.Reservations[g.ID]; ok {
+			r.Disk = remainder(r.Disk, disk)
+			h.Reservations[g.ID] = r
+		}
+		return nil
+	})
+}
+
+// unpoolVolume gives back the disk of a volume leaving the Hypervisor pool. It
+// must be called before the volume's link to the pool is removed, so the disk
+// is only given back while the pool still counts it.
+func (h *Hypervisor) unpoolVolume(v *Volume) error {
+	return h.casUpdate(func() error {
+		for _, id := range h.volumes {
+			if id == v.ID {
+				h.AvailableResources.Disk += v.Size
+				break
+			}
+		}
+		return nil
+	})
 }
 
 // Validate ensures a Hypervisor has reasonable data.
@@ -404,7 +622,7 @@ func (h *Hypervisor) Validate() error {
 	if uuid.Parse(h.ID) == nil {
 		return errors.New("invalid id")
 	}
-	return nil
+	return h.Taints.Validate()
 }
 
 // Save persists a FWGroup.
@@ -420,12 +638,22 @@ func (h *Hypervisor) Save() error {
 		return err
 	}
 
+	labels, err := h.context.savedLabels(h.key(), h.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := h.context.auditSaved(h.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := h.context.kv.Update(h.key(), kv.Value{Data: v, Index: h.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	h.modifiedIndex = index
-	return nil
+	h.context.recordChange("hypervisor", h.ID, before, v)
+	return h.context.updateLabelIndex(hypervisorLabelKind, h.ID, labels, h.Metadata)
 }
 
 // the many side of many:one relationships is done with nested keys
@@ -518,64 +746,158 @@ func (h *Hypervisor) guestKey(g *Guest) string {
 }
 
 // AddGuest adds a Guest to the Hypervisor.
-// It reserves an IPaddress for the Guest.
+// It reserves the resources of the Guest's Flavor and the disk of its Volumes
+// not yet in a pool, failing if they are not available.
+// It reserves an IPaddress for each Guest interface, honoring a requested subnet or IP.
 // It also updates the Guest.
-func (h *Hypervisor) AddGuest(g *Guest) error {
+func (h *Hypervisor) AddGuest(g *Guest) (err error) {
 
 	// make sure we have subnet guest wants.  we should have this figured out
 	// when we selected this hypervisor, so this is sort of silly to do again
 	// we need to rethink how we do this
 
-	n, err := h.context.Network(g.NetworkID)
+	if len(g.Interfaces) == 0 {
+		return errors.New("guest has no interfaces")
+	}
+
+	// attached volumes must already be in this pool or not in one yet
+	volumes, err := g.Volumes()
 	if err != nil {
 		return err
 	}
-	var s *Subnet
-	var bridge string
-LOOP:
-	for _, k := range n.Subnets() {
+	for _, v := range volumes {
+		if v.HypervisorID != "" && v.HypervisorID != h.ID {
+			return fmt.Errorf("volume %s is not in the hypervisor pool", v.ID)
+		}
+	}
 
-		for id, br := range h.subnets {
-			if id == k {
-				subnet, err := h.context.Subnet(id)
-				if err != nil {
-					return err
-				}
-				avail := subnet.AvailableAddresses()
-				if len(avail) > 0 {
-					s = subnet
-					bridge = br
-					break LOOP
-				}
+	subnets := make([]*Subnet, len(g.Interfaces))
+	bridges := make([]string, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		suitable, err := g.SuitableSubnets(iface)
+		if err != nil {
+			return err
+		}
+		for _, subnet := range suitable {
+			if br, ok := h.subnets[subnet.ID]; ok {
+				subnets[i] = subnet
+				bridges[i] = br
+				break
 			}
 		}
+		if subnets[i] == nil {
+			return fmt.Errorf("no suitable subnet found for interface %d", i)
+		}
 	}
 
-	if s == nil {
-		return errors.New("no suitable subnet found")
+	// reserve the resources up front so concurrent placements can not
+	// double-book the hypervisor, including the disk of volumes joining the pool
+	flavor, err := h.context.Flavor(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	need := flavorReservation(flavor)
+	var volumeDisk uint64
+	for _, v := range volumes {
+		if v.HypervisorID == "" {
+			volumeDisk += v.Size
+		}
+	}
+	need.Disk += volumeDisk
+	if err := h.reserveResources(g, need); err != nil {
+		return err
 	}
 
-	ip, err := s.ReserveAddress(g.ID)
+	// the requested subnets and addresses are restored on failure
+	requested := make([]net.IP, len(g.Interfaces))
+	requestedSubnets := make([]string, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		requested[i] = iface.IP
+		requestedSubnets[i] = iface.SubnetID
+	}
 
-	if err != nil {
-		return err
+	// give back everything taken so far if the guest can not be added, as
+	// reservations are kept for as long as the guest exists
+	ips := make([]net.IP, len(g.Interfaces))
+	var pooled Volumes
+	var disk uint64 // volume disk moved from the reservation to the pool
+	var added bool  // hypervisor guest key set
+	defer func() {
+		if err == nil {
+			return
+		}
+		if added {
+			_ = h.context.kv.Delete(filepath.Join(h.guestKey(g)), false)
+		}
+		for _, v := range pooled {
+			key := v.hypervisorKey()
+			v.HypervisorID = ""
+			if v.Save() == nil {
+				_ = h.context.kv.Delete(key, false)
+			}
+		}
+		_ = h.poolVolumeDisk(g, disk, false)
+		for i, ip := range ips {
+			if ip != nil {
+				_ = subnets[i].ReleaseAddress(ip)
+			}
+		}
+		_ = h.releaseResources(g)
+
+		g.HypervisorID = ""
+		for i, iface := range g.Interfaces {
+			iface.IP = requested[i]
+			iface.SubnetID = requestedSubnets[i]
+			iface.Bridge = ""
+		}
+	}()
+
+	for i, iface := range g.Interfaces {
+		ip := iface.IP
+		if ip != nil {
+			err = subnets[i].ReserveSpecificAddress(g.ID, ip)
+		} else {
+			ip, err = subnets[i].ReserveAddress(g.ID)
+			if err == nil && ip == nil {
+				err = errors.New("no available addresses")
+			}
+		}
+		if err != nil {
+			return err
+		}
+		ips[i] = ip
 	}
 
 	// an instance where transactions would be cool...
 	g.HypervisorID = h.ID
-	g.IP = ip
-	g.SubnetID = s.ID
-	g.Bridge = bridge
-
-	err = h.context.kv.Set(filepath.Join(h.guestKey(g)), g.ID)
+	for i, iface := range g.Interfaces {
+		iface.IP = ips[i]
+		iface.SubnetID = subnets[i].ID
+		iface.Bridge = bridges[i]
+	}
 
-	if err != nil {
+	for _, v := range volumes {
+		if v.HypervisorID != "" {
+			continue
+		}
+		v.HypervisorID = h.ID
+		pooled = append(pooled, v)
+		if err = v.Save(); err != nil {
+			return err
+		}
+		h.volumes = append(h.volumes, v.ID)
+	}
+	if err = h.poolVolumeDisk(g, volumeDisk, true); err != nil {
 		return err
 	}
+	disk = volumeDisk
 
-	err = g.Save()
+	if err = h.context.kv.Set(filepath.Join(h.guestKey(g)), g.ID); err != nil {
+		return err
+	}
+	added = true
 
-	if err != nil {
+	if err = g.Save(); err != nil {
 		return err
 	}
 
@@ -585,28 +907,44 @@ LOOP:
 }
 
 // RemoveGuest removes a guest from the hypervisor.
-// Also releases the IP.
+// Also releases the IP, the reserved resources, and the guest's snapshots.
 func (h *Hypervisor) RemoveGuest(g *Guest) error {
 	if g.HypervisorID != h.ID {
 		return errors.New("guest does not belong to hypervisor")
 	}
 
-	subnet, err := h.context.Subnet(g.SubnetID)
-	if err != nil {
+	for _, iface := range g.Interfaces {
+		if iface.SubnetID == "" || iface.IP == nil {
+			continue
+		}
+		subnet, err := h.context.Subnet(iface.SubnetID)
+		if err != nil {
+			return err
+		}
+		if err := subnet.ReleaseAddress(iface.IP); err != nil {
+			return err
+		}
+	}
+
+	if err := h.context.kv.Delete(filepath.Join(h.guestKey(g)), false); err != nil {
 		return err
 	}
-	if err := subnet.ReleaseAddress(g.IP); err != nil {
+
+	// snapshots go with the guest's disks
+	if err := g.destroySnapshots(); err != nil {
 		return err
 	}
 
-	if err := h.context.kv.Delete(filepath.Join(h.guestKey(g)), false); err != nil {
+	if err := h.releaseResources(g); err != nil {
 		return err
 	}
 
 	g.HypervisorID = ""
-	g.IP = nil
-	g.SubnetID = ""
-	g.Bridge = ""
+	for _, iface := range g.Interfaces {
+		iface.IP = nil
+		iface.SubnetID = ""
+		iface.Bridge = ""
+	}
 
 	if err := g.Save(); err != nil {
 		return err
@@ -623,6 +961,16 @@ func (h *Hypervisor) RemoveGuest(g *Guest) error {
 	return nil
 }
 
+// Volumes returns a slice of VolumeIDs in the Hypervisor pool.
+func (h *Hypervisor) Volumes() []string {
+	return h.volumes
+}
+
+// Snapshots returns a slice of SnapshotIDs held by the Hypervisor.
+func (h *Hypervisor) Snapshots() []string {
+	return h.snapshots
+}
+
 // Guests returns a slice of GuestIDs assigned to the Hypervisor.
 func (h *Hypervisor) Guests() []string {
 	return h.guests
@@ -722,9 +1070,27 @@ func (h *Hypervisor) Destroy() error {
 		return errors.New("not persisted")
 	}
 
+	labels, err := h.context.savedLabels(h.key(), h.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := h.context.auditSaved(h.key())
+	if err != nil {
+		return err
+	}
 	if err := h.context.kv.Remove(h.key(), h.modifiedIndex); err != nil {
 		return err
 	}
+	h.context.recordChange("hypervisor", h.ID, before, nil)
+	if err := h.context.updateLabelIndex(hypervisorLabelKind, h.ID, labels, nil); err != nil {
+		return err
+	}
+	if h.ZoneID != "" {
+		z := &Zone{context: h.context, ID: h.ZoneID}
+		if err := h.context.kv.Delete(z.hypervisorKey(h), false); err != nil && !h.context.kv.IsKeyNotFound(err) {
+			return err
+		}
+	}
 
 	return h.context.kv.Delete(filepath.Join(HypervisorPath, h.ID), true)
 }
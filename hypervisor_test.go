@@ -3,6 +3,7 @@ package lochness_test
 import (
 	"encoding/json"
 	"errors"
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -165,8 +166,7 @@ func (s *HypervisorSuite) TestUpdateResources() {
 	s.NotEqual(0, tr.CPU)
 	s.Equal(tr.Memory-flavor.Memory, ar.Memory)
 	s.Equal(tr.Disk-flavor.Disk, ar.Disk)
-	// Total and available CPU are currently equal
-	s.Equal(tr.CPU, ar.CPU)
+	s.Equal(tr.CPU-flavor.CPU, ar.CPU)
 
 	loadedHypervisor, _ := s.Context.Hypervisor(hypervisor.ID)
 	tr = loadedHypervisor.TotalResources
@@ -296,7 +296,7 @@ func (s *HypervisorSuite) TestAddGuest() {
 	guest := s.NewGuest()
 	hypervisor := s.NewHypervisor()
 	subnet := s.NewSubnet()
-	network, _ := s.Context.Network(guest.NetworkID)
+	network, _ := s.Context.Network(guest.Interfaces[0].NetworkID)
 	_ = network.AddSubnet(subnet)
 	_ = hypervisor.AddSubnet(subnet, "mistify0")
 
@@ -328,6 +328,89 @@ func (s *HypervisorSuite) TestAddGuest() {
 	}
 }
 
+func (s *HypervisorSuite) TestAddGuestInterfaces() {
+	hypervisor := s.NewHypervisor()
+	guest := s.NewGuest()
+	frontSubnet := s.NewSubnet()
+	frontNetwork, _ := s.Context.Network(guest.Interfaces[0].NetworkID)
+	s.Require().NoError(frontNetwork.AddSubnet(frontSubnet))
+	s.Require().NoError(hypervisor.AddSubnet(frontSubnet, "mistify0"))
+
+	backSubnet := s.NewSubnet()
+	backNetwork := s.NewNetwork()
+	s.Require().NoError(backNetwork.AddSubnet(backSubnet))
+	guest.AddInterface(backNetwork.ID)
+
+	s.Error(hypervisor.AddGuest(guest), "should fail without a subnet for every interface")
+	s.Empty(guest.HypervisorID)
+	_ = frontSubnet.Refresh()
+	s.Len(frontSubnet.Addresses(), 0, "should not leave addresses reserved")
+
+	s.Require().NoError(hypervisor.AddSubnet(backSubnet, "mistify1"))
+	s.NoError(hypervisor.AddGuest(guest))
+	s.Equal(hypervisor.ID, guest.HypervisorID)
+	s.Equal(frontSubnet.ID, guest.Interfaces[0].SubnetID)
+	s.Equal("mistify0", guest.Interfaces[0].Bridge)
+	s.NotNil(guest.Interfaces[0].IP)
+	s.Equal(backSubnet.ID, guest.Interfaces[1].SubnetID)
+	s.Equal("mistify1", guest.Interfaces[1].Bridge)
+	s.NotNil(guest.Interfaces[1].IP)
+
+	s.NoError(hypervisor.RemoveGuest(guest))
+	for _, iface := range guest.Interfaces {
+		s.Nil(iface.IP, "should release interface addresses")
+	}
+}
+
+func (s *HypervisorSuite) TestAddGuestRequested() {
+	hypervisor := s.NewHypervisor()
+	subnets := []*lochness.Subnet{s.NewSubnet(), s.NewSubnet()}
+	network := s.NewNetwork()
+	for _, subnet := range subnets {
+		s.Require().NoError(network.AddSubnet(subnet))
+		s.Require().NoError(hypervisor.AddSubnet(subnet, "mistify0"))
+	}
+
+	newGuest := func(subnetID string, ip net.IP) *lochness.Guest {
+		guest := s.NewGuest()
+		guest.Interfaces[0].NetworkID = network.ID
+		guest.Interfaces[0].SubnetID = subnetID
+		guest.Interfaces[0].IP = ip
+		return guest
+	}
+
+	tests := []struct {
+		description string
+		guest       *lochness.Guest
+		expectedErr bool
+	}{
+		{"subnet", newGuest(subnets[1].ID, nil), false},
+		{"ip", newGuest("", net.ParseIP("192.168.100.5")), false},
+		{"subnet and ip", newGuest(subnets[1].ID, net.ParseIP("192.168.100.5")), false},
+		{"taken ip", newGuest(subnets[1].ID, net.ParseIP("192.168.100.5")), true},
+		{"ip out of range", newGuest("", net.ParseIP("192.168.100.20")), true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		requestedSubnet, requestedIP := test.guest.Interfaces[0].SubnetID, test.guest.Interfaces[0].IP
+		err := hypervisor.AddGuest(test.guest)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			s.Empty(test.guest.HypervisorID, msg("should not set hypervisor id"))
+			continue
+		}
+		s.NoError(err, msg("should pass"))
+		s.Equal(hypervisor.ID, test.guest.HypervisorID, msg("should set hypervisor id"))
+		if requestedSubnet != "" {
+			s.Equal(requestedSubnet, test.guest.Interfaces[0].SubnetID, msg("should use requested subnet"))
+		}
+		if requestedIP != nil {
+			s.True(requestedIP.Equal(test.guest.Interfaces[0].IP), msg("should use requested ip"))
+		}
+	}
+}
+
 func (s *HypervisorSuite) TestRemoveGuest() {
 	hypervisor, guest := s.NewHypervisorWithGuest()
 
@@ -340,6 +423,122 @@ func (s *HypervisorSuite) TestRemoveGuest() {
 	s.Len(hypervisor.Guests(), 0)
 }
 
+func (s *HypervisorSuite) TestGuestReservations() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+	total := hypervisor.TotalResources
+
+	s.Equal(flavor.Resources, hypervisor.Reservations[guest.ID], "adding should reserve the flavor")
+	s.Equal(total.Memory-flavor.Memory, hypervisor.AvailableResources.Memory)
+	s.Equal(total.Disk-flavor.Disk, hypervisor.AvailableResources.Disk)
+
+	loadedHypervisor, err := s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Equal(hypervisor.AvailableResources, loadedHypervisor.AvailableResources, "reservation should be saved")
+	s.Equal(hypervisor.Reservations, loadedHypervisor.Reservations, "reservation should be saved")
+
+	s.NoError(hypervisor.RemoveGuest(guest))
+	s.Empty(hypervisor.Reservations, "removing should release the reservation")
+	s.Equal(total, hypervisor.AvailableResources)
+}
+
+func (s *HypervisorSuite) TestGuestReservationsVolumes() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+	s.NoError(hypervisor.RemoveGuest(guest))
+	volume := s.NewVolume()
+	s.Require().NoError(volume.Attach(guest))
+
+	// room for the flavor but not the volume joining the pool
+	hypervisor.AvailableResources.Disk = flavor.Disk + volume.Size - 1
+	s.Require().NoError(hypervisor.Save())
+	s.Error(hypervisor.AddGuest(guest), "should reserve the volume disk")
+	s.Empty(guest.HypervisorID)
+
+	hypervisor.AvailableResources.Disk = flavor.Disk + volume.Size
+	s.Require().NoError(hypervisor.Save())
+	s.NoError(hypervisor.AddGuest(guest))
+	s.Equal(uint64(0), hypervisor.AvailableResources.Disk, "should take the volume disk")
+	s.Equal(flavor.Resources, hypervisor.Reservations[guest.ID], "pool should count the volume disk")
+}
+
+func (s *HypervisorSuite) TestAddGuestRollback() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	subnet, _ := s.Context.Subnet(guest.Interfaces[0].SubnetID)
+	s.NoError(hypervisor.RemoveGuest(guest))
+	volume := s.NewVolume()
+	s.Require().NoError(volume.Attach(guest))
+	available := hypervisor.AvailableResources
+
+	// the guest can not be saved once everything else is taken
+	guest.State = "bogus"
+	s.Error(hypervisor.AddGuest(guest))
+	s.Empty(guest.HypervisorID, "should not set hypervisor id")
+	s.Nil(guest.Interfaces[0].IP, "should restore the requested address")
+
+	s.Require().NoError(hypervisor.Refresh())
+	s.Empty(hypervisor.Reservations, "should release the reservation")
+	s.Equal(available, hypervisor.AvailableResources, "should give back the resources")
+	s.Len(hypervisor.Guests(), 0, "should not add the guest")
+	s.Len(hypervisor.Volumes(), 0, "should not pool the volume")
+	s.Require().NoError(volume.Refresh())
+	s.Empty(volume.HypervisorID, "should not pool the volume")
+	s.Require().NoError(subnet.Refresh())
+	s.Len(subnet.Addresses(), 0, "should release the addresses")
+}
+
+func (s *HypervisorSuite) TestGuestReservationsConcurrent() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+	s.NoError(hypervisor.RemoveGuest(guest))
+
+	// only room for one more guest
+	hypervisor.AvailableResources.Memory = flavor.Memory
+	s.Require().NoError(hypervisor.Save())
+
+	// both placements see the same free memory
+	stale, err := s.Context.Hypervisor(hypervisor.ID)
+	s.Require().NoError(err)
+
+	other := s.NewGuest()
+	other.Interfaces[0].NetworkID = guest.Interfaces[0].NetworkID
+	other.FlavorID = guest.FlavorID
+
+	s.NoError(hypervisor.AddGuest(guest))
+	s.Equal(lochness.ErrInsufficientResources, stale.AddGuest(other), "should not double-book")
+	s.Empty(other.HypervisorID)
+	_, ok := stale.Reservations[other.ID]
+	s.False(ok, "failed add should not reserve")
+	s.Len(stale.Guests(), 1)
+}
+
+func (s *HypervisorSuite) TestUpdateResourcesReservations() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	_ = hypervisor.SetConfig("guestDiskDir", "/")
+	_, _ = lochness.SetHypervisorID(hypervisor.ID)
+
+	// a guest being added, a guest added before reservations, and a guest that
+	// no longer exists
+	inFlight := s.NewGuest()
+	inFlightReservation := lochness.Resources{Memory: 1024, Disk: 2048}
+	hypervisor.Reservations[inFlight.ID] = inFlightReservation
+	delete(hypervisor.Reservations, guest.ID)
+	hypervisor.Reservations[uuid.New()] = lochness.Resources{Memory: 1024}
+	s.Require().NoError(hypervisor.Save())
+
+	s.NoError(hypervisor.UpdateResources())
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+	s.Equal(map[string]lochness.Resources{
+		guest.ID:    flavor.Resources,
+		inFlight.ID: inFlightReservation,
+	}, hypervisor.Reservations, "reservations should be reconciled")
+
+	tr := hypervisor.TotalResources
+	ar := hypervisor.AvailableResources
+	s.Equal(tr.Memory-flavor.Memory-inFlightReservation.Memory, ar.Memory)
+	s.Equal(tr.Disk-flavor.Disk-inFlightReservation.Disk, ar.Disk)
+}
+
 func (s *HypervisorSuite) TestGuests() {
 	hypervisor, guest := s.NewHypervisorWithGuest()
 	guests := hypervisor.Guests()
@@ -350,7 +549,7 @@ func (s *HypervisorSuite) TestGuests() {
 func (s *HypervisorSuite) TestForEachGuest() {
 	hypervisor, guest1 := s.NewHypervisorWithGuest()
 	guest2 := s.NewGuest()
-	guest2.NetworkID = guest1.NetworkID
+	guest2.Interfaces[0].NetworkID = guest1.Interfaces[0].NetworkID
 	_ = hypervisor.AddGuest(guest2)
 
 	expectedFound := map[string]bool{
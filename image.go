@@ -0,0 +1,131 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mistifyio/mistify-image-service/metadata"
+	logx "github.com/mistifyio/mistify-logrus-ext"
+	"github.com/pborman/uuid"
+)
+
+// ImageServiceKey is the config key of the address of the image service, the
+// same one the img cli talks to. Flavor images are not checked without it.
+const ImageServiceKey = "imageService"
+
+// GuestImageType is the image type guests can be created from
+const GuestImageType = "kvm"
+
+// ErrImageNotFound is returned when the image service does not have an image
+var ErrImageNotFound = errors.New("image not found")
+
+// imageServiceURL returns the base url of the image service, or "" if none is
+// configured
+func (c *Context) imageServiceURL() (string, error) {
+	address, err := c.GetConfig(ImageServiceKey)
+	if err != nil {
+		if c.IsKeyNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	address = strings.TrimRight(strings.TrimSpace(address), "/")
+	if address != "" && !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	return address, nil
+}
+
+// Image fetches the metadata of an image from the image service. It fails if no
+// image service is configured.
+func (c *Context) Image(id string) (*metadata.Image, error) {
+	var err error
+	id, err = canonicalizeUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	serviceURL, err := c.imageServiceURL()
+	if err != nil {
+		return nil, err
+	}
+	if serviceURL == "" {
+		return nil, errors.New("no image service configured")
+	}
+
+	httpClient := &http.Client{
+		Timeout: 15 * time.Second,
+	}
+	resp, err := httpClient.Get(serviceURL + "/images/" + id)
+	if err != nil {
+		return nil, err
+	}
+	defer logx.LogReturnedErr(resp.Body.Close, nil, "failed to close response body")
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrImageNotFound
+	default:
+		return nil, ErrorHTTPCode{http.StatusOK, resp.StatusCode}
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	image := &metadata.Image{}
+	if err := json.Unmarshal(body, image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// verifyImage ensures the image of a Flavor exists in the image service, is
+// completely downloaded, and can be used for guests. It is skipped if no
+// image service is configured.
+func (f *Flavor) verifyImage() error {
+	serviceURL, err := f.context.imageServiceURL()
+	if err != nil || serviceURL == "" {
+		return err
+	}
+
+	image, err := f.context.Image(f.Image)
+	if err != nil {
+		if err == ErrImageNotFound {
+			return fmt.Errorf("flavor image %s not found", f.Image)
+		}
+		return err
+	}
+	if image.Status != metadata.StatusComplete {
+		return fmt.Errorf("flavor image %s is %s, not %s", f.Image, image.Status, metadata.StatusComplete)
+	}
+	if image.Type != GuestImageType {
+		return fmt.Errorf("flavor image %s is of type %s, not %s", f.Image, image.Type, GuestImageType)
+	}
+	return nil
+}
+
+// ImageFlavors returns the Flavors using an image
+func (c *Context) ImageFlavors(imageID string) (Flavors, error) {
+	image := uuid.Parse(imageID)
+	if image == nil {
+		return nil, fmt.Errorf("invalid UUID: %s", imageID)
+	}
+
+	flavors := Flavors{}
+	err := c.ForEachFlavor(func(f *Flavor) error {
+		if uuid.Equal(uuid.Parse(f.Image), image) {
+			flavors = append(flavors, f)
+		}
+		return nil
+	})
+	if err != nil && !c.IsKeyNotFound(err) {
+		return nil, err
+	}
+	return flavors, nil
+}
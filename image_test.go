@@ -0,0 +1,123 @@
+package lochness_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/mistifyio/mistify-image-service/metadata"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestImage(t *testing.T) {
+	suite.Run(t, new(ImageSuite))
+}
+
+type ImageSuite struct {
+	common.Suite
+	Server *httptest.Server
+	Images map[string]*metadata.Image
+}
+
+func (s *ImageSuite) SetupTest() {
+	s.Suite.SetupTest()
+	s.Images = make(map[string]*metadata.Image)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		image, ok := s.Images[strings.TrimPrefix(r.URL.Path, "/images/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(image)
+	}))
+	s.Require().NoError(s.Context.SetConfig(lochness.ImageServiceKey, s.Server.URL))
+}
+
+func (s *ImageSuite) TearDownTest() {
+	s.Server.Close()
+	s.Suite.TearDownTest()
+}
+
+// addImage adds an image to the fake image service
+func (s *ImageSuite) addImage(status, imageType string) string {
+	id := uuid.New()
+	s.Images[id] = &metadata.Image{ID: id, Status: status, Type: imageType}
+	return id
+}
+
+func (s *ImageSuite) TestImage() {
+	id := s.addImage(metadata.StatusComplete, lochness.GuestImageType)
+
+	image, err := s.Context.Image(strings.ToUpper(id))
+	s.NoError(err, "existing image should succeed")
+	s.Equal(s.Images[id], image)
+
+	_, err = s.Context.Image(uuid.New())
+	s.Equal(lochness.ErrImageNotFound, err, "missing image should fail")
+
+	_, err = s.Context.Image("asdf")
+	s.Error(err, "invalid id should fail")
+
+	s.Require().NoError(s.Context.SetConfig(lochness.ImageServiceKey, ""))
+	_, err = s.Context.Image(id)
+	s.Error(err, "no image service should fail")
+}
+
+func (s *ImageSuite) TestFlavorSave() {
+	tests := []struct {
+		description string
+		image       string
+		expectedErr bool
+	}{
+		{"complete image", s.addImage(metadata.StatusComplete, lochness.GuestImageType), false},
+		{"missing image", uuid.New(), true},
+		{"downloading image", s.addImage(metadata.StatusDownloading, lochness.GuestImageType), true},
+		{"failed image", s.addImage(metadata.StatusError, lochness.GuestImageType), true},
+		{"container image", s.addImage(metadata.StatusComplete, "container"), true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		flavor := s.Context.NewFlavor()
+		flavor.Image = test.image
+		err := flavor.Save()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+		}
+	}
+
+	s.Require().NoError(s.Context.SetConfig(lochness.ImageServiceKey, ""))
+	flavor := s.Context.NewFlavor()
+	flavor.Image = uuid.New()
+	s.NoError(flavor.Save(), "unchecked without an image service")
+}
+
+func (s *ImageSuite) TestImageFlavors() {
+	id := s.addImage(metadata.StatusComplete, lochness.GuestImageType)
+
+	flavors, err := s.Context.ImageFlavors(id)
+	s.NoError(err, "no flavors should succeed")
+	s.Len(flavors, 0)
+
+	flavor := s.Context.NewFlavor()
+	flavor.Image = id
+	s.Require().NoError(flavor.Save())
+	other := s.Context.NewFlavor()
+	other.Image = s.addImage(metadata.StatusComplete, lochness.GuestImageType)
+	s.Require().NoError(other.Save())
+
+	flavors, err = s.Context.ImageFlavors(strings.ToUpper(id))
+	s.NoError(err, "should succeed")
+	s.Len(flavors, 1)
+	s.Equal(flavor.ID, flavors[0].ID)
+
+	_, err = s.Context.ImageFlavors("asdf")
+	s.Error(err, "invalid id should fail")
+}
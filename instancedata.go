@@ -0,0 +1,94 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// MaxUserDataSize is the largest user data a Guest may have, in bytes
+const MaxUserDataSize = 64 * 1024
+
+// hostnameLabel matches a single label of a hostname
+var hostnameLabel = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+// validateInstanceData ensures the data a Guest learns about itself from the
+// metadata service is reasonable.
+func (g *Guest) validateInstanceData() error {
+	if g.Hostname != "" {
+		if len(g.Hostname) > 253 {
+			return errors.New("hostname is too long")
+		}
+		for _, label := range strings.Split(g.Hostname, ".") {
+			if !hostnameLabel.MatchString(label) {
+				return errors.New("invalid hostname")
+			}
+		}
+	}
+	for i, key := range g.SSHKeys {
+		if strings.TrimSpace(key) == "" || strings.ContainsAny(key, "\r\n") {
+			return fmt.Errorf("ssh key %d: invalid", i)
+		}
+	}
+	if len(g.UserData) > MaxUserDataSize {
+		return fmt.Errorf("user data is larger than %d bytes", MaxUserDataSize)
+	}
+	return nil
+}
+
+// LocalHostname returns the hostname of the Guest, its id if it has none.
+func (g *Guest) LocalHostname() string {
+	if g.Hostname != "" {
+		return g.Hostname
+	}
+	return g.ID
+}
+
+// InterfaceByIP returns the interface of the Guest with the address, or nil if
+// it has none.
+func (g *Guest) InterfaceByIP(ip net.IP) *GuestInterface {
+	for _, iface := range g.Interfaces {
+		if iface != nil && iface.IP.Equal(ip) {
+			return iface
+		}
+	}
+	return nil
+}
+
+// GuestByIP fetches the Guest holding an address, looked up through the address
+// reservations of the Subnets containing it. It returns nil if no Guest holds
+// the address, and an error if more than one does, as overlapping Subnets of
+// different Networks may.
+func (c *Context) GuestByIP(ip net.IP) (*Guest, error) {
+	if ip.To4() == nil {
+		return nil, nil
+	}
+
+	var guestID string
+	err := c.ForEachSubnet(func(s *Subnet) error {
+		if s.CIDR == nil || !s.CIDR.Contains(ip) {
+			return nil
+		}
+		id, ok := s.addresses[ipToI32(ip)]
+		if !ok {
+			return nil
+		}
+		if guestID != "" && guestID != id {
+			return fmt.Errorf("address %s is held by more than one guest", ip)
+		}
+		guestID = id
+		return nil
+	})
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if guestID == "" {
+		return nil, nil
+	}
+	return c.Guest(guestID)
+}
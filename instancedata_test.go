@@ -0,0 +1,110 @@
+package lochness_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestInstanceData(t *testing.T) {
+	suite.Run(t, new(InstanceDataSuite))
+}
+
+type InstanceDataSuite struct {
+	common.Suite
+}
+
+func (s *InstanceDataSuite) TestValidate() {
+	tests := []struct {
+		description string
+		hostname    string
+		sshKeys     []string
+		userData    string
+		expectedErr bool
+	}{
+		{"none", "", nil, "", false},
+		{"hostname", "web-1.example.com", nil, "", false},
+		{"invalid hostname", "web_1", nil, "", true},
+		{"empty hostname label", "web..example.com", nil, "", true},
+		{"ssh key", "", []string{"ssh-rsa AAAA user@host"}, "", false},
+		{"blank ssh key", "", []string{" "}, "", true},
+		{"multiline ssh key", "", []string{"ssh-rsa AAAA\nssh-rsa BBBB"}, "", true},
+		{"user data", "", nil, "#cloud-config\n", false},
+		{"large user data", "", nil, strings.Repeat("a", lochness.MaxUserDataSize+1), true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest := s.NewGuest()
+		guest.Hostname = test.hostname
+		guest.SSHKeys = test.sshKeys
+		guest.UserData = test.userData
+		err := guest.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *InstanceDataSuite) TestLocalHostname() {
+	guest := s.NewGuest()
+	s.Equal(guest.ID, guest.LocalHostname())
+	guest.Hostname = "web-1"
+	s.Equal("web-1", guest.LocalHostname())
+}
+
+func (s *InstanceDataSuite) TestSave() {
+	guest := s.NewGuest()
+	guest.Hostname = "web-1"
+	guest.SSHKeys = []string{"ssh-rsa AAAA user@host"}
+	guest.UserData = "#cloud-config\n"
+	s.Require().NoError(guest.Save())
+
+	g, err := s.Context.Guest(guest.ID)
+	s.Require().NoError(err)
+	s.Equal(guest.Hostname, g.Hostname)
+	s.Equal(guest.SSHKeys, g.SSHKeys)
+	s.Equal(guest.UserData, g.UserData)
+}
+
+func (s *InstanceDataSuite) TestGuestByIP() {
+	_, guest := s.NewHypervisorWithGuest()
+	s.Require().NoError(guest.Refresh())
+	ip := guest.Interfaces[0].IP
+	s.Require().NotNil(ip)
+
+	tests := []struct {
+		description string
+		ip          net.IP
+		expected    string
+	}{
+		{"guest address", ip, guest.ID},
+		{"unused address", net.ParseIP("192.168.100.200"), ""},
+		{"address outside subnets", net.ParseIP("10.0.0.1"), ""},
+		{"ipv6 address", net.ParseIP("fe80::1"), ""},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		g, err := s.Context.GuestByIP(test.ip)
+		s.NoError(err, msg("lookup should succeed"))
+		if test.expected == "" {
+			s.Nil(g, msg("should not find a guest"))
+		} else if s.NotNil(g, msg("should find the guest")) {
+			s.Equal(test.expected, g.ID, msg("should find the guest"))
+			s.Equal(ip.String(), g.InterfaceByIP(test.ip).IP.String(), msg("should find the interface"))
+		}
+	}
+
+	// overlapping subnets of other networks may hold the same address
+	other := s.NewSubnet()
+	s.Require().NoError(other.ReserveSpecificAddress(s.NewGuest().ID, ip))
+	_, err := s.Context.GuestByIP(ip)
+	s.Error(err, "should not pick between guests")
+}
@@ -74,7 +74,7 @@ func (c *Client) Post(title, endpoint, body string) (map[string]interface{}, *ht
 		}).Fatal("unable to create new " + title)
 	}
 	ret := map[string]interface{}{}
-	ProcessResponse(resp, title, "create", []int{http.StatusAccepted, http.StatusCreated}, &ret)
+	ProcessResponse(resp, title, "create", []int{http.StatusAccepted, http.StatusCreated, http.StatusOK}, &ret)
 	return ret, resp
 }
 
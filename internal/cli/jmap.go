@@ -16,6 +16,21 @@ func (j JMap) ID() string {
 	return ""
 }
 
+// Labels returns the string values of the metadata
+func (j JMap) Labels() map[string]string {
+	labels := make(map[string]string)
+	metadata, ok := j["metadata"].(map[string]interface{})
+	if !ok {
+		return labels
+	}
+	for k, v := range metadata {
+		if s, ok := v.(string); ok {
+			labels[k] = s
+		}
+	}
+	return labels
+}
+
 // String marshals into a json string
 func (j JMap) String() string {
 	buf, err := json.Marshal(&j)
@@ -25,6 +25,14 @@ func (s *JMapSuite) TestID() {
 	s.Equal("asdf", j.ID())
 }
 
+func (s *JMapSuite) TestLabels() {
+	j := &cli.JMap{}
+	s.Empty(j.Labels())
+
+	j = &cli.JMap{"metadata": map[string]interface{}{"app": "web", "count": 1.0}}
+	s.Equal(map[string]string{"app": "web"}, j.Labels())
+}
+
 func (s *JMapSuite) TestString() {
 	j := &cli.JMap{"id": "asdf", "foo": "bar"}
 	s.Equal(`{"foo":"bar","id":"asdf"}`, j.String())
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/mistifyio/lochness"
 	"github.com/pborman/uuid"
 )
 
@@ -26,3 +27,16 @@ func AssertSpec(spec string) {
 		}).Fatal("invalid spec")
 	}
 }
+
+// AssertSelector checks whether a string parses as a label selector and
+// returns it
+func AssertSelector(selector string) lochness.Selector {
+	sel, err := lochness.ParseSelector(selector)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"selector": selector,
+			"error":    err,
+		}).Fatal("invalid selector")
+	}
+	return sel
+}
@@ -208,6 +208,30 @@ func (s *Suite) NewSubnet() *lochness.Subnet {
 	return sub
 }
 
+// NewVolume creates and saves a new Volume.
+func (s *Suite) NewVolume() *lochness.Volume {
+	v := s.Context.NewVolume()
+	v.Size = 1024
+	_ = v.Save()
+	return v
+}
+
+// NewZone creates and saves a new Zone.
+func (s *Suite) NewZone() *lochness.Zone {
+	z := s.Context.NewZone()
+	z.Name = "zone-" + z.ID[:8]
+	_ = z.Save()
+	return z
+}
+
+// NewProject creates and saves a new Project.
+func (s *Suite) NewProject() *lochness.Project {
+	p := s.Context.NewProject()
+	p.Name = "project-" + p.ID[:8]
+	_ = p.Save()
+	return p
+}
+
 // NewHypervisor creates and saves a new Hypervisor.
 func (s *Suite) NewHypervisor() *lochness.Hypervisor {
 	h := s.Context.NewHypervisor()
@@ -233,8 +257,7 @@ func (s *Suite) NewGuest() *lochness.Guest {
 
 	guest := s.Context.NewGuest()
 	guest.FlavorID = flavor.ID
-	guest.NetworkID = network.ID
-	guest.MAC = mac
+	guest.AddInterface(network.ID).MAC = mac
 
 	_ = guest.Save()
 	return guest
@@ -246,7 +269,7 @@ func (s *Suite) NewHypervisorWithGuest() (*lochness.Hypervisor, *lochness.Guest)
 	hypervisor := s.NewHypervisor()
 
 	subnet := s.NewSubnet()
-	network, _ := s.Context.Network(guest.NetworkID)
+	network, _ := s.Context.Network(guest.Interfaces[0].NetworkID)
 	s.Require().NoError(network.AddSubnet(subnet))
 	s.Require().NoError(hypervisor.AddSubnet(subnet, "mistify0"))
 
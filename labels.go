@@ -0,0 +1,263 @@
+package lochness
+
+import (
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"sort"
+)
+
+var (
+	// LabelPath is the path in the config store for the label indexes
+	LabelPath = "lochness/labels/"
+)
+
+// Kinds of objects with indexed labels
+const (
+	guestLabelKind      = "guests"
+	hypervisorLabelKind = "hypervisors"
+)
+
+// labelEscape makes a label key or value, including an empty one, safe to
+// use as a single config store key element
+func labelEscape(s string) string {
+	return "=" + url.QueryEscape(s)
+}
+
+// labelDir is a helper to generate the config store key of a label index
+// directory. The key and value are optional.
+func labelDir(kind string, labels ...string) string {
+	elems := []string{LabelPath, kind}
+	for _, l := range labels {
+		elems = append(elems, labelEscape(l))
+	}
+	return filepath.Join(elems...)
+}
+
+// labelIndexedKey is a helper to generate the config store key marking that
+// the labels of a kind of object have been indexed
+func labelIndexedKey(kind string) string {
+	return filepath.Join(LabelPath, "indexed", kind)
+}
+
+// savedLabels returns the labels last saved in the metadata at key, if the
+// object has been saved
+func (c *Context) savedLabels(key string, index uint64) (map[string]string, error) {
+	if index == 0 {
+		return nil, nil
+	}
+
+	value, err := c.kv.Get(key)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var data struct {
+		Metadata map[string]string `json:"metadata"`
+	}
+	if err := json.Unmarshal(value.Data, &data); err != nil {
+		return nil, err
+	}
+	return data.Metadata, nil
+}
+
+// updateLabelIndex indexes an object's current labels and removes the index
+// entries of its previous labels
+func (c *Context) updateLabelIndex(kind, id string, previous, current map[string]string) error {
+	for k, v := range previous {
+		if cv, ok := current[k]; ok && cv == v {
+			continue
+		}
+		key := filepath.Join(labelDir(kind, k, v), id)
+		if err := c.kv.Delete(key, false); err != nil && !c.kv.IsKeyNotFound(err) {
+			return err
+		}
+	}
+
+	for k, v := range current {
+		if pv, ok := previous[k]; ok && pv == v {
+			continue
+		}
+		if err := c.kv.Set(filepath.Join(labelDir(kind, k, v), id), ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keysIn returns the last elements of the keys in a directory
+func (c *Context) keysIn(dir string) ([]string, error) {
+	keys, err := c.kv.Keys(dir)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	for i, k := range keys {
+		keys[i] = filepath.Base(k)
+	}
+	return keys, nil
+}
+
+// selectIDs uses the label index to find the ids of objects that may match the
+// Selector. It returns false if no requirement can use the index.
+func (c *Context) selectIDs(kind string, sel Selector) ([]string, bool, error) {
+	// prefer a requirement on a specific value over mere existence
+	var req *Requirement
+	for i, r := range sel {
+		if r.Operator == SelectorEquals || r.Operator == SelectorIn {
+			req = &sel[i]
+			break
+		}
+		if r.Operator == SelectorExists && req == nil {
+			req = &sel[i]
+		}
+	}
+	if req == nil {
+		return nil, false, nil
+	}
+
+	if err := c.ensureLabelIndex(kind); err != nil {
+		return nil, false, err
+	}
+
+	var valueDirs []string
+	if req.Operator == SelectorExists {
+		dirs, err := c.kv.Keys(labelDir(kind, req.Key))
+		if err != nil && !c.kv.IsKeyNotFound(err) {
+			return nil, false, err
+		}
+		valueDirs = dirs
+	} else {
+		for _, v := range req.Values {
+			valueDirs = append(valueDirs, labelDir(kind, req.Key, v))
+		}
+	}
+
+	ids := make(map[string]bool)
+	for _, dir := range valueDirs {
+		keys, err := c.keysIn(dir)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, id := range keys {
+			ids[id] = true
+		}
+	}
+
+	result := make([]string, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	sort.Strings(result)
+	return result, true, nil
+}
+
+// ensureLabelIndex rebuilds the label index if a kind of object has not been
+// indexed yet
+func (c *Context) ensureLabelIndex(kind string) error {
+	_, err := c.kv.Get(labelIndexedKey(kind))
+	if err == nil {
+		return nil
+	}
+	if !c.kv.IsKeyNotFound(err) {
+		return err
+	}
+	return c.RebuildLabelIndex()
+}
+
+// RebuildLabelIndex indexes the labels of every Guest and Hypervisor. Objects
+// index their labels when saved, so this is only needed for objects saved
+// before the index existed.
+func (c *Context) RebuildLabelIndex() error {
+	err := c.ForEachGuest(func(g *Guest) error {
+		return c.updateLabelIndex(guestLabelKind, g.ID, nil, g.Metadata)
+	})
+	if err != nil && !c.kv.IsKeyNotFound(err) {
+		return err
+	}
+	if err := c.kv.Set(labelIndexedKey(guestLabelKind), ""); err != nil {
+		return err
+	}
+
+	err = c.ForEachHypervisor(func(h *Hypervisor) error {
+		return c.updateLabelIndex(hypervisorLabelKind, h.ID, nil, h.Metadata)
+	})
+	if err != nil && !c.kv.IsKeyNotFound(err) {
+		return err
+	}
+	return c.kv.Set(labelIndexedKey(hypervisorLabelKind), "")
+}
+
+// SelectGuests returns the Guests with metadata matching the Selector.
+func (c *Context) SelectGuests(sel Selector) (Guests, error) {
+	guests := Guests{}
+
+	ids, indexed, err := c.selectIDs(guestLabelKind, sel)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		err := c.ForEachGuest(func(g *Guest) error {
+			if sel.Matches(g.Metadata) {
+				guests = append(guests, g)
+			}
+			return nil
+		})
+		return guests, err
+	}
+
+	for _, id := range ids {
+		g, err := c.Guest(id)
+		if err != nil {
+			// the index may be stale
+			if c.kv.IsKeyNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if sel.Matches(g.Metadata) {
+			guests = append(guests, g)
+		}
+	}
+	return guests, nil
+}
+
+// SelectHypervisors returns the Hypervisors with metadata matching the
+// Selector.
+func (c *Context) SelectHypervisors(sel Selector) (Hypervisors, error) {
+	hypervisors := Hypervisors{}
+
+	ids, indexed, err := c.selectIDs(hypervisorLabelKind, sel)
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		err := c.ForEachHypervisor(func(h *Hypervisor) error {
+			if sel.Matches(h.Metadata) {
+				hypervisors = append(hypervisors, h)
+			}
+			return nil
+		})
+		return hypervisors, err
+	}
+
+	for _, id := range ids {
+		h, err := c.Hypervisor(id)
+		if err != nil {
+			// the index may be stale
+			if c.kv.IsKeyNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		if sel.Matches(h.Metadata) {
+			hypervisors = append(hypervisors, h)
+		}
+	}
+	return hypervisors, nil
+}
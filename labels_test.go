@@ -0,0 +1,119 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestLabels(t *testing.T) {
+	suite.Run(t, new(LabelsSuite))
+}
+
+type LabelsSuite struct {
+	common.Suite
+}
+
+func (s *LabelsSuite) guestIDs(selector string) []string {
+	sel, err := lochness.ParseSelector(selector)
+	s.Require().NoError(err)
+	guests, err := s.Context.SelectGuests(sel)
+	s.Require().NoError(err)
+	ids := make([]string, len(guests))
+	for i, g := range guests {
+		ids[i] = g.ID
+	}
+	return ids
+}
+
+func (s *LabelsSuite) TestSelectGuests() {
+	web := s.NewGuest()
+	web.Metadata["app"] = "web"
+	web.Metadata["env"] = "prod"
+	s.Require().NoError(web.Save())
+
+	db := s.NewGuest()
+	db.Metadata["app"] = "db"
+	s.Require().NoError(db.Save())
+
+	plain := s.NewGuest()
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{"", []string{web.ID, db.ID, plain.ID}},
+		{"app=web", []string{web.ID}},
+		{"app in (web,db)", []string{web.ID, db.ID}},
+		{"app=web,env=staging", []string{}},
+		{"app", []string{web.ID, db.ID}},
+		{"!app", []string{plain.ID}},
+		{"app!=web", []string{db.ID, plain.ID}},
+	}
+
+	for _, test := range tests {
+		s.matchIDs(test.expected, s.guestIDs(test.selector), test.selector)
+	}
+}
+
+func (s *LabelsSuite) TestSelectGuestsIndexUpdates() {
+	guest := s.NewGuest()
+	guest.Metadata["app"] = "web"
+	s.Require().NoError(guest.Save())
+	s.Len(s.guestIDs("app=web"), 1)
+
+	guest.Metadata["app"] = "db"
+	s.Require().NoError(guest.Save())
+	s.Len(s.guestIDs("app=web"), 0, "old label should no longer be indexed")
+	s.Len(s.guestIDs("app=db"), 1, "new label should be indexed")
+
+	s.Require().NoError(guest.Destroy())
+	s.Len(s.guestIDs("app=db"), 0, "destroyed guest should no longer be indexed")
+}
+
+func (s *LabelsSuite) TestRebuildLabelIndex() {
+	guest := s.NewGuest()
+	guest.Metadata["app"] = "web"
+	s.Require().NoError(guest.Save())
+
+	// Simulate guests saved before the index existed
+	s.Require().NoError(s.KV.Delete(lochness.LabelPath, true))
+
+	s.Equal([]string{guest.ID}, s.guestIDs("app=web"), "missing index should be rebuilt")
+}
+
+func (s *LabelsSuite) TestSelectHypervisors() {
+	big := s.NewHypervisor()
+	big.Metadata["size"] = "big"
+	s.Require().NoError(big.Save())
+	small := s.NewHypervisor()
+
+	sel, err := lochness.ParseSelector("size=big")
+	s.Require().NoError(err)
+	hypervisors, err := s.Context.SelectHypervisors(sel)
+	s.NoError(err)
+	s.Len(hypervisors, 1)
+	s.Equal(big.ID, hypervisors[0].ID)
+
+	sel, err = lochness.ParseSelector("!size")
+	s.Require().NoError(err)
+	hypervisors, err = s.Context.SelectHypervisors(sel)
+	s.NoError(err)
+	s.Len(hypervisors, 1)
+	s.Equal(small.ID, hypervisors[0].ID)
+}
+
+// matchIDs checks that two lists of ids have the same elements
+func (s *LabelsSuite) matchIDs(expected, actual []string, msg string) {
+	expectedSet := make(map[string]bool, len(expected))
+	for _, id := range expected {
+		expectedSet[id] = true
+	}
+	actualSet := make(map[string]bool, len(actual))
+	for _, id := range actual {
+		actualSet[id] = true
+	}
+	s.Equal(expectedSet, actualSet, msg)
+}
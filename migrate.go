@@ -0,0 +1,354 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LiveMigrationConfig is the Hypervisor config key that, when "true", marks its
+// agent as able to migrate running guests without stopping them
+const LiveMigrationConfig = "liveMigration"
+
+// GuestMigration is a pending move of a Guest to another Hypervisor. The Guest
+// stays on its current Hypervisor until the move is completed.
+type GuestMigration struct {
+	HypervisorID string          `json:"hypervisor"`       // target hypervisor
+	Interfaces   GuestInterfaces `json:"interfaces"`       // interfaces as they will be on the target
+	FlavorID     string          `json:"flavor,omitempty"` // flavor to resize to once moved, if any
+}
+
+// CanMigrate returns an error if the Guest can not be moved to another
+// Hypervisor.
+func (g *Guest) CanMigrate() error {
+	if g.HypervisorID == "" {
+		return errors.New("guest is not on a hypervisor")
+	}
+	if g.Migration != nil {
+		return fmt.Errorf("guest is already migrating to hypervisor %s", g.Migration.HypervisorID)
+	}
+	switch g.State {
+	case "", GuestStateRunning, GuestStateStopped:
+	default:
+		return fmt.Errorf("guest can not migrate while %s", g.State)
+	}
+
+	// snapshots are kept on the hypervisor and can not follow the guest
+	snapshots, err := g.Snapshots()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) > 0 {
+		return errors.New("guest has snapshots")
+	}
+	return nil
+}
+
+// CanLiveMigrate returns whether the pending migration of the Guest can be
+// done without stopping it. Both Hypervisors must support live migration and
+// the Guest must be running; otherwise it is migrated cold.
+func (g *Guest) CanLiveMigrate() (bool, error) {
+	if g.Migration == nil {
+		return false, errors.New("guest is not migrating")
+	}
+	if g.State != GuestStateRunning {
+		return false, nil
+	}
+
+	for _, id := range []string{g.HypervisorID, g.Migration.HypervisorID} {
+		h, err := g.context.Hypervisor(id)
+		if err != nil {
+			return false, err
+		}
+		if h.Config[LiveMigrationConfig] != "true" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// candidateNotOn returns a CandidateFunction removing the Hypervisor with the
+// id
+func candidateNotOn(hypervisorID string) CandidateFunction {
+	return func(g *Guest, hs Hypervisors) (Hypervisors, error) {
+		logFields := log.Fields{
+			"guestID": g.ID,
+			"func":    "candidateNotOn",
+		}
+
+		var hypervisors Hypervisors
+		for _, h := range hs {
+			if h.ID != hypervisorID {
+				hypervisors = append(hypervisors, h)
+			} else {
+				log.WithFields(logFields).WithFields(log.Fields{
+					"hypervisorID": h.ID,
+				}).Debug("hypervisor candidate failed")
+			}
+		}
+
+		log.WithFields(logFields).WithFields(log.Fields{
+			"in":      len(hs),
+			"out":     len(hypervisors),
+			"removed": len(hs) - len(hypervisors),
+		}).Info("hypervisor candidates filtered")
+
+		return hypervisors, nil
+	}
+}
+
+// MigrationCandidates returns the Hypervisors the Guest may be moved to, best
+// first, as RankedCandidates does for a new Guest. Its current Hypervisor is
+// excluded, and the subnets and addresses it holds are not treated as requests.
+func (g *Guest) MigrationCandidates(f ...CandidateFunction) (Hypervisors, error) {
+	unplaced := *g
+	unplaced.HypervisorID = ""
+	unplaced.Interfaces = make(GuestInterfaces, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		copied := *iface
+		copied.SubnetID = ""
+		copied.IP = nil
+		copied.Bridge = ""
+		unplaced.Interfaces[i] = &copied
+	}
+
+	fs := append([]CandidateFunction{candidateNotOn(g.HypervisorID)}, f...)
+	return unplaced.RankedCandidates(fs...)
+}
+
+// PrepareMigration starts moving the Guest to the Hypervisor. The resources of
+// its Flavor are reserved on the Hypervisor and each interface is given a
+// bridge there. An interface keeps its address when the Hypervisor bridges the
+// same subnet; otherwise a new address is reserved in a suitable subnet. The
+// Guest is saved with the pending Migration.
+func (g *Guest) PrepareMigration(h *Hypervisor) error {
+	return g.prepareMigration(h, "")
+}
+
+// PrepareResizeMigration starts moving the Guest to the Hypervisor, as
+// PrepareMigration does, so that it can be resized to the Flavor there. Enough
+// is reserved on the Hypervisor for either Flavor.
+func (g *Guest) PrepareResizeMigration(h *Hypervisor, flavorID string) error {
+	if err := g.CanResize(flavorID); err != nil {
+		return err
+	}
+	return g.prepareMigration(h, flavorID)
+}
+
+// prepareMigration starts moving the Guest to the Hypervisor, reserving enough
+// for it to be resized to the Flavor if one is given
+func (g *Guest) prepareMigration(h *Hypervisor, flavorID string) error {
+	if err := g.CanMigrate(); err != nil {
+		return err
+	}
+	if g.HypervisorID == h.ID {
+		return fmt.Errorf("guest is already on hypervisor %s", h.ID)
+	}
+
+	// volumes in the current pool can not follow the guest
+	volumes, err := g.Volumes()
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if v.HypervisorID != "" && v.HypervisorID != h.ID {
+			return fmt.Errorf("volume %s is in the pool of hypervisor %s", v.ID, v.HypervisorID)
+		}
+	}
+
+	interfaces := make(GuestInterfaces, len(g.Interfaces))
+	subnets := make([]*Subnet, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		moved := *iface
+		interfaces[i] = &moved
+
+		if br, ok := h.subnets[iface.SubnetID]; ok {
+			moved.Bridge = br
+			continue
+		}
+
+		moved.SubnetID, moved.IP, moved.Bridge = "", nil, ""
+		suitable, err := g.SuitableSubnets(&moved)
+		if err != nil {
+			return err
+		}
+		for _, subnet := range suitable {
+			if br, ok := h.subnets[subnet.ID]; ok {
+				subnets[i] = subnet
+				moved.SubnetID = subnet.ID
+				moved.Bridge = br
+				break
+			}
+		}
+		if subnets[i] == nil {
+			return fmt.Errorf("no suitable subnet found for interface %d", i)
+		}
+	}
+
+	flavor, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	need := flavorReservation(flavor)
+	if flavorID != "" {
+		resized, err := g.context.Flavor(flavorID)
+		if err != nil {
+			return err
+		}
+		need = resizeReservation(flavor, resized)
+	}
+	if err := h.reserveResources(g, need); err != nil {
+		return err
+	}
+
+	// give back anything reserved if the migration can not be recorded
+	release := func() {
+		for i, subnet := range subnets {
+			if subnet != nil && interfaces[i].IP != nil {
+				_ = subnet.ReleaseAddress(interfaces[i].IP)
+			}
+		}
+		_ = h.releaseResources(g)
+	}
+
+	for i, subnet := range subnets {
+		if subnet == nil {
+			continue
+		}
+		ip, err := subnet.ReserveAddress(g.ID)
+		if err == nil && ip == nil {
+			err = errors.New("no available addresses")
+		}
+		if err != nil {
+			release()
+			return err
+		}
+		interfaces[i].IP = ip
+	}
+
+	g.Migration = &GuestMigration{
+		HypervisorID: h.ID,
+		Interfaces:   interfaces,
+		FlavorID:     flavorID,
+	}
+	if err := g.Save(); err != nil {
+		g.Migration = nil
+		release()
+		return err
+	}
+	return nil
+}
+
+// changed returns, for each interface, whether it will have a different
+// subnet or address once migrated
+func (m *GuestMigration) changed(current GuestInterfaces) []bool {
+	changed := make([]bool, len(current))
+	for i, iface := range current {
+		if i >= len(m.Interfaces) {
+			continue
+		}
+		moved := m.Interfaces[i]
+		changed[i] = moved.SubnetID != iface.SubnetID || !moved.IP.Equal(iface.IP)
+	}
+	return changed
+}
+
+// CompleteMigration cuts the Guest over to the Hypervisor it is migrating to,
+// once it is running there. The Guest takes on its migrated interfaces and is
+// moved between the Hypervisors' guests, and the addresses and resources it
+// held on its previous Hypervisor are released.
+func (g *Guest) CompleteMigration() error {
+	if g.Migration == nil {
+		return errors.New("guest is not migrating")
+	}
+	source, err := g.context.Hypervisor(g.HypervisorID)
+	if err != nil {
+		return err
+	}
+	target, err := g.context.Hypervisor(g.Migration.HypervisorID)
+	if err != nil {
+		return err
+	}
+
+	previous := g.Interfaces
+	changed := g.Migration.changed(previous)
+
+	if err := g.context.kv.Set(target.guestKey(g), g.ID); err != nil {
+		return err
+	}
+
+	// the guest record is the cutover point; until it is saved the guest
+	// still belongs to the source
+	g.HypervisorID = target.ID
+	g.Interfaces = g.Migration.Interfaces
+	migration := g.Migration
+	g.Migration = nil
+	if err := g.Save(); err != nil {
+		g.HypervisorID = source.ID
+		g.Interfaces = previous
+		g.Migration = migration
+		_ = g.context.kv.Delete(target.guestKey(g), false)
+		return err
+	}
+
+	if err := g.context.kv.Delete(source.guestKey(g), false); err != nil {
+		return err
+	}
+	for i, iface := range previous {
+		if !changed[i] || iface.SubnetID == "" || iface.IP == nil {
+			continue
+		}
+		subnet, err := g.context.Subnet(iface.SubnetID)
+		if err != nil {
+			return err
+		}
+		if err := subnet.ReleaseAddress(iface.IP); err != nil {
+			return err
+		}
+	}
+	return source.releaseResources(g)
+}
+
+// CancelMigration abandons the pending migration of the Guest, releasing the
+// addresses and resources reserved for it on the target Hypervisor. The Guest
+// stays on its current Hypervisor, and keeps its current Flavor if it was being
+// migrated to be resized.
+func (g *Guest) CancelMigration() error {
+	if g.Migration == nil {
+		return nil
+	}
+	target, err := g.context.Hypervisor(g.Migration.HypervisorID)
+	if err != nil {
+		return err
+	}
+
+	// addresses the guest would not have kept were reserved for the target
+	for i, changed := range g.Migration.changed(g.Interfaces) {
+		moved := g.Migration.Interfaces[i]
+		if !changed || moved.IP == nil {
+			continue
+		}
+		subnet, err := g.context.Subnet(moved.SubnetID)
+		if err != nil {
+			return err
+		}
+		if err := subnet.ReleaseAddress(moved.IP); err != nil {
+			return err
+		}
+	}
+	if err := target.releaseResources(g); err != nil {
+		return err
+	}
+
+	resize := g.Migration.FlavorID != ""
+	g.Migration = nil
+	if err := g.Save(); err != nil {
+		return err
+	}
+	if resize {
+		// the resize the migration made room for is abandoned too
+		return g.ChargeQuota()
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package lochness_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMigrate(t *testing.T) {
+	suite.Run(t, new(MigrateSuite))
+}
+
+type MigrateSuite struct {
+	common.Suite
+}
+
+// newRunningGuest creates a running Guest placed on a new Hypervisor
+func (s *MigrateSuite) newRunningGuest() (*lochness.Hypervisor, *lochness.Guest) {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	return hypervisor, guest
+}
+
+func (s *MigrateSuite) TestCanMigrate() {
+	_, migrating := s.newRunningGuest()
+	s.Require().NoError(migrating.PrepareMigration(s.NewHypervisor()))
+
+	tests := []struct {
+		description string
+		guest       *lochness.Guest
+		state       string
+		expectedErr bool
+	}{
+		{"unplaced", s.NewGuest(), lochness.GuestStatePending, true},
+		{"provisioning", nil, lochness.GuestStateProvisioning, true},
+		{"failed", nil, lochness.GuestStateFailed, true},
+		{"running", nil, lochness.GuestStateRunning, false},
+		{"stopped", nil, lochness.GuestStateStopped, false},
+		{"migrating", migrating, lochness.GuestStateRunning, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest := test.guest
+		if guest == nil {
+			_, guest = s.NewHypervisorWithGuest()
+		}
+		guest.State = test.state
+
+		err := guest.CanMigrate()
+		if test.expectedErr {
+			s.Error(err, msg("should not migrate"))
+		} else {
+			s.NoError(err, msg("should migrate"))
+		}
+	}
+}
+
+func (s *MigrateSuite) TestMigrationCandidates() {
+	hypervisor, guest := s.newRunningGuest()
+	target := s.NewHypervisor()
+
+	candidates, err := guest.MigrationCandidates(lochness.CandidateHasSubnet)
+	s.Error(err, "target without the network should not be a candidate")
+
+	// a target bridging another subnet of the network is a candidate even
+	// though the guest holds an address in its current subnet
+	subnet := s.NewSubnet()
+	network, err := s.Context.Network(guest.Interfaces[0].NetworkID)
+	s.Require().NoError(err)
+	s.Require().NoError(network.AddSubnet(subnet))
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	candidates, err = guest.MigrationCandidates(lochness.CandidateHasSubnet)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	for _, h := range candidates {
+		s.NotEqual(hypervisor.ID, h.ID, "current hypervisor should not be a candidate")
+	}
+}
+
+func (s *MigrateSuite) TestMigrationSameSubnet() {
+	hypervisor, guest := s.newRunningGuest()
+	iface := *guest.Interfaces[0]
+	target := s.NewHypervisor()
+	subnet, err := s.Context.Subnet(iface.SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	s.Error(guest.PrepareMigration(hypervisor), "current hypervisor should fail")
+	s.Require().NoError(guest.PrepareMigration(target))
+	s.Error(guest.PrepareMigration(target), "pending migration should fail")
+
+	g, err := s.Context.Guest(guest.ID)
+	s.NoError(err)
+	s.Equal(hypervisor.ID, g.HypervisorID, "guest should not have moved yet")
+	if s.NotNil(g.Migration, "migration should be saved") {
+		s.Equal(target.ID, g.Migration.HypervisorID)
+		s.Equal(iface.SubnetID, g.Migration.Interfaces[0].SubnetID)
+		s.Equal(iface.IP, g.Migration.Interfaces[0].IP, "address should be kept")
+		s.Equal("br1", g.Migration.Interfaces[0].Bridge)
+	}
+	s.NoError(target.Refresh())
+	s.Contains(target.Reservations, guest.ID, "resources should be reserved on the target")
+
+	s.NoError(g.CompleteMigration())
+	s.Equal(target.ID, g.HypervisorID)
+	s.Nil(g.Migration)
+	s.Equal(iface.IP, g.Interfaces[0].IP)
+	s.Equal("br1", g.Interfaces[0].Bridge)
+
+	s.NoError(guest.Refresh())
+	s.Equal(target.ID, guest.HypervisorID, "cutover should be saved")
+	s.Nil(guest.Migration, "finished migration should be cleared")
+
+	s.NoError(subnet.Refresh())
+	s.Equal(guest.ID, subnet.Addresses()[iface.IP.String()], "kept address should still be reserved")
+	s.NoError(hypervisor.Refresh())
+	s.NotContains(hypervisor.Guests(), guest.ID)
+	s.NotContains(hypervisor.Reservations, guest.ID)
+	s.NoError(target.Refresh())
+	s.Contains(target.Guests(), guest.ID)
+}
+
+func (s *MigrateSuite) TestMigrationOtherSubnet() {
+	hypervisor, guest := s.newRunningGuest()
+	iface := *guest.Interfaces[0]
+	target := s.NewHypervisor()
+
+	s.Error(guest.PrepareMigration(target), "target without the network should fail")
+
+	subnet := s.Context.NewSubnet()
+	_, subnet.CIDR, _ = net.ParseCIDR("192.168.200.1/24")
+	subnet.StartRange = net.ParseIP("192.168.200.2")
+	subnet.EndRange = net.ParseIP("192.168.200.10")
+	s.Require().NoError(subnet.Save())
+	network, err := s.Context.Network(iface.NetworkID)
+	s.Require().NoError(err)
+	s.Require().NoError(network.AddSubnet(subnet))
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	s.Require().NoError(guest.PrepareMigration(target))
+	moved := guest.Migration.Interfaces[0]
+	s.Equal(subnet.ID, moved.SubnetID)
+	s.True(subnet.CIDR.Contains(moved.IP), "address should be in the target subnet")
+
+	s.NoError(guest.CompleteMigration())
+	s.Equal(moved.IP, guest.Interfaces[0].IP)
+
+	previous, err := s.Context.Subnet(iface.SubnetID)
+	s.Require().NoError(err)
+	s.NotContains(previous.Addresses(), iface.IP.String(), "previous address should be released")
+	s.NoError(hypervisor.Refresh())
+	s.NotContains(hypervisor.Reservations, guest.ID)
+}
+
+func (s *MigrateSuite) TestCancelMigration() {
+	hypervisor, guest := s.newRunningGuest()
+	iface := *guest.Interfaces[0]
+	target := s.NewHypervisor()
+
+	subnet := s.Context.NewSubnet()
+	_, subnet.CIDR, _ = net.ParseCIDR("192.168.200.1/24")
+	subnet.StartRange = net.ParseIP("192.168.200.2")
+	subnet.EndRange = net.ParseIP("192.168.200.10")
+	s.Require().NoError(subnet.Save())
+	network, err := s.Context.Network(iface.NetworkID)
+	s.Require().NoError(err)
+	s.Require().NoError(network.AddSubnet(subnet))
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	s.Require().NoError(guest.PrepareMigration(target))
+	s.NoError(guest.CancelMigration())
+	s.Nil(guest.Migration)
+	s.Equal(hypervisor.ID, guest.HypervisorID)
+	s.Equal(iface.IP, guest.Interfaces[0].IP)
+
+	s.NoError(subnet.Refresh())
+	s.Len(subnet.Addresses(), 0, "target address should be released")
+	s.NoError(target.Refresh())
+	s.NotContains(target.Reservations, guest.ID, "target resources should be released")
+
+	s.NoError(guest.CanMigrate(), "guest should be able to migrate again")
+}
+
+func (s *MigrateSuite) TestCanLiveMigrate() {
+	hypervisor, guest := s.newRunningGuest()
+	target := s.NewHypervisor()
+	subnet, err := s.Context.Subnet(guest.Interfaces[0].SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	_, err = guest.CanLiveMigrate()
+	s.Error(err, "guest without a migration should fail")
+
+	s.Require().NoError(guest.PrepareMigration(target))
+	live, err := guest.CanLiveMigrate()
+	s.NoError(err)
+	s.False(live, "hypervisors without live migration should migrate cold")
+
+	s.Require().NoError(hypervisor.SetConfig(lochness.LiveMigrationConfig, "true"))
+	s.Require().NoError(target.SetConfig(lochness.LiveMigrationConfig, "true"))
+	live, err = guest.CanLiveMigrate()
+	s.NoError(err)
+	s.True(live)
+
+	guest.State = lochness.GuestStateStopped
+	live, err = guest.CanLiveMigrate()
+	s.NoError(err)
+	s.False(live, "stopped guest should migrate cold")
+}
@@ -27,6 +27,42 @@ type (
 		port    int
 	}
 
+	// migrationRequest asks a hypervisor agent to move a guest to the agent
+	// on another hypervisor
+	migrationRequest struct {
+		Host  string      `json:"host"`  // target hypervisor address
+		Port  int         `json:"port"`  // target agent port
+		Live  bool        `json:"live"`  // move without stopping the guest
+		Guest *agentGuest `json:"guest"` // guest as defined on the target
+	}
+
+	// agentGuest is a client.Guest as sent to a hypervisor agent, with the
+	// IOLimits of its flavor on each disk and nic
+	agentGuest struct {
+		client.Guest
+		Nics  []agentNic  `json:"nics,omitempty"`
+		Disks []agentDisk `json:"disks,omitempty"`
+	}
+
+	// agentNic is a client.Nic with its bandwidth limit
+	agentNic struct {
+		client.Nic
+		Bandwidth uint64 `json:"bandwidth,omitempty"` // Mbit/s. 0 is unlimited
+	}
+
+	// agentDisk is a client.Disk with its I/O limits
+	agentDisk struct {
+		client.Disk
+		IOPS       uint64 `json:"iops,omitempty"`       // 0 is unlimited
+		Throughput uint64 `json:"throughput,omitempty"` // MB/s. 0 is unlimited
+	}
+
+	// snapshotInfo is a guest snapshot as reported by a hypervisor agent
+	snapshotInfo struct {
+		ID   string `json:"id"`
+		Size uint64 `json:"size"` // disk usage in MB
+	}
+
 	// ErrorHTTPCode should be used for errors resulting from an http response
 	// code not matching the expected code
 	ErrorHTTPCode struct {
@@ -52,8 +88,9 @@ func (context *Context) NewMistifyAgent(port int) *MistifyAgent {
 }
 
 // generateClientGuest creates a client.Guest object based on the stored guest
-// properties. Used during guest creation
-func (agent *MistifyAgent) generateClientGuest(g *Guest) (*client.Guest, error) {
+// properties, with the I/O limits of its flavor on each disk and nic. Used
+// during guest creation
+func (agent *MistifyAgent) generateClientGuest(g *Guest) (*agentGuest, error) {
 	if err := g.Validate(); err != nil {
 		return nil, err
 	}
@@ -63,14 +100,65 @@ func (agent *MistifyAgent) generateClientGuest(g *Guest) (*client.Guest, error)
 		return nil, err
 	}
 
-	subnet, err := agent.context.Subnet(g.SubnetID)
+	nics := make([]agentNic, len(g.Interfaces))
+	for i, iface := range g.Interfaces {
+		nic, err := agent.generateClientNic(iface)
+		if err != nil {
+			return nil, err
+		}
+		nic.Name = fmt.Sprintf("eth%d", i)
+		nics[i] = agentNic{Nic: *nic, Bandwidth: flavor.NicBandwidth}
+	}
+
+	disks := []client.Disk{
+		{
+			Size:   flavor.Disk,
+			Image:  flavor.Image,
+			Source: flavor.Image,
+		},
+	}
+
+	volumes, err := g.Volumes()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range volumes {
+		disks = append(disks, generateClientDisk(v))
+	}
+
+	limitedDisks := make([]agentDisk, len(disks))
+	for i, disk := range disks {
+		limitedDisks[i] = agentDisk{
+			Disk:       disk,
+			IOPS:       flavor.DiskIOPS,
+			Throughput: flavor.DiskThroughput,
+		}
+	}
+
+	return &agentGuest{
+		Guest: client.Guest{
+			ID:       g.ID,
+			Type:     g.Type,
+			Image:    flavor.Image,
+			Memory:   uint(flavor.Memory),
+			CPU:      uint(flavor.CPU),
+			Metadata: g.Metadata,
+		},
+		Nics:  nics,
+		Disks: limitedDisks,
+	}, nil
+}
+
+// generateClientNic creates a client.Nic object based on a guest interface
+func (agent *MistifyAgent) generateClientNic(iface *GuestInterface) (*client.Nic, error) {
+	subnet, err := agent.context.Subnet(iface.SubnetID)
 	if err != nil {
 		return nil, err
 	}
 
 	var vlans []int
-	if g.VLANGroupID != "" {
-		vlanGroup, err := agent.context.VLANGroup(g.VLANGroupID)
+	if iface.VLANGroupID != "" {
+		vlanGroup, err := agent.context.VLANGroup(iface.VLANGroupID)
 		if err != nil {
 			return nil, err
 		}
@@ -82,33 +170,23 @@ func (agent *MistifyAgent) generateClientGuest(g *Guest) (*client.Guest, error)
 		vlans = []int{1}
 	}
 
-	nic := client.Nic{
-		Name:    "eth0",
-		Network: g.Bridge,
+	return &client.Nic{
+		Network: iface.Bridge,
 		Model:   "virtio", // TODO: Check whether this is alwalys the case
-		Mac:     g.MAC.String(),
-		Address: g.IP.String(),
+		Mac:     iface.MAC.String(),
+		Address: iface.IP.String(),
 		Netmask: subnet.CIDR.Mask.String(),
 		Gateway: subnet.Gateway.String(),
 		VLANs:   vlans,
-	}
+	}, nil
+}
 
-	disk := client.Disk{
-		Size:   flavor.Disk,
-		Image:  flavor.Image,
-		Source: flavor.Image,
+// generateClientDisk creates a client.Disk object based on a volume
+func generateClientDisk(v *Volume) client.Disk {
+	return client.Disk{
+		Size:   v.Size,
+		Volume: v.ID,
 	}
-
-	return &client.Guest{
-		ID:       g.ID,
-		Type:     g.Type,
-		Image:    flavor.Image,
-		Nics:     []client.Nic{nic},
-		Disks:    []client.Disk{disk},
-		Memory:   uint(flavor.Memory),
-		CPU:      uint(flavor.CPU),
-		Metadata: g.Metadata,
-	}, nil
 }
 
 // guestActionURL crafts the guest action url
@@ -127,6 +205,19 @@ func (agent *MistifyAgent) guestActionURL(host, guestID, action string) string {
 	return fmt.Sprintf("http://%s:%d/%s", host, agent.port, urlPath)
 }
 
+// volumeActionURL crafts the guest volume action url
+func (agent *MistifyAgent) volumeActionURL(host, guestID, volumeID, action string) string {
+	urlPath := path.Join("guests", guestID, "volumes", volumeID, action)
+	return fmt.Sprintf("http://%s:%d/%s", host, agent.port, urlPath)
+}
+
+// snapshotActionURL crafts the guest snapshot action url. A blank action
+// addresses the snapshot itself.
+func (agent *MistifyAgent) snapshotActionURL(host, guestID, snapshotID, action string) string {
+	urlPath := path.Join("guests", guestID, "snapshots", snapshotID, action)
+	return fmt.Sprintf("http://%s:%d/%s", host, agent.port, urlPath)
+}
+
 // jobURL crafts the job status url
 func (agent *MistifyAgent) jobURL(host, jobID string) string {
 	return fmt.Sprintf("http://%s:%d/jobs/%s", host, agent.port, jobID)
@@ -307,3 +398,162 @@ func (agent *MistifyAgent) FetchImage(guestID string) (string, error) {
 	_, jobID, err := agent.request(url, "POST", http.StatusAccepted, req)
 	return jobID, err
 }
+
+// AttachVolume attaches a volume to a guest on its hypervisor. The volume must
+// already be recorded as attached to the guest.
+func (agent *MistifyAgent) AttachVolume(guestID, volumeID string) (string, error) {
+	return agent.requestVolumeAction(guestID, volumeID, "attach")
+}
+
+// DetachVolume detaches a volume from a guest on its hypervisor
+func (agent *MistifyAgent) DetachVolume(guestID, volumeID string) (string, error) {
+	return agent.requestVolumeAction(guestID, volumeID, "detach")
+}
+
+// requestVolumeAction makes volume requests for a guest to a hypervisor agent
+func (agent *MistifyAgent) requestVolumeAction(guestID, volumeID, action string) (string, error) {
+	volume, err := agent.context.Volume(volumeID)
+	if err != nil {
+		return "", err
+	}
+	if volume.GuestID != guestID {
+		return "", errors.New("volume is not attached to guest")
+	}
+	hypervisor, err := agent.getHypervisor(guestID)
+	if err != nil {
+		return "", err
+	}
+
+	url := agent.volumeActionURL(hypervisor.IP.String(), guestID, volumeID, action)
+	_, jobID, err := agent.request(url, "POST", http.StatusAccepted, generateClientDisk(volume))
+	return jobID, err
+}
+
+// MigrateGuest asks the agent on a guest's hypervisor to move it to the
+// hypervisor it is migrating to. A live migration keeps the guest running,
+// while a cold one stops it for the transfer and starts it again on the target
+// if it was running. The job is tracked by the agent on the current hypervisor.
+func (agent *MistifyAgent) MigrateGuest(guestID string, live bool) (string, error) {
+	guest, err := agent.context.Guest(guestID)
+	if err != nil {
+		return "", err
+	}
+	if guest.Migration == nil {
+		return "", errors.New("guest is not migrating")
+	}
+	source, err := agent.context.Hypervisor(guest.HypervisorID)
+	if err != nil {
+		return "", err
+	}
+	target, err := agent.context.Hypervisor(guest.Migration.HypervisorID)
+	if err != nil {
+		return "", err
+	}
+
+	// the guest is defined on the target with its migrated interfaces
+	migrated := *guest
+	migrated.Interfaces = guest.Migration.Interfaces
+	g, err := agent.generateClientGuest(&migrated)
+	if err != nil {
+		return "", err
+	}
+
+	req := &migrationRequest{
+		Host:  target.IP.String(),
+		Port:  agent.port,
+		Live:  live,
+		Guest: g,
+	}
+	url := agent.guestActionURL(source.IP.String(), guestID, "migrate")
+	_, jobID, err := agent.request(url, "POST", http.StatusAccepted, req)
+	return jobID, err
+}
+
+// ResizeGuest asks the agent on a guest's hypervisor to apply the memory, cpus,
+// disk size and I/O limits of a flavor to the guest.
+func (agent *MistifyAgent) ResizeGuest(guestID, flavorID string) (string, error) {
+	guest, err := agent.context.Guest(guestID)
+	if err != nil {
+		return "", err
+	}
+	hypervisor, err := agent.context.Hypervisor(guest.HypervisorID)
+	if err != nil {
+		return "", err
+	}
+
+	// the guest is described at its new size
+	resized := *guest
+	resized.FlavorID = flavorID
+	g, err := agent.generateClientGuest(&resized)
+	if err != nil {
+		return "", err
+	}
+
+	url := agent.guestActionURL(hypervisor.IP.String(), guestID, "resize")
+	_, jobID, err := agent.request(url, "POST", http.StatusAccepted, g)
+	return jobID, err
+}
+
+// CreateSnapshot asks the agent on a guest's hypervisor to snapshot the
+// guest's disks. The snapshot must already be recorded as pending.
+func (agent *MistifyAgent) CreateSnapshot(guestID, snapshotID string) (string, error) {
+	return agent.requestSnapshotAction(guestID, snapshotID, "create")
+}
+
+// DeleteSnapshot deletes a guest snapshot from its hypervisor
+func (agent *MistifyAgent) DeleteSnapshot(guestID, snapshotID string) (string, error) {
+	return agent.requestSnapshotAction(guestID, snapshotID, "delete")
+}
+
+// RollbackSnapshot restores a guest's disks to a snapshot on its hypervisor
+func (agent *MistifyAgent) RollbackSnapshot(guestID, snapshotID string) (string, error) {
+	return agent.requestSnapshotAction(guestID, snapshotID, "rollback")
+}
+
+// SnapshotSize retrieves the disk usage of a guest snapshot, in MB, from the
+// agent on its hypervisor
+func (agent *MistifyAgent) SnapshotSize(guestID, snapshotID string) (uint64, error) {
+	snapshot, err := agent.context.Snapshot(snapshotID)
+	if err != nil {
+		return 0, err
+	}
+	if snapshot.GuestID != guestID {
+		return 0, errors.New("snapshot is not of guest")
+	}
+	hypervisor, err := agent.context.Hypervisor(snapshot.HypervisorID)
+	if err != nil {
+		return 0, err
+	}
+
+	url := agent.snapshotActionURL(hypervisor.IP.String(), guestID, snapshotID, "")
+	body, _, err := agent.request(url, "GET", http.StatusOK, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var info snapshotInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// requestSnapshotAction makes snapshot requests for a guest to the agent on the
+// hypervisor holding the snapshot
+func (agent *MistifyAgent) requestSnapshotAction(guestID, snapshotID, action string) (string, error) {
+	snapshot, err := agent.context.Snapshot(snapshotID)
+	if err != nil {
+		return "", err
+	}
+	if snapshot.GuestID != guestID {
+		return "", errors.New("snapshot is not of guest")
+	}
+	hypervisor, err := agent.context.Hypervisor(snapshot.HypervisorID)
+	if err != nil {
+		return "", err
+	}
+
+	url := agent.snapshotActionURL(hypervisor.IP.String(), guestID, snapshotID, action)
+	_, jobID, err := agent.request(url, "POST", http.StatusAccepted, nil)
+	return jobID, err
+}
@@ -3,6 +3,7 @@ package lochness_test
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -29,6 +30,7 @@ type MistifyAgentSuite struct {
 	api        *httptest.Server
 	guest      *lochness.Guest
 	hypervisor *lochness.Hypervisor
+	lastBody   []byte // body of the last guest action request
 }
 
 func (s *MistifyAgentSuite) SetupSuite() {
@@ -38,11 +40,15 @@ func (s *MistifyAgentSuite) SetupSuite() {
 		path := r.URL.String()
 		actionRegexp := regexp.MustCompile(fmt.Sprintf("/guests/%s/\\w+", s.guest.ID))
 		jobRegexp := regexp.MustCompile("/jobs/\\w+")
+		snapshotRegexp := regexp.MustCompile(fmt.Sprintf("^/guests/%s/snapshots/[\\w-]+$", s.guest.ID))
 		switch {
 		case path == fmt.Sprintf("/guests/%s", s.guest.ID):
 			guestBytes, _ := json.Marshal(s.guest)
 			_, _ = w.Write(guestBytes)
+		case r.Method == "GET" && snapshotRegexp.MatchString(path):
+			_, _ = w.Write([]byte(`{"size": 100}`))
 		case path == "/guests", actionRegexp.MatchString(path), path == "/images":
+			s.lastBody, _ = ioutil.ReadAll(r.Body)
 			w.Header().Set("X-Guest-Job-ID", uuid.New())
 			w.WriteHeader(http.StatusAccepted)
 		case jobRegexp.MatchString(path):
@@ -226,3 +232,160 @@ func (s *MistifyAgentSuite) TestFetchImage() {
 		}
 	}
 }
+
+func (s *MistifyAgentSuite) TestMigrateGuest() {
+	_, unmigrated := s.NewHypervisorWithGuest()
+
+	s.guest.State = lochness.GuestStateRunning
+	s.Require().NoError(s.guest.Save())
+	target := s.NewHypervisor()
+	subnet, err := s.Context.Subnet(s.guest.Interfaces[0].SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+	s.Require().NoError(s.guest.PrepareMigration(target))
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"nonexistent id", uuid.New(), true},
+		{"not migrating id", unmigrated.ID, true},
+		{"migrating id", s.guest.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		jobID, err := s.agent.MigrateGuest(test.id, false)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			s.Nil(uuid.Parse(jobID), msg("fail should not return jobID"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			s.NotNil(uuid.Parse(jobID), msg("should return jobID"))
+		}
+	}
+}
+
+func (s *MistifyAgentSuite) TestResizeGuest() {
+	flavor := s.NewFlavor()
+
+	tests := []struct {
+		description string
+		id          string
+		flavorID    string
+		expectedErr bool
+	}{
+		{"missing id", "", flavor.ID, true},
+		{"nonexistent id", uuid.New(), flavor.ID, true},
+		{"nonexistent flavor", s.guest.ID, uuid.New(), true},
+		{"real id", s.guest.ID, flavor.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		jobID, err := s.agent.ResizeGuest(test.id, test.flavorID)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			s.Nil(uuid.Parse(jobID), msg("fail should not return jobID"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			s.NotNil(uuid.Parse(jobID), msg("should return jobID"))
+		}
+	}
+}
+
+func (s *MistifyAgentSuite) TestIOLimits() {
+	flavor := s.NewFlavor()
+	flavor.IOLimits = lochness.IOLimits{DiskIOPS: 500, DiskThroughput: 50, NicBandwidth: 100}
+	s.Require().NoError(flavor.Save())
+
+	// the limits of the flavor the guest is resized to are applied
+	_, err := s.agent.ResizeGuest(s.guest.ID, flavor.ID)
+	s.Require().NoError(err)
+
+	var sent struct {
+		Memory uint64 `json:"memory"`
+		Nics   []struct {
+			Name      string `json:"name"`
+			Bandwidth uint64 `json:"bandwidth"`
+		} `json:"nics"`
+		Disks []struct {
+			Size       uint64 `json:"size"`
+			IOPS       uint64 `json:"iops"`
+			Throughput uint64 `json:"throughput"`
+		} `json:"disks"`
+	}
+	s.Require().NoError(json.Unmarshal(s.lastBody, &sent))
+	s.Equal(flavor.Memory, sent.Memory)
+	if s.Len(sent.Nics, 1) {
+		s.Equal("eth0", sent.Nics[0].Name)
+		s.Equal(uint64(100), sent.Nics[0].Bandwidth)
+	}
+	if s.Len(sent.Disks, 1) {
+		s.Equal(flavor.Disk, sent.Disks[0].Size)
+		s.Equal(uint64(500), sent.Disks[0].IOPS)
+		s.Equal(uint64(50), sent.Disks[0].Throughput)
+	}
+
+	// unlimited flavors send no limits
+	_, err = s.agent.CreateGuest(s.guest.ID)
+	s.Require().NoError(err)
+	s.NotContains(string(s.lastBody), "iops")
+	s.NotContains(string(s.lastBody), "bandwidth")
+}
+
+func (s *MistifyAgentSuite) TestSnapshotActions() {
+	s.guest.State = lochness.GuestStateRunning
+	s.Require().NoError(s.guest.Save())
+	snapshot, err := s.guest.NewSnapshot("")
+	s.Require().NoError(err)
+	_, other := s.NewHypervisorWithGuest()
+
+	actions := map[string]func(string, string) (string, error){
+		"create":   s.agent.CreateSnapshot,
+		"delete":   s.agent.DeleteSnapshot,
+		"rollback": s.agent.RollbackSnapshot,
+	}
+
+	tests := []struct {
+		description string
+		guestID     string
+		snapshotID  string
+		expectedErr bool
+	}{
+		{"missing snapshot id", s.guest.ID, "", true},
+		{"nonexistent snapshot id", s.guest.ID, uuid.New(), true},
+		{"other guest", other.ID, snapshot.ID, true},
+		{"real ids", s.guest.ID, snapshot.ID, false},
+	}
+
+	for action, f := range actions {
+		for _, test := range tests {
+			msg := s.Messager(fmt.Sprintf("%s %s", action, test.description))
+			jobID, err := f(test.guestID, test.snapshotID)
+			if test.expectedErr {
+				s.Error(err, msg("should fail"))
+				s.Nil(uuid.Parse(jobID), msg("fail should not return jobID"))
+			} else {
+				s.NoError(err, msg("should succeed"))
+				s.NotNil(uuid.Parse(jobID), msg("should return jobID"))
+			}
+		}
+	}
+}
+
+func (s *MistifyAgentSuite) TestSnapshotSize() {
+	s.guest.State = lochness.GuestStateRunning
+	s.Require().NoError(s.guest.Save())
+	snapshot, err := s.guest.NewSnapshot("")
+	s.Require().NoError(err)
+
+	_, err = s.agent.SnapshotSize(s.guest.ID, uuid.New())
+	s.Error(err, "nonexistent snapshot should fail")
+
+	size, err := s.agent.SnapshotSize(s.guest.ID, snapshot.ID)
+	s.NoError(err)
+	s.Equal(uint64(100), size)
+}
@@ -22,6 +22,7 @@ type (
 		modifiedIndex uint64
 		ID            string            `json:"id"`
 		Metadata      map[string]string `json:"metadata"`
+		ProjectID     string            `json:"project"` // owning project. blank if not owned by one
 		subnets       []string
 	}
 
@@ -115,7 +116,7 @@ func (n *Network) Validate() error {
 	if _, err := canonicalizeUUID(n.ID); err != nil {
 		return errors.New("invalid ID")
 	}
-	return nil
+	return validateProjectID(n.ProjectID)
 }
 
 // Save persists a Network.
@@ -132,12 +133,22 @@ func (n *Network) Save() error {
 		return err
 	}
 
+	project, err := n.context.savedProject(n.key(), n.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := n.context.auditSaved(n.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := n.context.kv.Update(n.key(), kv.Value{Data: v, Index: n.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	n.modifiedIndex = index
-	return nil
+	n.context.recordChange("network", n.ID, before, v)
+	return n.context.updateProjectLink(projectNetworks, n.ID, project, n.ProjectID)
 }
 
 func (n *Network) subnetKey(s *Subnet) string {
@@ -45,14 +45,16 @@ func NewClient(bstalk string, kv kv.KV) (*Client, error) {
 	return client, nil
 }
 
-// AddTask creates a new task in the appropriate beanstalk queue
+// AddTask creates a new task in the appropriate beanstalk queue. Jobs needing
+// a hypervisor selected, including migrations without a target hypervisor yet,
+// go to the create queue.
 func (c *Client) AddTask(j *Job) (uint64, error) {
 	if j == nil {
 		return 0, errors.New("missing job")
 	}
 
 	ts := c.tubes.work
-	if j.Action == "select-hypervisor" {
+	if j.Action == "select-hypervisor" || (j.Action == "migrate" && j.Args["hypervisor"] == "") {
 		ts = c.tubes.create
 	}
 	id, err := ts.Put(j.ID)
@@ -103,9 +105,16 @@ func (c *Client) nextTask(ts *tubeSet) (*Task, error) {
 
 // AddJob creates a new job for a guest and adds a task for it
 func (c *Client) AddJob(guestID, action string) (*Job, error) {
+	return c.AddJobWithArgs(guestID, action, nil)
+}
+
+// AddJobWithArgs creates a new job with action specific arguments for a guest
+// and adds a task for it
+func (c *Client) AddJobWithArgs(guestID, action string, args map[string]string) (*Job, error) {
 	job := c.NewJob()
 	job.Guest = guestID
 	job.Action = action
+	job.Args = args
 	if err := job.Save(jobTTL); err != nil {
 		return nil, err
 	}
@@ -99,6 +99,20 @@ func (s *ClientSuite) TestNextCreateTask() {
 	s.Equal(job.ID, task.JobID)
 }
 
+func (s *ClientSuite) TestAddTaskMigrate() {
+	job := s.newJob("migrate")
+	taskID, _ := s.Client.AddTask(job)
+	task, err := s.Client.NextCreateTask()
+	s.NoError(err)
+	s.Equal(taskID, task.ID, "migration without a target should need one selected")
+
+	job.Args = map[string]string{"hypervisor": uuid.New()}
+	taskID, _ = s.Client.AddTask(job)
+	task, err = s.Client.NextWorkTask()
+	s.NoError(err)
+	s.Equal(taskID, task.ID, "migration with a target should be worked")
+}
+
 func (s *ClientSuite) TestAddJob() {
 	tests := []struct {
 		description string
@@ -125,6 +139,20 @@ func (s *ClientSuite) TestAddJob() {
 	}
 }
 
+func (s *ClientSuite) TestAddJobWithArgs() {
+	args := map[string]string{"volume": uuid.New()}
+	job, err := s.Client.AddJobWithArgs(uuid.New(), "attach-volume", args)
+	s.NoError(err)
+	if !s.NotNil(job) {
+		return
+	}
+
+	loaded, err := s.Client.Job(job.ID)
+	s.NoError(err)
+	s.Equal(args, loaded.Args)
+	_ = loaded.Release()
+}
+
 func (s *ClientSuite) TestStats() {
 	stats, err := s.Client.StatsCreate()
 	if connErr, ok := err.(beanstalk.ConnError); ok {
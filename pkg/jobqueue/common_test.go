@@ -66,7 +66,7 @@ func (s *JobQCommonSuite) newJob(action string) *jobqueue.Job {
 	context := lochness.NewContext(s.KV)
 	guest := context.NewGuest()
 	guest.FlavorID = uuid.New()
-	guest.NetworkID = uuid.New()
+	guest.AddInterface(uuid.New())
 	s.Require().NoError(guest.Save())
 
 	j := s.Client.NewJob()
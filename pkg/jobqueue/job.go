@@ -26,14 +26,15 @@ const (
 type (
 	// Job is a single job for a guest such as create, delete, etc.
 	Job struct {
-		ID         string    `json:"id"`
-		RemoteID   string    `json:"remote"` // ID of remote hypervisor/guest job
-		Action     string    `json:"action"`
-		Guest      string    `json:"guest"`
-		Error      string    `json:"error,omitempty"`
-		Status     string    `json:"status,omitempty"`
-		StartedAt  time.Time `json:"started_at,omitempty"`
-		FinishedAt time.Time `json:"finished_at,omitempty"`
+		ID         string            `json:"id"`
+		RemoteID   string            `json:"remote"` // ID of remote hypervisor/guest job
+		Action     string            `json:"action"`
+		Guest      string            `json:"guest"`
+		Args       map[string]string `json:"args,omitempty"` // action specific arguments
+		Error      string            `json:"error,omitempty"`
+		Status     string            `json:"status,omitempty"`
+		StartedAt  time.Time         `json:"started_at,omitempty"`
+		FinishedAt time.Time         `json:"finished_at,omitempty"`
 		client     *Client
 		lock       kv.Lock
 	}
@@ -148,3 +149,23 @@ func (c *Client) Job(id string) (*Job, error) {
 
 	return j, nil
 }
+
+// PeekJob retrieves a single job from the data store without locking it, so it
+// may be used while another component is working the job. The returned Job is
+// only for reading.
+func (c *Client) PeekJob(id string) (*Job, error) {
+	j := &Job{
+		ID:     id,
+		client: c,
+	}
+
+	v, err := c.kv.Get(j.key())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(v.Data, &j); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
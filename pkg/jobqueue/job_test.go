@@ -133,3 +133,36 @@ func (s *JobSuite) TestJob() {
 		}
 	}
 }
+
+func (s *JobSuite) TestPeekJob() {
+	job := s.newJob("")
+
+	// a locked job can still be peeked at
+	locked, err := s.Client.Job(job.ID)
+	s.Require().NoError(err)
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"nonexistant id", uuid.New(), true},
+		{"locked id", locked.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		j, err := s.Client.PeekJob(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(j, msg("failure shouldn't return a job"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.Equal(job.Action, j.Action, msg("should pull correct data"))
+			s.Equal(job.Guest, j.Guest, msg("should pull correct data"))
+		}
+	}
+
+	s.NoError(locked.Release())
+}
@@ -11,7 +11,10 @@ import (
 	"github.com/mistifyio/lochness/pkg/kv"
 )
 
-var err404 = errors.New("key not found")
+var (
+	err404       = errors.New("key not found")
+	errCASFailed = errors.New("CAS failed")
+)
 
 func init() {
 	kv.Register("consul", New)
@@ -113,8 +116,7 @@ func (c *ckv) cas(key string, value kv.Value) error {
 	}
 
 	if !valid {
-		// TODO(mm) better error
-		return errors.New("CAS failed")
+		return errCASFailed
 	}
 
 	return nil
@@ -141,7 +143,7 @@ func (c *ckv) Remove(key string, index uint64) error {
 	}
 
 	if !ok {
-		err = errors.New("failed to delete atomically")
+		err = errCASFailed
 	}
 
 	return err
@@ -151,6 +153,10 @@ func (c *ckv) IsKeyNotFound(err error) bool {
 	return err == err404
 }
 
+func (c *ckv) IsCASFailed(err error) bool {
+	return err == errCASFailed
+}
+
 func (c *ckv) Watch(prefix string, lastIndex uint64, stop chan struct{}) (chan kv.Event, chan error, error) {
 	wp, err := watch.Parse(map[string]interface{}{
 		"type":   "keyprefix",
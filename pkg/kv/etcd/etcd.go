@@ -138,6 +138,13 @@ func (e *ekv) IsKeyNotFound(err error) bool {
 	return ok && eErr.ErrorCode == etcdErr.EcodeKeyNotFound
 }
 
+// IsCASFailed covers creating a key that exists as well as swapping or
+// deleting one modified since the index
+func (e *ekv) IsCASFailed(err error) bool {
+	eErr, ok := err.(*etcd.EtcdError)
+	return ok && (eErr.ErrorCode == etcdErr.EcodeTestFailed || eErr.ErrorCode == etcdErr.EcodeNodeExist)
+}
+
 func (e *ekv) isKeyExists(err error) bool {
 	eErr, ok := err.(*etcd.EtcdError)
 	return ok && eErr.ErrorCode == etcdErr.EcodeNodeExist
@@ -146,6 +146,8 @@ type KV interface {
 
 	// IsKeyNotFound is a helper to determine if the error is a key not found error
 	IsKeyNotFound(error) bool
+	// IsCASFailed is a helper to determine if the error is from an atomic operation finding a newer value
+	IsCASFailed(error) bool
 
 	// Watch returns channels for watching prefixes.
 	// stop *must* always be closed by callers
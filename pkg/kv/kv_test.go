@@ -250,8 +250,10 @@ func (s *KVSuite) TestUpdate() {
 
 	_, err = s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2")})
 	s.Require().Error(err)
+	s.Require().True(s.KV.IsCASFailed(err))
 	_, err = s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2"), Index: idx - 1})
 	s.Require().Error(err)
+	s.Require().True(s.KV.IsCASFailed(err))
 
 	idx2, err := s.KV.Update("lochness/some-key", kv.Value{Data: []byte("2"), Index: idx})
 	s.Require().NoError(err)
@@ -265,7 +267,9 @@ func (s *KVSuite) TestRemove() {
 	s.Require().NoError(err)
 	s.Require().True(idx > 0)
 
-	s.Require().Error(s.KV.Remove("lochness/some-key", idx-1))
+	err = s.KV.Remove("lochness/some-key", idx-1)
+	s.Require().Error(err)
+	s.Require().True(s.KV.IsCASFailed(err))
 	v, err := s.KV.Get("lochness/some-key")
 	s.Require().NoError(err)
 	s.Require().True(v.Index == idx)
@@ -0,0 +1,384 @@
+package lochness
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Defaults for the resource probe settings of a Hypervisor
+const (
+	DefaultGuestDiskDir    = "/mistify/guests"
+	DefaultGuestDataset    = "mistify/guests"
+	DefaultHostReservedCPU = 1
+)
+
+type (
+	// HostResources are the physical resources of a Hypervisor, as found by a
+	// ResourceProbe.
+	HostResources struct {
+		Physical  Resources   `json:"physical"`
+		Reserved  Resources   `json:"reserved"` // held back for the host
+		NUMANodes []NUMANode  `json:"numa_nodes"`
+		HugePages []HugePages `json:"huge_pages"`
+	}
+
+	// NUMANode is a memory node of a host and its cpus
+	NUMANode struct {
+		ID     int    `json:"id"`
+		CPUs   []int  `json:"cpus"`
+		Memory uint64 `json:"memory"` // memory in MB
+	}
+
+	// HugePages is the pool of huge pages of a size
+	HugePages struct {
+		Size  uint64 `json:"size"` // page size in KB
+		Total uint64 `json:"total"`
+		Free  uint64 `json:"free"`
+	}
+
+	// ResourceProbe discovers the physical resources of the host it runs on.
+	ResourceProbe interface {
+		Probe() (HostResources, error)
+	}
+
+	// DiskProbe measures the disk available to guests, in MB.
+	DiskProbe interface {
+		Disk() (uint64, error)
+	}
+
+	// HostProbe is the ResourceProbe of a Linux host. Memory, cpus, NUMA nodes
+	// and huge pages are read from /proc and sysfs under Root, and disk from the
+	// DiskProbe.
+	HostProbe struct {
+		Root           string // "/" on the host
+		Disk           DiskProbe
+		ReservedMemory uint64 // memory in MB held back for the host
+		ReservedCPU    uint32 // cpus held back for the host
+	}
+
+	// StatfsDiskProbe measures the size of the filesystem at Path. Guest
+	// usage is taken out of it, as with the other resources.
+	StatfsDiskProbe struct {
+		Path string
+	}
+
+	// ZFSDiskProbe measures the space of a ZFS dataset, used and available.
+	// Available space accounts for the free space of the pool and the quotas
+	// and reservations of the dataset.
+	ZFSDiskProbe struct {
+		Dataset string
+		// Command runs a command and returns its output. It runs the actual
+		// command if nil.
+		Command func(name string, arg ...string) ([]byte, error)
+	}
+)
+
+// Available returns the physical resources not reserved for the host.
+func (r HostResources) Available() Resources {
+	return Resources{
+		Memory: remainder(r.Physical.Memory, r.Reserved.Memory),
+		Disk:   remainder(r.Physical.Disk, r.Reserved.Disk),
+		CPU:    uint32(remainder(uint64(r.Physical.CPU), uint64(r.Reserved.CPU))),
+	}
+}
+
+// ResourceProbe returns the ResourceProbe of the Hypervisor. Each setting is
+// read from the Hypervisor Config, falling back to the cluster config. The keys
+// are hostReservedMemory (MB, default 0), hostReservedCPU (default 1),
+// diskProbe (statfs, the default, or zfs), guestDiskDir (the statfs path,
+// default /mistify/guests) and guestDataset (the zfs dataset, default
+// mistify/guests).
+func (h *Hypervisor) ResourceProbe() (ResourceProbe, error) {
+	probe := &HostProbe{
+		Root:        "/",
+		ReservedCPU: DefaultHostReservedCPU,
+	}
+
+	if s, ok, err := h.setting("hostReservedMemory"); err != nil {
+		return nil, err
+	} else if ok {
+		v, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostReservedMemory: %s", err)
+		}
+		probe.ReservedMemory = v
+	}
+	if s, ok, err := h.setting("hostReservedCPU"); err != nil {
+		return nil, err
+	} else if ok {
+		v, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostReservedCPU: %s", err)
+		}
+		probe.ReservedCPU = uint32(v)
+	}
+
+	kind, _, err := h.setting("diskProbe")
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "", "statfs":
+		dir, ok, err := h.setting("guestDiskDir")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			dir = DefaultGuestDiskDir
+		}
+		probe.Disk = StatfsDiskProbe{Path: dir}
+	case "zfs":
+		dataset, ok, err := h.setting("guestDataset")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			dataset = DefaultGuestDataset
+		}
+		probe.Disk = ZFSDiskProbe{Dataset: dataset}
+	default:
+		return nil, fmt.Errorf("invalid diskProbe: %s", kind)
+	}
+	return probe, nil
+}
+
+// Probe discovers the resources of the host.
+func (p *HostProbe) Probe() (HostResources, error) {
+	var host HostResources
+	var err error
+
+	if host.Physical.Memory, err = p.memory(); err != nil {
+		return host, err
+	}
+	if host.Physical.CPU, err = p.cpu(); err != nil {
+		return host, err
+	}
+	if p.Disk != nil {
+		if host.Physical.Disk, err = p.Disk.Disk(); err != nil {
+			return host, err
+		}
+	}
+	if host.NUMANodes, err = p.numaNodes(); err != nil {
+		return host, err
+	}
+	if host.HugePages, err = p.hugePages(); err != nil {
+		return host, err
+	}
+
+	host.Reserved = Resources{Memory: p.ReservedMemory, CPU: p.ReservedCPU}
+	return host, nil
+}
+
+// path returns the path of a file under the Root
+func (p *HostProbe) path(elem ...string) string {
+	return filepath.Join(append([]string{p.Root}, elem...)...)
+}
+
+// memory gets the amount of memory in MB.
+func (p *HostProbe) memory() (uint64, error) {
+	f, err := os.Open(p.path("proc", "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return meminfoTotal(f, "MemTotal:")
+}
+
+// meminfoTotal reads the value, in KB, of the first line starting with prefix
+// from meminfo, returning it in MB.
+func meminfoTotal(f *os.File, prefix string) (uint64, error) {
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, prefix))
+		if len(fields) == 0 {
+			return 0, fmt.Errorf("invalid meminfo line: %s", line)
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("%s not found in %s", strings.TrimSuffix(prefix, ":"), f.Name())
+}
+
+// cpu gets number of CPU's.
+func (p *HostProbe) cpu() (uint32, error) {
+	f, err := os.Open(p.path("proc", "cpuinfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	scanner := bufio.NewScanner(f)
+	var count uint32
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "processor") {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
+
+// numaNodes gets the NUMA nodes, if the host reports any.
+func (p *HostProbe) numaNodes() ([]NUMANode, error) {
+	dirs, err := filepath.Glob(p.path("sys", "devices", "system", "node", "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]NUMANode, 0, len(dirs))
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		node := NUMANode{ID: id}
+
+		cpulist, err := ioutil.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		if node.CPUs, err = parseCPUList(string(bytes.TrimSpace(cpulist))); err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(filepath.Join(dir, "meminfo"))
+		if err != nil {
+			return nil, err
+		}
+		node.Memory, err = meminfoTotal(f, fmt.Sprintf("Node %d MemTotal:", id))
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		nodes = append(nodes, node)
+	}
+	sort.Sort(numaNodesByID(nodes))
+	return nodes, nil
+}
+
+// numaNodesByID sorts NUMANodes by id
+type numaNodesByID []NUMANode
+
+func (n numaNodesByID) Len() int           { return len(n) }
+func (n numaNodesByID) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n numaNodesByID) Less(i, j int) bool { return n[i].ID < n[j].ID }
+
+// parseCPUList parses a list of cpus, such as 0-3,8-11
+func parseCPUList(list string) ([]int, error) {
+	cpus := make([]int, 0)
+	if list == "" {
+		return cpus, nil
+	}
+	for _, part := range strings.Split(list, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu list %s", list)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil || last < first {
+				return nil, fmt.Errorf("invalid cpu list %s", list)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// hugePages gets the pools of huge pages, if the host has any.
+func (p *HostProbe) hugePages() ([]HugePages, error) {
+	dirs, err := filepath.Glob(p.path("sys", "kernel", "mm", "hugepages", "hugepages-*kB"))
+	if err != nil {
+		return nil, err
+	}
+
+	pools := make([]HugePages, 0, len(dirs))
+	for _, dir := range dirs {
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(dir), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		pool := HugePages{Size: size}
+		if pool.Total, err = readUint(filepath.Join(dir, "nr_hugepages")); err != nil {
+			return nil, err
+		}
+		if pool.Free, err = readUint(filepath.Join(dir, "free_hugepages")); err != nil {
+			return nil, err
+		}
+		pools = append(pools, pool)
+	}
+	sort.Sort(hugePagesBySize(pools))
+	return pools, nil
+}
+
+// hugePagesBySize sorts HugePages by page size
+type hugePagesBySize []HugePages
+
+func (h hugePagesBySize) Len() int           { return len(h) }
+func (h hugePagesBySize) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h hugePagesBySize) Less(i, j int) bool { return h[i].Size < h[j].Size }
+
+// readUint reads a file holding a single number
+func readUint(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+}
+
+// Disk gets the size of the filesystem at Path in MB.
+func (p StatfsDiskProbe) Disk() (uint64, error) {
+	stat := &syscall.Statfs_t{}
+	err := syscall.Statfs(p.Path, stat)
+	return uint64(stat.Bsize) * stat.Blocks / 1024 / 1024, err
+}
+
+// Disk gets the space of the dataset, used and available, in MB.
+func (p ZFSDiskProbe) Disk() (uint64, error) {
+	command := p.Command
+	if command == nil {
+		command = func(name string, arg ...string) ([]byte, error) {
+			return exec.Command(name, arg...).Output()
+		}
+	}
+
+	out, err := command("zfs", "get", "-Hp", "-o", "value", "used,available", p.Dataset)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("unexpected zfs output for %s: %q", p.Dataset, out)
+	}
+	var total uint64
+	for _, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected zfs output for %s: %q", p.Dataset, out)
+		}
+		total += n
+	}
+	return total / 1024 / 1024, nil
+}
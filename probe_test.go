@@ -0,0 +1,216 @@
+package lochness_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestProbe(t *testing.T) {
+	suite.Run(t, new(ProbeSuite))
+}
+
+type ProbeSuite struct {
+	common.Suite
+	Root string
+}
+
+func (s *ProbeSuite) SetupTest() {
+	s.Suite.SetupTest()
+	s.Root, _ = ioutil.TempDir("", "probe-test")
+}
+
+func (s *ProbeSuite) TearDownTest() {
+	s.Suite.TearDownTest()
+	_ = os.RemoveAll(s.Root)
+}
+
+// writeFile writes a file of the fake host tree
+func (s *ProbeSuite) writeFile(path, data string) {
+	path = filepath.Join(s.Root, path)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(ioutil.WriteFile(path, []byte(data), 0644))
+}
+
+// writeHost writes the /proc files of a fake host with 4 cpus and 8GB memory
+func (s *ProbeSuite) writeHost() {
+	s.writeFile("proc/meminfo", "MemTotal:        8388608 kB\nMemFree:         4194304 kB\n")
+	s.writeFile("proc/cpuinfo", "processor\t: 0\nprocessor\t: 1\nprocessor\t: 2\nprocessor\t: 3\n")
+}
+
+// zfsOutput returns a ZFSDiskProbe Command printing the output
+func zfsOutput(out string, err error) func(string, ...string) ([]byte, error) {
+	return func(string, ...string) ([]byte, error) {
+		return []byte(out), err
+	}
+}
+
+// fakeProbe is a ResourceProbe finding fixed resources
+type fakeProbe lochness.HostResources
+
+func (p fakeProbe) Probe() (lochness.HostResources, error) {
+	return lochness.HostResources(p), nil
+}
+
+func (s *ProbeSuite) TestHostProbe() {
+	s.writeHost()
+	s.writeFile("sys/devices/system/node/node0/cpulist", "0-1\n")
+	s.writeFile("sys/devices/system/node/node0/meminfo", "Node 0 MemTotal:       4194304 kB\n")
+	s.writeFile("sys/devices/system/node/node1/cpulist", "2,3\n")
+	s.writeFile("sys/devices/system/node/node1/meminfo", "Node 1 MemTotal:       4194304 kB\n")
+	s.writeFile("sys/kernel/mm/hugepages/hugepages-2048kB/nr_hugepages", "512\n")
+	s.writeFile("sys/kernel/mm/hugepages/hugepages-2048kB/free_hugepages", "256\n")
+	s.writeFile("sys/kernel/mm/hugepages/hugepages-1048576kB/nr_hugepages", "0\n")
+	s.writeFile("sys/kernel/mm/hugepages/hugepages-1048576kB/free_hugepages", "0\n")
+
+	probe := &lochness.HostProbe{
+		Root:           s.Root,
+		Disk:           lochness.ZFSDiskProbe{Dataset: "mistify/guests", Command: zfsOutput("1073741824\n3221225472\n", nil)},
+		ReservedMemory: 1024,
+		ReservedCPU:    1,
+	}
+	host, err := probe.Probe()
+	s.Require().NoError(err)
+	s.Equal(lochness.Resources{Memory: 8192, Disk: 4096, CPU: 4}, host.Physical)
+	s.Equal(lochness.Resources{Memory: 1024, CPU: 1}, host.Reserved)
+	s.Equal(lochness.Resources{Memory: 7168, Disk: 4096, CPU: 3}, host.Available())
+	s.Equal([]lochness.NUMANode{
+		{ID: 0, CPUs: []int{0, 1}, Memory: 4096},
+		{ID: 1, CPUs: []int{2, 3}, Memory: 4096},
+	}, host.NUMANodes)
+	s.Equal([]lochness.HugePages{
+		{Size: 2048, Total: 512, Free: 256},
+		{Size: 1048576},
+	}, host.HugePages)
+}
+
+func (s *ProbeSuite) TestHostProbeMinimal() {
+	probe := &lochness.HostProbe{Root: s.Root, ReservedCPU: 8}
+	_, err := probe.Probe()
+	s.Error(err, "missing meminfo should fail")
+
+	s.writeHost()
+	host, err := probe.Probe()
+	s.Require().NoError(err)
+	s.Len(host.NUMANodes, 0)
+	s.Len(host.HugePages, 0)
+	s.Equal(uint32(0), host.Available().CPU, "reserving more than exists should leave none")
+
+	s.writeFile("sys/devices/system/node/node0/cpulist", "3-1\n")
+	s.writeFile("sys/devices/system/node/node0/meminfo", "Node 0 MemTotal:       4194304 kB\n")
+	_, err = probe.Probe()
+	s.Error(err, "invalid cpu list should fail")
+}
+
+func (s *ProbeSuite) TestZFSDiskProbe() {
+	tests := []struct {
+		description string
+		out         string
+		err         error
+		expected    uint64
+		expectedErr bool
+	}{
+		{"used and available", "1048576\t\n2097152\n", nil, 3, false},
+		{"command error", "", errors.New("no such dataset"), 0, true},
+		{"missing value", "1048576\n", nil, 0, true},
+		{"invalid value", "1048576\n-\n", nil, 0, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		probe := lochness.ZFSDiskProbe{Dataset: "mistify/guests", Command: zfsOutput(test.out, test.err)}
+		disk, err := probe.Disk()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			s.Equal(test.expected, disk, msg("unexpected disk"))
+		}
+	}
+}
+
+func (s *ProbeSuite) TestResourceProbe() {
+	hypervisor := s.NewHypervisor()
+
+	probe, err := hypervisor.ResourceProbe()
+	s.Require().NoError(err)
+	s.Equal(&lochness.HostProbe{
+		Root:        "/",
+		Disk:        lochness.StatfsDiskProbe{Path: lochness.DefaultGuestDiskDir},
+		ReservedCPU: lochness.DefaultHostReservedCPU,
+	}, probe, "defaults")
+
+	s.Require().NoError(s.Context.SetConfig("hostReservedMemory", "2048"))
+	s.Require().NoError(hypervisor.SetConfig("hostReservedCPU", "2"))
+	s.Require().NoError(hypervisor.SetConfig("diskProbe", "zfs"))
+	s.Require().NoError(hypervisor.SetConfig("guestDataset", "tank/guests"))
+	probe, err = hypervisor.ResourceProbe()
+	s.Require().NoError(err)
+	s.Equal(&lochness.HostProbe{
+		Root:           "/",
+		Disk:           lochness.ZFSDiskProbe{Dataset: "tank/guests"},
+		ReservedMemory: 2048,
+		ReservedCPU:    2,
+	}, probe, "settings")
+
+	for key, value := range map[string]string{
+		"hostReservedMemory": "lots",
+		"hostReservedCPU":    "-1",
+		"diskProbe":          "lvm",
+	} {
+		stale := hypervisor.Config[key]
+		s.Require().NoError(hypervisor.SetConfig(key, value))
+		_, err := hypervisor.ResourceProbe()
+		s.Error(err, "invalid "+key+" should fail")
+		s.Require().NoError(hypervisor.SetConfig(key, stale))
+	}
+}
+
+func (s *ProbeSuite) TestUpdateResourcesFrom() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+	s.Require().NoError(hypervisor.SetConfig("memoryReserved", "0"))
+	s.Require().NoError(hypervisor.SetConfig("diskReserved", "0"))
+	s.Require().NoError(hypervisor.SetConfig("cpuOvercommit", "1"))
+
+	host := lochness.HostResources{
+		Physical:  lochness.Resources{Memory: 8192, Disk: 4096, CPU: 4},
+		Reserved:  lochness.Resources{Memory: 1024, CPU: 1},
+		NUMANodes: []lochness.NUMANode{{ID: 0, CPUs: []int{0, 1, 2, 3}, Memory: 8192}},
+		HugePages: []lochness.HugePages{{Size: 2048, Total: 0, Free: 0}},
+	}
+	s.NoError(hypervisor.UpdateResourcesFrom(fakeProbe(host)))
+	s.Equal(lochness.Resources{Memory: 7168, Disk: 4096, CPU: 3}, hypervisor.TotalResources)
+	s.Equal(lochness.Resources{
+		Memory: 7168 - flavor.Memory,
+		Disk:   4096 - flavor.Disk,
+		CPU:    3 - flavor.CPU,
+	}, hypervisor.AvailableResources)
+
+	loaded, err := s.Context.Hypervisor(hypervisor.ID)
+	s.Require().NoError(err)
+	s.Equal(host, loaded.Host, "probed resources should be saved")
+}
+
+func (s *ProbeSuite) TestUpdateResourcesFromHostReserved() {
+	hypervisor := s.NewHypervisor()
+	s.Require().NoError(hypervisor.SetConfig("cpuOvercommit", "1"))
+
+	host := lochness.HostResources{
+		Physical: lochness.Resources{Memory: 8192, Disk: 4000, CPU: 4},
+		Reserved: lochness.Resources{Memory: 1024, CPU: 1},
+	}
+	s.NoError(hypervisor.UpdateResourcesFrom(fakeProbe(host)))
+	s.Equal(lochness.Resources{Memory: 7168, Disk: 3200, CPU: 3}, hypervisor.TotalResources,
+		"default fractions should only be reserved without a host reservation")
+
+	s.Require().NoError(hypervisor.SetConfig("memoryReserved", "0.5"))
+	s.NoError(hypervisor.UpdateResourcesFrom(fakeProbe(host)))
+	s.Equal(uint64(3584), hypervisor.TotalResources.Memory, "configured fractions should still apply")
+}
@@ -0,0 +1,308 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// ProjectPath is the path in the config store.
+	ProjectPath = "lochness/projects/"
+)
+
+// Kinds of objects owned by a Project
+const (
+	projectGuests     = "guests"
+	projectNetworks   = "networks"
+	projectSubnets    = "subnets"
+	projectFWGroups   = "fwgroups"
+	projectVLANGroups = "vlangroups"
+)
+
+type (
+	// Project is a tenant owning Guests, Networks, Subnets, FWGroups, and
+	// VLANGroups. Objects without a Project are shared by all Projects.
+	Project struct {
+		context       *Context
+		modifiedIndex uint64
+		ID            string            `json:"id"`
+		Name          string            `json:"name"`
+		Metadata      map[string]string `json:"metadata"`
+		members       map[string][]string
+	}
+
+	// Projects is an alias to a slice of *Project
+	Projects []*Project
+)
+
+// blankProject is a helper for creating a blank Project.
+func (c *Context) blankProject(id string) *Project {
+	p := &Project{
+		context:  c,
+		ID:       id,
+		Metadata: make(map[string]string),
+		members:  make(map[string][]string),
+	}
+
+	if id == "" {
+		p.ID = uuid.New()
+	}
+
+	return p
+}
+
+// NewProject creates a new, blank Project.
+func (c *Context) NewProject() *Project {
+	return c.blankProject("")
+}
+
+// Project fetches a Project from the data store.
+func (c *Context) Project(id string) (*Project, error) {
+	var err error
+	id, err = canonicalizeUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	p := c.blankProject(id)
+	err = p.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// key is a helper to generate the config store key.
+func (p *Project) key() string {
+	return filepath.Join(ProjectPath, p.ID, "metadata")
+}
+
+// projectMemberKey is a helper to generate the config store key linking an
+// object of a kind to its Project.
+func projectMemberKey(projectID, kind, id string) string {
+	return filepath.Join(ProjectPath, projectID, kind, id)
+}
+
+// Refresh reloads the Project from the data store.
+func (p *Project) Refresh() error {
+	prefix := filepath.Join(ProjectPath, p.ID)
+
+	nodes, err := p.context.kv.GetAll(prefix)
+	if err != nil {
+		return err
+	}
+
+	// handle metadata
+	key := filepath.Join(prefix, "metadata")
+	value, ok := nodes[key]
+	if !ok {
+		return errors.New("metadata key is missing")
+	}
+
+	if err := json.Unmarshal(value.Data, &p); err != nil {
+		return err
+	}
+	p.modifiedIndex = value.Index
+	delete(nodes, key)
+
+	members := make(map[string][]string)
+	for k := range nodes {
+		elements := strings.Split(k, "/")
+		base := elements[len(elements)-1]
+		dir := elements[len(elements)-2]
+
+		members[dir] = append(members[dir], base)
+	}
+
+	p.members = members
+
+	return nil
+}
+
+// Validate ensures a Project has reasonable data.
+func (p *Project) Validate() error {
+	if _, err := canonicalizeUUID(p.ID); err != nil {
+		return errors.New("invalid ID")
+	}
+	if p.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+// Save persists a Project.
+// It will call Validate.
+func (p *Project) Save() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	before, err := p.context.auditSaved(p.key())
+	if err != nil {
+		return err
+	}
+
+	index, err := p.context.kv.Update(p.key(), kv.Value{Data: v, Index: p.modifiedIndex})
+	if err != nil {
+		return err
+	}
+	p.modifiedIndex = index
+	p.context.recordChange("project", p.ID, before, v)
+	return nil
+}
+
+// Destroy removes a Project. It must not own anything.
+func (p *Project) Destroy() error {
+	for kind, ids := range p.members {
+		if len(ids) != 0 {
+			return fmt.Errorf("project still owns %s", kind)
+		}
+	}
+
+	if p.modifiedIndex == 0 {
+		// it has not been saved?
+		return errors.New("not persisted")
+	}
+
+	before, err := p.context.auditSaved(p.key())
+	if err != nil {
+		return err
+	}
+	if err := p.context.kv.Remove(p.key(), p.modifiedIndex); err != nil {
+		return err
+	}
+	p.context.recordChange("project", p.ID, before, nil)
+
+	return p.context.kv.Delete(filepath.Join(ProjectPath, p.ID), true)
+}
+
+// Guests returns the IDs of the Guests owned by the Project.
+func (p *Project) Guests() []string {
+	return p.members[projectGuests]
+}
+
+// Networks returns the IDs of the Networks owned by the Project.
+func (p *Project) Networks() []string {
+	return p.members[projectNetworks]
+}
+
+// Subnets returns the IDs of the Subnets owned by the Project.
+func (p *Project) Subnets() []string {
+	return p.members[projectSubnets]
+}
+
+// FWGroups returns the IDs of the FWGroups owned by the Project.
+func (p *Project) FWGroups() []string {
+	return p.members[projectFWGroups]
+}
+
+// VLANGroups returns the IDs of the VLANGroups owned by the Project.
+func (p *Project) VLANGroups() []string {
+	return p.members[projectVLANGroups]
+}
+
+// ForEachProject will run f on each Project. It will stop iteration if f
+// returns an error.
+func (c *Context) ForEachProject(f func(*Project) error) error {
+	keys, err := c.kv.Keys(ProjectPath)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		p, err := c.Project(filepath.Base(k))
+		if err != nil {
+			return err
+		}
+
+		if err := f(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InProject returns whether an object owned by projectID is visible to
+// project. Every object is visible without a project, and shared objects are
+// visible to every project.
+func InProject(project, projectID string) bool {
+	return project == "" || projectID == "" || projectID == project
+}
+
+// OwnedByProject returns whether an object owned by projectID belongs to
+// project. Unlike InProject, objects without a project are outside every
+// project; it is for objects that can not be shared, such as Guests.
+func OwnedByProject(project, projectID string) bool {
+	return project == "" || projectID == project
+}
+
+// validateProjectID ensures an optional project id is reasonable
+func validateProjectID(projectID string) error {
+	if projectID == "" {
+		return nil
+	}
+	if _, err := canonicalizeUUID(projectID); err != nil {
+		return errors.New("invalid project")
+	}
+	return nil
+}
+
+// checkProjectReference returns an error if an object owned by projectID
+// references an object of a kind owned by another project.
+func checkProjectReference(projectID, kind, id, referencedProjectID string) error {
+	if InProject(projectID, referencedProjectID) {
+		return nil
+	}
+	return fmt.Errorf("%s %s belongs to another project", kind, id)
+}
+
+// savedProject returns the project last saved in the metadata at key, if the
+// object has been saved
+func (c *Context) savedProject(key string, index uint64) (string, error) {
+	if index == 0 {
+		return "", nil
+	}
+
+	value, err := c.kv.Get(key)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	var data struct {
+		ProjectID string `json:"project"`
+	}
+	if err := json.Unmarshal(value.Data, &data); err != nil {
+		return "", err
+	}
+	return data.ProjectID, nil
+}
+
+// updateProjectLink links an object to its current project and removes the
+// link to its previous one
+func (c *Context) updateProjectLink(kind, id, previous, current string) error {
+	if previous == current {
+		return nil
+	}
+	if previous != "" {
+		if err := c.kv.Delete(projectMemberKey(previous, kind, id), false); err != nil && !c.kv.IsKeyNotFound(err) {
+			return err
+		}
+	}
+	if current != "" {
+		return c.kv.Set(projectMemberKey(current, kind, id), "")
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestProject(t *testing.T) {
+	suite.Run(t, new(ProjectSuite))
+}
+
+type ProjectSuite struct {
+	common.Suite
+}
+
+func (s *ProjectSuite) TestNewProject() {
+	p := s.Context.NewProject()
+	s.NotNil(uuid.Parse(p.ID))
+}
+
+func (s *ProjectSuite) TestProject() {
+	project := s.NewProject()
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", uuid.New(), true},
+		{"real id", project.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		p, err := s.Context.Project(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(p, msg("failure shouldn't return a project"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.True(assert.ObjectsAreEqual(project, p), msg("success should return correct data"))
+		}
+	}
+}
+
+func (s *ProjectSuite) TestValidate() {
+	tests := []struct {
+		description string
+		project     *lochness.Project
+		expectedErr bool
+	}{
+		{"missing id", &lochness.Project{Name: "a"}, true},
+		{"invalid id", &lochness.Project{ID: "asdf", Name: "a"}, true},
+		{"missing name", &lochness.Project{ID: uuid.New()}, true},
+		{"valid", &lochness.Project{ID: uuid.New(), Name: "a"}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.project.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *ProjectSuite) TestSave() {
+	goodProject := s.Context.NewProject()
+	goodProject.Name = "tenant-a"
+
+	clobberProject := *goodProject
+	clobberProject.Name = "tenant-b"
+
+	tests := []struct {
+		description string
+		project     *lochness.Project
+		expectedErr bool
+	}{
+		{"invalid project", s.Context.NewProject(), true},
+		{"valid project", goodProject, false},
+		{"existing project", goodProject, false},
+		{"existing project clobber changes", &clobberProject, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.project.Save()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *ProjectSuite) TestMembers() {
+	project := s.NewProject()
+	other := s.NewProject()
+
+	network := s.NewNetwork()
+	network.ProjectID = project.ID
+	s.Require().NoError(network.Save())
+
+	guest := s.NewGuest()
+	guest.ProjectID = project.ID
+	guest.Interfaces[0].NetworkID = network.ID
+	s.Require().NoError(guest.Save())
+
+	vlanGroup := s.NewVLANGroup()
+	vlanGroup.ProjectID = project.ID
+	s.Require().NoError(vlanGroup.Save())
+
+	s.NoError(project.Refresh())
+	s.Equal([]string{guest.ID}, project.Guests())
+	s.Equal([]string{network.ID}, project.Networks())
+	s.Equal([]string{vlanGroup.ID}, project.VLANGroups())
+	s.Len(project.Subnets(), 0)
+	s.Len(project.FWGroups(), 0)
+
+	// moving an object moves its link
+	vlanGroup.ProjectID = other.ID
+	s.Require().NoError(vlanGroup.Save())
+	s.NoError(project.Refresh())
+	s.Len(project.VLANGroups(), 0)
+	s.NoError(other.Refresh())
+	s.Equal([]string{vlanGroup.ID}, other.VLANGroups())
+
+	// destroying an object removes its link
+	s.Require().NoError(guest.Destroy())
+	s.NoError(project.Refresh())
+	s.Len(project.Guests(), 0)
+}
+
+func (s *ProjectSuite) TestDestroy() {
+	full := s.NewProject()
+	network := s.NewNetwork()
+	network.ProjectID = full.ID
+	s.Require().NoError(network.Save())
+	s.Require().NoError(full.Refresh())
+
+	tests := []struct {
+		description string
+		project     *lochness.Project
+		expectedErr bool
+	}{
+		{"nonexistant project", s.Context.NewProject(), true},
+		{"project with networks", full, true},
+		{"existing project", s.NewProject(), false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.project.Destroy()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			_, err := s.Context.Project(test.project.ID)
+			s.Error(err, msg("should no longer exist"))
+		}
+	}
+}
+
+func (s *ProjectSuite) TestForEachProject() {
+	project := s.NewProject()
+	project2 := s.NewProject()
+	expectedFound := map[string]bool{
+		project.ID:  true,
+		project2.ID: true,
+	}
+
+	resultFound := make(map[string]bool)
+
+	err := s.Context.ForEachProject(func(p *lochness.Project) error {
+		resultFound[p.ID] = true
+		return nil
+	})
+	s.NoError(err)
+	s.True(assert.ObjectsAreEqual(expectedFound, resultFound))
+}
+
+func (s *ProjectSuite) TestInProject() {
+	project, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		description string
+		project     string
+		projectID   string
+		expected    bool
+	}{
+		{"unscoped", "", project, true},
+		{"shared", project, "", true},
+		{"same project", project, project, true},
+		{"other project", project, other, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		s.Equal(test.expected, lochness.InProject(test.project, test.projectID), msg("should match"))
+	}
+}
+
+func (s *ProjectSuite) TestOwnedByProject() {
+	project, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		description string
+		project     string
+		projectID   string
+		expected    bool
+	}{
+		{"unscoped", "", project, true},
+		{"unscoped unowned", "", "", true},
+		{"unowned", project, "", false},
+		{"same project", project, project, true},
+		{"other project", project, other, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		s.Equal(test.expected, lochness.OwnedByProject(test.project, test.projectID), msg("should match"))
+	}
+}
+
+func (s *ProjectSuite) TestCrossProjectReferences() {
+	project := s.NewProject()
+	other := s.NewProject()
+
+	shared := s.NewFWGroup()
+	owned := s.NewFWGroup()
+	owned.ProjectID = project.ID
+	s.Require().NoError(owned.Save())
+	foreign := s.NewFWGroup()
+	foreign.ProjectID = other.ID
+	s.Require().NoError(foreign.Save())
+
+	foreignNetwork := s.NewNetwork()
+	foreignNetwork.ProjectID = other.ID
+	s.Require().NoError(foreignNetwork.Save())
+
+	guestTests := []struct {
+		description string
+		fwGroupID   string
+		expectedErr bool
+	}{
+		{"shared fwgroup", shared.ID, false},
+		{"same project fwgroup", owned.ID, false},
+		{"other project fwgroup", foreign.ID, true},
+	}
+
+	for _, test := range guestTests {
+		msg := s.Messager(test.description)
+		guest := s.NewGuest()
+		guest.ProjectID = project.ID
+		guest.Interfaces[0].FWGroupID = test.fwGroupID
+		err := guest.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+
+	// unowned guests may use anything
+	guest := s.NewGuest()
+	guest.Interfaces[0].FWGroupID = foreign.ID
+	s.NoError(guest.Validate())
+
+	// fwgroup rules may not allow other projects' groups
+	owned.Rules = lochness.FWRules{&lochness.FWRule{Group: foreign.ID}}
+	s.Error(owned.Validate())
+	owned.Rules = lochness.FWRules{&lochness.FWRule{Group: shared.ID}}
+	s.NoError(owned.Validate())
+
+	// subnets may not belong to other projects' networks
+	subnet := s.NewSubnet()
+	subnet.ProjectID = project.ID
+	subnet.NetworkID = foreignNetwork.ID
+	s.Error(subnet.Validate())
+	subnet.ProjectID = other.ID
+	s.NoError(subnet.Validate())
+}
@@ -0,0 +1,403 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// QuotaPath is the path in the config store.
+	QuotaPath = "lochness/quotas/"
+)
+
+type (
+	// Quota limits what the Guests of a Project may use, and tracks what they
+	// use. Guests are charged when they are admitted, such as when created or
+	// resized, and a Project without a Quota is unlimited.
+	Quota struct {
+		context       *Context
+		modifiedIndex uint64
+		ProjectID     string                    `json:"project"`
+		Limits        QuotaResources            `json:"limits"` // zero is unlimited
+		Usage         QuotaResources            `json:"usage"`
+		Guests        map[string]QuotaResources `json:"guests"` // usage charged to each guest
+	}
+
+	// QuotaResources are the dimensions limited by a Quota.
+	QuotaResources struct {
+		Guests    uint64            `json:"guests"`
+		Memory    uint64            `json:"memory"`    // memory in MB
+		Disk      uint64            `json:"disk"`      // disk in MB
+		CPU       uint64            `json:"cpu"`       // virtual cpus
+		Addresses map[string]uint64 `json:"addresses"` // ip addresses by network
+	}
+
+	// ErrorQuotaExceeded is returned when charging a Guest would take its
+	// Project beyond one of its Quota limits.
+	ErrorQuotaExceeded struct {
+		ProjectID string
+		Dimension string // guests, memory, disk, cpu, or addresses:<network id>
+		Limit     uint64
+		Requested uint64 // usage the charge would have reached
+	}
+)
+
+// Error returns a string error message
+func (e ErrorQuotaExceeded) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %d requested, limit %d", e.Dimension, e.Requested, e.Limit)
+}
+
+// dimensions returns the values of the QuotaResources by dimension name
+func (r QuotaResources) dimensions() map[string]uint64 {
+	d := map[string]uint64{
+		"guests": r.Guests,
+		"memory": r.Memory,
+		"disk":   r.Disk,
+		"cpu":    r.CPU,
+	}
+	for network, n := range r.Addresses {
+		d["addresses:"+network] = n
+	}
+	return d
+}
+
+// replace returns the QuotaResources with previous taken out and next put in.
+func (r QuotaResources) replace(previous, next QuotaResources) QuotaResources {
+	result := QuotaResources{
+		Guests:    remainder(r.Guests, previous.Guests) + next.Guests,
+		Memory:    remainder(r.Memory, previous.Memory) + next.Memory,
+		Disk:      remainder(r.Disk, previous.Disk) + next.Disk,
+		CPU:       remainder(r.CPU, previous.CPU) + next.CPU,
+		Addresses: make(map[string]uint64),
+	}
+	for network, n := range r.Addresses {
+		result.Addresses[network] = remainder(n, previous.Addresses[network])
+	}
+	for network, n := range next.Addresses {
+		result.Addresses[network] += n
+	}
+	for network, n := range result.Addresses {
+		if n == 0 {
+			delete(result.Addresses, network)
+		}
+	}
+	return result
+}
+
+// NewQuota creates a new, blank Quota for a Project.
+func (c *Context) NewQuota(projectID string) *Quota {
+	return &Quota{
+		context:   c,
+		ProjectID: projectID,
+		Guests:    make(map[string]QuotaResources),
+	}
+}
+
+// Quota fetches the Quota of a Project from the data store.
+func (c *Context) Quota(projectID string) (*Quota, error) {
+	var err error
+	projectID, err = canonicalizeUUID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	q := c.NewQuota(projectID)
+	if err := q.Refresh(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// key is a helper to generate the config store key.
+func (q *Quota) key() string {
+	return filepath.Join(QuotaPath, q.ProjectID, "metadata")
+}
+
+// Refresh reloads the Quota from the data store.
+func (q *Quota) Refresh() error {
+	resp, err := q.context.kv.Get(q.key())
+	if err != nil {
+		return err
+	}
+
+	// maps are replaced rather than merged into
+	q.Limits, q.Usage, q.Guests = QuotaResources{}, QuotaResources{}, nil
+	if err := json.Unmarshal(resp.Data, &q); err != nil {
+		return err
+	}
+	if q.Guests == nil {
+		q.Guests = make(map[string]QuotaResources)
+	}
+	q.modifiedIndex = resp.Index
+	return nil
+}
+
+// Validate ensures a Quota has reasonable data.
+func (q *Quota) Validate() error {
+	if _, err := canonicalizeUUID(q.ProjectID); err != nil {
+		return errors.New("invalid project")
+	}
+	for network := range q.Limits.Addresses {
+		if _, err := canonicalizeUUID(network); err != nil {
+			return fmt.Errorf("invalid address limit network %s", network)
+		}
+	}
+	return nil
+}
+
+// Save persists a Quota.
+// It will call Validate.
+func (q *Quota) Save() error {
+	if err := q.Validate(); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+
+	before, err := q.context.auditSaved(q.key())
+	if err != nil {
+		return err
+	}
+
+	index, err := q.context.kv.Update(q.key(), kv.Value{Data: v, Index: q.modifiedIndex})
+	if err != nil {
+		return err
+	}
+	q.modifiedIndex = index
+	q.context.recordChange("quota", q.ProjectID, before, v)
+	return nil
+}
+
+// Destroy removes a Quota, leaving its Project unlimited.
+func (q *Quota) Destroy() error {
+	if q.modifiedIndex == 0 {
+		// it has not been saved?
+		return errors.New("not persisted")
+	}
+
+	before, err := q.context.auditSaved(q.key())
+	if err != nil {
+		return err
+	}
+	if err := q.context.kv.Remove(q.key(), q.modifiedIndex); err != nil {
+		return err
+	}
+	q.context.recordChange("quota", q.ProjectID, before, nil)
+
+	return q.context.kv.Delete(filepath.Join(QuotaPath, q.ProjectID), true)
+}
+
+// casUpdate refreshes the Quota, applies f, and saves it. If the save loses a
+// race with another update, it starts over. Other errors are returned right
+// away.
+func (q *Quota) casUpdate(f func() error) error {
+	var err error
+	for i := 0; i < maxUpdateAttempts; i++ {
+		if err = q.Refresh(); err != nil {
+			return err
+		}
+		if err = f(); err != nil {
+			return err
+		}
+		if err = q.Save(); err == nil || !q.context.kv.IsCASFailed(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// SetLimits replaces the limits of a saved Quota, keeping its usage. Usage
+// already beyond a lowered limit is kept, but no more is admitted.
+func (q *Quota) SetLimits(limits QuotaResources) error {
+	return q.casUpdate(func() error {
+		q.Limits = limits
+		return nil
+	})
+}
+
+// ChargeGuests charges the Guests already in the Quota's Project to an unsaved
+// Quota, so a new Quota starts from what the Project uses. They are charged
+// regardless of the limits.
+func (q *Quota) ChargeGuests() error {
+	project := uuid.Parse(q.ProjectID)
+	err := q.context.ForEachGuest(func(g *Guest) error {
+		if !uuid.Equal(uuid.Parse(g.ProjectID), project) {
+			return nil
+		}
+		need, err := g.quotaUsage(g.FlavorID)
+		if err != nil {
+			return err
+		}
+		q.Usage = q.Usage.replace(q.Guests[g.ID], need)
+		q.Guests[g.ID] = need
+		return nil
+	})
+	if err != nil && !q.context.kv.IsKeyNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// setGuestUsage replaces the usage charged to a Guest. Growing a dimension
+// beyond its limit fails with ErrorQuotaExceeded, while shrinking always
+// succeeds.
+func (q *Quota) setGuestUsage(guestID string, need QuotaResources) error {
+	return q.casUpdate(func() error {
+		usage := q.Usage.replace(q.Guests[guestID], need)
+
+		current := q.Usage.dimensions()
+		limits := q.Limits.dimensions()
+		for dimension, n := range usage.dimensions() {
+			limit := limits[dimension]
+			if limit != 0 && n > limit && n > current[dimension] {
+				return ErrorQuotaExceeded{
+					ProjectID: q.ProjectID,
+					Dimension: dimension,
+					Limit:     limit,
+					Requested: n,
+				}
+			}
+		}
+
+		q.Usage = usage
+		q.Guests[guestID] = need
+		return nil
+	})
+}
+
+// removeGuest gives back the usage charged to a Guest.
+func (q *Quota) removeGuest(guestID string) error {
+	return q.casUpdate(func() error {
+		previous, ok := q.Guests[guestID]
+		if !ok {
+			return nil
+		}
+		q.Usage = q.Usage.replace(previous, QuotaResources{})
+		delete(q.Guests, guestID)
+		return nil
+	})
+}
+
+// quota returns the Quota of the Guest's Project, or nil if the Guest is not
+// limited by one.
+func (g *Guest) quota() (*Quota, error) {
+	if g.ProjectID == "" {
+		return nil, nil
+	}
+	q, err := g.context.Quota(g.ProjectID)
+	if err != nil {
+		if g.context.kv.IsKeyNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return q, nil
+}
+
+// quotaUsage returns what the Guest counts toward its Project's Quota with the
+// Flavor: itself, the Flavor's resources, the disk of its attached Volumes, and
+// an address on the network of each interface.
+func (g *Guest) quotaUsage(flavorID string) (QuotaResources, error) {
+	usage := QuotaResources{
+		Guests:    1,
+		Addresses: make(map[string]uint64),
+	}
+	if flavorID != "" {
+		f, err := g.context.Flavor(flavorID)
+		if err != nil {
+			return usage, err
+		}
+		usage.Memory = f.Memory
+		usage.Disk = f.Disk
+		usage.CPU = uint64(f.CPU)
+	}
+	volumes, err := g.Volumes()
+	if err != nil {
+		return usage, err
+	}
+	for _, v := range volumes {
+		usage.Disk += v.Size
+	}
+	for _, iface := range g.Interfaces {
+		if iface != nil && iface.NetworkID != "" {
+			usage.Addresses[iface.NetworkID]++
+		}
+	}
+	return usage, nil
+}
+
+// ChargeQuota charges the Guest, as it currently is, to its Project's Quota,
+// replacing what it was charged before. It fails with ErrorQuotaExceeded if the
+// Guest grows its Project beyond a limit.
+func (g *Guest) ChargeQuota() error {
+	q, err := g.quota()
+	if err != nil || q == nil {
+		return err
+	}
+	need, err := g.quotaUsage(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	return q.setGuestUsage(g.ID, need)
+}
+
+// chargeVolumeQuota charges the Guest to its Project's Quota with a Volume of
+// the size attached on top of its current disks. It fails with
+// ErrorQuotaExceeded if that grows its Project beyond a limit.
+func (g *Guest) chargeVolumeQuota(size uint64) error {
+	q, err := g.quota()
+	if err != nil || q == nil {
+		return err
+	}
+	need, err := g.quotaUsage(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	need.Disk += size
+	return q.setGuestUsage(g.ID, need)
+}
+
+// ChargeResizeQuota charges the Guest to its Project's Quota while it is
+// resized to the Flavor, with the larger of the two in each dimension so either
+// outcome is admitted. Completing or cancelling the resize charges only what
+// the Guest then has.
+func (g *Guest) ChargeResizeQuota(flavorID string) error {
+	q, err := g.quota()
+	if err != nil || q == nil {
+		return err
+	}
+	current, err := g.quotaUsage(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	next, err := g.quotaUsage(flavorID)
+	if err != nil {
+		return err
+	}
+	if next.Memory > current.Memory {
+		current.Memory = next.Memory
+	}
+	if next.Disk > current.Disk {
+		current.Disk = next.Disk
+	}
+	if next.CPU > current.CPU {
+		current.CPU = next.CPU
+	}
+	return q.setGuestUsage(g.ID, current)
+}
+
+// ReleaseQuota gives back what the Guest was charged to its Project's Quota.
+func (g *Guest) ReleaseQuota() error {
+	q, err := g.quota()
+	if err != nil || q == nil {
+		return err
+	}
+	return q.removeGuest(g.ID)
+}
@@ -0,0 +1,281 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestQuota(t *testing.T) {
+	suite.Run(t, new(QuotaSuite))
+}
+
+type QuotaSuite struct {
+	common.Suite
+}
+
+// newQuota creates and saves a Quota with the limits for a new Project
+func (s *QuotaSuite) newQuota(limits lochness.QuotaResources) *lochness.Quota {
+	q := s.Context.NewQuota(s.NewProject().ID)
+	q.Limits = limits
+	s.Require().NoError(q.Save())
+	return q
+}
+
+// newProjectGuest creates and saves a Guest in the Quota's Project
+func (s *QuotaSuite) newProjectGuest(q *lochness.Quota) *lochness.Guest {
+	guest := s.NewGuest()
+	guest.ProjectID = q.ProjectID
+	s.Require().NoError(guest.Save())
+	return guest
+}
+
+func (s *QuotaSuite) TestQuota() {
+	quota := s.newQuota(lochness.QuotaResources{Guests: 1})
+
+	tests := []struct {
+		description string
+		projectID   string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", uuid.New(), true},
+		{"real id", quota.ProjectID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		q, err := s.Context.Quota(test.projectID)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(q, msg("failure shouldn't return a quota"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.True(assert.ObjectsAreEqual(quota, q), msg("success should return correct data"))
+		}
+	}
+}
+
+func (s *QuotaSuite) TestValidate() {
+	tests := []struct {
+		description string
+		quota       *lochness.Quota
+		expectedErr bool
+	}{
+		{"missing project", &lochness.Quota{}, true},
+		{"invalid project", &lochness.Quota{ProjectID: "asdf"}, true},
+		{"invalid address network", &lochness.Quota{
+			ProjectID: uuid.New(),
+			Limits:    lochness.QuotaResources{Addresses: map[string]uint64{"asdf": 1}},
+		}, true},
+		{"valid", &lochness.Quota{ProjectID: uuid.New()}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.quota.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *QuotaSuite) TestSave() {
+	goodQuota := s.Context.NewQuota(uuid.New())
+
+	clobberQuota := *goodQuota
+	clobberQuota.Limits.Guests = 1
+
+	tests := []struct {
+		description string
+		quota       *lochness.Quota
+		expectedErr bool
+	}{
+		{"invalid quota", s.Context.NewQuota(""), true},
+		{"valid quota", goodQuota, false},
+		{"existing quota", goodQuota, false},
+		{"existing quota clobber changes", &clobberQuota, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.quota.Save()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *QuotaSuite) TestSetLimits() {
+	quota := s.newQuota(lochness.QuotaResources{Guests: 1})
+	stale := *quota
+
+	s.NoError(stale.SetLimits(lochness.QuotaResources{Memory: 1024}), "stale quota should be refreshed")
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(0), quota.Limits.Guests)
+	s.Equal(uint64(1024), quota.Limits.Memory)
+}
+
+func (s *QuotaSuite) TestChargeGuests() {
+	project := s.NewProject()
+	guest := s.NewGuest()
+	guest.ProjectID = project.ID
+	s.Require().NoError(guest.Save())
+	other := s.NewGuest()
+	other.ProjectID = s.NewProject().ID
+	s.Require().NoError(other.Save())
+	flavor, _ := s.Context.Flavor(guest.FlavorID)
+
+	q := s.Context.NewQuota(project.ID)
+	q.Limits = lochness.QuotaResources{Memory: 1}
+	s.NoError(q.ChargeGuests(), "should charge beyond the limits")
+	s.Equal(uint64(1), q.Usage.Guests)
+	s.Equal(flavor.Memory, q.Usage.Memory)
+	s.Contains(q.Guests, guest.ID)
+	s.NotContains(q.Guests, other.ID, "other projects' guests should not be charged")
+	s.NoError(q.Save())
+
+	s.Error(s.newProjectGuest(q).ChargeQuota(), "new guests should be charged on top of existing ones")
+}
+
+func (s *QuotaSuite) TestChargeQuota() {
+	// NewFlavor is 128 memory, 1024 disk, 1 cpu
+	quota := s.newQuota(lochness.QuotaResources{Guests: 2, Memory: 200})
+	first := s.newProjectGuest(quota)
+	second := s.newProjectGuest(quota)
+	third := s.newProjectGuest(quota)
+	network := first.Interfaces[0].NetworkID
+
+	s.NoError(first.ChargeQuota())
+	s.NoError(first.ChargeQuota(), "charging again should replace the charge")
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(1), quota.Usage.Guests)
+	s.Equal(uint64(128), quota.Usage.Memory)
+	s.Equal(uint64(1024), quota.Usage.Disk)
+	s.Equal(uint64(1), quota.Usage.CPU)
+	s.Equal(uint64(1), quota.Usage.Addresses[network])
+
+	err := second.ChargeQuota()
+	s.Error(err)
+	if exceeded, ok := err.(lochness.ErrorQuotaExceeded); s.True(ok, "should be a quota error") {
+		s.Equal("memory", exceeded.Dimension)
+		s.Equal(uint64(200), exceeded.Limit)
+		s.Equal(uint64(256), exceeded.Requested)
+	}
+
+	s.Require().NoError(quota.SetLimits(lochness.QuotaResources{Guests: 2}))
+	s.NoError(second.ChargeQuota())
+	err = third.ChargeQuota()
+	if exceeded, ok := err.(lochness.ErrorQuotaExceeded); s.True(ok, "should be a quota error") {
+		s.Equal("guests", exceeded.Dimension)
+	}
+
+	s.NoError(first.ReleaseQuota())
+	s.NoError(third.ChargeQuota(), "released usage should be admitted again")
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(2), quota.Usage.Guests)
+	s.Len(quota.Guests, 2)
+
+	// unowned guests are not limited
+	s.NoError(s.NewGuest().ChargeQuota())
+}
+
+func (s *QuotaSuite) TestAddressLimit() {
+	guest := s.NewGuest()
+	network := guest.Interfaces[0].NetworkID
+	quota := s.newQuota(lochness.QuotaResources{Addresses: map[string]uint64{network: 1}})
+	guest.ProjectID = quota.ProjectID
+	s.Require().NoError(guest.Save())
+
+	s.NoError(guest.ChargeQuota())
+	guest.AddInterface(network)
+	err := guest.ChargeQuota()
+	if exceeded, ok := err.(lochness.ErrorQuotaExceeded); s.True(ok, "should be a quota error") {
+		s.Equal("addresses:"+network, exceeded.Dimension)
+	}
+	guest.Interfaces[1].NetworkID = s.NewNetwork().ID
+	s.NoError(guest.ChargeQuota(), "other networks should not be limited")
+}
+
+func (s *QuotaSuite) TestResizeQuota() {
+	quota := s.newQuota(lochness.QuotaResources{Memory: 300})
+	_, guest := s.NewHypervisorWithGuest()
+	guest.ProjectID = quota.ProjectID
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	s.Require().NoError(guest.ChargeQuota())
+
+	bigger := s.NewFlavor()
+	bigger.Memory, bigger.Disk = 256, 2048
+	s.Require().NoError(bigger.Save())
+	huge := s.NewFlavor()
+	huge.Memory, huge.Disk = 512, 2048
+	s.Require().NoError(huge.Save())
+
+	s.Error(guest.ChargeResizeQuota(huge.ID), "should not exceed memory")
+	s.NoError(guest.ChargeResizeQuota(bigger.ID))
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(256), quota.Usage.Memory, "should charge the larger flavor")
+	s.Equal(uint64(2048), quota.Usage.Disk)
+
+	s.Require().NoError(guest.PrepareResize(bigger.ID))
+	s.NoError(guest.CancelResize())
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(128), quota.Usage.Memory, "cancelling should charge the current flavor")
+
+	s.NoError(guest.ChargeResizeQuota(bigger.ID))
+	s.Require().NoError(guest.PrepareResize(bigger.ID))
+	s.NoError(guest.CompleteResize(bigger.ID))
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(256), quota.Usage.Memory, "completing should charge the new flavor")
+}
+
+func (s *QuotaSuite) TestVolumeQuota() {
+	// NewFlavor and NewVolume are 1024 disk each
+	quota := s.newQuota(lochness.QuotaResources{Disk: 2500})
+	guest := s.newProjectGuest(quota)
+	s.Require().NoError(guest.ChargeQuota())
+	first := s.NewVolume()
+	second := s.NewVolume()
+
+	s.NoError(first.Attach(guest))
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(2048), quota.Usage.Disk, "attached volume should be charged")
+	s.NoError(guest.ChargeQuota(), "charging again should keep the volume")
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(2048), quota.Usage.Disk)
+
+	err := second.Attach(guest)
+	if exceeded, ok := err.(lochness.ErrorQuotaExceeded); s.True(ok, "should be a quota error") {
+		s.Equal("disk", exceeded.Dimension)
+		s.Equal(uint64(3072), exceeded.Requested)
+	}
+	s.Empty(second.GuestID, "volume beyond the quota should not attach")
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(2048), quota.Usage.Disk)
+
+	s.NoError(first.Detach())
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(1024), quota.Usage.Disk, "detached volume should no longer be charged")
+	s.NoError(second.Attach(guest), "released disk should be admitted again")
+}
+
+func (s *QuotaSuite) TestDestroyGuest() {
+	quota := s.newQuota(lochness.QuotaResources{Guests: 1})
+	guest := s.newProjectGuest(quota)
+	s.Require().NoError(guest.ChargeQuota())
+
+	s.NoError(guest.Destroy())
+	s.NoError(quota.Refresh())
+	s.Equal(uint64(0), quota.Usage.Guests, "destroying should release the guest")
+	s.Len(quota.Guests, 0)
+}
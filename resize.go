@@ -0,0 +1,146 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInsufficientResources is returned when a Hypervisor can not hold a Guest,
+// whether being added or at its new size
+var ErrInsufficientResources = errors.New("insufficient resources")
+
+// CanResize returns an error if the Guest can not be resized to the Flavor.
+// Memory and cpus may grow or shrink, but the disk may only grow.
+func (g *Guest) CanResize(flavorID string) error {
+	if g.HypervisorID == "" {
+		return errors.New("guest is not on a hypervisor")
+	}
+	if g.Migration != nil {
+		return fmt.Errorf("guest is migrating to hypervisor %s", g.Migration.HypervisorID)
+	}
+	switch g.State {
+	case "", GuestStateRunning, GuestStateStopped:
+	default:
+		return fmt.Errorf("guest can not resize while %s", g.State)
+	}
+
+	current, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	f, err := g.context.Flavor(flavorID)
+	if err != nil {
+		return err
+	}
+	if f.ID == current.ID {
+		return fmt.Errorf("guest already has flavor %s", f.ID)
+	}
+	if f.Disk < current.Disk {
+		return errors.New("flavor disk can not be smaller than the current disk")
+	}
+	return nil
+}
+
+// resizeReservation returns the resources reserved for a Guest while it is
+// resized between Flavors, the larger of the two in each dimension, so either
+// outcome fits
+func resizeReservation(from, to *Flavor) Resources {
+	r := flavorReservation(from)
+	next := flavorReservation(to)
+	if next.Memory > r.Memory {
+		r.Memory = next.Memory
+	}
+	if next.Disk > r.Disk {
+		r.Disk = next.Disk
+	}
+	if next.CPU > r.CPU {
+		r.CPU = next.CPU
+	}
+	return r
+}
+
+// setReservation replaces the resources reserved for a Guest, adjusting those
+// available by the difference. Growing the reservation fails with
+// ErrInsufficientResources if the Hypervisor does not have enough available.
+func (h *Hypervisor) setReservation(g *Guest, current, need Resources) error {
+	return h.casUpdate(func() error {
+		if r, ok := h.Reservations[g.ID]; ok {
+			current = r
+		}
+		avail := h.AvailableResources
+		avail.add(current)
+		if avail.Memory < need.Memory || avail.Disk < need.Disk || avail.CPU < need.CPU {
+			return ErrInsufficientResources
+		}
+		h.AvailableResources = Resources{
+			Memory: avail.Memory - need.Memory,
+			Disk:   avail.Disk - need.Disk,
+			CPU:    avail.CPU - need.CPU,
+		}
+		h.Reservations[g.ID] = need
+		return nil
+	})
+}
+
+// PrepareResize reserves what the Guest needs on its Hypervisor to be resized
+// to the Flavor. Nothing changes on the Guest until the resize is completed.
+// ErrInsufficientResources is returned if the Hypervisor can not hold it, in
+// which case it may be migrated to one that can with PrepareResizeMigration.
+func (g *Guest) PrepareResize(flavorID string) error {
+	if err := g.CanResize(flavorID); err != nil {
+		return err
+	}
+	current, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	f, err := g.context.Flavor(flavorID)
+	if err != nil {
+		return err
+	}
+	h, err := g.context.Hypervisor(g.HypervisorID)
+	if err != nil {
+		return err
+	}
+
+	return h.setReservation(g, flavorReservation(current), resizeReservation(current, f))
+}
+
+// CompleteResize gives the Guest the Flavor once its agent has resized it, and
+// reserves and charges to its Project's Quota only what the Flavor needs.
+func (g *Guest) CompleteResize(flavorID string) error {
+	f, err := g.context.Flavor(flavorID)
+	if err != nil {
+		return err
+	}
+	h, err := g.context.Hypervisor(g.HypervisorID)
+	if err != nil {
+		return err
+	}
+
+	g.FlavorID = f.ID
+	if err := g.Save(); err != nil {
+		return err
+	}
+	if err := h.setReservation(g, flavorReservation(f), flavorReservation(f)); err != nil {
+		return err
+	}
+	return g.ChargeQuota()
+}
+
+// CancelResize abandons resizing the Guest, reserving and charging to its
+// Project's Quota only what its current Flavor needs again.
+func (g *Guest) CancelResize() error {
+	current, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return err
+	}
+	h, err := g.context.Hypervisor(g.HypervisorID)
+	if err != nil {
+		return err
+	}
+	if err := h.setReservation(g, flavorReservation(current), flavorReservation(current)); err != nil {
+		return err
+	}
+	return g.ChargeQuota()
+}
@@ -0,0 +1,141 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestResize(t *testing.T) {
+	suite.Run(t, new(ResizeSuite))
+}
+
+type ResizeSuite struct {
+	common.Suite
+}
+
+// newFlavor creates and saves a Flavor with the resources
+func (s *ResizeSuite) newFlavor(memory, disk uint64, cpu uint32) *lochness.Flavor {
+	f := s.NewFlavor()
+	f.Resources = lochness.Resources{
+		Memory: memory,
+		Disk:   disk,
+		CPU:    cpu,
+	}
+	s.Require().NoError(f.Save())
+	return f
+}
+
+// newRunningGuest creates a running Guest placed on a new Hypervisor
+func (s *ResizeSuite) newRunningGuest() (*lochness.Hypervisor, *lochness.Guest) {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	return hypervisor, guest
+}
+
+func (s *ResizeSuite) TestCanResize() {
+	_, guest := s.newRunningGuest()
+	bigger := s.newFlavor(256, 2048, 2)
+	smallerDisk := s.newFlavor(256, 512, 2)
+
+	_, migrating := s.newRunningGuest()
+	s.Require().NoError(migrating.PrepareMigration(s.NewHypervisor()))
+
+	tests := []struct {
+		description string
+		guest       *lochness.Guest
+		state       string
+		flavorID    string
+		expectedErr bool
+	}{
+		{"unplaced", s.NewGuest(), lochness.GuestStatePending, bigger.ID, true},
+		{"provisioning", guest, lochness.GuestStateProvisioning, bigger.ID, true},
+		{"migrating", migrating, lochness.GuestStateRunning, bigger.ID, true},
+		{"nonexistent flavor", guest, lochness.GuestStateRunning, "foobar", true},
+		{"same flavor", guest, lochness.GuestStateRunning, guest.FlavorID, true},
+		{"smaller disk", guest, lochness.GuestStateRunning, smallerDisk.ID, true},
+		{"running", guest, lochness.GuestStateRunning, bigger.ID, false},
+		{"stopped", guest, lochness.GuestStateStopped, bigger.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		test.guest.State = test.state
+
+		err := test.guest.CanResize(test.flavorID)
+		if test.expectedErr {
+			s.Error(err, msg("should not resize"))
+		} else {
+			s.NoError(err, msg("should resize"))
+		}
+	}
+}
+
+func (s *ResizeSuite) TestCompleteResize() {
+	hypervisor, guest := s.newRunningGuest()
+	current := guest.FlavorID
+	flavor := s.newFlavor(256, 2048, 1)
+	s.Require().NoError(hypervisor.Refresh())
+	available := hypervisor.AvailableResources
+
+	s.Require().NoError(guest.PrepareResize(flavor.ID))
+	s.NoError(guest.Refresh())
+	s.Equal(current, guest.FlavorID, "guest should keep its flavor until resized")
+	s.NoError(hypervisor.Refresh())
+	s.Equal(lochness.Resources{Memory: 256, Disk: 2048, CPU: 1}, hypervisor.Reservations[guest.ID], "larger of both flavors should be reserved")
+	s.Equal(available.Memory-128, hypervisor.AvailableResources.Memory)
+
+	s.Require().NoError(guest.CompleteResize(flavor.ID))
+	s.NoError(guest.Refresh())
+	s.Equal(flavor.ID, guest.FlavorID)
+	s.NoError(hypervisor.Refresh())
+	s.Equal(flavor.Resources, hypervisor.Reservations[guest.ID])
+	s.Equal(available.Disk-1024, hypervisor.AvailableResources.Disk)
+}
+
+func (s *ResizeSuite) TestCancelResize() {
+	hypervisor, guest := s.newRunningGuest()
+	flavor := s.newFlavor(512, 1024, 4)
+	s.Require().NoError(hypervisor.Refresh())
+	available := hypervisor.AvailableResources
+	reserved := hypervisor.Reservations[guest.ID]
+
+	s.Require().NoError(guest.PrepareResize(flavor.ID))
+	s.Require().NoError(guest.CancelResize())
+
+	s.NoError(guest.Refresh())
+	s.NotEqual(flavor.ID, guest.FlavorID)
+	s.NoError(hypervisor.Refresh())
+	s.Equal(available, hypervisor.AvailableResources, "resources should be given back")
+	s.Equal(reserved, hypervisor.Reservations[guest.ID])
+}
+
+func (s *ResizeSuite) TestResizeInsufficientResources() {
+	hypervisor, guest := s.newRunningGuest()
+	flavor := s.newFlavor(256, 1024, 1)
+	s.Require().NoError(hypervisor.Refresh())
+	hypervisor.AvailableResources.Memory = 0
+	s.Require().NoError(hypervisor.Save())
+	available := hypervisor.AvailableResources
+
+	s.Equal(lochness.ErrInsufficientResources, guest.PrepareResize(flavor.ID))
+	s.NoError(hypervisor.Refresh())
+	s.Equal(available, hypervisor.AvailableResources, "failed resize should not change resources")
+
+	// migrating at the new size reserves it on the target
+	target := s.NewHypervisor()
+	subnet, err := s.Context.Subnet(guest.Interfaces[0].SubnetID)
+	s.Require().NoError(err)
+	s.Require().NoError(target.AddSubnet(subnet, "br1"))
+
+	s.Require().NoError(guest.PrepareResizeMigration(target, flavor.ID))
+	s.Equal(flavor.ID, guest.Migration.FlavorID)
+	s.NoError(target.Refresh())
+	s.Equal(flavor.Resources, target.Reservations[guest.ID])
+
+	s.Require().NoError(guest.CompleteMigration())
+	s.NoError(guest.PrepareResize(flavor.ID), "resize should fit on the target")
+}
@@ -0,0 +1,247 @@
+package lochness
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// PlacementWeightsConfig is the config store directory, relative to
+// ConfigPath, holding the weights of the placement Scorers keyed by name
+const PlacementWeightsConfig = "placement/weights"
+
+type (
+	// ScoreFunction is used to rank candidate Hypervisors for a Guest. It
+	// returns a score between 0 and 1 for each Hypervisor, in order. Higher
+	// scores are preferred.
+	ScoreFunction func(*Guest, Hypervisors) ([]float64, error)
+
+	// Scorer is a named, weighted ScoreFunction
+	Scorer struct {
+		Name   string
+		Weight float64
+		Score  ScoreFunction
+	}
+
+	// Scorers is an alias to a slice of Scorer
+	Scorers []Scorer
+)
+
+// DefaultScorers is a default list of Scorers for general use. Spreading
+// guests across hypervisors is preferred over packing them.
+var DefaultScorers = Scorers{
+	{Name: "least-allocated", Weight: 1, Score: ScoreLeastAllocated},
+	{Name: "most-allocated", Weight: 0, Score: ScoreMostAllocated},
+	{Name: "fewest-guests", Weight: 0.5, Score: ScoreFewestGuests},
+	{Name: "image-cached", Weight: 0.5, Score: ScoreImageCached},
+	{Name: "affinity", Weight: 1, Score: ScoreAffinity},
+	{Name: "zone-spread", Weight: 1, Score: ScoreZoneSpread},
+	{Name: "tolerated", Weight: 1, Score: ScoreTolerated},
+}
+
+// fraction returns part/total clamped between 0 and 1
+func fraction(part, total float64) float64 {
+	if total <= 0 || part <= 0 {
+		return 0
+	}
+	if part >= total {
+		return 1
+	}
+	return part / total
+}
+
+// remaining returns the fraction of a Hypervisor's resources that would remain
+// available after placing a Guest needing need
+func remaining(h *Hypervisor, need Resources) float64 {
+	total, avail := h.TotalResources, h.AvailableResources
+	return (fraction(float64(avail.Memory)-float64(need.Memory), float64(total.Memory)) +
+		fraction(float64(avail.Disk)-float64(need.Disk), float64(total.Disk)) +
+		fraction(float64(avail.CPU)-float64(need.CPU), float64(total.CPU))) / 3
+}
+
+// ScoreLeastAllocated prefers Hypervisors with the largest share of their
+// memory, disk, and cpu left available after placing the Guest.
+func ScoreLeastAllocated(g *Guest, hs Hypervisors) ([]float64, error) {
+	need, err := g.requiredResources()
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float64, len(hs))
+	for i, h := range hs {
+		scores[i] = remaining(h, need)
+	}
+	return scores, nil
+}
+
+// ScoreMostAllocated prefers Hypervisors with the smallest share of their
+// memory, disk, and cpu left available after placing the Guest, packing guests
+// onto as few Hypervisors as possible.
+func ScoreMostAllocated(g *Guest, hs Hypervisors) ([]float64, error) {
+	scores, err := ScoreLeastAllocated(g, hs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range scores {
+		scores[i] = 1 - scores[i]
+	}
+	return scores, nil
+}
+
+// ScoreFewestGuests prefers Hypervisors running fewer Guests.
+func ScoreFewestGuests(g *Guest, hs Hypervisors) ([]float64, error) {
+	most := 0
+	for _, h := range hs {
+		if n := len(h.Guests()); n > most {
+			most = n
+		}
+	}
+
+	scores := make([]float64, len(hs))
+	for i, h := range hs {
+		scores[i] = 1 - fraction(float64(len(h.Guests())), float64(most))
+	}
+	return scores, nil
+}
+
+// ScoreImageCached prefers Hypervisors already running a Guest with the same
+// image, which will not need to fetch it.
+func ScoreImageCached(g *Guest, hs Hypervisors) ([]float64, error) {
+	f, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the hypervisors holding the image in one pass over the guests rather
+	// than loading the guests of each candidate
+	images := map[string]string{f.ID: f.Image} // many guests share few flavors
+	cached := make(map[string]bool)
+	err = g.context.ForEachGuest(func(guest *Guest) error {
+		if guest.ID == g.ID || guest.HypervisorID == "" || cached[guest.HypervisorID] {
+			return nil
+		}
+		image, ok := images[guest.FlavorID]
+		if !ok {
+			flavor, err := g.context.Flavor(guest.FlavorID)
+			if err != nil {
+				return err
+			}
+			image = flavor.Image
+			images[guest.FlavorID] = image
+		}
+		if image == f.Image {
+			cached[guest.HypervisorID] = true
+		}
+		return nil
+	})
+	if err != nil && !g.context.kv.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	scores := make([]float64, len(hs))
+	for i, h := range hs {
+		if cached[h.ID] {
+			scores[i] = 1
+		}
+	}
+	return scores, nil
+}
+
+// PlacementScorers returns the DefaultScorers with any weights set in the
+// config store under PlacementWeightsConfig applied.
+func (c *Context) PlacementScorers() (Scorers, error) {
+	scorers := make(Scorers, len(DefaultScorers))
+	copy(scorers, DefaultScorers)
+
+	for i, s := range scorers {
+		value, err := c.GetConfig(filepath.Join(PlacementWeightsConfig, s.Name))
+		if err != nil {
+			if c.kv.IsKeyNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight for scorer %s: %s", s.Name, err)
+		}
+		scorers[i].Weight = weight
+	}
+	return scorers, nil
+}
+
+// Rank orders the Hypervisors by the weighted sum of their Scorer scores,
+// best first. Hypervisors with equal totals keep their relative order.
+func (g *Guest) Rank(hs Hypervisors, scorers Scorers) (Hypervisors, error) {
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "Rank",
+	}
+
+	totals := make(map[string]float64, len(hs))
+	for _, s := range scorers {
+		if s.Weight == 0 {
+			continue
+		}
+		scores, err := s.Score(g, hs)
+		if err != nil {
+			return nil, err
+		}
+		if len(scores) != len(hs) {
+			return nil, fmt.Errorf("scorer %s returned %d scores for %d hypervisors", s.Name, len(scores), len(hs))
+		}
+		for i, h := range hs {
+			totals[h.ID] += s.Weight * scores[i]
+		}
+	}
+
+	ranked := make(Hypervisors, len(hs))
+	copy(ranked, hs)
+	sort.Stable(byScore{ranked, totals})
+
+	for _, h := range ranked {
+		log.WithFields(logFields).WithFields(log.Fields{
+			"hypervisorID": h.ID,
+			"score":        totals[h.ID],
+		}).Debug("hypervisor candidate scored")
+	}
+
+	return ranked, nil
+}
+
+// RankedCandidates returns the candidate Hypervisors for the Guest, filtered by
+// the CandidateFunctions and then ranked by the configured PlacementScorers.
+func (g *Guest) RankedCandidates(f ...CandidateFunction) (Hypervisors, error) {
+	candidates, err := g.Candidates(f...)
+	if err != nil {
+		return nil, err
+	}
+
+	scorers, err := g.context.PlacementScorers()
+	if err != nil {
+		return nil, err
+	}
+
+	return g.Rank(candidates, scorers)
+}
+
+// byScore sorts Hypervisors by descending score
+type byScore struct {
+	hs     Hypervisors
+	scores map[string]float64
+}
+
+func (b byScore) Len() int {
+	return len(b.hs)
+}
+
+func (b byScore) Less(i, j int) bool {
+	return b.scores[b.hs[i].ID] > b.scores[b.hs[j].ID]
+}
+
+func (b byScore) Swap(i, j int) {
+	b.hs[i], b.hs[j] = b.hs[j], b.hs[i]
+}
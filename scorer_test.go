@@ -0,0 +1,189 @@
+package lochness_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestScorer(t *testing.T) {
+	suite.Run(t, new(ScorerSuite))
+}
+
+type ScorerSuite struct {
+	common.Suite
+}
+
+func (s *ScorerSuite) TestScoreAllocated() {
+	guest := s.NewGuest()
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+	}
+	hypervisors[1].AvailableResources = lochness.Resources{
+		Memory: hypervisors[1].TotalResources.Memory / 2,
+		Disk:   hypervisors[1].TotalResources.Disk / 2,
+		CPU:    hypervisors[1].TotalResources.CPU / 2,
+	}
+	hypervisors[2].TotalResources = lochness.Resources{}
+	hypervisors[2].AvailableResources = lochness.Resources{}
+
+	least, err := lochness.ScoreLeastAllocated(guest, hypervisors)
+	s.NoError(err)
+	s.Len(least, 3)
+	s.True(least[0] > least[1], "emptier hypervisor should score higher")
+	s.True(least[0] < 1, "guest resources should count as allocated")
+	s.Equal(0.0, least[2], "hypervisor without resources should score 0")
+
+	most, err := lochness.ScoreMostAllocated(guest, hypervisors)
+	s.NoError(err)
+	s.Len(most, 3)
+	s.True(most[1] > most[0], "fuller hypervisor should score higher")
+	for i := range most {
+		s.InDelta(1, least[i]+most[i], 0.0001)
+	}
+}
+
+func (s *ScorerSuite) TestScoreFewestGuests() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	hypervisors := lochness.Hypervisors{
+		hypervisor,
+		s.NewHypervisor(),
+	}
+
+	scores, err := lochness.ScoreFewestGuests(guest, hypervisors)
+	s.NoError(err)
+	s.Equal([]float64{0, 1}, scores)
+
+	scores, err = lochness.ScoreFewestGuests(guest, hypervisors[1:])
+	s.NoError(err)
+	s.Equal([]float64{1}, scores, "no guests anywhere should score 1")
+}
+
+func (s *ScorerSuite) TestScoreImageCached() {
+	hypervisor, existing := s.NewHypervisorWithGuest()
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		hypervisor,
+	}
+
+	sameImage := s.NewGuest()
+	flavor, err := s.Context.Flavor(sameImage.FlavorID)
+	s.Require().NoError(err)
+	existingFlavor, err := s.Context.Flavor(existing.FlavorID)
+	s.Require().NoError(err)
+	flavor.Image = existingFlavor.Image
+	s.Require().NoError(flavor.Save())
+
+	tests := []struct {
+		description string
+		guest       *lochness.Guest
+		expected    []float64
+	}{
+		{"different image", s.NewGuest(), []float64{0, 0}},
+		{"same flavor", existing, []float64{0, 0}},
+		{"same image", sameImage, []float64{0, 1}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		scores, err := lochness.ScoreImageCached(test.guest, hypervisors)
+		s.NoError(err, msg("should succeed"))
+		s.Equal(test.expected, scores, msg("unexpected scores"))
+	}
+}
+
+func (s *ScorerSuite) TestPlacementScorers() {
+	scorers, err := s.Context.PlacementScorers()
+	s.NoError(err)
+	s.Equal(len(lochness.DefaultScorers), len(scorers))
+	for i, scorer := range scorers {
+		s.Equal(lochness.DefaultScorers[i].Name, scorer.Name)
+		s.Equal(lochness.DefaultScorers[i].Weight, scorer.Weight, "default weights should be used")
+	}
+
+	s.Require().NoError(s.Context.SetConfig("placement/weights/most-allocated", "2.5"))
+	scorers, err = s.Context.PlacementScorers()
+	s.NoError(err)
+	for _, scorer := range scorers {
+		if scorer.Name == "most-allocated" {
+			s.Equal(2.5, scorer.Weight, "configured weight should be used")
+		}
+	}
+	for _, scorer := range lochness.DefaultScorers {
+		if scorer.Name == "most-allocated" {
+			s.Equal(0.0, scorer.Weight, "defaults should not be changed")
+		}
+	}
+
+	s.Require().NoError(s.Context.SetConfig("placement/weights/most-allocated", "foobar"))
+	_, err = s.Context.PlacementScorers()
+	s.Error(err, "invalid weight should fail")
+}
+
+func (s *ScorerSuite) TestRank() {
+	guest := s.NewGuest()
+	hypervisors := lochness.Hypervisors{
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+		s.NewHypervisor(),
+	}
+
+	fixed := func(scores ...float64) lochness.ScoreFunction {
+		return func(g *lochness.Guest, hs lochness.Hypervisors) ([]float64, error) {
+			return scores, nil
+		}
+	}
+	failing := func(g *lochness.Guest, hs lochness.Hypervisors) ([]float64, error) {
+		return nil, errors.New("failed")
+	}
+
+	tests := []struct {
+		description string
+		scorers     lochness.Scorers
+		expected    []int
+		expectedErr bool
+	}{
+		{"no scorers", lochness.Scorers{}, []int{0, 1, 2}, false},
+		{"single scorer", lochness.Scorers{{Name: "a", Weight: 1, Score: fixed(0.1, 0.9, 0.5)}}, []int{1, 2, 0}, false},
+		{"weighted scorers", lochness.Scorers{
+			{Name: "a", Weight: 1, Score: fixed(0.1, 0.9, 0.5)},
+			{Name: "b", Weight: 2, Score: fixed(1, 0, 0.5)},
+		}, []int{0, 2, 1}, false},
+		{"ties keep order", lochness.Scorers{{Name: "a", Weight: 1, Score: fixed(0.5, 1, 0.5)}}, []int{1, 0, 2}, false},
+		{"zero weight", lochness.Scorers{{Name: "a", Weight: 0, Score: failing}}, []int{0, 1, 2}, false},
+		{"failing scorer", lochness.Scorers{{Name: "a", Weight: 1, Score: failing}}, nil, true},
+		{"wrong score count", lochness.Scorers{{Name: "a", Weight: 1, Score: fixed(1)}}, nil, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		ranked, err := guest.Rank(hypervisors, test.scorers)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			continue
+		}
+		s.NoError(err, msg("should succeed"))
+		s.Len(ranked, len(test.expected), msg("should not filter"))
+		for i, j := range test.expected {
+			s.Equal(hypervisors[j].ID, ranked[i].ID, msg("unexpected order"))
+		}
+	}
+}
+
+func (s *ScorerSuite) TestRankedCandidates() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	_, err := lochness.SetHypervisorID(hypervisor.ID)
+	s.Require().NoError(err)
+	s.Require().NoError(hypervisor.Heartbeat(60 * time.Second))
+
+	candidates, err := guest.RankedCandidates(lochness.CandidateIsAlive)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	s.Equal(hypervisor.ID, candidates[0].ID)
+}
@@ -0,0 +1,206 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Selector operators
+const (
+	SelectorEquals    = "="
+	SelectorNotEquals = "!="
+	SelectorIn        = "in"
+	SelectorNotIn     = "notin"
+	SelectorExists    = "exists"
+	SelectorNotExists = "!"
+)
+
+const (
+	// selectorDoubleEquals is accepted as an alias of SelectorEquals
+	selectorDoubleEquals = "=="
+	// selectorSpecials may not appear in label keys or values
+	selectorSpecials = ",=!() \t\n"
+)
+
+type (
+	// Requirement is a single condition on a label. Values holds the single
+	// value for equality operators, the set for set operators, and is empty
+	// for existence operators.
+	Requirement struct {
+		Key      string
+		Operator string
+		Values   []string
+	}
+
+	// Selector is a set of Requirements that must all match. An empty
+	// Selector matches everything.
+	Selector []Requirement
+)
+
+// setRequirementRegexp matches `key in (a,b)` and `key notin (a,b)`
+var setRequirementRegexp = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// ParseSelector parses a comma separated list of label requirements. Each
+// requirement is one of:
+//
+//	key=value, key==value, key!=value
+//	key in (value1,value2), key notin (value1,value2)
+//	key, !key
+func ParseSelector(s string) (Selector, error) {
+	s = strings.TrimSpace(s)
+	sel := Selector{}
+	if s == "" {
+		return sel, nil
+	}
+
+	parts, err := splitRequirements(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, req)
+	}
+	return sel, nil
+}
+
+// splitRequirements splits a selector on the commas outside of parentheses
+func splitRequirements(s string) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+			if depth > 1 {
+				return nil, errors.New("nested parentheses in selector")
+			}
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses in selector")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("unbalanced parentheses in selector")
+	}
+	return append(parts, s[start:]), nil
+}
+
+// parseRequirement parses a single requirement
+func parseRequirement(s string) (Requirement, error) {
+	s = strings.TrimSpace(s)
+	req := Requirement{}
+
+	if m := setRequirementRegexp.FindStringSubmatch(s); m != nil {
+		req.Key, req.Operator = m[1], m[2]
+		for _, v := range strings.Split(m[3], ",") {
+			req.Values = append(req.Values, strings.TrimSpace(v))
+		}
+	} else if i := strings.Index(s, SelectorNotEquals); i >= 0 {
+		req.Key, req.Operator = strings.TrimSpace(s[:i]), SelectorNotEquals
+		req.Values = []string{strings.TrimSpace(s[i+len(SelectorNotEquals):])}
+	} else if i := strings.Index(s, selectorDoubleEquals); i >= 0 {
+		req.Key, req.Operator = strings.TrimSpace(s[:i]), SelectorEquals
+		req.Values = []string{strings.TrimSpace(s[i+len(selectorDoubleEquals):])}
+	} else if i := strings.Index(s, SelectorEquals); i >= 0 {
+		req.Key, req.Operator = strings.TrimSpace(s[:i]), SelectorEquals
+		req.Values = []string{strings.TrimSpace(s[i+len(SelectorEquals):])}
+	} else if strings.HasPrefix(s, SelectorNotExists) {
+		req.Key, req.Operator = strings.TrimSpace(s[len(SelectorNotExists):]), SelectorNotExists
+	} else {
+		req.Key, req.Operator = s, SelectorExists
+	}
+
+	if req.Key == "" || strings.ContainsAny(req.Key, selectorSpecials) {
+		return req, fmt.Errorf("invalid label key in requirement %q", s)
+	}
+	for _, v := range req.Values {
+		if strings.ContainsAny(v, selectorSpecials) {
+			return req, fmt.Errorf("invalid label value in requirement %q", s)
+		}
+	}
+	return req, nil
+}
+
+// Matches returns whether the labels meet the Requirement. As with a missing
+// key, an inequality is met by any other value.
+func (r Requirement) Matches(labels map[string]string) bool {
+	value, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorEquals:
+		return ok && value == r.Values[0]
+	case SelectorNotEquals:
+		return !ok || value != r.Values[0]
+	case SelectorIn:
+		return ok && r.hasValue(value)
+	case SelectorNotIn:
+		return !ok || !r.hasValue(value)
+	case SelectorExists:
+		return ok
+	case SelectorNotExists:
+		return !ok
+	}
+	return false
+}
+
+// hasValue returns whether value is one of the Requirement's values
+func (r Requirement) hasValue(value string) bool {
+	for _, v := range r.Values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the Requirement as it would be parsed
+func (r Requirement) String() string {
+	switch r.Operator {
+	case SelectorEquals, SelectorNotEquals:
+		return r.Key + r.Operator + r.Values[0]
+	case SelectorIn, SelectorNotIn:
+		values := append([]string{}, r.Values...)
+		sort.Strings(values)
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(values, ","))
+	case SelectorNotExists:
+		return SelectorNotExists + r.Key
+	}
+	return r.Key
+}
+
+// Matches returns whether the labels meet every Requirement of the Selector.
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, r := range sel {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+// Empty returns whether the Selector has no Requirements.
+func (sel Selector) Empty() bool {
+	return len(sel) == 0
+}
+
+// String formats the Selector as it would be parsed
+func (sel Selector) String() string {
+	reqs := make([]string, len(sel))
+	for i, r := range sel {
+		reqs[i] = r.String()
+	}
+	return strings.Join(reqs, ",")
+}
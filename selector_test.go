@@ -0,0 +1,89 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestSelector(t *testing.T) {
+	suite.Run(t, new(SelectorSuite))
+}
+
+type SelectorSuite struct {
+	suite.Suite
+}
+
+func (s *SelectorSuite) TestParseSelector() {
+	tests := []struct {
+		description string
+		selector    string
+		expected    string
+		expectedErr bool
+	}{
+		{"empty", "", "", false},
+		{"equals", "app=web", "app=web", false},
+		{"double equals", "app == web", "app=web", false},
+		{"not equals", "app!=web", "app!=web", false},
+		{"empty value", "app=", "app=", false},
+		{"in", "env in (prod, staging)", "env in (prod,staging)", false},
+		{"notin", "env notin (dev)", "env notin (dev)", false},
+		{"exists", "app", "app", false},
+		{"not exists", "!app", "!app", false},
+		{"multiple", "app=web, env in (prod,staging),!canary", "app=web,env in (prod,staging),!canary", false},
+		{"missing key", "=web", "", true},
+		{"bad key", "a pp=web", "", true},
+		{"bad value", "app=w(eb", "", true},
+		{"unbalanced", "env in (prod", "", true},
+		{"nested", "env in ((prod))", "", true},
+		{"empty requirement", "app=web,", "", true},
+	}
+
+	for _, test := range tests {
+		sel, err := lochness.ParseSelector(test.selector)
+		if test.expectedErr {
+			s.Error(err, test.description)
+		} else {
+			s.NoError(err, test.description)
+			s.Equal(test.expected, sel.String(), test.description)
+		}
+	}
+}
+
+func (s *SelectorSuite) TestMatches() {
+	labels := map[string]string{
+		"app": "web",
+		"env": "prod",
+	}
+
+	tests := []struct {
+		selector string
+		expected bool
+	}{
+		{"", true},
+		{"app=web", true},
+		{"app=db", false},
+		{"app!=db", true},
+		{"app!=web", false},
+		{"tier!=front", true},
+		{"env in (prod,staging)", true},
+		{"env in (dev)", false},
+		{"tier in (front)", false},
+		{"env notin (dev)", true},
+		{"env notin (prod)", false},
+		{"tier notin (front)", true},
+		{"app", true},
+		{"tier", false},
+		{"!tier", true},
+		{"!app", false},
+		{"app=web,env=prod", true},
+		{"app=web,env=dev", false},
+	}
+
+	for _, test := range tests {
+		sel, err := lochness.ParseSelector(test.selector)
+		s.Require().NoError(err, test.selector)
+		s.Equal(test.expected, sel.Matches(labels), test.selector)
+	}
+}
@@ -0,0 +1,336 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// SnapshotPath is the path in the config store
+	SnapshotPath = "lochness/snapshots/"
+)
+
+// Snapshot statuses
+const (
+	SnapshotStatusPending  = "pending"  // being taken by the agent
+	SnapshotStatusCreated  = "created"  // taken and ready to roll back to
+	SnapshotStatusDeleting = "deleting" // being deleted by the agent
+)
+
+type (
+	// Snapshot is a point in time copy of a guest's disks, kept on its
+	// hypervisor
+	Snapshot struct {
+		context       *Context
+		modifiedIndex uint64
+		ID            string            `json:"id"`
+		Name          string            `json:"name"`
+		Metadata      map[string]string `json:"metadata"`
+		GuestID       string            `json:"guest"`      // guest the snapshot is of
+		HypervisorID  string            `json:"hypervisor"` // hypervisor holding the snapshot
+		FlavorID      string            `json:"flavor"`     // guest flavor when taken
+		Size          uint64            `json:"size"`       // disk usage in MB, once created
+		Status        string            `json:"status"`
+		CreatedAt     time.Time         `json:"created_at"`
+	}
+
+	// Snapshots is an alias to a slice of *Snapshot
+	Snapshots []*Snapshot
+)
+
+// Snapshot fetches a single Snapshot from the config store
+func (c *Context) Snapshot(id string) (*Snapshot, error) {
+	var err error
+	id, err = canonicalizeUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		context: c,
+		ID:      id,
+	}
+
+	err = s.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// key is a helper to generate the config store key
+func (s *Snapshot) key() string {
+	return filepath.Join(SnapshotPath, s.ID, "metadata")
+}
+
+// hypervisorKey is a helper to generate the config store key linking the
+// Snapshot to its Hypervisor
+func (s *Snapshot) hypervisorKey() string {
+	return filepath.Join(HypervisorPath, s.HypervisorID, "snapshots", s.ID)
+}
+
+// guestKey is a helper to generate the config store key linking the Snapshot
+// to its Guest
+func (s *Snapshot) guestKey() string {
+	return filepath.Join(GuestPath, s.GuestID, "snapshots", s.ID)
+}
+
+// fromResponse is a helper to unmarshal a Snapshot
+func (s *Snapshot) fromResponse(value kv.Value) error {
+	s.modifiedIndex = value.Index
+	return json.Unmarshal(value.Data, &s)
+}
+
+// Refresh reloads from the data store
+func (s *Snapshot) Refresh() error {
+	resp, err := s.context.kv.Get(s.key())
+
+	if err != nil {
+		return err
+	}
+
+	return s.fromResponse(resp)
+}
+
+// Validate ensures a Snapshot has reasonable data.
+func (s *Snapshot) Validate() error {
+	if _, err := canonicalizeUUID(s.ID); err != nil {
+		return errors.New("missing or invalid id")
+	}
+	if _, err := canonicalizeUUID(s.GuestID); err != nil {
+		return errors.New("missing or invalid guest")
+	}
+	if _, err := canonicalizeUUID(s.HypervisorID); err != nil {
+		return errors.New("missing or invalid hypervisor")
+	}
+	switch s.Status {
+	case SnapshotStatusPending, SnapshotStatusCreated, SnapshotStatusDeleting:
+	default:
+		return errors.New("invalid status")
+	}
+	return nil
+}
+
+// Save persists a Snapshot.
+// It will call Validate.
+func (s *Snapshot) Save() error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	before, err := s.context.auditSaved(s.key())
+	if err != nil {
+		return err
+	}
+
+	index, err := s.context.kv.Update(s.key(), kv.Value{Data: value, Index: s.modifiedIndex})
+	if err != nil {
+		return err
+	}
+	s.modifiedIndex = index
+	s.context.recordChange("snapshot", s.ID, before, value)
+
+	if err := s.context.kv.Set(s.guestKey(), ""); err != nil {
+		return err
+	}
+	return s.context.kv.Set(s.hypervisorKey(), "")
+}
+
+// Destroy removes a Snapshot. The disk it used is given back to its Hypervisor
+// by the next UpdateResources, which recalculates usage from the Snapshots
+// left; crediting it here as well could count it twice.
+func (s *Snapshot) Destroy() error {
+	if s.modifiedIndex == 0 {
+		// it has not been saved?
+		return errors.New("not persisted")
+	}
+
+	before, err := s.context.auditSaved(s.key())
+	if err != nil {
+		return err
+	}
+	if err := s.context.kv.Remove(s.key(), s.modifiedIndex); err != nil {
+		return err
+	}
+	s.context.recordChange("snapshot", s.ID, before, nil)
+	for _, key := range []string{s.guestKey(), s.hypervisorKey()} {
+		if err := s.context.kv.Delete(key, false); err != nil && !s.context.kv.IsKeyNotFound(err) {
+			return err
+		}
+	}
+	return s.context.kv.Delete(filepath.Join(SnapshotPath, s.ID), true)
+}
+
+// Complete marks the Snapshot created once its agent has taken it, and takes
+// the disk it uses from those available on its Hypervisor.
+func (s *Snapshot) Complete(size uint64) error {
+	if s.Status != SnapshotStatusPending {
+		return fmt.Errorf("snapshot is %s", s.Status)
+	}
+	h, err := s.context.Hypervisor(s.HypervisorID)
+	if err != nil {
+		return err
+	}
+
+	s.Status = SnapshotStatusCreated
+	s.Size = size
+	if err := s.Save(); err != nil {
+		return err
+	}
+	return h.casUpdate(func() error {
+		h.AvailableResources.Disk = remainder(h.AvailableResources.Disk, size)
+		return nil
+	})
+}
+
+// SetDeleting marks the Snapshot as being deleted. Only created Snapshots may
+// be deleted.
+func (s *Snapshot) SetDeleting() error {
+	if s.Status != SnapshotStatusCreated {
+		return fmt.Errorf("snapshot is %s", s.Status)
+	}
+	s.Status = SnapshotStatusDeleting
+	return s.Save()
+}
+
+// CanRollback returns an error if the Guest can not be rolled back to the
+// Snapshot. The Guest must still be on the Hypervisor holding the Snapshot,
+// with the Flavor it had when the Snapshot was taken.
+func (s *Snapshot) CanRollback(g *Guest) error {
+	if s.GuestID != g.ID {
+		return errors.New("snapshot is not of guest")
+	}
+	if s.Status != SnapshotStatusCreated {
+		return fmt.Errorf("snapshot is %s", s.Status)
+	}
+	if err := g.CanSnapshot(); err != nil {
+		return err
+	}
+	if g.HypervisorID != s.HypervisorID {
+		return errors.New("snapshot is not on the guest's hypervisor")
+	}
+	if g.FlavorID != s.FlavorID {
+		return errors.New("guest flavor has changed since the snapshot")
+	}
+	return nil
+}
+
+// CanSnapshot returns an error if the Guest can not be snapshotted or rolled
+// back.
+func (g *Guest) CanSnapshot() error {
+	if g.HypervisorID == "" {
+		return errors.New("guest is not on a hypervisor")
+	}
+	if g.Migration != nil {
+		return fmt.Errorf("guest is migrating to hypervisor %s", g.Migration.HypervisorID)
+	}
+	switch g.State {
+	case "", GuestStateRunning, GuestStateStopped:
+	default:
+		return fmt.Errorf("guest can not snapshot while %s", g.State)
+	}
+	return nil
+}
+
+// NewSnapshot creates and saves a pending Snapshot of the Guest on its
+// Hypervisor. The agent takes it separately.
+func (g *Guest) NewSnapshot(name string) (*Snapshot, error) {
+	if err := g.CanSnapshot(); err != nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		context:      g.context,
+		ID:           uuid.New(),
+		Name:         name,
+		Metadata:     make(map[string]string),
+		GuestID:      g.ID,
+		HypervisorID: g.HypervisorID,
+		FlavorID:     g.FlavorID,
+		Status:       SnapshotStatusPending,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Snapshots returns the Snapshots of the Guest, oldest first.
+func (g *Guest) Snapshots() (Snapshots, error) {
+	keys, err := g.context.kv.Keys(filepath.Join(GuestPath, g.ID, "snapshots"))
+	if err != nil {
+		if g.context.kv.IsKeyNotFound(err) {
+			return Snapshots{}, nil
+		}
+		return nil, err
+	}
+
+	snapshots := make(Snapshots, 0, len(keys))
+	for _, k := range keys {
+		s, err := g.context.Snapshot(filepath.Base(k))
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	sort.Sort(snapshotsByAge(snapshots))
+	return snapshots, nil
+}
+
+// ExpiredSnapshots returns the created Snapshots of the Guest beyond its
+// SnapshotLimit, oldest first. Snapshots still being taken or deleted do not
+// count toward the limit.
+func (g *Guest) ExpiredSnapshots() (Snapshots, error) {
+	if g.SnapshotLimit <= 0 {
+		return Snapshots{}, nil
+	}
+	snapshots, err := g.Snapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(Snapshots, 0, len(snapshots))
+	for _, s := range snapshots {
+		if s.Status == SnapshotStatusCreated {
+			created = append(created, s)
+		}
+	}
+	if len(created) <= g.SnapshotLimit {
+		return Snapshots{}, nil
+	}
+	return created[:len(created)-g.SnapshotLimit], nil
+}
+
+// destroySnapshots removes all of the Guest's Snapshots, such as when it is
+// deleted from its Hypervisor along with them.
+func (g *Guest) destroySnapshots() error {
+	snapshots, err := g.Snapshots()
+	if err != nil {
+		return err
+	}
+	for _, s := range snapshots {
+		if err := s.Destroy(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshotsByAge sorts Snapshots oldest first
+type snapshotsByAge Snapshots
+
+func (s snapshotsByAge) Len() int           { return len(s) }
+func (s snapshotsByAge) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s snapshotsByAge) Less(i, j int) bool { return s[i].CreatedAt.Before(s[j].CreatedAt) }
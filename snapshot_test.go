@@ -0,0 +1,209 @@
+package lochness_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestSnapshot(t *testing.T) {
+	suite.Run(t, new(SnapshotSuite))
+}
+
+type SnapshotSuite struct {
+	common.Suite
+}
+
+// newRunningGuest creates a running Guest placed on a new Hypervisor
+func (s *SnapshotSuite) newRunningGuest() (*lochness.Hypervisor, *lochness.Guest) {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	guest.State = lochness.GuestStateRunning
+	s.Require().NoError(guest.Save())
+	return hypervisor, guest
+}
+
+func (s *SnapshotSuite) TestSnapshot() {
+	_, guest := s.newRunningGuest()
+	snapshot, err := guest.NewSnapshot("first")
+	s.Require().NoError(err)
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", uuid.New(), true},
+		{"real id", snapshot.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		sn, err := s.Context.Snapshot(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(sn, msg("failure shouldn't return a snapshot"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.Equal(snapshot.Name, sn.Name, msg("success should return correct data"))
+			s.Equal(guest.FlavorID, sn.FlavorID, msg("snapshot should record the flavor"))
+			s.Equal(lochness.SnapshotStatusPending, sn.Status, msg("new snapshot should be pending"))
+		}
+	}
+}
+
+func (s *SnapshotSuite) TestValidate() {
+	tests := []struct {
+		description string
+		snapshot    *lochness.Snapshot
+		expectedErr bool
+	}{
+		{"missing id", &lochness.Snapshot{}, true},
+		{"missing guest", &lochness.Snapshot{ID: uuid.New()}, true},
+		{"missing hypervisor", &lochness.Snapshot{ID: uuid.New(), GuestID: uuid.New()}, true},
+		{"invalid status", &lochness.Snapshot{ID: uuid.New(), GuestID: uuid.New(), HypervisorID: uuid.New(), Status: "asdf"}, true},
+		{"valid", &lochness.Snapshot{ID: uuid.New(), GuestID: uuid.New(), HypervisorID: uuid.New(), Status: lochness.SnapshotStatusCreated}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.snapshot.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *SnapshotSuite) TestNewSnapshot() {
+	_, guest := s.newRunningGuest()
+
+	tests := []struct {
+		description string
+		guest       *lochness.Guest
+		state       string
+		expectedErr bool
+	}{
+		{"unplaced", s.NewGuest(), lochness.GuestStatePending, true},
+		{"provisioning", guest, lochness.GuestStateProvisioning, true},
+		{"running", guest, lochness.GuestStateRunning, false},
+		{"stopped", guest, lochness.GuestStateStopped, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		test.guest.State = test.state
+
+		snapshot, err := test.guest.NewSnapshot(test.description)
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+			s.Nil(snapshot, msg("failure shouldn't return a snapshot"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			s.Equal(test.guest.HypervisorID, snapshot.HypervisorID, msg("should be on the guest's hypervisor"))
+		}
+	}
+
+	snapshots, err := guest.Snapshots()
+	s.NoError(err)
+	s.Len(snapshots, 2)
+	s.Error(guest.CanMigrate(), "guest with snapshots should not migrate")
+}
+
+func (s *SnapshotSuite) TestCompleteDestroy() {
+	hypervisor, guest := s.newRunningGuest()
+	s.Require().NoError(hypervisor.Refresh())
+	available := hypervisor.AvailableResources.Disk
+
+	snapshot, err := guest.NewSnapshot("")
+	s.Require().NoError(err)
+	s.Error(snapshot.SetDeleting(), "pending snapshot should not be deleted")
+
+	s.Require().NoError(snapshot.Complete(100))
+	s.Equal(lochness.SnapshotStatusCreated, snapshot.Status)
+	s.Error(snapshot.Complete(100), "created snapshot should not complete again")
+	s.NoError(hypervisor.Refresh())
+	s.Equal(available-100, hypervisor.AvailableResources.Disk, "snapshot disk should be used")
+	s.Contains(hypervisor.Snapshots(), snapshot.ID)
+
+	probe := fakeProbe(lochness.HostResources{Physical: lochness.Resources{Memory: 8192, Disk: 4096, CPU: 4}})
+	s.Require().NoError(hypervisor.UpdateResourcesFrom(probe))
+	available = hypervisor.AvailableResources.Disk
+
+	s.NoError(snapshot.SetDeleting())
+	s.NoError(snapshot.Destroy())
+	s.NoError(hypervisor.Refresh())
+	s.Equal(available, hypervisor.AvailableResources.Disk, "snapshot disk should stay used until the next UpdateResourcesFrom")
+	s.NotContains(hypervisor.Snapshots(), snapshot.ID)
+	s.NoError(hypervisor.UpdateResourcesFrom(probe))
+	s.Equal(available+100, hypervisor.AvailableResources.Disk, "snapshot disk should be given back once")
+
+	snapshots, err := guest.Snapshots()
+	s.NoError(err)
+	s.Len(snapshots, 0)
+}
+
+func (s *SnapshotSuite) TestCanRollback() {
+	_, guest := s.newRunningGuest()
+	_, other := s.newRunningGuest()
+	pending, err := guest.NewSnapshot("pending")
+	s.Require().NoError(err)
+	snapshot, err := guest.NewSnapshot("created")
+	s.Require().NoError(err)
+	s.Require().NoError(snapshot.Complete(100))
+
+	s.Error(pending.CanRollback(guest), "pending snapshot should fail")
+	s.Error(snapshot.CanRollback(other), "other guest should fail")
+	s.NoError(snapshot.CanRollback(guest))
+
+	guest.FlavorID = s.NewFlavor().ID
+	s.Error(snapshot.CanRollback(guest), "changed flavor should fail")
+}
+
+func (s *SnapshotSuite) TestExpiredSnapshots() {
+	_, guest := s.newRunningGuest()
+
+	expired, err := guest.ExpiredSnapshots()
+	s.NoError(err)
+	s.Len(expired, 0, "no snapshots should be expired")
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		snapshot, err := guest.NewSnapshot("")
+		s.Require().NoError(err)
+		s.Require().NoError(snapshot.Complete(1))
+		ids = append(ids, snapshot.ID)
+		// keep the creation times apart
+		time.Sleep(time.Millisecond)
+	}
+	_, err = guest.NewSnapshot("pending")
+	s.Require().NoError(err)
+
+	expired, err = guest.ExpiredSnapshots()
+	s.NoError(err)
+	s.Len(expired, 0, "guest without a limit should keep all snapshots")
+
+	guest.SnapshotLimit = 2
+	expired, err = guest.ExpiredSnapshots()
+	s.NoError(err)
+	if s.Len(expired, 1) {
+		s.Equal(ids[0], expired[0].ID, "oldest snapshot should expire")
+	}
+}
+
+func (s *SnapshotSuite) TestRemoveGuest() {
+	hypervisor, guest := s.newRunningGuest()
+	snapshot, err := guest.NewSnapshot("")
+	s.Require().NoError(err)
+	s.Require().NoError(snapshot.Complete(100))
+
+	s.Require().NoError(hypervisor.RemoveGuest(guest))
+	_, err = s.Context.Snapshot(snapshot.ID)
+	s.Error(err, "snapshots should be removed with the guest")
+}
@@ -27,6 +27,7 @@ type (
 		ID            string            `json:"id"`
 		Metadata      map[string]string `json:"metadata"`
 		NetworkID     string            `json:"network"`
+		ProjectID     string            `json:"project"` // owning project. blank if not owned by one
 		Gateway       net.IP            `json:"gateway"`
 		CIDR          *net.IPNet        `json:"cidr"`
 		StartRange    net.IP            `json:"start"` // first usable IP in range
@@ -42,6 +43,7 @@ type (
 		ID         string            `json:"id"`
 		Metadata   map[string]string `json:"metadata"`
 		NetworkID  string            `json:"network"`
+		ProjectID  string            `json:"project"`
 		Gateway    net.IP            `json:"gateway"`
 		CIDR       string            `json:"cidr"`
 		StartRange net.IP            `json:"start"`
@@ -57,6 +59,7 @@ func (s *Subnet) MarshalJSON() ([]byte, error) {
 		ID:         s.ID,
 		Metadata:   s.Metadata,
 		NetworkID:  s.NetworkID,
+		ProjectID:  s.ProjectID,
 		Gateway:    s.Gateway,
 		CIDR:       s.CIDR.String(),
 		StartRange: s.StartRange,
@@ -77,6 +80,7 @@ func (s *Subnet) UnmarshalJSON(input []byte) error {
 	s.ID = data.ID
 	s.Metadata = data.Metadata
 	s.NetworkID = data.NetworkID
+	s.ProjectID = data.ProjectID
 	s.Gateway = data.Gateway
 	s.StartRange = data.StartRange
 	s.EndRange = data.EndRange
@@ -181,8 +185,21 @@ func (s *Subnet) Delete() error {
 		}
 	}
 
+	if err := s.context.updateProjectLink(projectSubnets, s.ID, s.ProjectID, ""); err != nil {
+		return err
+	}
+
+	before, err := s.context.auditSaved(s.key())
+	if err != nil {
+		return err
+	}
+
 	// Delete the subnet
-	return s.context.kv.Delete(filepath.Join(SubnetPath, s.ID), true)
+	if err := s.context.kv.Delete(filepath.Join(SubnetPath, s.ID), true); err != nil {
+		return err
+	}
+	s.context.recordChange("subnet", s.ID, before, nil)
+	return nil
 }
 
 // Validate ensures the values are reasonable.
@@ -212,6 +229,19 @@ func (s *Subnet) Validate() error {
 	if bytes.Compare(s.StartRange, s.EndRange) > 0 {
 		return errors.New("EndRange cannot be less than StartRange")
 	}
+
+	if err := validateProjectID(s.ProjectID); err != nil {
+		return err
+	}
+	if s.ProjectID != "" && s.NetworkID != "" {
+		network, err := s.context.Network(s.NetworkID)
+		if err != nil {
+			return err
+		}
+		if err := checkProjectReference(s.ProjectID, "network", network.ID, network.ProjectID); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -228,12 +258,22 @@ func (s *Subnet) Save() error {
 		return err
 	}
 
+	project, err := s.context.savedProject(s.key(), s.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := s.context.auditSaved(s.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := s.context.kv.Update(s.key(), kv.Value{Data: v, Index: s.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	s.modifiedIndex = index
-	return nil
+	s.context.recordChange("subnet", s.ID, before, v)
+	return s.context.updateProjectLink(projectSubnets, s.ID, project, s.ProjectID)
 }
 
 func (s *Subnet) addressKey(address string) string {
@@ -321,6 +361,35 @@ func (s *Subnet) ReserveAddress(id string) (net.IP, error) {
 	return chosen, nil
 }
 
+// AddressAvailable returns whether an ip address is within the usable range of
+// the Subnet and not already reserved.
+func (s *Subnet) AddressAvailable(ip net.IP) bool {
+	if ip.To4() == nil || !s.CIDR.Contains(ip) {
+		return false
+	}
+	i := ipToI32(ip)
+	if i < ipToI32(s.StartRange) || i > ipToI32(s.EndRange) {
+		return false
+	}
+	_, ok := s.addresses[i]
+	return !ok
+}
+
+// ReserveSpecificAddress reserves a particular ip address. The id is a guest id.
+// It fails if the address is outside the usable range or is already reserved.
+func (s *Subnet) ReserveSpecificAddress(id string, ip net.IP) error {
+	if !s.AddressAvailable(ip) {
+		return fmt.Errorf("address %s is not available in subnet %s", ip, s.ID)
+	}
+
+	// an Index of 0 only succeeds if nothing else has reserved the address
+	if _, err := s.context.kv.Update(s.addressKey(ip.String()), kv.Value{Data: []byte(id)}); err != nil {
+		return fmt.Errorf("address %s is not available in subnet %s", ip, s.ID)
+	}
+	s.addresses[ipToI32(ip)] = id
+	return nil
+}
+
 // ReleaseAddress releases an address.
 // This does not change any thing that may also be referring to this address.
 func (s *Subnet) ReleaseAddress(ip net.IP) error {
@@ -192,6 +192,45 @@ func (s *SubnetSuite) TestReserveAddress() {
 	}
 }
 
+func (s *SubnetSuite) TestAddressAvailable() {
+	subnet := s.NewSubnet()
+	s.Require().NoError(subnet.ReserveSpecificAddress("foo", net.ParseIP("192.168.100.5")))
+
+	tests := []struct {
+		description string
+		ip          net.IP
+		expected    bool
+	}{
+		{"nil", nil, false},
+		{"outside cidr", net.ParseIP("10.10.10.5"), false},
+		{"before range", net.ParseIP("192.168.100.1"), false},
+		{"after range", net.ParseIP("192.168.100.11"), false},
+		{"reserved", net.ParseIP("192.168.100.5"), false},
+		{"start of range", subnet.StartRange, true},
+		{"end of range", subnet.EndRange, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		s.Equal(test.expected, subnet.AddressAvailable(test.ip), msg("should be correct"))
+	}
+}
+
+func (s *SubnetSuite) TestReserveSpecificAddress() {
+	subnet := s.NewSubnet()
+	staleSubnet, _ := s.Context.Subnet(subnet.ID)
+	ip := net.ParseIP("192.168.100.5")
+	n := len(subnet.AvailableAddresses())
+
+	s.NoError(subnet.ReserveSpecificAddress("foo", ip), "should succeed when address available")
+	s.Len(subnet.AvailableAddresses(), n-1, "should update available addresses")
+	s.Equal("foo", subnet.Addresses()[ip.String()], "should reserve for the id")
+
+	s.Error(subnet.ReserveSpecificAddress("bar", ip), "should fail when address reserved")
+	s.Error(staleSubnet.ReserveSpecificAddress("bar", ip), "should fail when address reserved elsewhere")
+	s.Error(subnet.ReserveSpecificAddress("bar", net.ParseIP("192.168.100.20")), "should fail when address out of range")
+}
+
 func (s *SubnetSuite) TestReleaseAddress() {
 	subnet := s.NewSubnet()
 	ip, _ := subnet.ReserveAddress("foobar")
@@ -0,0 +1,220 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Taint effects
+const (
+	TaintNoSchedule       = "NoSchedule"       // only place guests tolerating the taint
+	TaintPreferNoSchedule = "PreferNoSchedule" // prefer hypervisors without the taint
+)
+
+type (
+	// Taint marks a Hypervisor, such as one dedicated to a team or to a class of
+	// flavors, so that only Guests with a matching Toleration are placed on it.
+	Taint struct {
+		Key    string `json:"key"`
+		Value  string `json:"value"`
+		Effect string `json:"effect"`
+	}
+
+	// Taints is an alias to a slice of Taint
+	Taints []Taint
+
+	// Toleration allows a Guest to be placed on Hypervisors with matching
+	// Taints. A blank Value matches any value and a blank Effect any effect.
+	Toleration struct {
+		Key    string `json:"key"`
+		Value  string `json:"value,omitempty"`
+		Effect string `json:"effect,omitempty"`
+	}
+
+	// Tolerations is an alias to a slice of Toleration
+	Tolerations []Toleration
+)
+
+// validTaintEffect checks an effect is one of the Taint effects
+func validTaintEffect(effect string) bool {
+	return effect == TaintNoSchedule || effect == TaintPreferNoSchedule
+}
+
+// Validate ensures a Taint has reasonable data.
+func (t Taint) Validate() error {
+	if t.Key == "" {
+		return errors.New("missing key")
+	}
+	if !validTaintEffect(t.Effect) {
+		return errors.New("invalid effect")
+	}
+	return nil
+}
+
+// String describes the Taint for logging
+func (t Taint) String() string {
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+// Validate ensures the Taints have reasonable data.
+func (ts Taints) Validate() error {
+	for i, t := range ts {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("taint %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate ensures a Toleration has reasonable data.
+func (t Toleration) Validate() error {
+	if t.Key == "" {
+		return errors.New("missing key")
+	}
+	if t.Effect != "" && !validTaintEffect(t.Effect) {
+		return errors.New("invalid effect")
+	}
+	return nil
+}
+
+// Tolerates checks whether the Toleration matches a Taint.
+func (t Toleration) Tolerates(taint Taint) bool {
+	return t.Key == taint.Key &&
+		(t.Value == "" || t.Value == taint.Value) &&
+		(t.Effect == "" || t.Effect == taint.Effect)
+}
+
+// Validate ensures the Tolerations have reasonable data.
+func (ts Tolerations) Validate() error {
+	for i, t := range ts {
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("toleration %d: %s", i, err)
+		}
+	}
+	return nil
+}
+
+// Tolerates checks whether any of the Tolerations matches a Taint.
+func (ts Tolerations) Tolerates(taint Taint) bool {
+	for _, t := range ts {
+		if t.Tolerates(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTaint adds a Taint to the Hypervisor, replacing any with the same key and
+// effect.
+func (h *Hypervisor) SetTaint(t Taint) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+
+	return h.casUpdate(func() error {
+		taints := Taints{}
+		for _, existing := range h.Taints {
+			if existing.Key != t.Key || existing.Effect != t.Effect {
+				taints = append(taints, existing)
+			}
+		}
+		h.Taints = append(taints, t)
+		return nil
+	})
+}
+
+// RemoveTaint removes the Taints with the key from the Hypervisor.
+func (h *Hypervisor) RemoveTaint(key string) error {
+	return h.casUpdate(func() error {
+		taints := Taints{}
+		for _, existing := range h.Taints {
+			if existing.Key != key {
+				taints = append(taints, existing)
+			}
+		}
+		h.Taints = taints
+		return nil
+	})
+}
+
+// tolerations returns the Tolerations of the Guest and of its Flavor
+func (g *Guest) tolerations() (Tolerations, error) {
+	f, err := g.context.Flavor(g.FlavorID)
+	if err != nil {
+		return nil, err
+	}
+
+	tolerations := make(Tolerations, 0, len(g.Tolerations)+len(f.Tolerations))
+	tolerations = append(tolerations, g.Tolerations...)
+	return append(tolerations, f.Tolerations...), nil
+}
+
+// CandidateTolerated returns Hypervisors whose NoSchedule Taints are all
+// tolerated by the Guest or its Flavor.
+func CandidateTolerated(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateTolerated",
+	}
+
+	tolerations, err := g.tolerations()
+	if err != nil {
+		return nil, err
+	}
+
+	var hypervisors Hypervisors
+	for _, h := range hs {
+		tolerated := true
+		for _, taint := range h.Taints {
+			if taint.Effect == TaintNoSchedule && !tolerations.Tolerates(taint) {
+				tolerated = false
+				log.WithFields(logFields).WithFields(log.Fields{
+					"hypervisorID": h.ID,
+					"taint":        taint.String(),
+				}).Debug("hypervisor candidate failed")
+				break
+			}
+		}
+		if tolerated {
+			hypervisors = append(hypervisors, h)
+		}
+	}
+
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
+
+// ScoreTolerated prefers Hypervisors with fewer PreferNoSchedule Taints that
+// the Guest and its Flavor do not tolerate.
+func ScoreTolerated(g *Guest, hs Hypervisors) ([]float64, error) {
+	tolerations, err := g.tolerations()
+	if err != nil {
+		return nil, err
+	}
+
+	untolerated := make([]int, len(hs))
+	most := 0
+	for i, h := range hs {
+		for _, taint := range h.Taints {
+			if taint.Effect == TaintPreferNoSchedule && !tolerations.Tolerates(taint) {
+				untolerated[i]++
+			}
+		}
+		if untolerated[i] > most {
+			most = untolerated[i]
+		}
+	}
+
+	scores := make([]float64, len(hs))
+	for i, n := range untolerated {
+		scores[i] = 1 - fraction(float64(n), float64(most))
+	}
+	return scores, nil
+}
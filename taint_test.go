@@ -0,0 +1,153 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTaint(t *testing.T) {
+	suite.Run(t, new(TaintSuite))
+}
+
+type TaintSuite struct {
+	common.Suite
+}
+
+func (s *TaintSuite) TestValidate() {
+	tests := []struct {
+		description string
+		validator   interface {
+			Validate() error
+		}
+		expectedErr bool
+	}{
+		{"taint missing key", lochness.Taint{Effect: lochness.TaintNoSchedule}, true},
+		{"taint missing effect", lochness.Taint{Key: "a"}, true},
+		{"taint invalid effect", lochness.Taint{Key: "a", Effect: "foo"}, true},
+		{"taint", lochness.Taint{Key: "a", Effect: lochness.TaintPreferNoSchedule}, false},
+		{"toleration missing key", lochness.Toleration{Value: "b"}, true},
+		{"toleration invalid effect", lochness.Toleration{Key: "a", Effect: "foo"}, true},
+		{"toleration any effect", lochness.Toleration{Key: "a"}, false},
+		{"toleration", lochness.Toleration{Key: "a", Value: "b", Effect: lochness.TaintNoSchedule}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.validator.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+
+	hypervisor := s.NewHypervisor()
+	hypervisor.Taints = lochness.Taints{{Key: "a"}}
+	s.Error(hypervisor.Save(), "hypervisor with invalid taint should be invalid")
+
+	guest := s.NewGuest()
+	guest.Tolerations = lochness.Tolerations{{Effect: lochness.TaintNoSchedule}}
+	s.Error(guest.Validate(), "guest with invalid toleration should be invalid")
+
+	flavor := s.NewFlavor()
+	flavor.Tolerations = lochness.Tolerations{{}}
+	s.Error(flavor.Validate(), "flavor with invalid toleration should be invalid")
+}
+
+func (s *TaintSuite) TestTolerates() {
+	taint := lochness.Taint{Key: "dedicated", Value: "db", Effect: lochness.TaintNoSchedule}
+
+	tests := []struct {
+		description string
+		toleration  lochness.Toleration
+		expected    bool
+	}{
+		{"other key", lochness.Toleration{Key: "nvme"}, false},
+		{"any value and effect", lochness.Toleration{Key: "dedicated"}, true},
+		{"same value", lochness.Toleration{Key: "dedicated", Value: "db"}, true},
+		{"other value", lochness.Toleration{Key: "dedicated", Value: "web"}, false},
+		{"same effect", lochness.Toleration{Key: "dedicated", Effect: lochness.TaintNoSchedule}, true},
+		{"other effect", lochness.Toleration{Key: "dedicated", Effect: lochness.TaintPreferNoSchedule}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		s.Equal(test.expected, test.toleration.Tolerates(taint), msg("unexpected result"))
+		s.Equal(test.expected, lochness.Tolerations{test.toleration}.Tolerates(taint), msg("unexpected result"))
+	}
+}
+
+func (s *TaintSuite) TestSetRemoveTaint() {
+	hypervisor := s.NewHypervisor()
+	dedicated := lochness.Taint{Key: "dedicated", Value: "db", Effect: lochness.TaintNoSchedule}
+	preferred := lochness.Taint{Key: "dedicated", Value: "db", Effect: lochness.TaintPreferNoSchedule}
+
+	s.Error(hypervisor.SetTaint(lochness.Taint{Key: "dedicated"}), "invalid taint should fail")
+	s.NoError(hypervisor.SetTaint(dedicated))
+	s.NoError(hypervisor.SetTaint(preferred))
+	s.Equal(lochness.Taints{dedicated, preferred}, hypervisor.Taints)
+
+	dedicated.Value = "web"
+	s.NoError(hypervisor.SetTaint(dedicated))
+	s.Equal(lochness.Taints{preferred, dedicated}, hypervisor.Taints, "same key and effect should be replaced")
+
+	h, err := s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Equal(hypervisor.Taints, h.Taints)
+
+	s.NoError(hypervisor.RemoveTaint("dedicated"))
+	s.Len(hypervisor.Taints, 0)
+
+	h, err = s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Len(h.Taints, 0)
+}
+
+func (s *TaintSuite) TestCandidateTolerated() {
+	dedicated := lochness.Taint{Key: "dedicated", Value: "db", Effect: lochness.TaintNoSchedule}
+	nvme := lochness.Taint{Key: "nvme", Effect: lochness.TaintPreferNoSchedule}
+
+	hypervisors := lochness.Hypervisors{s.NewHypervisor(), s.NewHypervisor(), s.NewHypervisor()}
+	s.Require().NoError(hypervisors[1].SetTaint(dedicated))
+	s.Require().NoError(hypervisors[2].SetTaint(nvme))
+
+	tests := []struct {
+		description string
+		guest       lochness.Tolerations
+		flavor      lochness.Tolerations
+		candidates  []int
+		scores      []float64
+	}{
+		{"no tolerations", nil, nil, []int{0, 2}, []float64{1, 1, 0}},
+		{"guest toleration", lochness.Tolerations{{Key: "dedicated"}}, nil, []int{0, 1, 2}, []float64{1, 1, 0}},
+		{"flavor toleration", nil, lochness.Tolerations{{Key: "dedicated", Value: "db"}}, []int{0, 1, 2}, []float64{1, 1, 0}},
+		{"wrong value", lochness.Tolerations{{Key: "dedicated", Value: "web"}}, nil, []int{0, 2}, []float64{1, 1, 0}},
+		{"preferred toleration", lochness.Tolerations{{Key: "nvme"}}, nil, []int{0, 2}, []float64{1, 1, 1}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		flavor := s.NewFlavor()
+		flavor.Tolerations = test.flavor
+		s.Require().NoError(flavor.Save(), msg("flavor should save"))
+		guest := s.NewGuest()
+		guest.FlavorID = flavor.ID
+		guest.Tolerations = test.guest
+
+		candidates, err := lochness.CandidateTolerated(guest, hypervisors)
+		s.NoError(err, msg("filter should succeed"))
+		s.Len(candidates, len(test.candidates), msg("unexpected candidates"))
+		for i, j := range test.candidates {
+			if i < len(candidates) {
+				s.Equal(hypervisors[j].ID, candidates[i].ID, msg("unexpected candidate"))
+			}
+		}
+
+		scores, err := lochness.ScoreTolerated(guest, hypervisors)
+		s.NoError(err, msg("scoring should succeed"))
+		s.Equal(test.scores, scores, msg("unexpected scores"))
+	}
+}
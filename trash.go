@@ -0,0 +1,87 @@
+package lochness
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DeleteRetentionConfig is the cluster config key holding how long deleted
+// Guests are kept before they are purged, as a duration such as "72h"
+const DeleteRetentionConfig = "deleteRetention"
+
+// DefaultDeleteRetention is used when the cluster config has no delete
+// retention
+const DefaultDeleteRetention = 24 * time.Hour
+
+// DeleteRetention returns how long deleted Guests are kept before they are
+// purged, read from the cluster config and falling back to
+// DefaultDeleteRetention.
+func (c *Context) DeleteRetention() (time.Duration, error) {
+	s, err := c.GetConfig(DeleteRetentionConfig)
+	if err != nil {
+		if c.kv.IsKeyNotFound(err) {
+			return DefaultDeleteRetention, nil
+		}
+		return 0, err
+	}
+	retention, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %s", DeleteRetentionConfig, err)
+	}
+	if retention < 0 {
+		return 0, fmt.Errorf("invalid %s: must not be negative", DeleteRetentionConfig)
+	}
+	return retention, nil
+}
+
+// Trash moves a Guest that has been stopped for deletion to the deleted state,
+// to be purged once the delete retention has passed. It keeps its Hypervisor,
+// addresses and Quota until then, so it can be undeleted.
+func (g *Guest) Trash() error {
+	retention, err := g.context.DeleteRetention()
+	if err != nil {
+		return err
+	}
+	if err := g.Refresh(); err != nil {
+		return err
+	}
+	if err := g.SetState(GuestStateDeleted, "stopped for deletion"); err != nil {
+		return err
+	}
+	purgeAt := time.Now().Add(retention)
+	g.PurgeAt = &purgeAt
+	return g.Save()
+}
+
+// Undelete restores a deleted Guest before it is purged. It is left stopped.
+func (g *Guest) Undelete() error {
+	if g.State != GuestStateDeleted {
+		return errors.New("guest is not deleted")
+	}
+	if err := g.SetState(GuestStateStopped, "undeleted"); err != nil {
+		return err
+	}
+	g.PurgeAt = nil
+	return g.Save()
+}
+
+// Expired returns whether a deleted Guest is due to be purged.
+func (g *Guest) Expired(now time.Time) bool {
+	return g.State == GuestStateDeleted && g.PurgeAt != nil && !g.PurgeAt.After(now)
+}
+
+// ExpiredGuests returns the deleted Guests due to be purged.
+func (c *Context) ExpiredGuests(now time.Time) (Guests, error) {
+	guests := Guests{}
+	err := c.ForEachGuest(func(g *Guest) error {
+		if g.Expired(now) {
+			guests = append(guests, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return guests, nil
+}
@@ -0,0 +1,112 @@
+package lochness_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestTrash(t *testing.T) {
+	suite.Run(t, new(TrashSuite))
+}
+
+type TrashSuite struct {
+	common.Suite
+}
+
+// newDeletingGuest creates and saves a Guest stopped for deletion
+func (s *TrashSuite) newDeletingGuest() *lochness.Guest {
+	guest := s.NewGuest()
+	guest.State = lochness.GuestStateDeleting
+	s.Require().NoError(guest.Save())
+	return guest
+}
+
+func (s *TrashSuite) TestDeleteRetention() {
+	tests := []struct {
+		description string
+		value       string
+		expected    time.Duration
+		expectedErr bool
+	}{
+		{"default", "", lochness.DefaultDeleteRetention, false},
+		{"configured", "72h", 72 * time.Hour, false},
+		{"no retention", "0s", 0, false},
+		{"invalid", "asdf", 0, true},
+		{"negative", "-1h", 0, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		if test.value != "" {
+			s.Require().NoError(s.Context.SetConfig(lochness.DeleteRetentionConfig, test.value))
+		}
+		retention, err := s.Context.DeleteRetention()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			s.Equal(test.expected, retention, msg("should return the retention"))
+		}
+	}
+}
+
+func (s *TrashSuite) TestTrash() {
+	s.Require().NoError(s.Context.SetConfig(lochness.DeleteRetentionConfig, "1h"))
+
+	s.Error(s.NewGuest().Trash(), "guests not being deleted can not be trashed")
+
+	guest := s.newDeletingGuest()
+	before := time.Now()
+	s.NoError(guest.Trash())
+	s.Equal(lochness.GuestStateDeleted, guest.State)
+	if s.NotNil(guest.PurgeAt) {
+		s.WithinDuration(before.Add(time.Hour), *guest.PurgeAt, time.Minute)
+	}
+
+	s.NoError(guest.Refresh())
+	s.Equal(lochness.GuestStateDeleted, guest.State, "should be saved")
+	s.NotNil(guest.PurgeAt)
+}
+
+func (s *TrashSuite) TestUndelete() {
+	s.Error(s.NewGuest().Undelete(), "guests not deleted can not be undeleted")
+
+	guest := s.newDeletingGuest()
+	s.Require().NoError(guest.Trash())
+	s.NoError(guest.Undelete())
+	s.Equal(lochness.GuestStateStopped, guest.State)
+	s.Nil(guest.PurgeAt)
+
+	s.NoError(guest.Refresh())
+	s.Equal(lochness.GuestStateStopped, guest.State, "should be saved")
+	s.Nil(guest.PurgeAt, "purge time should be cleared")
+}
+
+func (s *TrashSuite) TestExpiredGuests() {
+	s.Require().NoError(s.Context.SetConfig(lochness.DeleteRetentionConfig, "1h"))
+
+	kept := s.newDeletingGuest()
+	s.Require().NoError(kept.Trash())
+	s.Require().NoError(s.Context.SetConfig(lochness.DeleteRetentionConfig, "0s"))
+	expired := s.newDeletingGuest()
+	s.Require().NoError(expired.Trash())
+	s.NewGuest()
+
+	now := time.Now()
+	s.True(expired.Expired(now))
+	s.False(kept.Expired(now))
+
+	guests, err := s.Context.ExpiredGuests(now)
+	s.NoError(err)
+	if s.Len(guests, 1) {
+		s.Equal(expired.ID, guests[0].ID)
+	}
+
+	guests, err = s.Context.ExpiredGuests(now.Add(2 * time.Hour))
+	s.NoError(err)
+	s.Len(guests, 2)
+}
@@ -130,11 +130,17 @@ func (v *VLAN) Save() error {
 		return err
 	}
 
+	before, err := v.context.auditSaved(v.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := v.context.kv.Update(v.key(), kv.Value{Data: value, Index: v.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	v.modifiedIndex = index
+	v.context.recordChange("vlan", strconv.Itoa(v.Tag), before, value)
 	return nil
 }
 
@@ -151,8 +157,17 @@ func (v *VLAN) Destroy() error {
 		}
 	}
 
+	before, err := v.context.auditSaved(v.key())
+	if err != nil {
+		return err
+	}
+
 	// Delete the VLAN
-	return v.context.kv.Delete(filepath.Dir(v.key()), true)
+	if err := v.context.kv.Delete(filepath.Dir(v.key()), true); err != nil {
+		return err
+	}
+	v.context.recordChange("vlan", strconv.Itoa(v.Tag), before, nil)
+	return nil
 }
 
 // ForEachVLAN will run f on each VLAN. It will stop iteration if f returns an error.
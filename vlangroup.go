@@ -24,6 +24,7 @@ type (
 		ID            string            `json:"id"`
 		Description   string            `json:"description"`
 		Metadata      map[string]string `json:"metadata"`
+		ProjectID     string            `json:"project"` // owning project. blank if not owned by one
 		vlans         []int
 	}
 
@@ -124,7 +125,7 @@ func (vg *VLANGroup) Validate() error {
 	if _, err := canonicalizeUUID(vg.ID); err != nil {
 		return errors.New("invalid ID")
 	}
-	return nil
+	return validateProjectID(vg.ProjectID)
 }
 
 // Save persists a VLANgroup. It will call Validate.
@@ -138,12 +139,22 @@ func (vg *VLANGroup) Save() error {
 		return err
 	}
 
+	project, err := vg.context.savedProject(vg.key(), vg.modifiedIndex)
+	if err != nil {
+		return err
+	}
+	before, err := vg.context.auditSaved(vg.key())
+	if err != nil {
+		return err
+	}
+
 	index, err := vg.context.kv.Update(vg.key(), kv.Value{Data: value, Index: vg.modifiedIndex})
 	if err != nil {
 		return err
 	}
 	vg.modifiedIndex = index
-	return nil
+	vg.context.recordChange("vlangroup", vg.ID, before, value)
+	return vg.context.updateProjectLink(projectVLANGroups, vg.ID, project, vg.ProjectID)
 }
 
 // Destroy removes a VLANGroup
@@ -164,8 +175,21 @@ func (vg *VLANGroup) Destroy() error {
 		}
 	}
 
+	if err := vg.context.updateProjectLink(projectVLANGroups, vg.ID, vg.ProjectID, ""); err != nil {
+		return err
+	}
+
+	before, err := vg.context.auditSaved(vg.key())
+	if err != nil {
+		return err
+	}
+
 	// Delete the VLANGroup
-	return vg.context.kv.Delete(filepath.Dir(vg.key()), true)
+	if err := vg.context.kv.Delete(filepath.Dir(vg.key()), true); err != nil {
+		return err
+	}
+	vg.context.recordChange("vlangroup", vg.ID, before, nil)
+	return nil
 }
 
 // AddVLAN adds a VLAN to the VLANGroup
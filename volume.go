@@ -0,0 +1,385 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// VolumePath is the path in the config store
+	VolumePath = "lochness/volumes/"
+)
+
+type (
+	// Volume is an additional data disk that can be attached to a guest
+	Volume struct {
+		context       *Context
+		modifiedIndex uint64
+		ID            string            `json:"id"`
+		Metadata      map[string]string `json:"metadata"`
+		Size          uint64            `json:"size"`       // size in MB
+		HypervisorID  string            `json:"hypervisor"` // hypervisor pool holding the volume. may be blank if not assigned yet
+		GuestID       string            `json:"guest"`      // attached guest. blank if detached
+		Device        int               `json:"device"`     // order among the attached guest's disks, after the flavor disk
+	}
+
+	// Volumes is an alias to a slice of *Volume
+	Volumes []*Volume
+)
+
+// NewVolume creates a blank Volume
+func (c *Context) NewVolume() *Volume {
+	v := &Volume{
+		context:  c,
+		ID:       uuid.New(),
+		Metadata: make(map[string]string),
+	}
+
+	return v
+}
+
+// Volume fetches a single Volume from the config store
+func (c *Context) Volume(id string) (*Volume, error) {
+	var err error
+	id, err = canonicalizeUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	v := &Volume{
+		context: c,
+		ID:      id,
+	}
+
+	err = v.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// key is a helper to generate the config store key
+func (v *Volume) key() string {
+	return filepath.Join(VolumePath, v.ID, "metadata")
+}
+
+// hypervisorKey is a helper to generate the config store key linking the
+// Volume to its Hypervisor pool
+func (v *Volume) hypervisorKey() string {
+	return filepath.Join(HypervisorPath, v.HypervisorID, "volumes", v.ID)
+}
+
+// guestKey is a helper to generate the config store key linking the Volume to
+// its attached Guest
+func (v *Volume) guestKey() string {
+	return filepath.Join(GuestPath, v.GuestID, "volumes", v.ID)
+}
+
+// fromResponse is a helper to unmarshal a Volume
+func (v *Volume) fromResponse(value kv.Value) error {
+	v.modifiedIndex = value.Index
+	return json.Unmarshal(value.Data, &v)
+}
+
+// Refresh reloads from the data store
+func (v *Volume) Refresh() error {
+	resp, err := v.context.kv.Get(v.key())
+
+	if err != nil {
+		return err
+	}
+
+	return v.fromResponse(resp)
+}
+
+// Validate ensures a Volume has reasonable data.
+func (v *Volume) Validate() error {
+	if _, err := canonicalizeUUID(v.ID); err != nil {
+		return errors.New("missing or invalid id")
+	}
+	if v.Size == 0 {
+		return errors.New("missing size")
+	}
+	if v.HypervisorID != "" {
+		if _, err := canonicalizeUUID(v.HypervisorID); err != nil {
+			return errors.New("invalid hypervisor")
+		}
+	}
+	if v.GuestID != "" {
+		if _, err := canonicalizeUUID(v.GuestID); err != nil {
+			return errors.New("invalid guest")
+		}
+	}
+	return nil
+}
+
+// Save persists a Volume.
+// It will call Validate.
+func (v *Volume) Save() error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	before, err := v.context.auditSaved(v.key())
+	if err != nil {
+		return err
+	}
+
+	index, err := v.context.kv.Update(v.key(), kv.Value{Data: value, Index: v.modifiedIndex})
+	if err != nil {
+		return err
+	}
+	v.modifiedIndex = index
+	v.context.recordChange("volume", v.ID, before, value)
+
+	if v.HypervisorID != "" {
+		return v.context.kv.Set(v.hypervisorKey(), "")
+	}
+	return nil
+}
+
+// Destroy removes a Volume. It must not be attached to a Guest.
+func (v *Volume) Destroy() error {
+	if v.modifiedIndex == 0 {
+		// it has not been saved?
+		return errors.New("not persisted")
+	}
+	if v.GuestID != "" {
+		return errors.New("volume is attached")
+	}
+
+	before, err := v.context.auditSaved(v.key())
+	if err != nil {
+		return err
+	}
+	if err := v.context.kv.Remove(v.key(), v.modifiedIndex); err != nil {
+		return err
+	}
+	v.context.recordChange("volume", v.ID, before, nil)
+	if v.HypervisorID != "" {
+		// the disk is given back while the pool still links the volume
+		h, err := v.context.Hypervisor(v.HypervisorID)
+		if err != nil && !v.context.kv.IsKeyNotFound(err) {
+			return err
+		}
+		if h != nil {
+			if err := h.unpoolVolume(v); err != nil {
+				return err
+			}
+		}
+		if err := v.context.kv.Delete(v.hypervisorKey(), false); err != nil && !v.context.kv.IsKeyNotFound(err) {
+			return err
+		}
+	}
+	return v.context.kv.Delete(filepath.Join(VolumePath, v.ID), true)
+}
+
+// Attach attaches the Volume to a Guest as the Guest's last disk. A Volume
+// without a Hypervisor pool is assigned to the Guest's Hypervisor, if it has
+// one, which must have the disk available; otherwise the Volume must already be
+// in the Guest's Hypervisor pool. The Guest's Project is charged for the disk,
+// failing with ErrorQuotaExceeded if that is beyond its Quota.
+func (v *Volume) Attach(g *Guest) (err error) {
+	if v.GuestID != "" {
+		return errors.New("volume is already attached")
+	}
+
+	// give back everything taken so far if the volume can not be attached
+	var h *Hypervisor
+	index := v.modifiedIndex
+	var pooled bool // disk moved from the reservation to the pool
+	defer func() {
+		if err == nil {
+			return
+		}
+		_ = g.ChargeQuota()
+		key := v.hypervisorKey()
+		v.GuestID = ""
+		v.Device = 0
+		if h != nil {
+			v.HypervisorID = ""
+		}
+		if v.modifiedIndex != index && v.Save() != nil {
+			return
+		}
+		if h == nil {
+			return
+		}
+		if pooled {
+			_ = h.unpoolVolume(v)
+		} else {
+			_ = h.releaseVolumeDisk(g, v.Size)
+		}
+		_ = v.context.kv.Delete(key, false)
+	}()
+
+	// the disk counts toward the guest's project quota
+	if err = g.chargeVolumeQuota(v.Size); err != nil {
+		return err
+	}
+
+	// a volume joining the pool takes its disk through the guest's reservation
+	// until the pool counts it
+	if g.HypervisorID != "" {
+		switch v.HypervisorID {
+		case "":
+			hypervisor, err := v.context.Hypervisor(g.HypervisorID)
+			if err != nil {
+				return err
+			}
+			if err := hypervisor.reserveVolumeDisk(g, v.Size); err != nil {
+				return err
+			}
+			h = hypervisor
+			v.HypervisorID = h.ID
+		case g.HypervisorID:
+		default:
+			return errors.New("volume is not in the guest's hypervisor pool")
+		}
+	}
+
+	if v.Device, err = g.nextDevice(); err != nil {
+		return err
+	}
+	v.GuestID = g.ID
+
+	if err = v.Save(); err != nil {
+		return err
+	}
+	if h != nil {
+		if err = h.poolVolumeDisk(g, v.Size, true); err != nil {
+			return err
+		}
+		pooled = true
+	}
+	return v.context.kv.Set(v.guestKey(), "")
+}
+
+// Detach detaches the Volume from its Guest, which is no longer charged for it.
+func (v *Volume) Detach() error {
+	if v.GuestID == "" {
+		return errors.New("volume is not attached")
+	}
+
+	if err := v.context.kv.Delete(v.guestKey(), false); err != nil && !v.context.kv.IsKeyNotFound(err) {
+		return err
+	}
+
+	guestID := v.GuestID
+	v.GuestID = ""
+	v.Device = 0
+	if err := v.Save(); err != nil {
+		return err
+	}
+
+	// the disk no longer counts toward the guest's project quota
+	g, err := v.context.Guest(guestID)
+	if err != nil {
+		if v.context.kv.IsKeyNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return g.ChargeQuota()
+}
+
+// Volumes returns the Volumes attached to the Guest, in device order.
+func (g *Guest) Volumes() (Volumes, error) {
+	keys, err := g.context.kv.Keys(filepath.Join(GuestPath, g.ID, "volumes"))
+	if err != nil {
+		if g.context.kv.IsKeyNotFound(err) {
+			return Volumes{}, nil
+		}
+		return nil, err
+	}
+
+	volumes := make(Volumes, 0, len(keys))
+	for _, k := range keys {
+		v, err := g.context.Volume(filepath.Base(k))
+		if err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, v)
+	}
+	sort.Sort(volumesByDevice(volumes))
+	return volumes, nil
+}
+
+// nextDevice allocates the next device order for a Volume attached to the
+// Guest. The last one handed out is kept under its own key, so concurrent
+// attaches can not be given the same one.
+func (g *Guest) nextDevice() (int, error) {
+	key := filepath.Join(GuestPath, g.ID, "device")
+	var err error
+	for i := 0; i < maxUpdateAttempts; i++ {
+		var last int
+		var index uint64
+		var value kv.Value
+		value, err = g.context.kv.Get(key)
+		switch {
+		case err == nil:
+			index = value.Index
+			if last, err = strconv.Atoi(string(value.Data)); err != nil {
+				return 0, err
+			}
+		case g.context.kv.IsKeyNotFound(err):
+			// volumes may have been attached before the key was kept
+			var volumes Volumes
+			if volumes, err = g.Volumes(); err != nil {
+				return 0, err
+			}
+			if len(volumes) > 0 {
+				last = volumes[len(volumes)-1].Device
+			}
+		default:
+			return 0, err
+		}
+
+		device := last + 1
+		_, err = g.context.kv.Update(key, kv.Value{Data: []byte(strconv.Itoa(device)), Index: index})
+		if err == nil {
+			return device, nil
+		}
+		if !g.context.kv.IsCASFailed(err) {
+			return 0, err
+		}
+	}
+	return 0, err
+}
+
+// volumesByDevice sorts Volumes by device order
+type volumesByDevice Volumes
+
+func (v volumesByDevice) Len() int           { return len(v) }
+func (v volumesByDevice) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v volumesByDevice) Less(i, j int) bool { return v[i].Device < v[j].Device }
+
+// ForEachVolume will run f on each Volume. It will stop iteration if f returns an error.
+func (c *Context) ForEachVolume(f func(*Volume) error) error {
+	keys, err := c.kv.Keys(VolumePath)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		v, err := c.Volume(filepath.Base(k))
+		if err != nil {
+			return err
+		}
+
+		if err := f(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
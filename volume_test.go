@@ -0,0 +1,257 @@
+package lochness_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestVolume(t *testing.T) {
+	suite.Run(t, new(VolumeSuite))
+}
+
+type VolumeSuite struct {
+	common.Suite
+}
+
+func (s *VolumeSuite) TestNewVolume() {
+	v := s.Context.NewVolume()
+	s.NotEmpty(uuid.Parse(v.ID))
+}
+
+func (s *VolumeSuite) TestVolume() {
+	volume := s.NewVolume()
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", uuid.New(), true},
+		{"real id", volume.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		v, err := s.Context.Volume(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(v, msg("failure shouldn't return a volume"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.True(assert.ObjectsAreEqual(volume, v), msg("success should return correct data"))
+		}
+	}
+}
+
+func (s *VolumeSuite) TestValidate() {
+	tests := []struct {
+		description string
+		volume      *lochness.Volume
+		expectedErr bool
+	}{
+		{"missing id", &lochness.Volume{}, true},
+		{"invalid id", &lochness.Volume{ID: "asdf"}, true},
+		{"missing size", &lochness.Volume{ID: uuid.New()}, true},
+		{"invalid hypervisor", &lochness.Volume{ID: uuid.New(), Size: 1, HypervisorID: "asdf"}, true},
+		{"invalid guest", &lochness.Volume{ID: uuid.New(), Size: 1, GuestID: "asdf"}, true},
+		{"valid", &lochness.Volume{ID: uuid.New(), Size: 1}, false},
+		{"valid with hypervisor and guest", &lochness.Volume{ID: uuid.New(), Size: 1, HypervisorID: uuid.New(), GuestID: uuid.New()}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.volume.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *VolumeSuite) TestSave() {
+	goodVolume := s.Context.NewVolume()
+	goodVolume.Size = 1024
+
+	clobberVolume := *goodVolume
+	clobberVolume.Size = 2048
+
+	tests := []struct {
+		description string
+		volume      *lochness.Volume
+		expectedErr bool
+	}{
+		{"invalid volume", s.Context.NewVolume(), true},
+		{"valid volume", goodVolume, false},
+		{"existing volume", goodVolume, false},
+		{"existing volume clobber changes", &clobberVolume, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.volume.Save()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *VolumeSuite) TestAttachDetach() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	otherHypervisor := s.NewHypervisor()
+
+	first := s.NewVolume()
+	second := s.NewVolume()
+	foreign := s.NewVolume()
+	foreign.HypervisorID = otherHypervisor.ID
+	s.Require().NoError(foreign.Save())
+
+	s.NoError(first.Attach(guest))
+	s.Equal(1, first.Device)
+	s.Equal(hypervisor.ID, first.HypervisorID, "unpooled volume should join the guest's hypervisor")
+	s.Error(first.Attach(guest), "attached volume should not attach again")
+
+	s.NoError(second.Attach(guest))
+	s.Equal(2, second.Device)
+
+	s.Error(foreign.Attach(guest), "volume from another pool should not attach")
+
+	volumes, err := guest.Volumes()
+	s.NoError(err)
+	s.Len(volumes, 2)
+	s.Equal(first.ID, volumes[0].ID)
+	s.Equal(second.ID, volumes[1].ID)
+
+	s.NoError(first.Detach())
+	s.Empty(first.GuestID)
+	s.Error(first.Detach(), "detached volume should not detach again")
+
+	volumes, err = guest.Volumes()
+	s.NoError(err)
+	s.Len(volumes, 1)
+	s.Equal(second.ID, volumes[0].ID)
+
+	// New attachments go after the last disk
+	s.NoError(first.Attach(guest))
+	s.Equal(3, first.Device)
+
+	s.NoError(hypervisor.Refresh())
+	s.Len(hypervisor.Volumes(), 2)
+}
+
+func (s *VolumeSuite) TestAttachPoolDisk() {
+	hypervisor, guest := s.NewHypervisorWithGuest()
+	probe := fakeProbe(lochness.HostResources{Physical: lochness.Resources{Memory: 8192, Disk: 1024 * 1024, CPU: 4}})
+	s.Require().NoError(hypervisor.UpdateResourcesFrom(probe))
+	available := hypervisor.AvailableResources.Disk
+
+	volume := s.NewVolume()
+	s.Require().NoError(volume.Attach(guest))
+	s.Require().NoError(hypervisor.Refresh())
+	s.Equal(available-volume.Size, hypervisor.AvailableResources.Disk, "joining the pool should take the disk")
+
+	// the reservation should not count the pooled disk again
+	s.Require().NoError(hypervisor.UpdateResourcesFrom(probe))
+	s.Equal(available-volume.Size, hypervisor.AvailableResources.Disk, "resync should count the disk once")
+
+	big := s.Context.NewVolume()
+	big.Size = hypervisor.AvailableResources.Disk + 1
+	s.Require().NoError(big.Save())
+	s.Error(big.Attach(guest), "volume larger than the available disk should not attach")
+	s.Require().NoError(big.Refresh())
+	s.Empty(big.HypervisorID, "failed attach should not join the pool")
+	s.Empty(big.GuestID)
+	s.Require().NoError(hypervisor.Refresh())
+	s.Equal(available-volume.Size, hypervisor.AvailableResources.Disk, "failed attach should not take the disk")
+
+	s.Require().NoError(volume.Detach())
+	s.Require().NoError(hypervisor.Refresh())
+	s.Equal(available-volume.Size, hypervisor.AvailableResources.Disk, "detached volume should stay in the pool")
+
+	s.Require().NoError(volume.Destroy())
+	s.Require().NoError(hypervisor.Refresh())
+	s.Equal(available, hypervisor.AvailableResources.Disk, "destroyed volume should give the disk back")
+	s.Empty(hypervisor.Volumes())
+}
+
+func (s *VolumeSuite) TestAttachConcurrent() {
+	guest := s.NewGuest()
+
+	volumes := make(lochness.Volumes, 10)
+	for i := range volumes {
+		volumes[i] = s.NewVolume()
+	}
+
+	var wg sync.WaitGroup
+	for _, v := range volumes {
+		wg.Add(1)
+		go func(v *lochness.Volume) {
+			defer wg.Done()
+			s.NoError(v.Attach(guest))
+		}(v)
+	}
+	wg.Wait()
+
+	devices := make(map[int]bool)
+	for _, v := range volumes {
+		s.False(devices[v.Device], "device should not be shared")
+		devices[v.Device] = true
+	}
+}
+
+func (s *VolumeSuite) TestDestroy() {
+	guest := s.NewGuest()
+	attached := s.NewVolume()
+	s.Require().NoError(attached.Attach(guest))
+
+	tests := []struct {
+		description string
+		volume      *lochness.Volume
+		expectedErr bool
+	}{
+		{"invalid volume", &lochness.Volume{}, true},
+		{"nonexistant volume", s.Context.NewVolume(), true},
+		{"attached volume", attached, true},
+		{"existing volume", s.NewVolume(), false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.volume.Destroy()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			_, err := s.Context.Volume(test.volume.ID)
+			s.Error(err, msg("should no longer exist"))
+		}
+	}
+}
+
+func (s *VolumeSuite) TestForEachVolume() {
+	volume := s.NewVolume()
+	volume2 := s.NewVolume()
+	expectedFound := map[string]bool{
+		volume.ID:  true,
+		volume2.ID: true,
+	}
+
+	resultFound := make(map[string]bool)
+
+	err := s.Context.ForEachVolume(func(v *lochness.Volume) error {
+		resultFound[v.ID] = true
+		return nil
+	})
+	s.NoError(err)
+	s.True(assert.ObjectsAreEqual(expectedFound, resultFound))
+}
@@ -0,0 +1,442 @@
+package lochness
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/mistifyio/lochness/pkg/kv"
+	"github.com/pborman/uuid"
+)
+
+var (
+	// ZonePath is the path in the config store.
+	ZonePath = "lochness/zones/"
+)
+
+// Zone spread policies for the server group of a Guest. Hypervisors without a
+// Zone count as a single zone.
+const (
+	ZoneSpreadNone = ""
+	ZoneSpreadSoft = "soft" // prefer the zones running the fewest of the group
+	ZoneSpreadHard = "hard" // only use the zones running the fewest of the group
+)
+
+type (
+	// Zone is a failure domain, such as a rack or a datacenter room, that
+	// Hypervisors belong to. A Hypervisor belongs to at most one Zone.
+	Zone struct {
+		context       *Context
+		modifiedIndex uint64
+		ID            string            `json:"id"`
+		Name          string            `json:"name"`
+		Metadata      map[string]string `json:"metadata"`
+		hypervisors   []string
+	}
+
+	// Zones is an alias to a slice of *Zone
+	Zones []*Zone
+
+	// ZoneCapacity is the sum of the resources of the Hypervisors in a Zone
+	ZoneCapacity struct {
+		ZoneID             string    `json:"zone"`
+		Hypervisors        int       `json:"hypervisors"`
+		TotalResources     Resources `json:"total_resources"`
+		AvailableResources Resources `json:"available_resources"`
+	}
+)
+
+// blankZone is a helper for creating a blank Zone.
+func (c *Context) blankZone(id string) *Zone {
+	z := &Zone{
+		context:     c,
+		ID:          id,
+		Metadata:    make(map[string]string),
+		hypervisors: make([]string, 0, 0),
+	}
+
+	if id == "" {
+		z.ID = uuid.New()
+	}
+
+	return z
+}
+
+// NewZone creates a new, blank Zone.
+func (c *Context) NewZone() *Zone {
+	return c.blankZone("")
+}
+
+// Zone fetches a Zone from the data store.
+func (c *Context) Zone(id string) (*Zone, error) {
+	var err error
+	id, err = canonicalizeUUID(id)
+	if err != nil {
+		return nil, err
+	}
+	z := c.blankZone(id)
+	err = z.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	return z, nil
+}
+
+// key is a helper to generate the config store key.
+func (z *Zone) key() string {
+	return filepath.Join(ZonePath, z.ID, "metadata")
+}
+
+// hypervisorKey is a helper to generate the config store key linking a
+// Hypervisor to the Zone.
+func (z *Zone) hypervisorKey(h *Hypervisor) string {
+	var key string
+	if h != nil {
+		key = h.ID
+	}
+	return filepath.Join(ZonePath, z.ID, "hypervisors", key)
+}
+
+// Refresh reloads the Zone from the data store.
+func (z *Zone) Refresh() error {
+	prefix := filepath.Join(ZonePath, z.ID)
+
+	nodes, err := z.context.kv.GetAll(prefix)
+	if err != nil {
+		return err
+	}
+
+	// handle metadata
+	key := filepath.Join(prefix, "metadata")
+	value, ok := nodes[key]
+	if !ok {
+		return errors.New("metadata key is missing")
+	}
+
+	if err := json.Unmarshal(value.Data, &z); err != nil {
+		return err
+	}
+	z.modifiedIndex = value.Index
+	delete(nodes, key)
+
+	hypervisors := []string{}
+	for k := range nodes {
+		elements := strings.Split(k, "/")
+		base := elements[len(elements)-1]
+		dir := elements[len(elements)-2]
+		if dir != "hypervisors" {
+			continue
+		}
+
+		hypervisors = append(hypervisors, base)
+	}
+
+	z.hypervisors = hypervisors
+
+	return nil
+}
+
+// Validate ensures a Zone has reasonable data.
+func (z *Zone) Validate() error {
+	if _, err := canonicalizeUUID(z.ID); err != nil {
+		return errors.New("invalid ID")
+	}
+	if z.Name == "" {
+		return errors.New("missing name")
+	}
+	return nil
+}
+
+// Save persists a Zone.
+// It will call Validate.
+func (z *Zone) Save() error {
+	if err := z.Validate(); err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(z)
+	if err != nil {
+		return err
+	}
+
+	before, err := z.context.auditSaved(z.key())
+	if err != nil {
+		return err
+	}
+
+	index, err := z.context.kv.Update(z.key(), kv.Value{Data: v, Index: z.modifiedIndex})
+	if err != nil {
+		return err
+	}
+	z.modifiedIndex = index
+	z.context.recordChange("zone", z.ID, before, v)
+	return nil
+}
+
+// Destroy removes a Zone. It must not have any Hypervisors.
+func (z *Zone) Destroy() error {
+	if len(z.hypervisors) != 0 {
+		return errors.New("not empty")
+	}
+
+	if z.modifiedIndex == 0 {
+		// it has not been saved?
+		return errors.New("not persisted")
+	}
+
+	before, err := z.context.auditSaved(z.key())
+	if err != nil {
+		return err
+	}
+	if err := z.context.kv.Remove(z.key(), z.modifiedIndex); err != nil {
+		return err
+	}
+	z.context.recordChange("zone", z.ID, before, nil)
+
+	return z.context.kv.Delete(filepath.Join(ZonePath, z.ID), true)
+}
+
+// AddHypervisor adds a Hypervisor to the Zone. The Hypervisor must not belong
+// to another Zone.
+func (z *Zone) AddHypervisor(h *Hypervisor) error {
+	// Make sure the Zone exists
+	if z.modifiedIndex == 0 {
+		if err := z.Refresh(); err != nil {
+			return err
+		}
+	}
+
+	if err := h.Refresh(); err != nil {
+		return err
+	}
+	if h.ZoneID != "" && h.ZoneID != z.ID {
+		return errors.New("hypervisor belongs to another zone")
+	}
+
+	if err := z.context.kv.Set(z.hypervisorKey(h), ""); err != nil {
+		return err
+	}
+	if h.ZoneID != z.ID {
+		z.hypervisors = append(z.hypervisors, h.ID)
+	}
+
+	// an instance where transactions would be cool...
+	h.ZoneID = z.ID
+	return h.Save()
+}
+
+// RemoveHypervisor removes a Hypervisor from the Zone.
+func (z *Zone) RemoveHypervisor(h *Hypervisor) error {
+	if h.ZoneID != z.ID {
+		return errors.New("hypervisor does not belong to zone")
+	}
+
+	if err := z.context.kv.Delete(z.hypervisorKey(h), false); err != nil {
+		return err
+	}
+
+	newHypervisors := make([]string, 0, len(z.hypervisors))
+	for _, id := range z.hypervisors {
+		if id != h.ID {
+			newHypervisors = append(newHypervisors, id)
+		}
+	}
+	z.hypervisors = newHypervisors
+
+	h.ZoneID = ""
+	return h.Save()
+}
+
+// Hypervisors returns the IDs of the Hypervisors in the Zone.
+func (z *Zone) Hypervisors() []string {
+	return z.hypervisors
+}
+
+// Capacity returns the total and available resources of the Hypervisors in the
+// Zone.
+func (z *Zone) Capacity() (*ZoneCapacity, error) {
+	capacity := &ZoneCapacity{
+		ZoneID:      z.ID,
+		Hypervisors: len(z.hypervisors),
+	}
+
+	for _, id := range z.hypervisors {
+		h, err := z.context.Hypervisor(id)
+		if err != nil {
+			return nil, err
+		}
+		capacity.TotalResources.add(h.TotalResources)
+		capacity.AvailableResources.add(h.AvailableResources)
+	}
+	return capacity, nil
+}
+
+// ForEachZone will run f on each Zone. It will stop iteration if f returns an
+// error.
+func (c *Context) ForEachZone(f func(*Zone) error) error {
+	keys, err := c.kv.Keys(ZonePath)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		z, err := c.Zone(filepath.Base(k))
+		if err != nil {
+			return err
+		}
+
+		if err := f(z); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CandidateInZone returns Hypervisors in the Zone requested by the Guest. If no
+// Zone is requested, all Hypervisors are returned.
+func CandidateInZone(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	if g.ZoneID == "" {
+		return hs, nil
+	}
+
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateInZone",
+	}
+
+	var hypervisors Hypervisors
+	for _, h := range hs {
+		if h.ZoneID == g.ZoneID {
+			hypervisors = append(hypervisors, h)
+		} else {
+			log.WithFields(logFields).WithFields(log.Fields{
+				"hypervisorID": h.ID,
+			}).Debug("hypervisor candidate failed")
+		}
+	}
+
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
+
+// serverGroupZoneCounts returns, for each Hypervisor, the number of other
+// Guests in the Guest's server group running in the Hypervisor's Zone
+func (g *Guest) serverGroupZoneCounts(hs Hypervisors) ([]int, error) {
+	zones := make(map[string]string, len(hs))
+	for _, h := range hs {
+		zones[h.ID] = h.ZoneID
+	}
+
+	counts := make(map[string]int)
+	err := g.context.ForEachGuest(func(guest *Guest) error {
+		if guest.ID == g.ID || guest.HypervisorID == "" || guest.ServerGroup != g.ServerGroup {
+			return nil
+		}
+		zoneID, ok := zones[guest.HypervisorID]
+		if !ok {
+			h, err := g.context.Hypervisor(guest.HypervisorID)
+			if err != nil {
+				if g.context.kv.IsKeyNotFound(err) {
+					return nil
+				}
+				return err
+			}
+			zoneID = h.ZoneID
+			zones[h.ID] = zoneID
+		}
+		counts[zoneID]++
+		return nil
+	})
+	if err != nil && !g.context.kv.IsKeyNotFound(err) {
+		return nil, err
+	}
+
+	result := make([]int, len(hs))
+	for i, h := range hs {
+		result[i] = counts[h.ZoneID]
+	}
+	return result, nil
+}
+
+// minMax returns the smallest and largest of the counts
+func minMax(counts []int) (int, int) {
+	if len(counts) == 0 {
+		return 0, 0
+	}
+	min, max := counts[0], counts[0]
+	for _, c := range counts[1:] {
+		if c < min {
+			min = c
+		}
+		if c > max {
+			max = c
+		}
+	}
+	return min, max
+}
+
+// CandidateZoneSpread returns, for a Guest with a hard zone spread policy, the
+// Hypervisors in the zones running the fewest Guests of its server group.
+func CandidateZoneSpread(g *Guest, hs Hypervisors) (Hypervisors, error) {
+	if g.ZoneSpread != ZoneSpreadHard {
+		return hs, nil
+	}
+
+	logFields := log.Fields{
+		"guestID": g.ID,
+		"func":    "CandidateZoneSpread",
+	}
+
+	counts, err := g.serverGroupZoneCounts(hs)
+	if err != nil {
+		return nil, err
+	}
+	min, _ := minMax(counts)
+
+	var hypervisors Hypervisors
+	for i, h := range hs {
+		if counts[i] == min {
+			hypervisors = append(hypervisors, h)
+		} else {
+			log.WithFields(logFields).WithFields(log.Fields{
+				"hypervisorID": h.ID,
+				"zoneID":       h.ZoneID,
+			}).Debug("hypervisor candidate failed")
+		}
+	}
+
+	log.WithFields(logFields).WithFields(log.Fields{
+		"in":      len(hs),
+		"out":     len(hypervisors),
+		"removed": len(hs) - len(hypervisors),
+	}).Info("hypervisor candidates filtered")
+
+	return hypervisors, nil
+}
+
+// ScoreZoneSpread prefers, for a Guest with a zone spread policy, Hypervisors
+// in zones running fewer Guests of its server group.
+func ScoreZoneSpread(g *Guest, hs Hypervisors) ([]float64, error) {
+	scores := make([]float64, len(hs))
+	if g.ZoneSpread == ZoneSpreadNone {
+		return scores, nil
+	}
+
+	counts, err := g.serverGroupZoneCounts(hs)
+	if err != nil {
+		return nil, err
+	}
+	min, max := minMax(counts)
+
+	for i, c := range counts {
+		scores[i] = 1 - fraction(float64(c-min), float64(max-min))
+	}
+	return scores, nil
+}
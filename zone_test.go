@@ -0,0 +1,296 @@
+package lochness_test
+
+import (
+	"testing"
+
+	"github.com/mistifyio/lochness"
+	"github.com/mistifyio/lochness/internal/tests/common"
+	"github.com/pborman/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestZone(t *testing.T) {
+	suite.Run(t, new(ZoneSuite))
+}
+
+type ZoneSuite struct {
+	common.Suite
+}
+
+func (s *ZoneSuite) TestNewZone() {
+	z := s.Context.NewZone()
+	s.NotNil(uuid.Parse(z.ID))
+}
+
+func (s *ZoneSuite) TestZone() {
+	zone := s.NewZone()
+
+	tests := []struct {
+		description string
+		id          string
+		expectedErr bool
+	}{
+		{"missing id", "", true},
+		{"invalid id", "asdf", true},
+		{"nonexistant id", uuid.New(), true},
+		{"real id", zone.ID, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		z, err := s.Context.Zone(test.id)
+		if test.expectedErr {
+			s.Error(err, msg("lookup should fail"))
+			s.Nil(z, msg("failure shouldn't return a zone"))
+		} else {
+			s.NoError(err, msg("lookup should succeed"))
+			s.True(assert.ObjectsAreEqual(zone, z), msg("success should return correct data"))
+		}
+	}
+}
+
+func (s *ZoneSuite) TestValidate() {
+	tests := []struct {
+		description string
+		zone        *lochness.Zone
+		expectedErr bool
+	}{
+		{"missing id", &lochness.Zone{Name: "a"}, true},
+		{"invalid id", &lochness.Zone{ID: "asdf", Name: "a"}, true},
+		{"missing name", &lochness.Zone{ID: uuid.New()}, true},
+		{"valid", &lochness.Zone{ID: uuid.New(), Name: "a"}, false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.zone.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *ZoneSuite) TestSave() {
+	goodZone := s.Context.NewZone()
+	goodZone.Name = "rack-a"
+
+	clobberZone := *goodZone
+	clobberZone.Name = "rack-b"
+
+	tests := []struct {
+		description string
+		zone        *lochness.Zone
+		expectedErr bool
+	}{
+		{"invalid zone", s.Context.NewZone(), true},
+		{"valid zone", goodZone, false},
+		{"existing zone", goodZone, false},
+		{"existing zone clobber changes", &clobberZone, true},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.zone.Save()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}
+
+func (s *ZoneSuite) TestAddRemoveHypervisor() {
+	zone := s.NewZone()
+	other := s.NewZone()
+	hypervisor := s.NewHypervisor()
+
+	s.NoError(zone.AddHypervisor(hypervisor))
+	s.Equal(zone.ID, hypervisor.ZoneID)
+	s.Equal([]string{hypervisor.ID}, zone.Hypervisors())
+	s.NoError(zone.AddHypervisor(hypervisor), "adding again should succeed")
+	s.Len(zone.Hypervisors(), 1, "adding again should not duplicate")
+	s.Error(other.AddHypervisor(hypervisor), "hypervisor should belong to one zone")
+
+	z, err := s.Context.Zone(zone.ID)
+	s.NoError(err)
+	s.Equal([]string{hypervisor.ID}, z.Hypervisors())
+	h, err := s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Equal(zone.ID, h.ZoneID)
+
+	s.Error(other.RemoveHypervisor(hypervisor))
+	s.NoError(zone.RemoveHypervisor(hypervisor))
+	s.Empty(hypervisor.ZoneID)
+	s.Len(zone.Hypervisors(), 0)
+
+	h, err = s.Context.Hypervisor(hypervisor.ID)
+	s.NoError(err)
+	s.Empty(h.ZoneID, "removal should be saved")
+}
+
+func (s *ZoneSuite) TestDestroy() {
+	full := s.NewZone()
+	s.Require().NoError(full.AddHypervisor(s.NewHypervisor()))
+
+	tests := []struct {
+		description string
+		zone        *lochness.Zone
+		expectedErr bool
+	}{
+		{"nonexistant zone", s.Context.NewZone(), true},
+		{"zone with hypervisors", full, true},
+		{"existing zone", s.NewZone(), false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		err := test.zone.Destroy()
+		if test.expectedErr {
+			s.Error(err, msg("should fail"))
+		} else {
+			s.NoError(err, msg("should succeed"))
+			_, err := s.Context.Zone(test.zone.ID)
+			s.Error(err, msg("should no longer exist"))
+		}
+	}
+
+	// destroying a hypervisor removes it from its zone
+	h, err := s.Context.Hypervisor(full.Hypervisors()[0])
+	s.Require().NoError(err)
+	s.NoError(h.Destroy())
+	s.NoError(full.Refresh())
+	s.Len(full.Hypervisors(), 0)
+}
+
+func (s *ZoneSuite) TestCapacity() {
+	zone := s.NewZone()
+	hypervisors := lochness.Hypervisors{s.NewHypervisor(), s.NewHypervisor()}
+	for _, h := range hypervisors {
+		s.Require().NoError(zone.AddHypervisor(h))
+	}
+	hypervisors[1].AvailableResources.Memory = 1024
+	s.Require().NoError(hypervisors[1].Save())
+
+	capacity, err := zone.Capacity()
+	s.NoError(err)
+	s.Equal(zone.ID, capacity.ZoneID)
+	s.Equal(2, capacity.Hypervisors)
+	total := hypervisors[0].TotalResources
+	s.Equal(2*total.Memory, capacity.TotalResources.Memory)
+	s.Equal(2*total.CPU, capacity.TotalResources.CPU)
+	s.Equal(total.Memory+1024, capacity.AvailableResources.Memory)
+}
+
+func (s *ZoneSuite) TestForEachZone() {
+	zone := s.NewZone()
+	zone2 := s.NewZone()
+	expectedFound := map[string]bool{
+		zone.ID:  true,
+		zone2.ID: true,
+	}
+
+	resultFound := make(map[string]bool)
+
+	err := s.Context.ForEachZone(func(z *lochness.Zone) error {
+		resultFound[z.ID] = true
+		return nil
+	})
+	s.NoError(err)
+	s.True(assert.ObjectsAreEqual(expectedFound, resultFound))
+}
+
+func (s *ZoneSuite) TestCandidateInZone() {
+	zone := s.NewZone()
+	hypervisors := lochness.Hypervisors{s.NewHypervisor(), s.NewHypervisor()}
+	s.Require().NoError(zone.AddHypervisor(hypervisors[1]))
+
+	guest := s.NewGuest()
+	candidates, err := lochness.CandidateInZone(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 2, "no requested zone should not filter")
+
+	guest.ZoneID = zone.ID
+	candidates, err = lochness.CandidateInZone(guest, hypervisors)
+	s.NoError(err)
+	s.Len(candidates, 1)
+	s.Equal(hypervisors[1].ID, candidates[0].ID)
+}
+
+func (s *ZoneSuite) TestZoneSpread() {
+	zones := lochness.Zones{s.NewZone(), s.NewZone()}
+
+	// a replica runs in the first zone
+	hypervisor, replica := s.NewHypervisorWithGuest()
+	replica.ServerGroup = "web"
+	s.Require().NoError(replica.Save())
+	s.Require().NoError(zones[0].AddHypervisor(hypervisor))
+
+	empty := s.NewHypervisor()
+	s.Require().NoError(zones[1].AddHypervisor(empty))
+	hypervisors := lochness.Hypervisors{hypervisor, empty}
+
+	guest := s.NewGuest()
+	guest.ServerGroup = "web"
+
+	tests := []struct {
+		description string
+		spread      string
+		candidates  []int
+		scores      []float64
+	}{
+		{"no spread", lochness.ZoneSpreadNone, []int{0, 1}, []float64{0, 0}},
+		{"soft spread", lochness.ZoneSpreadSoft, []int{0, 1}, []float64{0, 1}},
+		{"hard spread", lochness.ZoneSpreadHard, []int{1}, []float64{0, 1}},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest.ZoneSpread = test.spread
+
+		candidates, err := lochness.CandidateZoneSpread(guest, hypervisors)
+		s.NoError(err, msg("filter should succeed"))
+		s.Len(candidates, len(test.candidates), msg("unexpected candidates"))
+		for i, j := range test.candidates {
+			if i < len(candidates) {
+				s.Equal(hypervisors[j].ID, candidates[i].ID, msg("unexpected candidate"))
+			}
+		}
+
+		scores, err := lochness.ScoreZoneSpread(guest, hypervisors)
+		s.NoError(err, msg("scoring should succeed"))
+		s.Equal(test.scores, scores, msg("unexpected scores"))
+	}
+}
+
+func (s *ZoneSuite) TestGuestValidate() {
+	tests := []struct {
+		description string
+		zoneID      string
+		spread      string
+		group       string
+		expectedErr bool
+	}{
+		{"invalid zone", "asdf", "", "", true},
+		{"valid zone", uuid.New(), "", "", false},
+		{"invalid spread", "", "foo", "web", true},
+		{"spread without group", "", lochness.ZoneSpreadHard, "", true},
+		{"spread with group", "", lochness.ZoneSpreadSoft, "web", false},
+	}
+
+	for _, test := range tests {
+		msg := s.Messager(test.description)
+		guest := s.NewGuest()
+		guest.ZoneID = test.zoneID
+		guest.ZoneSpread = test.spread
+		guest.ServerGroup = test.group
+		err := guest.Validate()
+		if test.expectedErr {
+			s.Error(err, msg("should be invalid"))
+		} else {
+			s.NoError(err, msg("should be valid"))
+		}
+	}
+}